@@ -1,7 +1,12 @@
 package main
 
 import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,32 +25,78 @@ type AppState struct {
 
 	// Audio state
 	PTTActive  bool
+	Muted      bool // Transmission suppressed even while PTT is held
+	AudioPanic bool // Panic button pressed: both audio streams closed
 	AudioLevel int
 	PacketsRx  int
 	PacketsTx  int
 
+	OutputDropped int // Received frames lost because the playback queue was full
+
 	// Connection state
+	Phase          ConnPhase // Where connecting stands; see connstate.go
 	Connected      bool
+	Reconnecting   bool
 	Nickname       string
 	ServerName     string
 	MOTD           string
 	ConnectionTime time.Time
+	Latency        time.Duration // Last measured ping round trip
+	PacketLoss     float32       // Received audio loss rate (0.0 - 1.0)
+	Theme          common.Theme  // Server branding for the web UI; zero when there is none
+
+	// The current connection's running totals; see session.go
+	session sessionStats
 
 	// Channel state
 	CurrentChannel string
 	Channels       []string
-	ChannelUsers   map[string][]string
+	ChannelUsers   map[string][]common.UserInfo
+	ChannelTopics  map[string]string // channel -> topic, only channels that have one
+
+	// Other channels whose audio we hear without joining them, as confirmed by
+	// the server. Kept across reconnects so they can be asked for again.
+	MonitoredChannels []string
 
 	// UI state
-	PTTKey   string
-	Messages []AppMessage
+	PTTKey         string
+	Messages       []AppMessage
+	ChatDeliveries map[string]ChatDelivery // Outgoing chat awaiting ack, by msg_id
+	TypingUsers    map[string]time.Time    // Users composing in our channel -> last hint
 
 	// Observer pattern for UI updates
 	observers []StateObserver
 
+	// Notifications from the audio goroutines, delivered in order by one
+	// dispatcher goroutine instead of a goroutine per update
+	notifications        chan StateChange
+	batchNotifications   atomic.Bool  // Deliver only the latest of each type from a backlog
+	droppedNotifications atomic.Int64 // Lost to a full queue
+
+	// Playback panning
+	StereoOutput bool
+	UserPans     map[string]float64 // nickname -> -1 (left) .. 1 (right)
+
+	// Whose audio is played on the current server
+	Listen ListenFilter
+
+	// Result of the last audio device check
+	AudioDevices AudioDeviceReport
+
+	// Session recording in progress, and the received-audio file it writes
+	Recording     bool
+	RecordingPath string
+
+	// Low data mode, and the measured traffic in bytes per minute
+	LowData       bool
+	DataPerMinute int64
+
 	RawInputLevel       float32 // Before any processing
 	ProcessedInputLevel float32 // After processing
+	OutputLevel         float32 // Peak of received audio being played
 	BypassProcessing    bool    // Bypass toggle state
+
+	Spectrum []float32 // Mic band levels (0..1), low to high frequency
 }
 
 // AppMessage represents a message in the application
@@ -53,22 +104,44 @@ type AppMessage struct {
 	Timestamp string
 	Message   string
 	Type      string // "info", "error", "success", "ptt"
+
+	Segments []common.ChatSegment // Render data for chat messages, nil if formatting is off
 }
 
+// ChatDelivery tracks the delivery state of an outgoing chat message
+type ChatDelivery struct {
+	MsgID   string `json:"msgId"`
+	Message string `json:"message"`
+	Status  string `json:"status"` // "pending" (queued offline), "sending", "sent", "failed"
+}
+
+// A typing hint is shown this long unless refreshed
+const typingTimeout = 5 * time.Second
+
 // Global state instance
 var appState *AppState
 
 // InitAppState initializes the global application state
 func InitAppState() {
 	appState = &AppState{
-		ChannelUsers: make(map[string][]string),
-		Messages:     make([]AppMessage, 0),
-		PTTKey:       "LSHIFT",
-		observers:    make([]StateObserver, 0),
+		ChannelUsers:   make(map[string][]common.UserInfo),
+		Messages:       make([]AppMessage, 0),
+		ChatDeliveries: make(map[string]ChatDelivery),
+		TypingUsers:    make(map[string]time.Time),
+		UserPans:       make(map[string]float64),
+		PTTKey:         "LSHIFT",
+		Phase:          PhaseDisconnected,
+		observers:      make([]StateObserver, 0),
+		notifications:  make(chan StateChange, notificationQueueSize),
 	}
+	appState.batchNotifications.Store(true)
+	go appState.dispatchNotifications()
 }
 
-// AddObserver adds a function that will be called when state changes
+// AddObserver adds a function that will be called when state changes.
+// Observers run on the goroutine that changed the state, which may be the
+// audio loop, so they must only record the change: anything slow, such as
+// network writes or tray calls, goes to a coalescingWorker.
 func (as *AppState) AddObserver(observer StateObserver) {
 	as.mutex.Lock()
 	defer as.mutex.Unlock()
@@ -93,6 +166,95 @@ func (as *AppState) notifyObservers(changeType string, data interface{}) {
 	}
 }
 
+// coalescingWorker runs a job on its own goroutine whenever triggered.
+// Triggers that arrive while the job runs collapse into one more run, so the
+// job should work from current state rather than from what triggered it.
+type coalescingWorker struct {
+	wake chan struct{}
+}
+
+// newCoalescingWorker starts the goroutine that runs job
+func newCoalescingWorker(job func()) *coalescingWorker {
+	w := &coalescingWorker{wake: make(chan struct{}, 1)}
+	go func() {
+		for range w.wake {
+			job()
+		}
+	}()
+	return w
+}
+
+// trigger asks for a run without waiting for it
+func (w *coalescingWorker) trigger() {
+	select {
+	case w.wake <- struct{}{}:
+	default: // A run is already pending
+	}
+}
+
+// Notifications the dispatcher can fall behind by before new ones are dropped
+const notificationQueueSize = 256
+
+// notifyAsync queues a notification for the dispatcher without waiting for
+// the observers, for callers on the audio path. If the queue is full the
+// notification is dropped: these are level and stats updates, and a newer one
+// is never far behind.
+func (as *AppState) notifyAsync(changeType string, data interface{}) {
+	select {
+	case as.notifications <- StateChange{Type: changeType, Data: data}:
+	default:
+		if n := as.droppedNotifications.Add(1); n == 1 || n%1000 == 0 {
+			logger.Debug("Observer queue full, dropped %d notifications so far (latest: %s)", n, changeType)
+		}
+	}
+}
+
+// dispatchNotifications delivers queued notifications in order. Whatever has
+// piled up while observers were busy is taken as one batch.
+func (as *AppState) dispatchNotifications() {
+	var batch []StateChange
+	latest := make(map[string]int)
+	for change := range as.notifications {
+		batch = append(batch[:0], change)
+	drain:
+		for {
+			select {
+			case next := <-as.notifications:
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+		if as.batchNotifications.Load() {
+			batch = coalesceChanges(batch, latest)
+		}
+		for _, c := range batch {
+			as.notifyObservers(c.Type, c.Data)
+		}
+	}
+}
+
+// coalesceChanges keeps the latest change of each type, in the place of that
+// type's first change, reusing batch and latest
+func coalesceChanges(batch []StateChange, latest map[string]int) []StateChange {
+	clear(latest)
+	out := batch[:0]
+	for _, change := range batch {
+		if i, seen := latest[change.Type]; seen {
+			out[i] = change
+			continue
+		}
+		latest[change.Type] = len(out)
+		out = append(out, change)
+	}
+	return out
+}
+
+// SetNotificationBatching turns coalescing of queued notifications on or off
+func (as *AppState) SetNotificationBatching(enabled bool) {
+	as.batchNotifications.Store(enabled)
+}
+
 // === AUDIO STATE METHODS ===
 
 // SetRawInputLevel updates raw input level
@@ -119,6 +281,17 @@ func (as *AppState) SetBypassProcessing(bypass bool) {
 	as.notifyObservers("bypass_processing", bypass)
 }
 
+// SetSpectrum updates the mic spectrum. bands is copied, so the caller may reuse it.
+func (as *AppState) SetSpectrum(bands []float32) {
+	spectrum := append([]float32(nil), bands...)
+
+	as.mutex.Lock()
+	as.Spectrum = spectrum
+	as.mutex.Unlock()
+
+	as.notifyAsync("spectrum", spectrum)
+}
+
 // GetProcessedInputLevel returns current processed level
 func (as *AppState) GetProcessedInputLevel() float32 {
 	as.mutex.RLock()
@@ -145,6 +318,33 @@ func (as *AppState) GetPTTActive() bool {
 	return as.PTTActive
 }
 
+// SetMuted updates microphone mute state and notifies observers
+func (as *AppState) SetMuted(muted bool) {
+	as.mutex.Lock()
+	if as.Muted == muted {
+		as.mutex.Unlock()
+		return
+	}
+	as.Muted = muted
+	as.mutex.Unlock()
+	as.notifyObservers("muted", muted)
+}
+
+// SetAudioPanic updates whether the panic button has stopped all audio
+func (as *AppState) SetAudioPanic(stopped bool) {
+	as.mutex.Lock()
+	as.AudioPanic = stopped
+	as.mutex.Unlock()
+	as.notifyObservers("audio_panic", stopped)
+}
+
+// IsMuted returns current mute state
+func (as *AppState) IsMuted() bool {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.Muted
+}
+
 // SetAudioLevel updates audio level and notifies observers
 func (as *AppState) SetAudioLevel(level int) {
 	as.mutex.Lock()
@@ -179,17 +379,55 @@ func (as *AppState) IncrementTX() {
 	}
 }
 
+// IncrementOutputDropped counts a received frame lost to a full playback
+// queue and returns the new total
+func (as *AppState) IncrementOutputDropped() int {
+	as.mutex.Lock()
+	as.OutputDropped++
+	dropped := as.OutputDropped
+	as.mutex.Unlock()
+
+	// First drop right away so it shows up, then batched like the packet counters
+	if dropped == 1 || dropped%10 == 0 {
+		as.notifyObservers("output_dropped", dropped)
+	}
+	return dropped
+}
+
+// GetOutputDropped returns how many received frames the playback queue dropped
+func (as *AppState) GetOutputDropped() int {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.OutputDropped
+}
+
+// GetPacketCounts returns received and transmitted audio packet counters
+func (as *AppState) GetPacketCounts() (rx, tx int) {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.PacketsRx, as.PacketsTx
+}
+
 // === CONNECTION STATE METHODS ===
 
 // SetConnected updates connection state
 func (as *AppState) SetConnected(connected bool, nickname, serverName, motd string) {
 	as.mutex.Lock()
 	as.Connected = connected
+	if connected {
+		as.Reconnecting = false
+	}
 	as.Nickname = nickname
 	as.ServerName = serverName
 	as.MOTD = motd
 	if connected {
 		as.ConnectionTime = time.Now()
+		if as.session.started.IsZero() { // A reconnect carries on the session
+			as.startSession(serverName)
+		}
+	} else {
+		as.Latency = 0
+		as.PacketLoss = 0
 	}
 	as.mutex.Unlock()
 
@@ -202,12 +440,85 @@ func (as *AppState) SetConnected(connected bool, nickname, serverName, motd stri
 	as.notifyObservers("connection", connectionData)
 }
 
+// IsConnected returns current connection state
+func (as *AppState) IsConnected() bool {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.Connected
+}
+
+// SetConnectionPhase moves the connection state machine, refusing transitions
+// it doesn't allow. Reconnecting follows the phase.
+func (as *AppState) SetConnectionPhase(phase ConnPhase) error {
+	as.mutex.Lock()
+	from := as.Phase
+	if from == phase {
+		as.mutex.Unlock()
+		return nil
+	}
+	if !canTransition(from, phase) {
+		as.mutex.Unlock()
+		return errBadTransition(from, phase)
+	}
+	as.Phase = phase
+	reconnectingChanged := as.Reconnecting != (phase == PhaseReconnecting)
+	as.Reconnecting = phase == PhaseReconnecting
+	as.mutex.Unlock()
+
+	as.notifyObservers("connection_phase", phase)
+	if reconnectingChanged {
+		as.notifyObservers("reconnecting", phase == PhaseReconnecting)
+	}
+	return nil
+}
+
+// GetConnectionPhase returns the connection state machine's phase
+func (as *AppState) GetConnectionPhase() ConnPhase {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.Phase
+}
+
+// SetTheme updates the server's branding for the web UI
+func (as *AppState) SetTheme(theme common.Theme) {
+	as.mutex.Lock()
+	as.Theme = theme
+	as.mutex.Unlock()
+	as.notifyObservers("theme", theme)
+}
+
+// SetLatency updates the measured ping round trip time
+func (as *AppState) SetLatency(latency time.Duration) {
+	as.mutex.Lock()
+	as.Latency = latency
+	as.recordLatency(latency)
+	as.mutex.Unlock()
+	as.notifyObservers("latency", latency)
+}
+
+// SetPacketLoss updates the received audio packet loss rate
+func (as *AppState) SetPacketLoss(loss float32) {
+	as.mutex.Lock()
+	as.PacketLoss = loss
+	as.session.packetLoss = loss
+	as.mutex.Unlock()
+	as.notifyObservers("packet_loss", loss)
+}
+
+// GetNetworkQuality returns the latest latency and packet loss (thread-safe)
+func (as *AppState) GetNetworkQuality() (time.Duration, float32) {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.Latency, as.PacketLoss
+}
+
 // === CHANNEL STATE METHODS ===
 
 // SetChannel updates current channel
 func (as *AppState) SetChannel(channel string) {
 	as.mutex.Lock()
 	as.CurrentChannel = channel
+	as.recordChannel(channel)
 	as.mutex.Unlock()
 	as.notifyObservers("channel", channel)
 }
@@ -220,25 +531,81 @@ func (as *AppState) SetChannels(channels []string) {
 	as.notifyObservers("channels", channels)
 }
 
+// SetMonitoredChannels updates the channels we monitor besides our own
+func (as *AppState) SetMonitoredChannels(channels []string) {
+	as.mutex.Lock()
+	as.MonitoredChannels = channels
+	as.mutex.Unlock()
+	as.notifyObservers("monitored_channels", channels)
+}
+
+// GetMonitoredChannels returns a copy of the channels we monitor
+func (as *AppState) GetMonitoredChannels() []string {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return slices.Clone(as.MonitoredChannels)
+}
+
 // SetChannelUsers updates channel user lists
-func (as *AppState) SetChannelUsers(channelUsers map[string][]string) {
+func (as *AppState) SetChannelUsers(channelUsers map[string][]common.UserInfo) {
 	as.mutex.Lock()
 	as.ChannelUsers = channelUsers
 	as.mutex.Unlock()
 	as.notifyObservers("channel_users", channelUsers)
 }
 
+// SetChannelTopics replaces all channel topics (on connect)
+func (as *AppState) SetChannelTopics(topics map[string]string) {
+	copied := make(map[string]string, len(topics))
+	for channel, topic := range topics {
+		copied[channel] = topic
+	}
+
+	as.mutex.Lock()
+	as.ChannelTopics = copied
+	as.mutex.Unlock()
+	as.notifyObservers("channel_topics", copied)
+}
+
+// SetChannelTopic updates one channel's topic; empty clears it
+func (as *AppState) SetChannelTopic(channel, topic string) {
+	as.mutex.Lock()
+	topics := make(map[string]string, len(as.ChannelTopics)+1)
+	for ch, t := range as.ChannelTopics {
+		topics[ch] = t
+	}
+	if topic == "" {
+		delete(topics, channel)
+	} else {
+		topics[channel] = topic
+	}
+	as.ChannelTopics = topics
+	as.mutex.Unlock()
+	as.notifyObservers("channel_topics", topics)
+}
+
 // === MESSAGE METHODS ===
 
 // AddMessage adds a message and notifies observers
 func (as *AppState) AddMessage(message, msgType string) {
-	timestamp := time.Now().Format("15:04:05")
-	msg := AppMessage{
-		Timestamp: timestamp,
+	as.addMessage(AppMessage{
+		Timestamp: time.Now().Format("15:04:05"),
 		Message:   message,
 		Type:      msgType,
-	}
+	})
+}
 
+// AddChatMessage adds a chat line along with its formatted segments
+func (as *AppState) AddChatMessage(message string, segments []common.ChatSegment) {
+	as.addMessage(AppMessage{
+		Timestamp: time.Now().Format("15:04:05"),
+		Message:   message,
+		Type:      "chat",
+		Segments:  segments,
+	})
+}
+
+func (as *AppState) addMessage(msg AppMessage) {
 	as.mutex.Lock()
 	as.Messages = append(as.Messages, msg)
 
@@ -251,6 +618,98 @@ func (as *AppState) AddMessage(message, msgType string) {
 	as.notifyObservers("message", msg)
 }
 
+// SetChatDelivery updates delivery state of an outgoing chat message.
+// Sent messages are dropped from tracking; failed ones stay visible until
+// the next message is sent.
+func (as *AppState) SetChatDelivery(msgID, message, status string) {
+	delivery := ChatDelivery{MsgID: msgID, Message: message, Status: status}
+
+	as.mutex.Lock()
+	switch status {
+	case "sending":
+		for id, d := range as.ChatDeliveries {
+			if d.Status == "failed" {
+				delete(as.ChatDeliveries, id)
+			}
+		}
+		as.ChatDeliveries[msgID] = delivery
+	case "sent":
+		delete(as.ChatDeliveries, msgID)
+	default:
+		as.ChatDeliveries[msgID] = delivery
+	}
+	as.mutex.Unlock()
+
+	as.notifyObservers("chat_delivery", delivery)
+}
+
+// GetChatDeliveries returns a copy of tracked outgoing chat messages
+func (as *AppState) GetChatDeliveries() map[string]ChatDelivery {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	deliveries := make(map[string]ChatDelivery, len(as.ChatDeliveries))
+	for id, d := range as.ChatDeliveries {
+		deliveries[id] = d
+	}
+	return deliveries
+}
+
+// SetUserTyping marks a user as composing; the hint expires after typingTimeout
+func (as *AppState) SetUserTyping(username string) {
+	as.mutex.Lock()
+	as.TypingUsers[username] = time.Now()
+	as.mutex.Unlock()
+	as.notifyObservers("typing", as.GetTypingUsers())
+
+	time.AfterFunc(typingTimeout, func() {
+		as.mutex.Lock()
+		last, ok := as.TypingUsers[username]
+		expired := ok && time.Since(last) >= typingTimeout
+		if expired {
+			delete(as.TypingUsers, username)
+		}
+		as.mutex.Unlock()
+
+		if expired {
+			as.notifyObservers("typing", as.GetTypingUsers())
+		}
+	})
+}
+
+// ClearUserTyping removes a typing hint, e.g. when the user's message arrives
+func (as *AppState) ClearUserTyping(username string) {
+	as.mutex.Lock()
+	_, ok := as.TypingUsers[username]
+	delete(as.TypingUsers, username)
+	as.mutex.Unlock()
+
+	if ok {
+		as.notifyObservers("typing", as.GetTypingUsers())
+	}
+}
+
+// ClearTyping drops all typing hints (channel switch, disconnect)
+func (as *AppState) ClearTyping() {
+	as.mutex.Lock()
+	as.TypingUsers = make(map[string]time.Time)
+	as.mutex.Unlock()
+	as.notifyObservers("typing", []string{})
+}
+
+// GetTypingUsers returns sorted names of users currently composing
+func (as *AppState) GetTypingUsers() []string {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	users := make([]string, 0, len(as.TypingUsers))
+	for user := range as.TypingUsers {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
+}
+
 // SetPTTKey updates PTT key setting
 func (as *AppState) SetPTTKey(keyName string) {
 	as.mutex.Lock()
@@ -265,7 +724,7 @@ func (as *AppState) SetPTTKey(keyName string) {
 func (as *AppState) SetAudioStats(stats AudioStats) {
 	// Don't store stats in AppState to keep it clean
 	// Just forward to observers for UI updates
-	go as.notifyObservers("audio_stats", stats)
+	as.notifyAsync("audio_stats", stats)
 }
 
 // SetInputLevel updates real-time input level (0.0 to 1.0)
@@ -276,13 +735,155 @@ func (as *AppState) SetInputLevel(level float32) {
 	as.mutex.Unlock()
 
 	// Send high-frequency updates for smooth visualization
-	go as.notifyObservers("input_level", level)
+	as.notifyAsync("input_level", level)
+}
+
+// SetOutputLevel updates the received audio level (0.0 to 1.0)
+func (as *AppState) SetOutputLevel(level float32) {
+	as.mutex.Lock()
+	as.OutputLevel = level
+	as.mutex.Unlock()
+
+	as.notifyAsync("output_level", level)
 }
 
 // SetGateStatus updates noise gate open/closed status
 func (as *AppState) SetGateStatus(open bool) {
 	// Send instant updates for immediate visual feedback
-	go as.notifyObservers("gate_status", open)
+	as.notifyAsync("gate_status", open)
+}
+
+// SetRecording updates whether a session recording is running
+func (as *AppState) SetRecording(active bool, path string) {
+	as.mutex.Lock()
+	as.Recording = active
+	as.RecordingPath = path
+	as.mutex.Unlock()
+
+	as.notifyObservers("recording", map[string]interface{}{
+		"active": active,
+		"path":   path,
+	})
+}
+
+// SetLowData updates whether low data mode is on
+func (as *AppState) SetLowData(enabled bool) {
+	as.mutex.Lock()
+	as.LowData = enabled
+	as.mutex.Unlock()
+	as.notifyObservers("low_data", enabled)
+}
+
+// IsLowData returns whether low data mode is on
+func (as *AppState) IsLowData() bool {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.LowData
+}
+
+// SetDataUsage updates the measured traffic in bytes per minute
+func (as *AppState) SetDataUsage(bytesPerMinute int64) {
+	as.mutex.Lock()
+	changed := as.DataPerMinute != bytesPerMinute
+	as.DataPerMinute = bytesPerMinute
+	as.mutex.Unlock()
+	if changed {
+		as.notifyObservers("data_usage", bytesPerMinute)
+	}
+}
+
+// SetStereoOutput updates stereo playback state
+func (as *AppState) SetStereoOutput(stereo bool) {
+	as.mutex.Lock()
+	as.StereoOutput = stereo
+	as.mutex.Unlock()
+	as.notifyObservers("stereo_output", stereo)
+}
+
+// IsStereoOutput returns whether playback is stereo
+func (as *AppState) IsStereoOutput() bool {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.StereoOutput
+}
+
+// SetUserPans replaces all per-user pan settings
+func (as *AppState) SetUserPans(pans map[string]float64) {
+	as.mutex.Lock()
+	as.UserPans = make(map[string]float64, len(pans))
+	for nick, pan := range pans {
+		as.UserPans[nick] = pan
+	}
+	as.mutex.Unlock()
+	as.notifyObservers("user_pans", as.GetUserPans())
+}
+
+// SetUserPan updates one user's pan position
+func (as *AppState) SetUserPan(nickname string, pan float64) {
+	as.mutex.Lock()
+	if pan == 0 {
+		delete(as.UserPans, nickname) // Center is the default
+	} else {
+		as.UserPans[nickname] = pan
+	}
+	as.mutex.Unlock()
+	as.notifyObservers("user_pans", as.GetUserPans())
+}
+
+// GetUserPan returns a user's pan position (0 = center if unset)
+func (as *AppState) GetUserPan(nickname string) float64 {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.UserPans[nickname]
+}
+
+// GetUserPans returns a copy of all per-user pan settings
+func (as *AppState) GetUserPans() map[string]float64 {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	pans := make(map[string]float64, len(as.UserPans))
+	for nick, pan := range as.UserPans {
+		pans[nick] = pan
+	}
+	return pans
+}
+
+// SetListenFilter replaces the allow/block lists for received audio
+func (as *AppState) SetListenFilter(filter ListenFilter) {
+	as.mutex.Lock()
+	as.Listen = filter.clone()
+	as.mutex.Unlock()
+	as.notifyObservers("listen_filter", as.GetListenFilter())
+}
+
+// GetListenFilter returns a copy of the allow/block lists
+func (as *AppState) GetListenFilter() ListenFilter {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.Listen.clone()
+}
+
+// IsListeningTo reports whether a talker's audio should be played
+func (as *AppState) IsListeningTo(nickname string) bool {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.Listen.hears(nickname)
+}
+
+// SetAudioDeviceReport stores the latest audio device check
+func (as *AppState) SetAudioDeviceReport(report AudioDeviceReport) {
+	as.mutex.Lock()
+	as.AudioDevices = report
+	as.mutex.Unlock()
+	as.notifyObservers("audio_devices", report)
+}
+
+// GetAudioDeviceReport returns the latest audio device check
+func (as *AppState) GetAudioDeviceReport() AudioDeviceReport {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.AudioDevices
 }
 
 // GetInputLevel returns current input level (thread-safe)
@@ -306,11 +907,17 @@ func (as *AppState) GetState() map[string]interface{} {
 		"currentChannel": as.CurrentChannel,
 		"channels":       as.Channels,
 		"channelUsers":   as.ChannelUsers,
+		"channelTopics":  as.ChannelTopics,
 		"pttActive":      as.PTTActive,
+		"muted":          as.Muted,
+		"reconnecting":   as.Reconnecting,
+		"phase":          as.Phase,
 		"audioLevel":     as.AudioLevel,
 		"packetsRx":      as.PacketsRx,
 		"packetsTx":      as.PacketsTx,
 		"connectionTime": as.ConnectionTime,
+		"latencyMs":      as.Latency.Milliseconds(),
+		"packetLoss":     as.PacketLoss,
 		"messages":       as.Messages,
 		"pttKey":         as.PTTKey,
 	}
@@ -2,302 +2,648 @@
 package main
 
 import (
+	"ahcli/common"
 	"ahcli/common/logger"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 	"net"
-	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gordonklaus/portaudio"
 )
 
 const (
-	sampleRate      = 48000
-	framesPerBuffer = 960 // 20ms @ 48kHz mono
+	sampleRate             = 48000
+	defaultFramesPerBuffer = 960 // 20ms @ 48kHz mono
+)
+
+// Playback queue size limits (audio.output_buffer_frames) and overflow policies
+const (
+	defaultOutputBufferFrames = 100
+	minOutputBufferFrames     = 2
+	maxOutputBufferFrames     = 500
+
+	outputDropNewest = "drop_newest" // Keep what's queued, lose the arriving frame
+	outputDropOldest = "drop_oldest" // Make room by discarding the stalest frame
 )
 
 var (
 	audioStream    *portaudio.Stream
 	playbackStream *portaudio.Stream
-	incomingAudio  = make(chan []int16, 100)
+	incomingAudio  = make(chan audioFrame, defaultOutputBufferFrames)
+	transmitEnds   = make(chan uint16, 16) // Talkers who released push-to-talk, by source ID
 	serverConn     *net.UDPConn
 
 	// Premium audio processing
 	audioProcessor *AudioProcessor
 	sequenceNumber uint16 = 0
+	sendBuf        []byte // Reused packet buffer; audioSend only runs on the capture goroutine
+	sendFrames     int    // Frames queued in sendBuf
+
+	// Audio goroutine lifecycle
+	audioMutex  sync.Mutex
+	audioCancel context.CancelFunc
+	audioWG     sync.WaitGroup
+
+	// Samples per frame as negotiated with the server (0 = default)
+	frameSamples atomic.Int32
 )
 
+// framesPerBuffer returns the current samples per audio frame
+func framesPerBuffer() int {
+	if n := frameSamples.Load(); n > 0 {
+		return int(n)
+	}
+	return defaultFramesPerBuffer
+}
+
+// frameDuration returns the playback time of one audio frame
+func frameDuration() time.Duration {
+	return time.Duration(framesPerBuffer()) * time.Second / sampleRate
+}
+
+// setFrameSizeMs switches the audio frame size, restarting the streams if running
+func setFrameSizeMs(ms int) error {
+	samples := sampleRate * ms / 1000
+	if samples == framesPerBuffer() {
+		return nil
+	}
+	logger.Info("Switching audio frame size to %dms (%d samples)", ms, samples)
+
+	audioMutex.Lock()
+	running := audioCancel != nil
+	audioMutex.Unlock()
+
+	if !running {
+		frameSamples.Store(int32(samples))
+		return nil
+	}
+
+	StopAudio()
+	frameSamples.Store(int32(samples))
+	return startAudio()
+}
+
+// framesPerPacket is how many frames audioSend coalesces into one packet: the
+// configured number, if the server understands coalesced packets and they fit
+func framesPerPacket() int {
+	if currentConfig == nil || !common.HasCapability(serverCapabilities, common.CapabilityCoalesce) {
+		return 1
+	}
+	limit := common.FramesPerPacketLimit(int(frameDuration().Milliseconds()))
+	if currentConfig.Audio.LowData {
+		return limit // Low data mode: fewest packets, least header overhead
+	}
+	return max(1, min(currentConfig.AudioProcessing.FramesPerPacket, limit))
+}
+
+// audioSend queues a frame for the server, sending the packet once it holds
+// framesPerPacket frames. Callers flush with flushAudioSend when the frames
+// stop being consecutive.
 func audioSend(samples []int16) {
 	if serverConn == nil {
-		logger.Error("Warning: serverConn is nil, cannot send")
-		return
+		return // Not on a server, or reconnecting
 	}
 
 	// BYPASS PROCESSING FOR DEBUG - send raw samples
 	processedSamples := samples // Skip all processing
+	recordTransmitted(processedSamples)
 
-	// Create enhanced packet with sequence number
-	buf := make([]byte, 4+len(processedSamples)*2)
-	binary.LittleEndian.PutUint16(buf[0:2], 0x5541)         // Prefix 'AU'
-	binary.LittleEndian.PutUint16(buf[2:4], sequenceNumber) // Sequence number
-	binary.Write(sliceWriter(buf[4:]), binary.LittleEndian, processedSamples)
-
+	// Start a packet with the first frame's sequence number, reusing the send buffer
+	if sendFrames == 0 {
+		sendBuf = sendBuf[:0]
+		sendBuf = binary.LittleEndian.AppendUint16(sendBuf, currentAudioMagic().Audio) // Prefix, "AU" unless configured
+		sendBuf = binary.LittleEndian.AppendUint16(sendBuf, sequenceNumber)            // Sequence number
+	}
+	for _, sample := range processedSamples {
+		sendBuf = binary.LittleEndian.AppendUint16(sendBuf, uint16(sample))
+	}
+	sendFrames++
 	sequenceNumber++
 
+	if sendFrames >= framesPerPacket() {
+		flushAudioSend()
+	}
+}
+
+// flushAudioSend sends the frames audioSend has queued, if any
+func flushAudioSend() {
+	if sendFrames == 0 {
+		return
+	}
+	buf := sendBuf
+	sendFrames = 0
+	if serverConn == nil {
+		return
+	}
+
 	_, err := serverConn.Write(buf)
 	if err != nil {
 		logger.Error("Error sending audio packet: %v", err)
 		appState.AddMessage("Audio send failed", "error")
 	} else {
+		countSent(len(buf))
 		appState.IncrementTX()
 	}
 }
 
+// endTransmission sends the last queued frames and marks the end of the
+// transmission, so listeners stop filling the silence with comfort noise
+func endTransmission() {
+	flushAudioSend()
+	sendTransmitEnd()
+}
+
 func InitAudio() error {
 	logger.Info("InitAudio() entered - Premium Audio Processing Enabled")
-	fmt.Println("=== PREMIUM AUDIO INIT STARTED ===") // GUARANTEED CONSOLE OUTPUT
-
-	// MINIMAL ADDITION: Log to file too
-	if logFile, err := os.OpenFile("client.log", os.O_APPEND|os.O_WRONLY, 0666); err == nil {
-		fmt.Fprintln(logFile, "=== PREMIUM AUDIO INIT STARTED ===")
-		logFile.Close()
-	}
 
 	// Initialize premium audio processor
 	audioProcessor = NewAudioProcessor()
 	logger.Info("Premium audio processor initialized with noise gate and compression")
-	fmt.Println("Premium audio processor created")
+
+	return startAudio()
+}
+
+// startAudio opens and starts the audio streams and launches the audio goroutines.
+// The goroutines run until StopAudio or application shutdown cancels their context.
+func startAudio() error {
+	audioMutex.Lock()
+	defer audioMutex.Unlock()
+
+	if audioCancel != nil {
+		return fmt.Errorf("audio already running")
+	}
+	if audioPanicked.Load() {
+		// Restarts for settings or device changes wait for the panic button's release
+		logger.Info("Audio stays stopped until the panic button is released")
+		return nil
+	}
+
+	frames := framesPerBuffer()
+	audioProcessor.jitterBuffer.setPlayInterval(frameDuration())
 
 	// Set up input stream
-	in := make([]int16, framesPerBuffer)
-	inStream, err := portaudio.OpenDefaultStream(1, 0, sampleRate, len(in), in)
+	in := make([]int16, frames)
+	inStream, err := openInputStream(len(in), in)
 	if err != nil {
 		return err
 	}
 	audioStream = inStream
 
-	// Set up output stream
-	out := make([]int16, framesPerBuffer)
-	outStream, err := portaudio.OpenDefaultStream(0, 1, sampleRate, len(out), &out)
+	// Set up output stream - stereo when per-user panning is on
+	outChannels := 1
+	if appState.IsStereoOutput() {
+		outChannels = 2
+	}
+	out := make([]int16, frames*outChannels)
+	outStream, err := openOutputStream(outChannels, frames, &out)
 	if err != nil {
+		closeAudioStreams()
 		return err
 	}
 	playbackStream = outStream
 
 	// Start input stream
 	if err := inStream.Start(); err != nil {
+		closeAudioStreams()
 		return err
 	}
 	logger.Info("Input stream started successfully")
-	fmt.Println("Audio input stream STARTED")
 
 	// Start output stream
 	if err := outStream.Start(); err != nil {
+		closeAudioStreams()
 		return err
 	}
 	logger.Info("Output stream started successfully")
-	fmt.Println("Audio output stream STARTED")
 
-	// Start enhanced input goroutine with bypass and dual-level tracking
-	go func() {
-		logger.Info("Enhanced audio input goroutine started with bypass capability")
-		var lastPTTState bool
-		var frameCount int
-
-		for {
-			pttActive := IsPTTActive()
-
-			// Update PTT state
-			appState.SetPTTActive(pttActive)
-
-			// Log PTT state changes only
-			if pttActive != lastPTTState {
-				if pttActive {
-					logger.Info("Started transmitting with enhanced audio processing")
-					frameCount = 0
-					appState.AddMessage("● Transmitting", "ptt")
-				} else {
-					logger.Info("Stopped transmitting")
-					appState.AddMessage("○ Ready", "info")
-				}
-				lastPTTState = pttActive
-			}
+	ctx, cancel := context.WithCancel(appCtx)
+	audioCancel = cancel
 
+	audioWG.Add(3)
+	go runAudioInput(ctx, inStream, in)
+	go runAudioPlayback(ctx, outStream, out, outChannels == 2)
+	go runAudioQualityMonitor(ctx)
+
+	return nil
+}
+
+// StopAudio stops the audio goroutines, waits for them to exit, and releases the devices
+func StopAudio() {
+	audioMutex.Lock()
+	defer audioMutex.Unlock()
+
+	if audioCancel == nil {
+		return
+	}
+
+	logger.Info("Stopping audio system...")
+	audioCancel()
+	audioWG.Wait()
+	audioCancel = nil
+
+	closeAudioStreams()
+}
+
+// RestartAudio tears down and re-opens the audio streams (e.g. after a device change).
+// The processor and its settings are kept.
+func RestartAudio() error {
+	logger.Info("Restarting audio system...")
+	StopAudio()
+	return startAudio()
+}
+
+// runAudioInput reads the mic while PTT is held, processes and transmits it
+func runAudioInput(ctx context.Context, inStream *portaudio.Stream, in []int16) {
+	defer audioWG.Done()
+
+	logger.Info("Enhanced audio input goroutine started with bypass capability")
+	var lastPTTState bool
+	var frameCount int
+
+	spectrum := newSpectrumAnalyzer()
+	var lastSpectrum time.Time
+	var mic micWatch
+
+	// Roger beep frames still to send after PTT release, and when the next is due
+	var roger [][]int16
+	var nextRoger time.Time
+
+	for {
+		if ctx.Err() != nil {
+			flushAudioSend()
+			logger.Info("Audio input goroutine stopped")
+			return
+		}
+
+		// Muted mic never transmits, even with PTT held
+		pttActive := IsPTTActive() && !appState.IsMuted()
+
+		// Update PTT state
+		appState.SetPTTActive(pttActive)
+
+		// Log PTT state changes only
+		if pttActive != lastPTTState {
 			if pttActive {
-				if err := inStream.Read(); err != nil {
-					logger.Error("Mic read error: %v", err)
-					continue
+				logger.Info("Started transmitting with enhanced audio processing")
+				if n := framesPerPacket(); n > 1 {
+					logger.Debug("Sending %d frames per packet", n)
 				}
-				frameCount++
-
-				// Calculate RAW input level (before any processing)
-				var sumSquares float64 = 0
-				for _, sample := range in {
-					sumSquares += float64(sample) * float64(sample)
+				if roger != nil {
+					roger = nil // A new transmission cuts the last one's beep short
+					flushAudioSend()
+				}
+				frameCount = 0
+				mic = micWatch{limit: noInputWarningLimit()}
+				appState.AddMessage("● Transmitting", "ptt")
+				audioProcessor.ResetSilenceSuppression()
+				audioProcessor.ClearDelayLines()
+				playCourtesyBeep(true)
+			} else {
+				roger, nextRoger = rogerBeepFrames(), time.Now()
+				if roger == nil {
+					endTransmission()
 				}
-				rawRMS := math.Sqrt(sumSquares / float64(len(in)))
-				rawInputLevel := float32(rawRMS / 32767.0)
-
-				// Send raw level to AppState immediately
-				appState.SetRawInputLevel(rawInputLevel)
-
-				// Process through audio chain (or bypass)
-				var processedSamples []int16
-				if audioProcessor != nil && audioProcessor.IsBypassed() {
-					// BYPASS: Use raw samples
-					processedSamples = in
-					appState.SetProcessedInputLevel(rawInputLevel) // Same as raw when bypassed
-				} else {
-					// PROCESS: Run through audio chain
-					processedSamples = audioProcessor.ProcessInputAudio(in)
-
-					// Calculate PROCESSED input level
-					var processedSumSquares float64 = 0
-					for _, sample := range processedSamples {
-						processedSumSquares += float64(sample) * float64(sample)
-					}
-					processedRMS := math.Sqrt(processedSumSquares / float64(len(processedSamples)))
-					processedInputLevel := float32(processedRMS / 32767.0)
-
-					// Send processed level to AppState
-					appState.SetProcessedInputLevel(processedInputLevel)
+				logger.Info("Stopped transmitting")
+				appState.AddMessage("○ Ready", "info")
+				playCourtesyBeep(false)
+				spectrum.Reset()
+				appState.SetSpectrum(spectrum.bands)
+			}
+			lastPTTState = pttActive
+		}
+
+		if pttActive {
+			if err := inStream.Read(); err != nil {
+				logger.Error("Mic read error: %v", err)
+				continue
+			}
+			frameCount++
+
+			// Calculate RAW input level (before any processing)
+			var sumSquares float64 = 0
+			for _, sample := range in {
+				sumSquares += float64(sample) * float64(sample)
+			}
+			rawRMS := math.Sqrt(sumSquares / float64(len(in)))
+			rawInputLevel := float32(rawRMS / 32767.0)
+
+			// Send raw level to AppState immediately
+			appState.SetRawInputLevel(rawInputLevel)
+
+			if mic.observe(rawInputLevel, frameDuration()) {
+				logger.Warn("No microphone input for %v while transmitting (raw RMS %.5f)", mic.silent, rawInputLevel)
+				appState.AddMessage("🎤 "+noInputWarningMessage, "warning")
+			}
+
+			// Spectrum of the raw mic signal, analyzed every frame but pushed at a throttled rate
+			bands := spectrum.Analyze(in)
+			if now := time.Now(); now.Sub(lastSpectrum) >= spectrumInterval {
+				appState.SetSpectrum(bands)
+				lastSpectrum = now
+			}
+
+			// Process through audio chain (or bypass)
+			var processedSamples []int16
+			if audioProcessor != nil && audioProcessor.IsBypassed() {
+				// BYPASS: Use raw samples
+				processedSamples = in
+				appState.SetProcessedInputLevel(rawInputLevel) // Same as raw when bypassed
+			} else {
+				// PROCESS: Run through audio chain
+				processedSamples = audioProcessor.ProcessInputAudio(in)
+
+				// Calculate PROCESSED input level
+				var processedSumSquares float64 = 0
+				for _, sample := range processedSamples {
+					processedSumSquares += float64(sample) * float64(sample)
 				}
+				processedRMS := math.Sqrt(processedSumSquares / float64(len(processedSamples)))
+				processedInputLevel := float32(processedRMS / 32767.0)
 
-				// Update comprehensive audio stats every 10 frames
-				if frameCount%10 == 0 {
-					stats := audioProcessor.GetStats()
-					stats.InputLevel = rawInputLevel // Ensure raw level is in stats
-					appState.SetAudioStats(stats)
-
-					// Log processing comparison occasionally
-					if frameCount%50 == 0 {
-						logger.Info("Audio Levels - Raw: %.1f%%, Processed: %.1f%%, Bypass: %t",
-							rawInputLevel*100,
-							appState.GetProcessedInputLevel()*100,
-							audioProcessor.IsBypassed())
-					}
+				// Send processed level to AppState
+				appState.SetProcessedInputLevel(processedInputLevel)
+			}
+
+			// Update comprehensive audio stats every 10 frames
+			if frameCount%10 == 0 {
+				stats := audioProcessor.GetStats()
+				stats.InputLevel = rawInputLevel // Ensure raw level is in stats
+				appState.SetAudioStats(stats)
+
+				// Log processing comparison occasionally
+				if frameCount%50 == 0 {
+					logger.Info("Audio Levels - Raw: %.1f%%, Processed: %.1f%%, Bypass: %t",
+						rawInputLevel*100,
+						appState.GetProcessedInputLevel()*100,
+						audioProcessor.IsBypassed())
 				}
+			}
 
-				// Send the processed (or bypassed) audio
+			// Send the processed (or bypassed) audio, skipping sustained silence
+			if audioProcessor.IsBypassed() || audioProcessor.ShouldTransmit(processedSamples) {
 				audioSend(processedSamples)
 			} else {
-				// Reset levels when not transmitting
-				appState.SetRawInputLevel(0)
-				appState.SetProcessedInputLevel(0)
-				time.Sleep(5 * time.Millisecond)
+				flushAudioSend() // Don't hold the last frames before a silence back
+			}
+		} else {
+			// Reset levels when not transmitting
+			appState.SetRawInputLevel(0)
+			appState.SetProcessedInputLevel(0)
+
+			if roger != nil && !time.Now().Before(nextRoger) {
+				audioSend(roger[0])
+				nextRoger = nextRoger.Add(frameDuration())
+				if roger = roger[1:]; len(roger) == 0 {
+					roger = nil
+					endTransmission()
+				}
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Millisecond):
 			}
 		}
-	}()
+	}
+}
 
-	// Start enhanced playback goroutine with visualization support
-	go func() {
-		logger.Info("Enhanced playback goroutine started with visualization support")
-		fmt.Println("=== ENHANCED PLAYBACK GOROUTINE STARTED ===") // GUARANTEED OUTPUT
+// How often the received audio level is published to the UI
+const outputLevelInterval = 100 * time.Millisecond
+
+// runAudioPlayback plays received audio and feeds output visualization
+func runAudioPlayback(ctx context.Context, outStream *portaudio.Stream, out []int16, stereo bool) {
+	defer audioWG.Done()
+
+	logger.Info("Enhanced playback goroutine started with visualization support")
+
+	var playbackFrameCount int
+	var lastPacketTime time.Time
+	var timingLogCount int
+
+	// Output meter: peak of each frame, published at a steady rate so it falls to zero when audio stops
+	meterTicker := time.NewTicker(outputLevelInterval)
+	defer meterTicker.Stop()
+	var meterPeak, meterShown float32
+
+	// Simultaneous talkers are queued separately and mixed a frame at a time
+	talkers := newTalkerQueues(cap(incomingAudio))
+	defer talkers.clear()
+	var mixer audioMixer
+	var mixFrames []audioFrame
+	var mixSamples [][]int16
+	var mixPans []float64
+	var heard [][]int16 // Received talkers only, for the session recording
+	var recordBuf []int16
+
+	for {
+		talkers.warmup = audioProcessor.WarmupFrames()
+
+		// While a talker pauses, wake up each frame to fill the gap with comfort noise
+		var gapTimer <-chan time.Time
+		if !talkers.pending() {
+			if _, gap := audioProcessor.ComfortNoiseGap(); gap {
+				gapTimer = time.After(frameDuration() * 3 / 2)
+			}
+		}
 
-		// MINIMAL ADDITION: Log to file
-		if logFile, err := os.OpenFile("client.log", os.O_APPEND|os.O_WRONLY, 0666); err == nil {
-			fmt.Fprintln(logFile, "=== ENHANCED PLAYBACK GOROUTINE STARTED ===")
-			logFile.Close()
+		// Queued frames from other talkers play without waiting for new arrivals;
+		// a talker still warming up is woken when its wait runs out
+		var queued <-chan struct{}
+		var warmTimer <-chan time.Time
+		if talkers.ready(time.Now()) {
+			queued = alwaysReady
+		} else if until, ok := talkers.warmingUntil(); ok {
+			warmTimer = time.After(time.Until(until))
 		}
 
-		var playbackFrameCount int
-		var lastPacketTime time.Time
-		var timingLogCount int
+		select {
+		case <-ctx.Done():
+			logger.Info("Playback goroutine stopped")
+			return
+		case frame := <-incomingAudio:
+			talkers.push(frame)
+		case source := <-transmitEnds:
+			audioProcessor.EndComfortNoise(source)
+			continue
+		case <-queued:
+		case <-warmTimer:
+		case <-meterTicker.C:
+			if meterPeak != meterShown {
+				appState.SetOutputLevel(meterPeak)
+				meterShown = meterPeak
+			}
+			meterPeak = 0
+			continue
+		case <-gapTimer:
+			source, gap := audioProcessor.ComfortNoiseGap()
+			if !gap {
+				continue
+			}
+			noise := audioProcessor.GenerateComfortNoise(source, framesPerBuffer())
+			audioProcessor.DuckPlayback(noise, appState.GetPTTActive())
+			writePlayback(outStream, out, noise, 0, stereo)
+			continue
+		}
 
-		for samples := range incomingAudio {
-			now := time.Now()
+		// Everything already waiting joins this frame's mix
+		for drained := false; !drained; {
+			select {
+			case frame := <-incomingAudio:
+				talkers.push(frame)
+			default:
+				drained = true
+			}
+		}
+		mixFrames = talkers.popEach(mixFrames[:0])
+		if len(mixFrames) == 0 {
+			continue // Everything queued was filtered out or is still warming up
+		}
 
-			// WAN DIAGNOSTIC: Track timing between packets
-			if !lastPacketTime.IsZero() {
-				timeSinceLastPacket := now.Sub(lastPacketTime)
-				timingLogCount++
+		mixSamples, mixPans, heard = mixSamples[:0], mixPans[:0], heard[:0]
+		for _, frame := range mixFrames {
+			samples := frame.samples
 
-				// Log every 10th packet to avoid spam, but catch timing issues
-				if timingLogCount%10 == 0 || timeSinceLastPacket > 40*time.Millisecond || timeSinceLastPacket < 10*time.Millisecond {
-					fmt.Printf("🕕 PACKET TIMING: %v since last (should be ~20ms)\n", timeSinceLastPacket)
+			// Gated (all-zero) frames from a talker get comfort noise instead of dead air;
+			// real audio gets our own receive processing
+			if !frame.local && audioProcessor.ObserveReceived(frame.source, samples) {
+				samples = audioProcessor.GenerateComfortNoise(frame.source, len(samples))
+			} else if !frame.local {
+				audioProcessor.receive.Process(frame.source, samples)
+			}
 
-					// Log significant timing anomalies to file
-					if logFile, err := os.OpenFile("client.log", os.O_APPEND|os.O_WRONLY, 0666); err == nil {
-						fmt.Fprintf(logFile, "PACKET TIMING: %v since last\n", timeSinceLastPacket)
-						logFile.Close()
-					}
-				}
+			// Quieter while we talk so our own voice dominates on speakers
+			if !frame.local {
+				audioProcessor.DuckPlayback(samples, appState.GetPTTActive())
+				heard = append(heard, samples)
 			}
-			lastPacketTime = now
 
-			fmt.Println("*** RECEIVED AUDIO PACKET ***") // GUARANTEED OUTPUT
+			mixSamples = append(mixSamples, samples)
+			mixPans = append(mixPans, userPanForSource(frame.source))
+		}
 
-			// MINIMAL ADDITION: Log to file
-			if logFile, err := os.OpenFile("client.log", os.O_APPEND|os.O_WRONLY, 0666); err == nil {
-				fmt.Fprintln(logFile, "*** RECEIVED AUDIO PACKET ***")
-				logFile.Close()
-			}
+		now := time.Now()
 
-			// DEBUG: Check sample content and audio device
-			maxAmp := maxAmplitude(samples)
-			fmt.Printf("PLAYBACK DEBUG - Samples: %d, Max Amplitude: %d\n", len(samples), maxAmp)
+		// WAN DIAGNOSTIC: Track timing between packets
+		if !lastPacketTime.IsZero() {
+			timeSinceLastPacket := now.Sub(lastPacketTime)
+			timingLogCount++
 
-			// Log to file too
-			if logFile, err := os.OpenFile("client.log", os.O_APPEND|os.O_WRONLY, 0666); err == nil {
-				fmt.Fprintf(logFile, "PLAYBACK DEBUG - Samples: %d, Max Amplitude: %d\n", len(samples), maxAmp)
-				logFile.Close()
+			// Log every 10th packet to avoid spam, but catch timing issues
+			if timingLogCount%10 == 0 || timeSinceLastPacket > 40*time.Millisecond || timeSinceLastPacket < 10*time.Millisecond {
+				logger.Debug("Packet timing: %v since last", timeSinceLastPacket)
 			}
+		}
+		lastPacketTime = now
 
-			playbackFrameCount++
-			if maxAmp > 50 && playbackFrameCount%50 == 0 {
-				logger.Info("Playing audio (amplitude: %d)", maxAmp)
-				fmt.Printf("Playing audio (amplitude: %d)\n", maxAmp)
-			}
+		mixer.mix(out, mixSamples, mixPans, stereo)
+
+		// DEBUG: Check sample content and audio device
+		maxAmp := maxAmplitude(out)
+		logger.Debug("Playback: %d talker(s), max amplitude %d", len(mixSamples), maxAmp)
 
-			// Update output level for visualization based on received audio
-			if maxAmp > 50 {
-				// Calculate output level for visualization
-				outputLevel := float32(maxAmp) / 32767.0
+		playbackFrameCount++
+		if maxAmp > 50 && playbackFrameCount%50 == 0 {
+			logger.Info("Playing audio (amplitude: %d)", maxAmp)
+		}
 
-				// Update legacy audio level
-				level := int(outputLevel * 100)
-				appState.SetAudioLevel(level)
+		// Update output level for visualization based on received audio
+		outputLevel := float32(maxAmp) / 32767.0
+		meterPeak = max(meterPeak, outputLevel)
+		if maxAmp > 50 {
+			// Update legacy audio level
+			level := int(outputLevel * 100)
+			appState.SetAudioLevel(level)
+		}
 
-				// TODO: Add output level to AppState when we implement output visualization
-				// For now, the input visualization shows transmission, this shows reception
+		if len(heard) > 0 && recording.Load() {
+			if cap(recordBuf) < framesPerBuffer() {
+				recordBuf = make([]int16, framesPerBuffer())
 			}
+			recordBuf = recordBuf[:framesPerBuffer()]
+			mixer.mix(recordBuf, heard, nil, false)
+			recordReceived(recordBuf)
+		}
 
-			copy(out, samples)
-			if err := outStream.Write(); err != nil {
-				logger.Error("Playback error: %v", err)
-				fmt.Printf("PLAYBACK ERROR: %v\n", err)
-				appState.AddMessage("Audio playback failed", "error")
+		err := outStream.Write()
+		for _, frame := range mixFrames {
+			recycleFrame(frame)
+		}
+		if err != nil {
+			if err == portaudio.OutputUnderflowed {
+				continue // A glitch, not a lost device
 			}
+			logger.Error("Playback error: %v", err)
+			if outputFailoverEnabled() {
+				go recoverOutputDevice(err)
+				return
+			}
+			appState.AddMessage("Audio playback failed", "error")
 		}
-		fmt.Println("=== PLAYBACK GOROUTINE ENDED ===") // Should never see this
-	}()
+	}
+}
 
-	// Start enhanced audio quality monitoring with visualization updates
-	go func() {
-		qualityTicker := time.NewTicker(2 * time.Second) // More frequent for better visualization
-		defer qualityTicker.Stop()
+// writePlayback copies a mono frame into the output buffer (panned if stereo) and plays it
+func writePlayback(outStream *portaudio.Stream, out, samples []int16, pan float64, stereo bool) error {
+	if stereo {
+		panToStereo(out, samples, pan)
+	} else {
+		copy(out, samples)
+	}
+	return outStream.Write()
+}
 
-		for range qualityTicker.C {
-			stats := audioProcessor.GetStats()
+// runAudioQualityMonitor periodically publishes audio quality stats
+func runAudioQualityMonitor(ctx context.Context) {
+	defer audioWG.Done()
 
-			// Update AppState with comprehensive audio quality info
-			appState.SetAudioStats(stats)
+	qualityTicker := time.NewTicker(2 * time.Second) // More frequent for better visualization
+	defer qualityTicker.Stop()
 
-			// Report significant issues to user
-			if stats.PacketLoss > 0.05 {
-				appState.AddMessage(fmt.Sprintf("Audio Quality: %s (%.1f%% loss)",
-					stats.AudioQuality, stats.PacketLoss*100), "warning")
-			}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-qualityTicker.C:
+		}
+
+		stats := audioProcessor.GetStats()
 
-			// Log detailed stats for debugging
-			logger.Debug("Audio Stats - Quality: %s, Latency: %v, Loss: %.2f%%, Jitter: %v",
-				stats.AudioQuality, stats.BufferLatency, stats.PacketLoss*100, stats.NetworkJitter)
+		// Update AppState with comprehensive audio quality info
+		appState.SetAudioStats(stats)
+
+		// Report significant issues to user
+		if stats.PacketLoss > 0.05 {
+			appState.AddMessage(fmt.Sprintf("Audio Quality: %s (%.1f%% loss)",
+				stats.AudioQuality, stats.PacketLoss*100), "warning")
 		}
-	}()
 
-	return nil
+		// Log detailed stats for debugging
+		logger.Debug("Audio Stats - Quality: %s, Latency: %v, Loss: %.2f%%, Jitter: %v",
+			stats.AudioQuality, stats.BufferLatency, stats.PacketLoss*100, stats.NetworkJitter)
+	}
+}
+
+// closeAudioStreams stops and closes the PortAudio streams so the devices are released
+func closeAudioStreams() {
+	for name, stream := range map[string]*portaudio.Stream{"input": audioStream, "output": playbackStream} {
+		if stream == nil {
+			continue
+		}
+		if err := stream.Stop(); err != nil {
+			logger.Error("Failed to stop %s stream: %v", name, err)
+		}
+		if err := stream.Close(); err != nil {
+			logger.Error("Failed to close %s stream: %v", name, err)
+		}
+	}
+	audioStream = nil
+	playbackStream = nil
+	logger.Info("Audio streams closed")
 }
 
 // Helper function to check if we're actually getting audio data
@@ -314,19 +660,269 @@ func maxAmplitude(samples []int16) int16 {
 	return max
 }
 
-func sliceWriter(buf []byte) *sliceBuffer {
-	return &sliceBuffer{buf: buf}
+// Roger beep defaults for fields left zero in the config
+const (
+	defaultBeepFrequency = 1000.0
+	defaultBeepDuration  = 80 * time.Millisecond
+	defaultBeepVolume    = 0.25
+)
+
+// rogerBeepTone returns the configured beep tone, or ok=false when beeps are disabled
+func rogerBeepTone() (frequency float64, duration time.Duration, volume float64, ok bool) {
+	if currentConfig == nil || !currentConfig.AudioProcessing.RogerBeep.Enabled {
+		return 0, 0, 0, false
+	}
+
+	beep := currentConfig.AudioProcessing.RogerBeep
+	frequency = beep.FrequencyHz
+	if frequency <= 0 {
+		frequency = defaultBeepFrequency
+	}
+	duration = time.Duration(beep.DurationMs) * time.Millisecond
+	if duration <= 0 {
+		duration = defaultBeepDuration
+	}
+	volume = beep.Volume
+	if volume <= 0 || volume > 1 {
+		volume = defaultBeepVolume
+	}
+	return frequency, duration, volume, true
+}
+
+// generateTone builds a sine tone split into full framesPerBuffer frames.
+// A short fade in/out avoids clicks, and the last frame is padded with silence.
+func generateTone(frequency float64, duration time.Duration, volume float64) [][]int16 {
+	totalSamples := int(duration.Seconds() * sampleRate)
+	fadeSamples := sampleRate / 200 // 5ms
+	if fadeSamples*2 > totalSamples {
+		fadeSamples = totalSamples / 2
+	}
+
+	frameSize := framesPerBuffer()
+	frameCount := (totalSamples + frameSize - 1) / frameSize
+	frames := make([][]int16, frameCount)
+	for f := range frames {
+		frames[f] = make([]int16, frameSize)
+	}
+
+	for i := 0; i < totalSamples; i++ {
+		envelope := 1.0
+		if i < fadeSamples {
+			envelope = float64(i) / float64(fadeSamples)
+		} else if i >= totalSamples-fadeSamples {
+			envelope = float64(totalSamples-i) / float64(fadeSamples)
+		}
+
+		angle := 2.0 * math.Pi * frequency * float64(i) / float64(sampleRate)
+		frames[i/frameSize][i%frameSize] = int16(32767 * volume * envelope * math.Sin(angle))
+	}
+
+	return frames
 }
 
-type sliceBuffer struct {
-	buf []byte
-	off int
+// setOutputBufferFrames resizes the playback queue. Only call it before audio
+// starts: the playback and network goroutines use the channel unguarded.
+func setOutputBufferFrames(frames int) {
+	if frames == cap(incomingAudio) {
+		return
+	}
+	incomingAudio = make(chan audioFrame, frames)
+	receivedFrames = make(chan []int16, frames+8)
+	logger.Info("Playback queue holds %d frames (%v)", frames, time.Duration(frames)*frameDuration())
 }
 
-func (b *sliceBuffer) Write(p []byte) (int, error) {
-	n := copy(b.buf[b.off:], p)
-	b.off += n
-	return n, nil
+// queueReceivedFrame hands a network frame to playback without blocking the
+// reader. When the queue is full the configured overflow policy decides which
+// frame is lost, and the drop is counted.
+func queueReceivedFrame(frame audioFrame) {
+	if audioPanicked.Load() {
+		if frame.pooled {
+			putReceivedFrame(frame.samples)
+		}
+		return
+	}
+
+	select {
+	case incomingAudio <- frame:
+		return
+	default:
+	}
+
+	if currentConfig != nil && currentConfig.Audio.OutputOverflow == outputDropOldest {
+		select {
+		case old := <-incomingAudio:
+			if old.pooled {
+				putReceivedFrame(old.samples)
+			}
+		default:
+		}
+		select {
+		case incomingAudio <- frame:
+			countOutputDrop()
+			return
+		default:
+		}
+	}
+
+	if frame.pooled {
+		putReceivedFrame(frame.samples)
+	}
+	countOutputDrop()
+}
+
+// How often a playback queue overflow is logged, in dropped frames
+const outputDropLogInterval = 500
+
+// countOutputDrop records one dropped frame, warning on the first and then periodically
+func countOutputDrop() {
+	if dropped := appState.IncrementOutputDropped(); dropped%outputDropLogInterval == 1 {
+		logger.Warn("Playback can't keep up: %d received frames dropped so far (see audio.output_buffer_frames)", dropped)
+	}
+}
+
+// playCourtesyBeep queues a local-only beep into playback on PTT press/release
+func playCourtesyBeep(pressed bool) {
+	frequency, duration, volume, ok := rogerBeepTone()
+	if !ok {
+		return
+	}
+
+	// Release beep is pitched lower so press and release are distinguishable
+	if !pressed {
+		frequency *= 0.75
+	}
+
+	for _, frame := range generateTone(frequency, duration, volume) {
+		select {
+		case incomingAudio <- audioFrame{samples: frame, local: true}:
+		default:
+			logger.Debug("Playback channel full, dropping courtesy beep")
+			return
+		}
+	}
+}
+
+// Channel sound defaults for fields left zero in the config
+const (
+	defaultChannelSoundVolume   = 0.2
+	defaultChannelSoundInterval = 500 * time.Millisecond
+	channelSoundNoteDuration    = 60 * time.Millisecond
+)
+
+// Two-note cues: rising for a join, falling for a leave
+var channelSoundNotes = map[string][]float64{
+	common.SystemEventJoin:  {659.25, 880.0},
+	common.SystemEventLeave: {880.0, 659.25},
+}
+
+// Unix nanos of the last channel sound, for throttling
+var lastChannelSound atomic.Int64
+
+// playChannelSound queues a local cue for a join/leave in our channel.
+// Cues within min_interval_ms of the last one are dropped, so a mass join
+// plays once instead of a cacophony.
+func playChannelSound(event string) {
+	if currentConfig == nil || !currentConfig.AudioProcessing.ChannelSounds.Enabled {
+		return
+	}
+	notes, ok := channelSoundNotes[event]
+	if !ok {
+		return
+	}
+
+	sounds := currentConfig.AudioProcessing.ChannelSounds
+	volume := sounds.Volume
+	if volume <= 0 || volume > 1 {
+		volume = defaultChannelSoundVolume
+	}
+	interval := time.Duration(sounds.MinIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultChannelSoundInterval
+	}
+
+	now := time.Now().UnixNano()
+	last := lastChannelSound.Load()
+	if now-last < int64(interval) || !lastChannelSound.CompareAndSwap(last, now) {
+		logger.Debug("Skipping %s sound (throttled)", event)
+		return
+	}
+
+	for _, frequency := range notes {
+		for _, frame := range generateTone(frequency, channelSoundNoteDuration, volume) {
+			select {
+			case incomingAudio <- audioFrame{samples: frame, local: true}:
+			default:
+				logger.Debug("Playback channel full, dropping %s sound", event)
+				return
+			}
+		}
+	}
+}
+
+// Output test chime: a rising C major arpeggio, quiet enough not to startle on headphones
+var outputTestNotes = []float64{523.25, 659.25, 783.99}
+
+const (
+	outputTestNoteDuration = 200 * time.Millisecond
+	outputTestVolume       = 0.3
+	outputTestStall        = time.Second // Give up when playback takes nothing for this long
+)
+
+var outputTestPlaying atomic.Bool
+
+// playOutputTest plays a short chime straight into playback - no network,
+// processing or ducking - so users can check their speakers are audible.
+// The chime is fed a frame at a time, so it fits any output buffer size.
+func playOutputTest() error {
+	audioMutex.Lock()
+	running := audioCancel != nil
+	audioMutex.Unlock()
+	if !running {
+		return errors.New("audio output isn't running")
+	}
+	if !outputTestPlaying.CompareAndSwap(false, true) {
+		return errors.New("the test chime is already playing")
+	}
+
+	var frames [][]int16
+	for _, frequency := range outputTestNotes {
+		frames = append(frames, generateTone(frequency, outputTestNoteDuration, outputTestVolume)...)
+	}
+	logger.Info("Playing output test chime (%d frames)", len(frames))
+
+	queue := incomingAudio
+	go func() {
+		defer outputTestPlaying.Store(false)
+		ticker := time.NewTicker(frameDuration())
+		defer ticker.Stop()
+		for _, frame := range frames {
+			select {
+			case queue <- audioFrame{samples: frame, local: true}:
+			case <-time.After(outputTestStall):
+				logger.Warn("Output test chime cut short: playback stopped taking frames")
+				return
+			}
+			<-ticker.C
+		}
+	}()
+	return nil
+}
+
+// rogerBeepFrames returns the roger beep to transmit at the end of a
+// transmission, or nil if it's off. The input loop sends the frames straight
+// to audioSend, so the noise gate can't swallow the tone, one per frame time
+// like live audio so the receiver doesn't get a burst.
+func rogerBeepFrames() [][]int16 {
+	if currentConfig == nil || !currentConfig.AudioProcessing.RogerBeep.Transmit {
+		return nil
+	}
+	frequency, duration, volume, ok := rogerBeepTone()
+	if !ok {
+		return nil
+	}
+	frames := generateTone(frequency, duration, volume)
+	logger.Debug("Sending roger beep (%d frames, %.0fHz)", len(frames), frequency)
+	return frames
 }
 
 // TestAudioPipeline generates a test tone to verify premium audio processing
@@ -335,8 +931,8 @@ func TestAudioPipeline() {
 	appState.AddMessage("Testing premium audio processing with visualization...", "info")
 
 	// Generate a more sophisticated test signal
-	testSamples := make([]int16, framesPerBuffer)
-	for i := 0; i < framesPerBuffer; i++ {
+	testSamples := make([]int16, framesPerBuffer())
+	for i := range testSamples {
 		// Mix of 440Hz and 880Hz for richer test
 		angle1 := 2.0 * 3.14159 * 440.0 * float64(i) / float64(sampleRate)
 		angle2 := 2.0 * 3.14159 * 880.0 * float64(i) / float64(sampleRate)
@@ -354,8 +950,9 @@ func TestAudioPipeline() {
 	// Update visualization with test signal
 	appState.SetInputLevel(testLevel)
 
-	// Process through premium audio pipeline
-	processedSamples := audioProcessor.ProcessInputAudio(testSamples)
+	// Process through a copy of the pipeline: capture may be using the real one
+	processor := audioProcessor.testCopy()
+	processedSamples := processor.ProcessInputAudio(testSamples)
 
 	logger.Info("Generated test tone: %d samples, processed with premium pipeline", len(processedSamples))
 	logger.Info("Max amplitude - Original: %d, Processed: %d", maxAmplitude(testSamples), maxAmplitude(processedSamples))
@@ -364,7 +961,7 @@ func TestAudioPipeline() {
 	audioProcessor.AddToJitterBuffer(9999, processedSamples) // Special sequence for test
 
 	// Get processing stats and update visualization
-	stats := audioProcessor.GetStats()
+	stats := processor.GetStats()
 	stats.InputLevel = testLevel // Override with actual test level
 	appState.SetAudioStats(stats)
 
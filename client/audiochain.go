@@ -0,0 +1,129 @@
+// FILE: client/audiochain.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Stage is one step of the input processing chain. Stages may work in place
+// and return the same slice.
+type Stage interface {
+	Process(samples []int16) []int16
+}
+
+// stageFunc adapts a plain function to the Stage interface
+type stageFunc func(samples []int16) []int16
+
+func (f stageFunc) Process(samples []int16) []int16 { return f(samples) }
+
+// Used when audio_processing.chain isn't set in settings.config
+var defaultProcessingChain = []string{"noise_gate", "compressor", "makeup_gain"}
+
+// processingStages builds each known stage for a processor. A stage in the chain
+// still honours its own enabled flag, so the UI toggles keep working.
+var processingStages = map[string]func(ap *AudioProcessor) Stage{
+	"noise_gate": func(ap *AudioProcessor) Stage {
+		return stageFunc(func(samples []int16) []int16 {
+			if ap.enableNoiseGate {
+				ap.applyNoiseGate(samples)
+			}
+			return samples
+		})
+	},
+	"compressor": func(ap *AudioProcessor) Stage {
+		return stageFunc(func(samples []int16) []int16 {
+			if ap.enableCompressor {
+				ap.applyCompressor(samples)
+			}
+			return samples
+		})
+	},
+	"makeup_gain": func(ap *AudioProcessor) Stage {
+		return stageFunc(func(samples []int16) []int16 {
+			if ap.enableMakeupGain {
+				ap.applyMakeupGain(samples)
+			}
+			return samples
+		})
+	},
+	"high_pass": func(ap *AudioProcessor) Stage {
+		return ap.highPass
+	},
+}
+
+// buildProcessingChain turns stage names into stages. An empty list gives the default chain.
+func buildProcessingChain(ap *AudioProcessor, names []string) ([]Stage, error) {
+	if len(names) == 0 {
+		names = defaultProcessingChain
+	}
+
+	chain := make([]Stage, 0, len(names))
+	for _, name := range names {
+		build, ok := processingStages[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown processing stage %q (known: %s)", name, knownStages())
+		}
+		chain = append(chain, build(ap))
+	}
+	return chain, nil
+}
+
+// knownStages lists the stage names for error messages
+func knownStages() string {
+	names := make([]string, 0, len(processingStages))
+	for name := range processingStages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Used when audio_processing.high_pass.cutoff_hz isn't set
+const defaultHighPassCutoff = 80.0
+
+// HighPassFilter is a one-pole high-pass that removes rumble and handling noise.
+// It only runs when "high_pass" is in the chain.
+type HighPassFilter struct {
+	alpha float32
+
+	// State
+	prevIn  float32
+	prevOut float32
+}
+
+// newHighPassFilter creates a filter with the given cutoff in Hz
+func newHighPassFilter(cutoffHz float64) *HighPassFilter {
+	hp := &HighPassFilter{}
+	hp.setCutoff(cutoffHz)
+	return hp
+}
+
+// setCutoff recalculates the filter coefficient for a new cutoff frequency
+func (hp *HighPassFilter) setCutoff(cutoffHz float64) {
+	if cutoffHz <= 0 {
+		cutoffHz = defaultHighPassCutoff
+	}
+	rc := 1 / (2 * math.Pi * cutoffHz)
+	dt := 1.0 / sampleRate
+	hp.alpha = float32(rc / (rc + dt))
+}
+
+// Process filters samples in place
+func (hp *HighPassFilter) Process(samples []int16) []int16 {
+	for i, sample := range samples {
+		in := float32(sample)
+		out := hp.alpha * (hp.prevOut + in - hp.prevIn)
+		hp.prevIn, hp.prevOut = in, out
+
+		if out > 32767 {
+			out = 32767
+		} else if out < -32767 {
+			out = -32767
+		}
+		samples[i] = int16(out)
+	}
+	return samples
+}
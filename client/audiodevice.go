@@ -0,0 +1,431 @@
+// FILE: client/audiodevice.go
+package main
+
+import (
+	"ahcli/common/logger"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+const (
+	outputFailoverMinBackoff = 500 * time.Millisecond
+	outputFailoverMaxBackoff = 10 * time.Second
+	outputStableAfter        = 30 * time.Second // A device that survives this long resets the backoff
+
+	// Windows sends a burst of notifications per plug; rescan once it goes quiet
+	deviceChangeSettle = 1500 * time.Millisecond
+)
+
+// AudioDeviceInfo describes one PortAudio device for the diagnostics report
+type AudioDeviceInfo struct {
+	Name              string  `json:"name"`
+	HostAPI           string  `json:"hostApi"`
+	Inputs            int     `json:"inputs"`
+	Outputs           int     `json:"outputs"`
+	DefaultSampleRate float64 `json:"defaultSampleRate"`
+	InputOK           bool    `json:"inputOk"`  // Can capture mono at our sample rate
+	OutputOK          bool    `json:"outputOk"` // Can play at our sample rate
+}
+
+// AudioDeviceReport is the result of the startup device check
+type AudioDeviceReport struct {
+	Devices    []AudioDeviceInfo `json:"devices"`
+	Input      string            `json:"input"`  // Device that will be used
+	Output     string            `json:"output"` // Device that will be used
+	SampleRate int               `json:"sampleRate"`
+	Warnings   []string          `json:"warnings"`
+	CheckedAt  time.Time         `json:"checkedAt"`
+}
+
+var (
+	// Devices picked by the last check, nil = system default
+	selectedInput  *portaudio.DeviceInfo
+	selectedOutput *portaudio.DeviceInfo
+	selectedMutex  sync.Mutex
+
+	// Set while the playback device is being recovered
+	outputRecovering atomic.Bool
+
+	// Only touched by the (single) recovery goroutine
+	outputBackoff      time.Duration
+	lastOutputRecovery time.Time
+
+	// Pending rescan after a device change notification
+	deviceChangeTimer *time.Timer
+	deviceChangeMutex sync.Mutex
+)
+
+// refreshAudioDevices re-runs the device check against the configured
+// devices, logs the report and publishes it to the UI
+func refreshAudioDevices() AudioDeviceReport {
+	var inputName, outputName string
+	if currentConfig != nil {
+		inputName = currentConfig.Audio.InputDevice
+		outputName = currentConfig.Audio.OutputDevice
+	}
+
+	report := checkAudioDevices(inputName, outputName)
+	logAudioDeviceReport(report)
+	appState.SetAudioDeviceReport(report)
+	return report
+}
+
+// checkAudioDevices enumerates devices, confirms the configured (or default)
+// input and output exist and handle our sample rate, and picks what to open.
+// A missing or unusable configured device falls back to the default with a warning.
+func checkAudioDevices(inputName, outputName string) AudioDeviceReport {
+	report := AudioDeviceReport{SampleRate: sampleRate, CheckedAt: time.Now()}
+
+	devices, err := portaudio.Devices()
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("Could not list audio devices: %v", err))
+		return report
+	}
+	defaultHostAPI, _ := portaudio.DefaultHostApi()
+
+	var input, output *portaudio.DeviceInfo
+	for _, device := range devices {
+		info := AudioDeviceInfo{
+			Name:              device.Name,
+			Inputs:            device.MaxInputChannels,
+			Outputs:           device.MaxOutputChannels,
+			DefaultSampleRate: device.DefaultSampleRate,
+			InputOK:           deviceSupportsRate(device, true),
+			OutputOK:          deviceSupportsRate(device, false),
+		}
+		if device.HostApi != nil {
+			info.HostAPI = device.HostApi.Name
+		}
+		report.Devices = append(report.Devices, info)
+
+		// Windows lists each device once per host API - prefer the default API's entry
+		onDefaultAPI := defaultHostAPI != nil && device.HostApi == defaultHostAPI
+		if inputName != "" && device.Name == inputName && device.MaxInputChannels > 0 && (input == nil || onDefaultAPI) {
+			input = device
+		}
+		if outputName != "" && device.Name == outputName && device.MaxOutputChannels > 0 && (output == nil || onDefaultAPI) {
+			output = device
+		}
+	}
+
+	input = validateSelectedDevice(&report, "input", inputName, input, true)
+	output = validateSelectedDevice(&report, "output", outputName, output, false)
+
+	selectedMutex.Lock()
+	selectedInput = input
+	selectedOutput = output
+	selectedMutex.Unlock()
+
+	report.Input = describeSelectedDevice(input, true)
+	report.Output = describeSelectedDevice(output, false)
+	return report
+}
+
+// validateSelectedDevice returns the configured device if usable, otherwise nil (default) with a warning
+func validateSelectedDevice(report *AudioDeviceReport, kind, name string, device *portaudio.DeviceInfo, input bool) *portaudio.DeviceInfo {
+	if name != "" {
+		switch {
+		case device == nil:
+			report.Warnings = append(report.Warnings,
+				fmt.Sprintf("Configured %s device %q not found, using system default", kind, name))
+		case !deviceSupportsRate(device, input):
+			report.Warnings = append(report.Warnings,
+				fmt.Sprintf("Configured %s device %q does not support %d Hz, using system default", kind, name, sampleRate))
+			device = nil
+		default:
+			return device
+		}
+	}
+
+	// Falling back (or never configured) - make sure the default is sane too
+	var fallback *portaudio.DeviceInfo
+	if input {
+		fallback, _ = portaudio.DefaultInputDevice()
+	} else {
+		fallback, _ = portaudio.DefaultOutputDevice()
+	}
+	if fallback == nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("No default %s device", kind))
+	} else if !deviceSupportsRate(fallback, input) {
+		report.Warnings = append(report.Warnings,
+			fmt.Sprintf("Default %s device %q does not support %d Hz", kind, fallback.Name, sampleRate))
+	}
+	return nil
+}
+
+// deviceSupportsRate checks whether a device can open a 16-bit stream at our sample rate
+func deviceSupportsRate(device *portaudio.DeviceInfo, input bool) bool {
+	if device == nil {
+		return false
+	}
+
+	var params portaudio.StreamParameters
+	if input {
+		if device.MaxInputChannels < 1 {
+			return false
+		}
+		params = portaudio.LowLatencyParameters(device, nil)
+		params.Input.Channels = 1
+	} else {
+		if device.MaxOutputChannels < 1 {
+			return false
+		}
+		params = portaudio.LowLatencyParameters(nil, device)
+		params.Output.Channels = 1
+	}
+	params.SampleRate = sampleRate
+
+	return portaudio.IsFormatSupported(params, make([]int16, 1)) == nil
+}
+
+// describeSelectedDevice names the device that will actually be opened
+func describeSelectedDevice(device *portaudio.DeviceInfo, input bool) string {
+	if device != nil {
+		return device.Name
+	}
+
+	var fallback *portaudio.DeviceInfo
+	if input {
+		fallback, _ = portaudio.DefaultInputDevice()
+	} else {
+		fallback, _ = portaudio.DefaultOutputDevice()
+	}
+	if fallback == nil {
+		return "none"
+	}
+	return fallback.Name + " (default)"
+}
+
+// logAudioDeviceReport writes the device report to the log and surfaces warnings to the user
+func logAudioDeviceReport(report AudioDeviceReport) {
+	logger.Info("Audio devices found: %d", len(report.Devices))
+	for _, device := range report.Devices {
+		logger.Info("  [%s] %s - in:%d out:%d default:%.0fHz %dHz in:%t out:%t",
+			device.HostAPI, device.Name, device.Inputs, device.Outputs,
+			device.DefaultSampleRate, report.SampleRate, device.InputOK, device.OutputOK)
+	}
+	logger.Info("Selected input: %s", report.Input)
+	logger.Info("Selected output: %s", report.Output)
+
+	for _, warning := range report.Warnings {
+		logger.Warn("Audio device check: %s", warning)
+		appState.AddMessage(warning, "error")
+	}
+}
+
+// openInputStream opens the selected input device, or the default if none is selected or it fails
+func openInputStream(frames int, in []int16) (*portaudio.Stream, error) {
+	selectedMutex.Lock()
+	device := selectedInput
+	selectedMutex.Unlock()
+
+	if device != nil {
+		params := portaudio.LowLatencyParameters(device, nil)
+		params.Input.Channels = 1
+		params.SampleRate = sampleRate
+		params.FramesPerBuffer = frames
+
+		stream, err := portaudio.OpenStream(params, in)
+		if err == nil {
+			return stream, nil
+		}
+		logger.Warn("Input device %q failed (%v), using default", device.Name, err)
+	}
+
+	return portaudio.OpenDefaultStream(1, 0, sampleRate, frames, in)
+}
+
+// openOutputStream opens the selected output device, then the default, then
+// the first other device that can play the requested channel count
+func openOutputStream(channels, frames int, out *[]int16) (*portaudio.Stream, error) {
+	selectedMutex.Lock()
+	device := selectedOutput
+	selectedMutex.Unlock()
+
+	if device != nil && device.MaxOutputChannels >= channels {
+		params := portaudio.LowLatencyParameters(nil, device)
+		params.Output.Channels = channels
+		params.SampleRate = sampleRate
+		params.FramesPerBuffer = frames
+
+		stream, err := portaudio.OpenStream(params, out)
+		if err == nil {
+			return stream, nil
+		}
+		logger.Warn("Output device %q failed (%v), using default", device.Name, err)
+	}
+
+	stream, defaultErr := portaudio.OpenDefaultStream(0, channels, sampleRate, frames, out)
+	if defaultErr == nil {
+		return stream, nil
+	}
+	logger.Warn("Default output device unavailable: %v", defaultErr)
+
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("default output failed (%v) and devices could not be listed: %v", defaultErr, err)
+	}
+
+	for _, device := range devices {
+		if device.MaxOutputChannels < channels {
+			continue
+		}
+
+		params := portaudio.LowLatencyParameters(nil, device)
+		params.Output.Channels = channels
+		params.SampleRate = sampleRate
+		params.FramesPerBuffer = frames
+
+		stream, err := portaudio.OpenStream(params, out)
+		if err != nil {
+			logger.Debug("Output device %q failed: %v", device.Name, err)
+			continue
+		}
+		logger.Info("Using fallback output device: %s", device.Name)
+		return stream, nil
+	}
+
+	return nil, fmt.Errorf("no usable output device: %v", defaultErr)
+}
+
+// outputFailoverEnabled reports whether a lost output device should be reopened automatically
+func outputFailoverEnabled() bool {
+	return currentConfig == nil || currentConfig.Audio.OutputFailover
+}
+
+// failoverMaxBackoff returns the configured ceiling between reopen attempts
+func failoverMaxBackoff() time.Duration {
+	if currentConfig != nil && currentConfig.Audio.FailoverMaxBackoffMs > 0 {
+		return time.Duration(currentConfig.Audio.FailoverMaxBackoffMs) * time.Millisecond
+	}
+	return outputFailoverMaxBackoff
+}
+
+// recoverOutputDevice restarts audio after the output device went away,
+// retrying with exponential backoff until a device opens or the app exits.
+// Called from the playback goroutine, which must return right after.
+func recoverOutputDevice(cause error) {
+	if !outputRecovering.CompareAndSwap(false, true) {
+		return
+	}
+	defer outputRecovering.Store(false)
+
+	logger.Warn("Audio output lost (%v), attempting to reopen", cause)
+	appState.AddMessage("Audio output lost - trying to reconnect device...", "error")
+
+	// A device that fails again soon after recovering keeps backing off instead of
+	// starting over, so a flapping headset can't make us spin
+	maxBackoff := failoverMaxBackoff()
+	if time.Since(lastOutputRecovery) > outputStableAfter {
+		outputBackoff = outputFailoverMinBackoff
+	} else {
+		outputBackoff = min(outputBackoff*2, maxBackoff)
+	}
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-appCtx.Done():
+			return
+		case <-time.After(outputBackoff):
+		}
+
+		StopAudio()
+
+		// PortAudio only rescans devices on initialize, so a re-plugged or
+		// newly-default device is invisible without this
+		if err := portaudio.Terminate(); err != nil {
+			logger.Debug("PortAudio terminate during recovery: %v", err)
+		}
+		if err := portaudio.Initialize(); err != nil {
+			logger.Error("PortAudio re-initialize failed: %v", err)
+			outputBackoff = min(outputBackoff*2, maxBackoff)
+			continue
+		}
+
+		// Device info from before the re-init is stale
+		refreshAudioDevices()
+
+		err := startAudio()
+		if err == nil {
+			lastOutputRecovery = time.Now()
+			logger.Info("Audio output recovered after %d attempt(s)", attempt)
+			appState.AddMessage("Audio output restored", "info")
+			return
+		}
+
+		outputBackoff = min(outputBackoff*2, maxBackoff)
+		logger.Warn("Audio output reopen attempt %d failed: %v (retrying in %v)", attempt, err, outputBackoff)
+	}
+}
+
+// followDeviceChangesEnabled reports whether plugging or removing a device should reopen audio
+func followDeviceChangesEnabled() bool {
+	return currentConfig == nil || currentConfig.Audio.FollowDeviceChanges
+}
+
+// onAudioDeviceChange is called from the window procedure when an audio device
+// is added or removed. It only (re)arms a timer so the message loop never blocks.
+func onAudioDeviceChange() {
+	deviceChangeMutex.Lock()
+	defer deviceChangeMutex.Unlock()
+
+	if deviceChangeTimer != nil {
+		deviceChangeTimer.Reset(deviceChangeSettle)
+		return
+	}
+	deviceChangeTimer = time.AfterFunc(deviceChangeSettle, handleAudioDeviceChange)
+}
+
+// handleAudioDeviceChange runs once the device notifications settle
+func handleAudioDeviceChange() {
+	if appCtx.Err() != nil {
+		return
+	}
+
+	if !followDeviceChangesEnabled() {
+		logger.Info("Audio devices changed, follow_device_changes is off - not reopening")
+		appState.AddMessage("Audio devices changed - use /rescan_audio to switch", "info")
+		return
+	}
+
+	if err := rescanAudioDevices(); err != nil {
+		appState.AddMessage(fmt.Sprintf("Audio devices changed but audio could not restart: %v", err), "error")
+	}
+}
+
+// rescanAudioDevices re-initializes PortAudio so added and removed devices are
+// seen, picks devices again and reopens the streams
+func rescanAudioDevices() error {
+	// Shares the recovery guard: both tear down PortAudio, so only one may run
+	if !outputRecovering.CompareAndSwap(false, true) {
+		logger.Info("Audio device rescan skipped - output recovery already in progress")
+		return nil
+	}
+	defer outputRecovering.Store(false)
+
+	logger.Info("Rescanning audio devices")
+	StopAudio()
+
+	// PortAudio only sees devices that existed when it was initialized
+	if err := portaudio.Terminate(); err != nil {
+		logger.Debug("PortAudio terminate during rescan: %v", err)
+	}
+	if err := portaudio.Initialize(); err != nil {
+		logger.Error("PortAudio re-initialize failed: %v", err)
+		return err
+	}
+
+	report := refreshAudioDevices()
+	if err := startAudio(); err != nil {
+		logger.Error("Failed to reopen audio after device rescan: %v", err)
+		return err
+	}
+
+	logger.Info("Audio reopened after device rescan: input=%s, output=%s", report.Input, report.Output)
+	appState.AddMessage(fmt.Sprintf("Audio devices changed - using %s / %s", report.Input, report.Output), "info")
+	return nil
+}
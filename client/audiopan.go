@@ -0,0 +1,299 @@
+// FILE: client/audiopan.go
+package main
+
+import (
+	"ahcli/common/logger"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// audioFrame is one frame of mono audio queued for playback.
+// source is the talker's server-assigned ID, 0 for local sounds or untagged packets.
+type audioFrame struct {
+	source  uint16
+	samples []int16
+	pooled  bool // samples came from receivedFrames and go back once played
+	local   bool // Generated here (courtesy beeps): never ducked
+}
+
+// talkerKey tells apart the streams mixed in playback: each network source,
+// untagged audio (source 0) and local sounds
+type talkerKey struct {
+	source uint16
+	local  bool
+}
+
+// talkerQueues holds received frames per talker until playback mixes one from each.
+// A talker who starts sending is held back until warmup frames are queued, or
+// the first has waited that long, so network jitter eats into a cushion
+// rather than causing an underrun on the next late packet.
+type talkerQueues struct {
+	frames  map[talkerKey][]audioFrame
+	order   []talkerKey // Talkers with frames queued, in arrival order
+	limit   int         // Most frames held per talker
+	warmup  int         // Frames a talker builds up before playing (1 = none)
+	warming map[talkerKey]time.Time
+}
+
+// alwaysReady is a closed channel, for select cases that should fire at once
+var alwaysReady = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+func newTalkerQueues(limit int) *talkerQueues {
+	return &talkerQueues{
+		frames:  make(map[talkerKey][]audioFrame),
+		limit:   limit,
+		warmup:  1,
+		warming: make(map[talkerKey]time.Time),
+	}
+}
+
+// push queues a frame behind its talker's earlier ones. Talkers filtered out by
+// the listen lists are dropped unheard, and a talker running too far ahead
+// loses its oldest frame.
+func (q *talkerQueues) push(frame audioFrame) {
+	if !listeningToSource(frame.source) {
+		recycleFrame(frame)
+		return
+	}
+
+	key := talkerKey{source: frame.source, local: frame.local}
+	queue, ok := q.frames[key]
+	if !ok {
+		q.order = append(q.order, key)
+		// Local sounds play at once; received audio warms up each time it starts
+		if !frame.local && q.warmup > 1 {
+			q.warming[key] = time.Now()
+		}
+	}
+	if len(queue) >= q.limit {
+		recycleFrame(queue[0])
+		queue = queue[1:]
+		if !frame.local {
+			countOutputDrop()
+		}
+	}
+	q.frames[key] = append(queue, frame)
+}
+
+// pending reports whether any talker has a frame queued
+func (q *talkerQueues) pending() bool {
+	return len(q.order) > 0
+}
+
+// ready reports whether a talker has a frame to play now, ending the warm-up
+// of any talker whose cushion is full or who has waited long enough
+func (q *talkerQueues) ready(now time.Time) bool {
+	ready := false
+	for _, key := range q.order {
+		if since, ok := q.warming[key]; ok {
+			if len(q.frames[key]) < q.warmup && now.Sub(since) < q.warmupWait() {
+				continue
+			}
+			delete(q.warming, key)
+		}
+		ready = true
+	}
+	return ready
+}
+
+// warmingUntil returns when the next warming talker starts playing at the
+// latest, or false if none is warming
+func (q *talkerQueues) warmingUntil() (time.Time, bool) {
+	var until time.Time
+	for _, since := range q.warming {
+		if t := since.Add(q.warmupWait()); until.IsZero() || t.Before(until) {
+			until = t
+		}
+	}
+	return until, !until.IsZero()
+}
+
+// warmupWait is how long a talker's first frame waits for the cushion to fill
+func (q *talkerQueues) warmupWait() time.Duration {
+	return time.Duration(q.warmup) * frameDuration()
+}
+
+// popEach appends the oldest frame of every talker done warming up to dst.
+// Talkers whose queue runs dry are forgotten until they send again.
+func (q *talkerQueues) popEach(dst []audioFrame) []audioFrame {
+	q.ready(time.Now())
+	kept := q.order[:0]
+	for _, key := range q.order {
+		queue := q.frames[key]
+		if _, ok := q.warming[key]; ok {
+			kept = append(kept, key)
+			continue
+		}
+		dst = append(dst, queue[0])
+		if len(queue) == 1 {
+			delete(q.frames, key)
+			continue
+		}
+		q.frames[key] = queue[1:]
+		kept = append(kept, key)
+	}
+	q.order = kept
+	return dst
+}
+
+// clear drops everything queued
+func (q *talkerQueues) clear() {
+	for key, queue := range q.frames {
+		for _, frame := range queue {
+			recycleFrame(frame)
+		}
+		delete(q.frames, key)
+	}
+	clear(q.warming)
+	q.order = q.order[:0]
+}
+
+// recycleFrame returns a frame's samples to the pool if they came from it
+func recycleFrame(frame audioFrame) {
+	if frame.pooled {
+		putReceivedFrame(frame.samples)
+	}
+}
+
+// receivedFrames recycles decoded network frames between the reader and playback,
+// so steady-state receive doesn't allocate. Channel-backed so Put/Get never allocate.
+var receivedFrames = make(chan []int16, cap(incomingAudio)+8)
+
+// getReceivedFrame returns an n-sample buffer, recycled when one is available
+func getReceivedFrame(n int) []int16 {
+	select {
+	case frame := <-receivedFrames:
+		if cap(frame) >= n {
+			return frame[:n]
+		}
+	default:
+	}
+	return make([]int16, n)
+}
+
+// putReceivedFrame hands a played frame back for reuse
+func putReceivedFrame(frame []int16) {
+	select {
+	case receivedFrames <- frame:
+	default:
+	}
+}
+
+// Static pan positions offered in the UI
+var panPositions = map[string]float64{
+	"left":   -1.0,
+	"center": 0.0,
+	"right":  1.0,
+}
+
+var (
+	// Audio source ID -> nickname, from the server's user updates
+	sourceNames      = make(map[uint16]string)
+	sourceNamesMutex sync.RWMutex
+)
+
+// setSourceIDs replaces the source ID mapping (nickname -> ID as sent by the server)
+func setSourceIDs(ids map[string]uint16) {
+	if ids == nil {
+		return
+	}
+
+	names := make(map[uint16]string, len(ids))
+	for nick, id := range ids {
+		names[id] = nick
+	}
+
+	sourceNamesMutex.Lock()
+	sourceNames = names
+	sourceNamesMutex.Unlock()
+}
+
+// sourceName returns the nickname for an audio source ID, or "" if unknown
+func sourceName(source uint16) string {
+	sourceNamesMutex.RLock()
+	defer sourceNamesMutex.RUnlock()
+	return sourceNames[source]
+}
+
+// parsePanPosition converts "left"/"center"/"right" to a pan value
+func parsePanPosition(position string) (float64, error) {
+	pan, ok := panPositions[position]
+	if !ok {
+		return 0, fmt.Errorf("unknown pan position %q (use left, center or right)", position)
+	}
+	return pan, nil
+}
+
+// panToStereo writes a mono frame into an interleaved stereo buffer.
+// pan runs from -1 (left) through 0 (center, both channels full) to 1 (right).
+func panToStereo(out, samples []int16, pan float64) {
+	leftGain, rightGain := panGains(pan)
+
+	for i, s := range samples {
+		if 2*i+1 >= len(out) {
+			break
+		}
+		out[2*i] = int16(float64(s) * leftGain)
+		out[2*i+1] = int16(float64(s) * rightGain)
+	}
+}
+
+// userPanForSource returns the configured pan for whoever sent a frame
+func userPanForSource(source uint16) float64 {
+	if source == 0 {
+		return 0
+	}
+	nick := sourceName(source)
+	if nick == "" {
+		return 0
+	}
+	return appState.GetUserPan(nick)
+}
+
+// setUserPan sets a talker's stereo position and saves it to the config
+func setUserPan(nickname, position string) {
+	pan, err := parsePanPosition(position)
+	if err != nil {
+		logger.Warn("Invalid pan for %s: %v", nickname, err)
+		appState.AddMessage(err.Error(), "error")
+		return
+	}
+
+	logger.Info("Panning %s to %s", nickname, position)
+	appState.SetUserPan(nickname, pan)
+
+	if currentConfig == nil {
+		return
+	}
+	currentConfig.Audio.Pan = appState.GetUserPans()
+	if err := saveClientConfig("settings.config", currentConfig); err != nil {
+		logger.Error("Failed to save pan settings: %v", err)
+	}
+}
+
+// setStereoOutput switches playback between mono and stereo, restarting the streams
+func setStereoOutput(stereo bool) {
+	if appState.IsStereoOutput() == stereo {
+		return
+	}
+
+	logger.Info("Setting stereo output to: %t", stereo)
+	appState.SetStereoOutput(stereo)
+
+	if currentConfig != nil {
+		currentConfig.Audio.Stereo = stereo
+		if err := saveClientConfig("settings.config", currentConfig); err != nil {
+			logger.Error("Failed to save stereo setting: %v", err)
+		}
+	}
+
+	if err := RestartAudio(); err != nil {
+		logger.Error("Failed to restart audio for stereo change: %v", err)
+		appState.AddMessage("Audio restart failed", "error")
+	}
+}
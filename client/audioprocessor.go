@@ -4,6 +4,8 @@ package main
 import (
 	"ahcli/common/logger"
 	"container/list"
+	"math"
+	"slices"
 	"sync"
 	"time"
 )
@@ -24,6 +26,11 @@ type NoiseGate struct {
 	releaseTime time.Duration // 50ms
 	holdTime    time.Duration // 100ms
 
+	// Lookahead: the level is measured on incoming samples, but the samples
+	// themselves leave through this delay line, so the gate is already open
+	// when a word's first transient comes out
+	delay delayLine
+
 	// State
 	gateOpen   bool
 	holdTimer  time.Time
@@ -31,6 +38,37 @@ type NoiseGate struct {
 	lastSample float32
 }
 
+// delayLine delays samples by its length, starting from silence
+type delayLine struct {
+	buf []int16
+	pos int
+}
+
+// resize sets the delay in samples, clearing it if the length changes
+func (d *delayLine) resize(n int) {
+	if n != len(d.buf) {
+		d.buf = make([]int16, n)
+		d.pos = 0
+	}
+}
+
+// clear refills the delay with silence, keeping its length
+func (d *delayLine) clear() {
+	clear(d.buf)
+	d.pos = 0
+}
+
+// push stores a sample and returns the one from len(buf) samples ago
+func (d *delayLine) push(sample int16) int16 {
+	if len(d.buf) == 0 {
+		return sample
+	}
+	out := d.buf[d.pos]
+	d.buf[d.pos] = sample
+	d.pos = (d.pos + 1) % len(d.buf)
+	return out
+}
+
 // DynamicCompressor smooths out volume variations
 type DynamicCompressor struct {
 	threshold   float32       // -18dB
@@ -50,6 +88,64 @@ type MakeupGain struct {
 	gainLinear float32 // Calculated linear gain
 }
 
+// SilenceSuppressor stops transmission while the talker is silent
+type SilenceSuppressor struct {
+	thresholdDB float32       // Frames quieter than this count as silence
+	hangover    time.Duration // Keep sending this long after speech stops
+
+	// State
+	silentSince time.Time // Zero while speech is present
+	suppressing bool
+}
+
+// ComfortNoise fills receive-side gaps with low-level noise at the talker's
+// background level, so suppressed or gated silence doesn't sound like a dropout
+type ComfortNoise struct {
+	fallbackDB float32       // Used until a talker's floor is estimated
+	maxGap     time.Duration // Stop filling after this long without audio
+
+	// State
+	floors map[uint16]*noiseFloor // By source ID; 0 for servers that don't send one
+	seed   uint32
+}
+
+// noiseFloor is one talker's background level and whether they're mid-transmission
+type noiseFloor struct {
+	levelDB   float32 // Running estimate from quiet received frames
+	estimated bool
+	heard     time.Time // Last real audio
+	ended     time.Time // Last end of transmission, zero if never
+}
+
+// Frames still queued when a talker's end of transmission arrives don't
+// restart the gap filling
+const transmitEndGrace = 500 * time.Millisecond
+
+// Talkers not heard from for this long are forgotten
+const noiseFloorRetention = 10 * time.Minute
+
+// Ducker lowers received audio while we transmit, so on speakers our own voice
+// dominates locally. Gain changes ramp across a frame to avoid clicks.
+type Ducker struct {
+	gain    float32 // Linear gain while transmitting
+	current float32 // Gain reached at the end of the last frame
+}
+
+// Attenuation when duck_on_transmit doesn't set gain_db
+const defaultDuckGainDB = -12.0
+
+// arrivalTracker measures RFC 3550 interarrival jitter for each talker
+type arrivalTracker struct {
+	sources map[uint16]*sourceArrival
+	jitter  float64 // Smoothed jitter estimate in seconds
+}
+
+// sourceArrival is the last packet seen from one talker
+type sourceArrival struct {
+	seq     uint16
+	arrival time.Time
+}
+
 // JitterBuffer handles packet reordering and timing
 type JitterBuffer struct {
 	sync.RWMutex
@@ -72,7 +168,10 @@ type JitterBuffer struct {
 
 	// Output timing
 	nextPlayTime time.Time
-	playInterval time.Duration // 20ms (960 samples @ 48kHz)
+	playInterval time.Duration // One audio frame, 20ms by default
+
+	// Packets trimmed from the buffer, reused for the next arrivals
+	spare []*AudioPacket
 }
 
 // AudioProcessor handles the complete audio processing chain
@@ -81,9 +180,25 @@ type AudioProcessor struct {
 	noiseGate  *NoiseGate
 	compressor *DynamicCompressor
 	makeupGain *MakeupGain
+	highPass   *HighPassFilter
+
+	// Stages run in order on every input frame; swapped whole by SetProcessingChain
+	chainMu         sync.RWMutex
+	processingChain []Stage
+	chainNames      []string // What processingChain was built from
+
+	// Transmit-side silence suppression
+	silenceSuppressor *SilenceSuppressor
+
+	// Receive-side gap filling
+	comfortNoise *ComfortNoise
+
+	// Listener's own cleanup of received audio
+	receive *ReceiveProcessor
 
 	// Network buffering
 	jitterBuffer *JitterBuffer
+	arrivals     *arrivalTracker
 
 	// Settings
 	enableNoiseGate    bool
@@ -91,9 +206,32 @@ type AudioProcessor struct {
 	enableMakeupGain   bool
 	enableJitterBuffer bool
 
+	enableSilenceSuppression bool
+	enableComfortNoise       bool
+
+	// Playback attenuation while transmitting
+	ducker        *Ducker
+	enableDucking bool
+
 	// NEW: Bypass functionality
 	bypassProcessing bool
 
+	// Dry/wet blend of raw and processed input: 0 = raw, 1 = fully processed
+	mix float32
+
+	// The raw input delayed to line up with audio that went through the gate's
+	// lookahead, so a partial mix doesn't comb filter
+	dryDelay   delayLine
+	gateDelay  int // Samples the gate delayed the current frame by
+	delayedBuf []int16
+
+	// Where the quality rating draws its lines; guarded by stats
+	quality QualityThresholds
+
+	// Reused frame buffers; each is only valid until the next call that returns it
+	processBuf []int16 // ProcessInputAudio output
+	noiseBuf   []int16 // GenerateComfortNoise output
+
 	// Statistics - INTERNAL ONLY (with mutex for thread safety)
 	stats audioStatsInternal
 }
@@ -137,13 +275,7 @@ func NewAudioProcessor() *AudioProcessor {
 	logger.Info("Creating new audio processor with premium settings")
 
 	processor := &AudioProcessor{
-		noiseGate: &NoiseGate{
-			threshold:   -40.0, // dB
-			attackTime:  2 * time.Millisecond,
-			releaseTime: 50 * time.Millisecond,
-			holdTime:    100 * time.Millisecond,
-			envelope:    0.0,
-		},
+		noiseGate: newNoiseGate(-40.0),
 		compressor: &DynamicCompressor{
 			threshold:   -18.0, // dB
 			ratio:       3.0,   // 3:1 compression
@@ -156,12 +288,29 @@ func NewAudioProcessor() *AudioProcessor {
 			gainDB:     6.0, // +6dB default
 			gainLinear: 2.0, // Calculated from gainDB
 		},
+		highPass: newHighPassFilter(defaultHighPassCutoff),
+		receive:  newReceiveProcessor(),
+		silenceSuppressor: &SilenceSuppressor{
+			thresholdDB: -50.0,
+			hangover:    300 * time.Millisecond,
+		},
+		ducker: &Ducker{gain: powf(10, defaultDuckGainDB/20), current: 1},
+		comfortNoise: &ComfortNoise{
+			fallbackDB: -60.0,
+			maxGap:     3 * time.Second,
+			floors:     make(map[uint16]*noiseFloor),
+			seed:       uint32(time.Now().UnixNano()) | 1,
+		},
+		arrivals: &arrivalTracker{
+			sources: make(map[uint16]*sourceArrival),
+		},
+		quality: defaultQualityThresholds,
 		jitterBuffer: &JitterBuffer{
 			buffer:        list.New(),
 			bufferTime:    60 * time.Millisecond,
 			maxBuffer:     200 * time.Millisecond,
 			minBuffer:     20 * time.Millisecond,
-			targetLatency: 80 * time.Millisecond,
+			targetLatency: defaultJitterTarget,
 			playInterval:  20 * time.Millisecond, // 960 samples @ 48kHz
 		},
 		enableNoiseGate:    true,  // Was false
@@ -171,38 +320,43 @@ func NewAudioProcessor() *AudioProcessor {
 
 		// NEW: Initialize bypass to false
 		bypassProcessing: false,
+
+		mix: 1.0,
 	}
 
+	processor.processingChain, _ = buildProcessingChain(processor, nil)
+
 	logger.Debug("Audio processor initialized - NoiseGate: %t, Compressor: %t, MakeupGain: %t, JitterBuffer: %t",
 		processor.enableNoiseGate, processor.enableCompressor, processor.enableMakeupGain, processor.enableJitterBuffer)
 
 	return processor
 }
 
-// ProcessInputAudio processes audio from microphone before transmission
+// ProcessInputAudio processes audio from microphone before transmission.
+// The returned frame is reused by the next call.
 func (ap *AudioProcessor) ProcessInputAudio(samples []int16) []int16 {
 	if len(samples) == 0 {
 		logger.Debug("Empty audio samples received, returning as-is")
 		return samples
 	}
 
-	processed := make([]int16, len(samples))
+	// Work on a reused copy so the caller's frame stays intact for the stats
+	ap.processBuf = reuseFrame(ap.processBuf, len(samples))
+	processed := ap.processBuf
 	copy(processed, samples)
 
-	// Stage 1: Noise Gate
-	if ap.enableNoiseGate {
-		processed = ap.applyNoiseGate(processed)
-	}
-
-	// Stage 2: Dynamic Compressor
-	if ap.enableCompressor {
-		processed = ap.applyCompressor(processed)
+	if ap.IsBypassed() {
+		return processed
 	}
+	ap.gateDelay = 0
 
-	// Stage 3: Makeup Gain
-	if ap.enableMakeupGain {
-		processed = ap.applyMakeupGain(processed)
+	// The lock also covers the delay lines, which settings changes resize
+	ap.chainMu.RLock()
+	for _, stage := range ap.processingChain {
+		processed = stage.Process(processed)
 	}
+	ap.blendDry(samples, processed)
+	ap.chainMu.RUnlock()
 
 	// Update input statistics
 	ap.updateInputStats(samples, processed)
@@ -210,10 +364,109 @@ func (ap *AudioProcessor) ProcessInputAudio(samples []int16) []int16 {
 	return processed
 }
 
-// applyMakeupGain applies makeup gain to compensate for compression
-func (ap *AudioProcessor) applyMakeupGain(samples []int16) []int16 {
+// SetProcessingChain replaces the input stages with the named ones, in order.
+// An empty list restores the default gate -> compressor -> makeup chain.
+func (ap *AudioProcessor) SetProcessingChain(names []string) error {
+	chain, err := buildProcessingChain(ap, names)
+	if err != nil {
+		return err
+	}
+
+	ap.chainMu.Lock()
+	ap.processingChain = chain
+	ap.chainNames = slices.Clone(names)
+	ap.chainMu.Unlock()
+
+	logger.Debug("Processing chain set to %v (%d stages)", names, len(chain))
+	return nil
+}
+
+// testCopy returns a processor with ap's input settings and fresh state, so a
+// test signal can go through the chain without touching the live capture
+// path's buffers, gate or delay lines
+func (ap *AudioProcessor) testCopy() *AudioProcessor {
+	c := NewAudioProcessor()
+	c.enableNoiseGate = ap.enableNoiseGate
+	c.enableCompressor = ap.enableCompressor
+	c.enableMakeupGain = ap.enableMakeupGain
+	c.bypassProcessing = ap.IsBypassed()
+	c.mix = ap.mix
+
+	c.noiseGate = newNoiseGate(ap.noiseGate.threshold)
+	ap.chainMu.RLock()
+	c.noiseGate.delay.resize(ap.noiseGate.Lookahead())
+	ap.chainMu.RUnlock()
+	compressor := *ap.compressor
+	compressor.envelope, compressor.gainReduction = 0, 0
+	c.compressor = &compressor
+	makeup := *ap.makeupGain
+	c.makeupGain = &makeup
+	c.highPass.alpha = ap.highPass.alpha
+
+	ap.chainMu.RLock()
+	names := ap.chainNames
+	ap.chainMu.RUnlock()
+	if err := c.SetProcessingChain(names); err != nil {
+		logger.Debug("Test processor keeps the default chain: %v", err)
+	}
+	return c
+}
+
+// SetMix sets the dry/wet blend, clamped to [0,1]
+func (ap *AudioProcessor) SetMix(mix float32) {
+	ap.mix = clampMix(mix)
+	logger.Debug("Processing mix set to %.0f%%", ap.mix*100)
+}
+
+// clampMix keeps a dry/wet mix within [0,1]
+func clampMix(mix float32) float32 {
+	if mix < 0 {
+		return 0
+	}
+	if mix > 1 {
+		return 1
+	}
+	return mix
+}
+
+// blendDry mixes the raw input back into the processed frame, in place.
+// The endpoints are exact: 1 leaves the processed frame alone, 0 restores the raw one.
+func (ap *AudioProcessor) blendDry(raw, processed []int16) {
+	mix := ap.mix
+	switch {
+	case mix >= 1:
+		return
+	case mix <= 0:
+		copy(processed, raw)
+		return
+	}
+
+	if ap.gateDelay > 0 {
+		ap.dryDelay.resize(ap.gateDelay)
+		ap.delayedBuf = reuseFrame(ap.delayedBuf, len(raw))
+		for i, sample := range raw {
+			ap.delayedBuf[i] = ap.dryDelay.push(sample)
+		}
+		raw = ap.delayedBuf
+	}
+
+	dry := 1 - mix
+	for i, sample := range processed {
+		processed[i] = int16(float32(raw[i])*dry + float32(sample)*mix)
+	}
+}
+
+// reuseFrame returns buf resized to n samples, allocating only when it is too small
+func reuseFrame(buf []int16, n int) []int16 {
+	if cap(buf) < n {
+		return make([]int16, n)
+	}
+	return buf[:n]
+}
+
+// applyMakeupGain applies makeup gain to compensate for compression, in place
+func (ap *AudioProcessor) applyMakeupGain(samples []int16) {
 	mg := ap.makeupGain
-	processed := make([]int16, len(samples))
 
 	// Convert dB to linear gain if needed
 	if mg.gainLinear == 0 {
@@ -232,10 +485,8 @@ func (ap *AudioProcessor) applyMakeupGain(samples []int16) []int16 {
 			gained = -32767
 		}
 
-		processed[i] = int16(gained)
+		samples[i] = int16(gained)
 	}
-
-	return processed
 }
 
 // AddToJitterBuffer adds a received packet to the jitter buffer
@@ -246,16 +497,44 @@ func (ap *AudioProcessor) AddToJitterBuffer(seqNum uint16, data []int16) {
 		return
 	}
 
-	packet := &AudioPacket{
-		SeqNum:    seqNum,
-		Timestamp: uint32(time.Now().UnixNano() / 1000000), // milliseconds
-		Data:      data,
-		Size:      len(data),
-		Received:  time.Now(),
+	logger.Debug("Adding packet %d to jitter buffer (%d samples)", seqNum, len(data))
+	ap.jitterBuffer.addFrame(seqNum, data, time.Now())
+}
+
+// RecordArrival feeds a received packet's arrival time into the RFC 3550
+// interarrival jitter estimate. Senders emit one packet per frame, so the
+// expected spacing is the sequence difference times the frame duration.
+func (ap *AudioProcessor) RecordArrival(source, seqNum uint16, arrival time.Time) {
+	ap.stats.Lock()
+	defer ap.stats.Unlock()
+
+	tracker := ap.arrivals
+	last, ok := tracker.sources[source]
+	if !ok {
+		tracker.sources[source] = &sourceArrival{seq: seqNum, arrival: arrival}
+		return
+	}
+
+	frame := frameDuration()
+	seqDelta := int16(seqNum - last.seq) // Wraps correctly across 65535 -> 0
+	arrivalDelta := arrival.Sub(last.arrival)
+
+	// Duplicates/reordered packets say nothing about spacing, and a long silence
+	// (PTT released, suppressed silence) starts a new talk spurt - neither updates the estimate
+	if seqDelta <= 0 {
+		return
+	}
+	last.seq, last.arrival = seqNum, arrival
+	if arrivalDelta > 10*frame+time.Duration(seqDelta)*frame {
+		return
 	}
 
-	logger.Debug("Adding packet %d to jitter buffer (%d samples)", seqNum, len(data))
-	ap.jitterBuffer.addPacket(packet)
+	// D(i,j) = (Rj - Ri) - (Sj - Si);  J += (|D| - J) / 16
+	d := (arrivalDelta - time.Duration(seqDelta)*frame).Seconds()
+	tracker.jitter += (math.Abs(d) - tracker.jitter) / 16
+
+	ap.stats.NetworkJitter = time.Duration(tracker.jitter * float64(time.Second))
+	ap.assessQuality()
 }
 
 // GetNextAudioFrame retrieves the next audio frame from jitter buffer
@@ -267,10 +546,242 @@ func (ap *AudioProcessor) GetNextAudioFrame() []int16 {
 	return ap.jitterBuffer.getNextFrame()
 }
 
-// applyNoiseGate applies noise gate processing to audio samples
-func (ap *AudioProcessor) applyNoiseGate(samples []int16) []int16 {
-	ng := ap.noiseGate
-	processed := make([]int16, len(samples))
+// ShouldTransmit reports whether a processed frame should be sent. Sustained
+// silence is dropped entirely; speech resumes transmission on the next frame.
+// Suppressed frames don't consume sequence numbers, so receivers don't count them as loss.
+func (ap *AudioProcessor) ShouldTransmit(samples []int16) bool {
+	if !ap.enableSilenceSuppression || ap.silenceSuppressor == nil {
+		return true
+	}
+	ss := ap.silenceSuppressor
+	now := time.Now()
+
+	if frameLevelDB(samples) >= ss.thresholdDB {
+		if ss.suppressing {
+			logger.Debug("Speech resumed - transmission restored")
+		}
+		ss.silentSince = time.Time{}
+		ss.suppressing = false
+		return true
+	}
+
+	if ss.silentSince.IsZero() {
+		ss.silentSince = now
+	}
+	if now.Sub(ss.silentSince) < ss.hangover {
+		return true // Hangover keeps word tails and short pauses intact
+	}
+
+	if !ss.suppressing {
+		logger.Debug("Sustained silence - suppressing transmission")
+		ss.suppressing = true
+	}
+	return false
+}
+
+// ResetSilenceSuppression clears suppression state (e.g. on PTT press)
+func (ap *AudioProcessor) ResetSilenceSuppression() {
+	if ap.silenceSuppressor != nil {
+		ap.silenceSuppressor.silentSince = time.Time{}
+		ap.silenceSuppressor.suppressing = false
+	}
+}
+
+// ClearDelayLines empties the gate lookahead and the matching dry delay, so a
+// new transmission doesn't start with the tail of the previous one (e.g. on PTT press)
+func (ap *AudioProcessor) ClearDelayLines() {
+	ap.chainMu.Lock()
+	defer ap.chainMu.Unlock()
+	if ap.noiseGate != nil {
+		ap.noiseGate.delay.clear()
+	}
+	ap.dryDelay.clear()
+}
+
+// SetGateLookahead changes the noise gate lookahead between frames, so the
+// capture goroutine never sees its delay line mid-resize
+func (ap *AudioProcessor) SetGateLookahead(d time.Duration) {
+	ap.chainMu.Lock()
+	defer ap.chainMu.Unlock()
+	ap.noiseGate.SetLookahead(d)
+}
+
+// frameLevelDB returns the RMS level of a frame in dBFS (-120 for digital silence)
+func frameLevelDB(samples []int16) float32 {
+	if len(samples) == 0 {
+		return -120
+	}
+	var sumSquares float64
+	for _, s := range samples {
+		sumSquares += float64(s) * float64(s)
+	}
+	rms := math.Sqrt(sumSquares/float64(len(samples))) / 32767.0
+	if rms <= 0 {
+		return -120
+	}
+	return float32(20 * math.Log10(rms))
+}
+
+// floor returns a talker's noise floor, creating it (and forgetting long-gone
+// talkers) on first use
+func (cn *ComfortNoise) floor(source uint16, now time.Time) *noiseFloor {
+	if f, ok := cn.floors[source]; ok {
+		return f
+	}
+	for id, f := range cn.floors {
+		if now.Sub(f.heard) > noiseFloorRetention && now.Sub(f.ended) > noiseFloorRetention {
+			delete(cn.floors, id)
+		}
+	}
+	f := &noiseFloor{}
+	cn.floors[source] = f
+	return f
+}
+
+// ObserveReceived updates a talker's noise floor estimate from a received frame.
+// Returns true if the frame is digital silence (a gated frame) that comfort noise should replace.
+func (ap *AudioProcessor) ObserveReceived(source uint16, samples []int16) bool {
+	if !ap.enableComfortNoise || ap.comfortNoise == nil {
+		return false
+	}
+
+	level := frameLevelDB(samples)
+	if level <= -120 {
+		return true // All zeros: the sender's gate is closed
+	}
+	now := time.Now()
+	f := ap.comfortNoise.floor(source, now)
+	if f.ended.IsZero() || now.Sub(f.ended) >= transmitEndGrace {
+		f.heard = now
+	}
+
+	// Track the quietest recent frames: drop fast, rise slowly so speech
+	// doesn't drag the floor up. Speech-level frames are never taken as noise.
+	switch {
+	case !f.estimated:
+		f.levelDB = level
+		f.estimated = true
+	case level < f.levelDB:
+		f.levelDB = (f.levelDB + level) / 2
+	default:
+		f.levelDB += 0.05
+	}
+	if f.levelDB > -40 {
+		f.levelDB = -40
+	}
+	if f.levelDB < -90 {
+		f.levelDB = -90
+	}
+	return false
+}
+
+// EndComfortNoise stops filling a talker's gaps: they released push-to-talk,
+// so the silence that follows is real
+func (ap *AudioProcessor) EndComfortNoise(source uint16) {
+	if ap.comfortNoise == nil {
+		return
+	}
+	ap.comfortNoise.floor(source, time.Now()).ended = time.Now()
+}
+
+// ComfortNoiseGap returns the talker whose pause a playback gap should be
+// filled for: the most recently heard one still mid-transmission
+func (ap *AudioProcessor) ComfortNoiseGap() (uint16, bool) {
+	if !ap.enableComfortNoise || ap.comfortNoise == nil {
+		return 0, false
+	}
+	now := time.Now()
+	var source uint16
+	var latest time.Time
+	for id, f := range ap.comfortNoise.floors {
+		if f.heard.After(f.ended) && now.Sub(f.heard) < ap.comfortNoise.maxGap && f.heard.After(latest) {
+			source, latest = id, f.heard
+		}
+	}
+	return source, !latest.IsZero()
+}
+
+// GenerateComfortNoise returns a frame of white noise at a talker's estimated noise floor.
+// The returned frame is reused by the next call.
+func (ap *AudioProcessor) GenerateComfortNoise(source uint16, n int) []int16 {
+	cn := ap.comfortNoise
+	levelDB := cn.fallbackDB
+	if f, ok := cn.floors[source]; ok && f.estimated {
+		levelDB = f.levelDB
+	}
+
+	// Uniform noise in [-a, a] has RMS a/sqrt(3)
+	amplitude := float32(math.Pow(10, float64(levelDB)/20)) * 32767 * 1.732
+	ap.noiseBuf = reuseFrame(ap.noiseBuf, n)
+	samples := ap.noiseBuf
+	for i := range samples {
+		// xorshift32 - cheap and plenty random for noise
+		cn.seed ^= cn.seed << 13
+		cn.seed ^= cn.seed >> 17
+		cn.seed ^= cn.seed << 5
+		r := float32(cn.seed)/float32(math.MaxUint32)*2 - 1
+		samples[i] = int16(r * amplitude)
+	}
+	return samples
+}
+
+// SetDuckGain sets how far playback drops while transmitting, in dB (0 or above means no ducking)
+func (ap *AudioProcessor) SetDuckGain(gainDB float32) {
+	if gainDB > 0 {
+		gainDB = 0
+	}
+	ap.ducker.gain = powf(10, gainDB/20)
+	logger.Debug("Transmit ducking gain set to %.1fdB", gainDB)
+}
+
+// DuckPlayback attenuates a playback frame in place while transmitting and
+// restores full level afterwards, ramping from the previous frame's gain
+func (ap *AudioProcessor) DuckPlayback(samples []int16, transmitting bool) {
+	d := ap.ducker
+	target := float32(1)
+	if ap.enableDucking && transmitting {
+		target = d.gain
+	}
+	if target == 1 && d.current == 1 {
+		return
+	}
+
+	step := (target - d.current) / float32(len(samples))
+	gain := d.current
+	for i, sample := range samples {
+		gain += step
+		samples[i] = int16(float32(sample) * gain)
+	}
+	d.current = target
+}
+
+// newNoiseGate creates a gate with the standard timing and the given threshold in dB
+func newNoiseGate(thresholdDB float32) *NoiseGate {
+	return &NoiseGate{
+		threshold:   thresholdDB,
+		attackTime:  2 * time.Millisecond,
+		releaseTime: 50 * time.Millisecond,
+		holdTime:    100 * time.Millisecond,
+		envelope:    0.0,
+	}
+}
+
+// SetLookahead sets how far ahead of the output the gate listens. The
+// transmitted audio is delayed by the same amount.
+func (ng *NoiseGate) SetLookahead(d time.Duration) {
+	ng.delay.resize(int(d.Seconds() * sampleRate))
+}
+
+// Lookahead returns the gate's delay in samples
+func (ng *NoiseGate) Lookahead() int {
+	return len(ng.delay.buf)
+}
+
+// Process gates samples in place: silence while the level is under the
+// threshold. With a lookahead the output lags the input by that much.
+func (ng *NoiseGate) Process(samples []int16) []int16 {
+	// Threshold in linear scale, squared to compare against the power envelope
+	thresholdLinear := powf(10.0, ng.threshold/20.0)
 
 	for i, sample := range samples {
 		// Convert to float for processing
@@ -279,43 +790,48 @@ func (ap *AudioProcessor) applyNoiseGate(samples []int16) []int16 {
 		// Calculate envelope (RMS-like)
 		ng.envelope = ng.envelope*0.99 + floatSample*floatSample*0.01
 
-		// Threshold in linear scale (approximate)
-		thresholdLinear := powf(10.0, ng.threshold/20.0)
-
 		// Gate logic
-		if ng.envelope > thresholdLinear {
+		if ng.envelope > thresholdLinear*thresholdLinear {
 			if !ng.gateOpen {
 				ng.gateOpen = true
 				ng.holdTimer = time.Now().Add(ng.holdTime)
-				logger.Debug("Noise gate opened (envelope: %.4f)", ng.envelope)
 			}
 		} else {
 			if ng.gateOpen && time.Now().After(ng.holdTimer) {
 				ng.gateOpen = false
-				logger.Debug("Noise gate closed (envelope: %.4f)", ng.envelope)
 			}
 		}
 
-		// Apply gate
-		if ng.gateOpen {
-			processed[i] = sample
-		} else {
-			processed[i] = 0 // Silence when gate closed
+		// Apply gate to the delayed sample
+		out := ng.delay.push(sample)
+		if !ng.gateOpen {
+			out = 0 // Silence when gate closed
 		}
+		samples[i] = out
+	}
+	return samples
+}
+
+// applyNoiseGate applies the transmit noise gate to audio samples, in place
+func (ap *AudioProcessor) applyNoiseGate(samples []int16) {
+	ng := ap.noiseGate
+	wasOpen := ng.gateOpen
+	ng.Process(samples)
+	ap.gateDelay = ng.Lookahead()
+	if ng.gateOpen != wasOpen {
+		logger.Debug("Noise gate open=%t (envelope: %.4f)", ng.gateOpen, ng.envelope)
 	}
 
 	// Update stats
 	ap.stats.Lock()
 	ap.stats.NoiseGateOpen = ng.gateOpen
 	ap.stats.Unlock()
-
-	return processed
 }
 
-// applyCompressor applies dynamic compression to audio samples
-func (ap *AudioProcessor) applyCompressor(samples []int16) []int16 {
+// applyCompressor applies dynamic compression to audio samples, in place
+func (ap *AudioProcessor) applyCompressor(samples []int16) {
 	comp := ap.compressor
-	processed := make([]int16, len(samples))
+	thresholdLinear := powf(10.0, comp.threshold/20.0)
 
 	for i, sample := range samples {
 		// Convert to float for processing
@@ -332,7 +848,6 @@ func (ap *AudioProcessor) applyCompressor(samples []int16) []int16 {
 		}
 
 		// Compression calculation
-		thresholdLinear := powf(10.0, comp.threshold/20.0)
 		if comp.envelope > thresholdLinear {
 			// Above threshold: apply compression
 			excess := comp.envelope - thresholdLinear
@@ -354,15 +869,36 @@ func (ap *AudioProcessor) applyCompressor(samples []int16) []int16 {
 		}
 
 		// Convert back to int16
-		processed[i] = int16(compressedSample * 32767.0)
+		samples[i] = int16(compressedSample * 32767.0)
 	}
 
 	// Update stats
 	ap.stats.Lock()
 	ap.stats.CompressionGain = comp.gainReduction
 	ap.stats.Unlock()
+}
 
-	return processed
+// addFrame copies a received frame into the buffer. The buffer keeps its own
+// copy because the caller's frame is recycled once played; trimmed packets are
+// reused, so steady-state arrivals don't allocate.
+func (jb *JitterBuffer) addFrame(seqNum uint16, data []int16, received time.Time) {
+	jb.Lock()
+	var packet *AudioPacket
+	if n := len(jb.spare); n > 0 {
+		packet = jb.spare[n-1]
+		jb.spare = jb.spare[:n-1]
+	} else {
+		packet = &AudioPacket{}
+	}
+	jb.Unlock()
+
+	packet.SeqNum = seqNum
+	packet.Timestamp = uint32(received.UnixNano() / 1000000) // milliseconds
+	packet.Data = append(packet.Data[:0], data...)
+	packet.Size = len(data)
+	packet.Received = received
+
+	jb.addPacket(packet)
 }
 
 // addPacket adds a packet to the jitter buffer in the correct order
@@ -413,11 +949,19 @@ func (jb *JitterBuffer) addPacket(packet *AudioPacket) {
 		removed := jb.buffer.Remove(jb.buffer.Front())
 		removedPacket := removed.(*AudioPacket)
 		logger.Debug("Removed old packet %d from jitter buffer (overflow prevention)", removedPacket.SeqNum)
+		jb.spare = append(jb.spare, removedPacket)
 	}
 
 	logger.Debug("Jitter buffer now contains %d packets (target: %d)", jb.buffer.Len(), maxPackets)
 }
 
+// setPlayInterval matches the output cadence to the audio frame size
+func (jb *JitterBuffer) setPlayInterval(interval time.Duration) {
+	jb.Lock()
+	defer jb.Unlock()
+	jb.playInterval = interval
+}
+
 // getNextFrame retrieves the next audio frame when it's time to play
 func (jb *JitterBuffer) getNextFrame() []int16 {
 	jb.Lock()
@@ -425,16 +969,14 @@ func (jb *JitterBuffer) getNextFrame() []int16 {
 
 	now := time.Now()
 
-	// Initialize play timing - FIXED
+	// Warm up before playout: starting on the first packet leaves no cushion,
+	// so the next late packet is an underrun
 	if jb.nextPlayTime.IsZero() {
-		if jb.buffer.Len() > 0 {
-			// Start playing immediately when we have packets
-			jb.nextPlayTime = now
-			logger.Info("Jitter buffer initialized - starting playback immediately with %d packets", jb.buffer.Len())
-		} else {
-			// No packets yet, wait
+		if jb.buffer.Len() < jb.warmupPackets() {
 			return nil
 		}
+		jb.nextPlayTime = now
+		logger.Debug("Jitter buffer warmed up - starting playback with %d packets", jb.buffer.Len())
 	}
 
 	// Check if it's time to play next frame - SIMPLIFIED
@@ -447,9 +989,10 @@ func (jb *JitterBuffer) getNextFrame() []int16 {
 
 	// Get next packet from buffer
 	if jb.buffer.Len() == 0 {
-		// Buffer underrun - return silence and log it
+		// Buffer underrun - return silence and warm up again before resuming
 		logger.Debug("Jitter buffer underrun - returning silence")
-		return make([]int16, framesPerBuffer)
+		jb.nextPlayTime = time.Time{}
+		return make([]int16, framesPerBuffer())
 	}
 
 	// Remove and return first packet
@@ -461,6 +1004,16 @@ func (jb *JitterBuffer) getNextFrame() []int16 {
 	return packet.Data
 }
 
+// warmupPackets is how many packets must be queued before playout starts:
+// the target latency, capped at what the buffer will hold. Caller holds jb.
+func (jb *JitterBuffer) warmupPackets() int {
+	latency := minDuration(jb.targetLatency, jb.bufferTime)
+	if n := int(latency / jb.playInterval); n > 1 {
+		return n
+	}
+	return 1
+}
+
 // adaptBufferSize adjusts buffer size based on network conditions
 func (jb *JitterBuffer) adaptBufferSize() {
 	oldBufferTime := jb.bufferTime
@@ -498,21 +1051,67 @@ func (ap *AudioProcessor) updateInputStats(original, processed []int16) {
 
 	ap.stats.Lock()
 	ap.stats.InputLevel = rms
+	ap.assessQuality()
+	ap.stats.Unlock()
+}
 
-	// Update audio quality assessment
-	if ap.jitterBuffer.packetLoss < 0.01 && ap.stats.NetworkJitter < 30*time.Millisecond {
-		ap.stats.AudioQuality = "Excellent"
-	} else if ap.jitterBuffer.packetLoss < 0.05 && ap.stats.NetworkJitter < 60*time.Millisecond {
-		ap.stats.AudioQuality = "Good"
-	} else if ap.jitterBuffer.packetLoss < 0.10 {
-		ap.stats.AudioQuality = "Fair"
-	} else {
-		ap.stats.AudioQuality = "Poor"
+// QualityThresholds are the limits for each quality rating: loss in percent
+// and jitter in milliseconds must both be under a rating's limits to earn it.
+// Fair has no jitter limit; anything worse is Poor.
+type QualityThresholds struct {
+	ExcellentLossPct  float32 `json:"excellent_loss_pct"`
+	ExcellentJitterMs float32 `json:"excellent_jitter_ms"`
+	GoodLossPct       float32 `json:"good_loss_pct"`
+	GoodJitterMs      float32 `json:"good_jitter_ms"`
+	FairLossPct       float32 `json:"fair_loss_pct"`
+}
+
+// Thresholds for an ordinary internet link
+var defaultQualityThresholds = QualityThresholds{
+	ExcellentLossPct:  1,
+	ExcellentJitterMs: 30,
+	GoodLossPct:       5,
+	GoodJitterMs:      60,
+	FairLossPct:       10,
+}
+
+// valid reports whether every limit is positive and each rating is at least
+// as strict as the one below it
+func (q QualityThresholds) valid() bool {
+	return q.ExcellentLossPct > 0 && q.ExcellentJitterMs > 0 &&
+		q.ExcellentLossPct <= q.GoodLossPct && q.GoodLossPct <= q.FairLossPct &&
+		q.ExcellentJitterMs <= q.GoodJitterMs
+}
+
+// rate returns the rating for a loss ratio (0.0 - 1.0) and jitter
+func (q QualityThresholds) rate(loss float32, jitter time.Duration) string {
+	lossPct := loss * 100
+	jitterMs := float32(jitter) / float32(time.Millisecond)
+	switch {
+	case lossPct < q.ExcellentLossPct && jitterMs < q.ExcellentJitterMs:
+		return "Excellent"
+	case lossPct < q.GoodLossPct && jitterMs < q.GoodJitterMs:
+		return "Good"
+	case lossPct < q.FairLossPct:
+		return "Fair"
+	default:
+		return "Poor"
 	}
+}
 
+// SetQualityThresholds changes where the quality rating draws its lines
+func (ap *AudioProcessor) SetQualityThresholds(q QualityThresholds) {
+	ap.stats.Lock()
+	ap.quality = q
+	ap.assessQuality()
 	ap.stats.Unlock()
 }
 
+// assessQuality rates audio quality from loss and measured jitter. Caller holds ap.stats.
+func (ap *AudioProcessor) assessQuality() {
+	ap.stats.AudioQuality = ap.quality.rate(ap.jitterBuffer.packetLoss, ap.stats.NetworkJitter)
+}
+
 // GetStats returns current audio processing statistics - FIXED (no mutex copy)
 func (ap *AudioProcessor) GetStats() AudioStats {
 	ap.stats.RLock()
@@ -531,32 +1130,55 @@ func (ap *AudioProcessor) GetStats() AudioStats {
 	}
 }
 
-// Helper functions
-func powf(base, exp float32) float32 {
-	if exp == 0 {
-		return 1
-	}
-	if exp == 0.5 {
-		return sqrtf(base)
-	}
-	// Simple approximation for common cases
-	result := float32(1)
-	for i := 0; i < int(exp); i++ {
-		result *= base
-	}
-	return result
+// Jitter buffer latency target, unless low data mode raises it
+const defaultJitterTarget = 80 * time.Millisecond
+
+// SetJitterTarget changes the latency the jitter buffer aims for
+func (ap *AudioProcessor) SetJitterTarget(target time.Duration) {
+	ap.jitterBuffer.Lock()
+	ap.jitterBuffer.targetLatency = min(target, ap.jitterBuffer.maxBuffer)
+	ap.jitterBuffer.Unlock()
 }
 
-func sqrtf(x float32) float32 {
-	// Newton's method approximation
-	if x <= 0 {
-		return 0
-	}
-	guess := x / 2
-	for i := 0; i < 10; i++ {
-		guess = (guess + x/guess) / 2
+// WarmupFrames is how many frames a talker's playback queue builds up before
+// it starts playing: the jitter buffer's latency target
+func (ap *AudioProcessor) WarmupFrames() int {
+	ap.jitterBuffer.Lock()
+	defer ap.jitterBuffer.Unlock()
+	return max(int(ap.jitterBuffer.targetLatency/frameDuration()), 1)
+}
+
+// JitterBufferState is a point-in-time view of the jitter buffer, for diagnostics
+type JitterBufferState struct {
+	Enabled      bool    `json:"enabled"`
+	Playing      bool    `json:"playing"` // Warmed up and playing out
+	Packets      int     `json:"packets"`
+	BufferMs     float64 `json:"bufferMs"`
+	TargetMs     float64 `json:"targetMs"`
+	PacketsLost  int     `json:"packetsLost"`
+	PacketsTotal int     `json:"packetsTotal"`
+}
+
+// GetJitterBufferState snapshots the jitter buffer
+func (ap *AudioProcessor) GetJitterBufferState() JitterBufferState {
+	jb := ap.jitterBuffer
+	jb.RLock()
+	defer jb.RUnlock()
+
+	return JitterBufferState{
+		Enabled:      ap.enableJitterBuffer,
+		Playing:      !jb.nextPlayTime.IsZero(),
+		Packets:      jb.buffer.Len(),
+		BufferMs:     float64(jb.bufferTime) / float64(time.Millisecond),
+		TargetMs:     float64(jb.targetLatency) / float64(time.Millisecond),
+		PacketsLost:  jb.packetsLost,
+		PacketsTotal: jb.packetsTotal,
 	}
-	return guess
+}
+
+// Helper functions
+func powf(base, exp float32) float32 {
+	return float32(math.Pow(float64(base), float64(exp)))
 }
 
 func absf(x float32) float32 {
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// sine returns n samples of a 1kHz tone at the given peak amplitude (0..1)
+func sine(n int, amplitude float64) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(amplitude * 32767 * math.Sin(2*math.Pi*1000*float64(i)/sampleRate))
+	}
+	return samples
+}
+
+func peak(samples []int16) int {
+	max := 0
+	for _, s := range samples {
+		v := int(s)
+		if v < 0 {
+			v = -v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// newTestProcessor returns a processor with only the named stage enabled
+func newTestProcessor(gate, comp, gain bool) *AudioProcessor {
+	ap := NewAudioProcessor()
+	ap.enableNoiseGate = gate
+	ap.enableCompressor = comp
+	ap.enableMakeupGain = gain
+	ap.noiseGate.holdTime = 0 // No wall-clock hold in tests
+	return ap
+}
+
+func TestPowf(t *testing.T) {
+	tests := []struct{ base, exp, want float32 }{
+		{10, 0, 1},
+		{10, 1, 10},
+		{10, -2, 0.01},     // -40dB
+		{10, 0.3, 1.99526}, // +6dB
+		{4, 0.5, 2},
+	}
+	for _, tt := range tests {
+		if got := powf(tt.base, tt.exp); math.Abs(float64(got-tt.want)) > 1e-4 {
+			t.Errorf("powf(%v, %v) = %v, want %v", tt.base, tt.exp, got, tt.want)
+		}
+	}
+}
+
+func TestNoiseGateOpensAboveAndClosesBelowThreshold(t *testing.T) {
+	ap := newTestProcessor(true, false, false)
+	ap.noiseGate.threshold = -40
+
+	// -6dBFS tone is well above -40dB
+	var out []int16
+	for i := 0; i < 5; i++ {
+		out = ap.ProcessInputAudio(sine(960, 0.5))
+	}
+	if !ap.noiseGate.gateOpen {
+		t.Fatal("gate should be open for a -6dBFS tone")
+	}
+	if peak(out) == 0 {
+		t.Fatal("open gate should pass audio")
+	}
+
+	// -70dBFS tone is well below -40dB
+	for i := 0; i < 5; i++ {
+		out = ap.ProcessInputAudio(sine(960, 0.0003))
+	}
+	if ap.noiseGate.gateOpen {
+		t.Fatal("gate should close for a -70dBFS tone")
+	}
+	if peak(out) != 0 {
+		t.Errorf("closed gate should output silence, got peak %d", peak(out))
+	}
+}
+
+// onsetFrame is silence followed by a tone starting abruptly at onset
+func onsetFrame(n, onset int, amplitude float64) []int16 {
+	frame := make([]int16, n)
+	copy(frame[onset:], sine(n-onset, amplitude))
+	return frame
+}
+
+func TestNoiseGateLookaheadKeepsOnset(t *testing.T) {
+	const onset, lookahead = 480, 240  // 5ms at 48kHz
+	in := onsetFrame(960, onset, 0.02) // A soft consonant, 6dB over the -40dB threshold
+
+	// Without lookahead the envelope needs a moment to cross the threshold,
+	// and the start of the word is gated out
+	plain := newTestProcessor(true, false, false)
+	out := plain.ProcessInputAudio(in)
+	if peak(out[onset:onset+24]) != 0 {
+		t.Fatal("expected the gate to cut the first half millisecond without lookahead")
+	}
+
+	ap := newTestProcessor(true, false, false)
+	ap.noiseGate.SetLookahead(5 * time.Millisecond)
+	if got := ap.noiseGate.Lookahead(); got != lookahead {
+		t.Fatalf("Lookahead() = %d samples, want %d", got, lookahead)
+	}
+	out = ap.ProcessInputAudio(in)
+
+	// The output is the input shifted by the lookahead, onset intact
+	if peak(out[:onset+lookahead]) != 0 {
+		t.Error("audio before the delayed onset should be silent")
+	}
+	if !equalFrames(out[onset+lookahead:], in[onset:len(in)-lookahead]) {
+		t.Error("onset should come through the gate untouched, delayed by the lookahead")
+	}
+
+	// The delayed tail arrives at the start of the next frame
+	next := ap.ProcessInputAudio(sine(960, 0.02))
+	if !equalFrames(next[:lookahead], in[len(in)-lookahead:]) {
+		t.Error("delay line should carry the end of one frame into the next")
+	}
+}
+
+func TestNoiseGateLookaheadKeepsMixAligned(t *testing.T) {
+	in := sine(960, 0.5)
+
+	// With the gate open, a half mix of the raw and the delayed-but-otherwise
+	// untouched signal must add up to the delayed signal, not comb filter
+	ap := newTestProcessor(true, false, false)
+	ap.noiseGate.SetLookahead(5 * time.Millisecond)
+	ap.SetMix(0.5)
+	ap.ProcessInputAudio(in)
+	out := ap.ProcessInputAudio(in)
+
+	wet := newTestProcessor(true, false, false)
+	wet.noiseGate.SetLookahead(5 * time.Millisecond)
+	wet.ProcessInputAudio(in)
+	want := wet.ProcessInputAudio(in)
+
+	for i := range out {
+		if d := int(out[i]) - int(want[i]); d > 1 || d < -1 {
+			t.Fatalf("sample %d: mixed %d, want %d", i, out[i], want[i])
+		}
+	}
+}
+
+func TestClearDelayLinesDropsLastTransmission(t *testing.T) {
+	ap := newTestProcessor(true, false, false)
+	ap.noiseGate.SetLookahead(5 * time.Millisecond)
+	ap.SetMix(0.5) // Dry path runs through its own delay line too
+	ap.ProcessInputAudio(sine(960, 0.5))
+
+	// PTT released mid-word and pressed again: nothing of the old word may leak out
+	ap.ClearDelayLines()
+	if out := ap.ProcessInputAudio(make([]int16, 960)); peak(out) != 0 {
+		t.Errorf("new transmission starts with the last one's tail, peak %d", peak(out))
+	}
+}
+
+func TestLookaheadChangesDuringCapture(t *testing.T) {
+	ap := newTestProcessor(true, false, false)
+	ap.SetMix(0.5)
+
+	// Settings and PTT arrive on other goroutines while the capture loop runs
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			ap.SetGateLookahead(time.Duration(i%10) * time.Millisecond)
+			ap.ClearDelayLines()
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		ap.ProcessInputAudio(sine(960, 0.5))
+	}
+	<-done
+}
+
+func TestTestCopyLeavesLiveProcessorAlone(t *testing.T) {
+	setup := func() *AudioProcessor {
+		ap := newTestProcessor(true, true, true)
+		ap.noiseGate.SetLookahead(5 * time.Millisecond)
+		ap.SetMix(0.8)
+		if err := ap.SetProcessingChain([]string{"high_pass", "noise_gate", "compressor"}); err != nil {
+			t.Fatal(err)
+		}
+		return ap
+	}
+	live, reference := setup(), setup()
+	frame := sine(960, 0.3)
+
+	out := live.ProcessInputAudio(frame)
+	reference.ProcessInputAudio(frame)
+	sent := append([]int16(nil), out...)
+
+	// The mic test runs a different signal through a copy mid-transmission
+	test := live.testCopy()
+	if test.noiseGate.Lookahead() != live.noiseGate.Lookahead() || len(test.processingChain) != 3 || test.mix != live.mix {
+		t.Fatal("test copy should have the live settings")
+	}
+	test.ProcessInputAudio(sine(960, 0.9))
+
+	if !equalFrames(out, sent) {
+		t.Error("test copy overwrote the frame being transmitted")
+	}
+	if got, want := live.ProcessInputAudio(frame), reference.ProcessInputAudio(frame); !equalFrames(got, want) {
+		t.Error("test copy disturbed the live gate, filter or delay state")
+	}
+}
+
+func TestCompressorReducesGainAboveThreshold(t *testing.T) {
+	ap := newTestProcessor(false, true, false)
+	ap.compressor.threshold = -18
+	ap.compressor.ratio = 4
+	ap.compressor.makeupGain = 1 // Isolate the gain reduction
+
+	loud := sine(960, 0.9)
+	out := ap.ProcessInputAudio(loud)
+	if peak(out) >= peak(loud) {
+		t.Errorf("loud input not compressed: in peak %d, out peak %d", peak(loud), peak(out))
+	}
+	if ap.compressor.gainReduction >= 1 {
+		t.Errorf("gain reduction = %.3f, want < 1", ap.compressor.gainReduction)
+	}
+
+	// Far below threshold, on a fresh envelope, the signal passes untouched
+	ap = newTestProcessor(false, true, false)
+	ap.compressor.makeupGain = 1
+	quiet := sine(960, 0.01)
+	out = ap.ProcessInputAudio(quiet)
+	if diff := peak(out) - peak(quiet); diff > 1 || diff < -1 {
+		t.Errorf("quiet input changed: in peak %d, out peak %d", peak(quiet), peak(out))
+	}
+}
+
+func TestMakeupGainScales(t *testing.T) {
+	ap := newTestProcessor(false, false, true)
+	ap.makeupGain.gainDB = 6
+	ap.makeupGain.gainLinear = 0 // Recalculated from gainDB
+
+	out := ap.ProcessInputAudio([]int16{1000, -1000, 0})
+	if out[0] < 1990 || out[0] > 2000 {
+		t.Errorf("+6dB of 1000 = %d, want ~1995", out[0])
+	}
+	if out[1] > -1990 || out[1] < -2000 {
+		t.Errorf("+6dB of -1000 = %d, want ~-1995", out[1])
+	}
+	if out[2] != 0 {
+		t.Errorf("gain on silence = %d, want 0", out[2])
+	}
+
+	// Clipped rather than wrapped
+	out = ap.ProcessInputAudio([]int16{30000, -30000})
+	if out[0] != 32767 || out[1] != -32767 {
+		t.Errorf("clipping = %v, want [32767 -32767]", out)
+	}
+}
+
+func TestBypassReturnsInputUnchanged(t *testing.T) {
+	ap := newTestProcessor(true, true, true)
+	ap.SetBypass(true)
+
+	in := sine(960, 0.7)
+	out := ap.ProcessInputAudio(in)
+	if len(out) != len(in) {
+		t.Fatalf("length changed: %d -> %d", len(in), len(out))
+	}
+	for i := range in {
+		if out[i] != in[i] {
+			t.Fatalf("sample %d changed: %d -> %d", i, in[i], out[i])
+		}
+	}
+}
+
+func TestFullChainSilence(t *testing.T) {
+	ap := newTestProcessor(true, true, true)
+	for i := 0; i < 10; i++ {
+		if out := ap.ProcessInputAudio(make([]int16, 960)); peak(out) != 0 {
+			t.Fatalf("frame %d: silence in, peak %d out", i, peak(out))
+		}
+	}
+}
+
+func TestFullChainFullScale(t *testing.T) {
+	ap := newTestProcessor(true, true, true)
+
+	// Full-scale square wave: any int16 overflow shows up as a flipped sign
+	in := make([]int16, 960)
+	for i := range in {
+		if (i/24)%2 == 0 {
+			in[i] = 32767
+		} else {
+			in[i] = -32767
+		}
+	}
+
+	for frame := 0; frame < 20; frame++ {
+		out := ap.ProcessInputAudio(in)
+		for i := range in {
+			if out[i] != 0 && (out[i] > 0) != (in[i] > 0) {
+				t.Fatalf("frame %d sample %d: sign flipped (%d -> %d)", frame, i, in[i], out[i])
+			}
+		}
+	}
+}
+
+func TestJitterBufferKeepsItsOwnCopy(t *testing.T) {
+	ap := NewAudioProcessor()
+	ap.enableJitterBuffer = true
+	frame := sine(960, 0.5)
+	ap.AddToJitterBuffer(1, frame)
+
+	// The caller recycles its frame after playback; the buffered copy must not change
+	want := frame[10]
+	for i := range frame {
+		frame[i] = 0
+	}
+
+	packet := ap.jitterBuffer.buffer.Front().Value.(*AudioPacket)
+	if packet.Data[10] != want {
+		t.Errorf("buffered frame changed with the caller's buffer: got %d, want %d", packet.Data[10], want)
+	}
+}
+
+func TestJitterBufferWarmsUpBeforePlayout(t *testing.T) {
+	ap := NewAudioProcessor()
+	ap.enableJitterBuffer = true
+	jb := ap.jitterBuffer
+
+	// The buffer shrinks towards its minimum on a clean link, so the warm-up
+	// follows it; either way a single packet is not enough
+	seq := uint16(0)
+	for {
+		seq++
+		ap.AddToJitterBuffer(seq, sine(960, 0.5))
+		jb.RLock()
+		queued, want := jb.buffer.Len(), jb.warmupPackets()
+		jb.RUnlock()
+
+		frame := ap.GetNextAudioFrame()
+		if queued < want && frame != nil {
+			t.Fatalf("playout started with %d of %d packets queued", queued, want)
+		}
+		if frame != nil {
+			break
+		}
+		if seq > 10 {
+			t.Fatal("playout never started")
+		}
+	}
+	if seq < 2 {
+		t.Error("playout started on the first packet")
+	}
+
+	// Draining the buffer is an underrun: playout waits for a fresh warm-up
+	jb.Lock()
+	for jb.buffer.Len() > 0 {
+		jb.buffer.Remove(jb.buffer.Front())
+	}
+	jb.nextPlayTime = time.Now().Add(-time.Millisecond)
+	jb.Unlock()
+	ap.GetNextAudioFrame()
+	ap.AddToJitterBuffer(seq+1, sine(960, 0.5))
+	if frame := ap.GetNextAudioFrame(); frame != nil {
+		t.Error("playout resumed after an underrun without warming up again")
+	}
+}
+
+func TestProcessingChainFromConfig(t *testing.T) {
+	ap := newTestProcessor(true, true, true)
+	in := sine(960, 0.25)
+
+	// Only stages in the chain run, even when others are enabled
+	if err := ap.SetProcessingChain([]string{"makeup_gain"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := peak(ap.ProcessInputAudio(in)), peak(in)*2; got < want-2 || got > want+2 {
+		t.Errorf("makeup-only chain: peak %d, want about %d", got, want)
+	}
+
+	if err := ap.SetProcessingChain([]string{"noise_gate", "eq"}); err == nil {
+		t.Error("unknown stage should be rejected")
+	}
+	if got := len(ap.processingChain); got != 1 {
+		t.Errorf("rejected chain replaced the current one (%d stages)", got)
+	}
+
+	if err := ap.SetProcessingChain(nil); err != nil || len(ap.processingChain) != len(defaultProcessingChain) {
+		t.Errorf("empty chain should restore the default, got %d stages, err %v", len(ap.processingChain), err)
+	}
+}
+
+func TestHighPassRemovesDC(t *testing.T) {
+	ap := newTestProcessor(false, false, false)
+	if err := ap.SetProcessingChain([]string{"high_pass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dc := make([]int16, 960)
+	for i := range dc {
+		dc[i] = 10000
+	}
+	var out []int16
+	for frame := 0; frame < 5; frame++ {
+		out = ap.ProcessInputAudio(dc)
+	}
+	if p := peak(out); p > 100 {
+		t.Errorf("DC offset not removed: peak %d after 100ms", p)
+	}
+}
+
+func TestMixEndpoints(t *testing.T) {
+	in := sine(960, 0.25)
+
+	// Reference: the same chain fully processed on a fresh processor
+	want := append([]int16(nil), newTestProcessor(false, false, true).ProcessInputAudio(in)...)
+
+	wet := newTestProcessor(false, false, true)
+	wet.SetMix(1)
+	if out := wet.ProcessInputAudio(in); !equalFrames(out, want) {
+		t.Error("mix 1.0 should match the processed frame exactly")
+	}
+
+	dry := newTestProcessor(false, false, true)
+	dry.SetMix(0)
+	if out := dry.ProcessInputAudio(in); !equalFrames(out, in) {
+		t.Error("mix 0.0 should match the raw frame exactly")
+	}
+
+	half := newTestProcessor(false, false, true)
+	half.SetMix(0.5)
+	if got, lo, hi := peak(half.ProcessInputAudio(in)), peak(in), peak(want); got <= lo || got >= hi {
+		t.Errorf("mix 0.5 peak %d should fall between raw %d and processed %d", got, lo, hi)
+	}
+
+	for _, tt := range []struct{ in, want float32 }{{-0.5, 0}, {1.5, 1}, {0.3, 0.3}} {
+		if got := clampMix(tt.in); got != tt.want {
+			t.Errorf("clampMix(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDuckPlayback(t *testing.T) {
+	ap := NewAudioProcessor()
+	ap.enableDucking = true
+	ap.SetDuckGain(-12)
+
+	const level = 16000
+	frame := func() []int16 {
+		f := make([]int16, 960)
+		for i := range f {
+			f[i] = level
+		}
+		return f
+	}
+
+	// First transmitting frame ramps down without a step, then stays at -12dB (~0.25)
+	first := frame()
+	ap.DuckPlayback(first, true)
+	if first[0] < level*95/100 || first[len(first)-1] > level*26/100 {
+		t.Errorf("ramp down: starts at %d, ends at %d", first[0], first[len(first)-1])
+	}
+	steady := frame()
+	ap.DuckPlayback(steady, true)
+	if steady[0] != steady[len(steady)-1] || steady[0] > level*26/100 || steady[0] < level*24/100 {
+		t.Errorf("steady ducked frame should sit at -12dB, got %d..%d", steady[0], steady[len(steady)-1])
+	}
+
+	// Releasing PTT ramps back to full level, then frames pass untouched
+	ap.DuckPlayback(frame(), false)
+	restored := frame()
+	ap.DuckPlayback(restored, false)
+	if restored[0] != level || restored[len(restored)-1] != level {
+		t.Errorf("playback should be back at full level, got %d..%d", restored[0], restored[len(restored)-1])
+	}
+
+	// Disabled: transmitting changes nothing
+	ap.enableDucking = false
+	off := frame()
+	ap.DuckPlayback(off, true)
+	if off[0] != level {
+		t.Errorf("ducking disabled but frame changed to %d", off[0])
+	}
+}
+
+func TestComfortNoiseFollowsEachTalker(t *testing.T) {
+	ap := NewAudioProcessor()
+	ap.enableComfortNoise = true
+
+	constant := func(level int16) []int16 {
+		f := make([]int16, 960)
+		for i := range f {
+			f[i] = level
+		}
+		return f
+	}
+	ap.ObserveReceived(1, constant(300)) // About -40dB
+	ap.ObserveReceived(2, constant(30))  // About -60dB
+
+	// Each talker's gaps are filled at their own floor
+	loud := frameLevelDB(ap.GenerateComfortNoise(1, 960))
+	quiet := frameLevelDB(ap.GenerateComfortNoise(2, 960))
+	if loud-quiet < 15 {
+		t.Errorf("noise for talkers 1 and 2 at %.1fdB and %.1fdB, want about 20dB apart", loud, quiet)
+	}
+	if source, ok := ap.ComfortNoiseGap(); !ok || source != 2 {
+		t.Errorf("gap should follow the last talker heard, got %d (%t)", source, ok)
+	}
+
+	// Gated frames are replaced without a source ID too
+	if !ap.ObserveReceived(0, make([]int16, 960)) {
+		t.Error("all-zero frame from a server without source IDs should get comfort noise")
+	}
+
+	// Ending a transmission stops its noise, even with its last frames still queued
+	ap.EndComfortNoise(2)
+	if source, ok := ap.ComfortNoiseGap(); !ok || source != 1 {
+		t.Errorf("after talker 2 ended the gap should be talker 1's, got %d (%t)", source, ok)
+	}
+	ap.EndComfortNoise(1)
+	ap.ObserveReceived(1, constant(300))
+	if source, ok := ap.ComfortNoiseGap(); ok {
+		t.Errorf("no talker is mid-transmission, but talker %d's gap is filled", source)
+	}
+}
+
+func equalFrames(a, b []int16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// The full chain should not allocate per frame once warmed up
+func BenchmarkProcessInputAudio(b *testing.B) {
+	ap := newTestProcessor(true, true, true)
+	in := sine(960, 0.5)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ap.ProcessInputAudio(in)
+	}
+}
+
+func BenchmarkJitterBufferAdd(b *testing.B) {
+	ap := NewAudioProcessor()
+	ap.enableJitterBuffer = true
+	frame := sine(960, 0.5)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ap.AddToJitterBuffer(uint16(i), frame)
+	}
+}
+
+func TestQualityThresholds(t *testing.T) {
+	lan := QualityThresholds{
+		ExcellentLossPct:  0.1,
+		ExcellentJitterMs: 5,
+		GoodLossPct:       0.5,
+		GoodJitterMs:      10,
+		FairLossPct:       2,
+	}
+	if !lan.valid() || !defaultQualityThresholds.valid() {
+		t.Fatal("LAN and default thresholds should be valid")
+	}
+
+	for _, tt := range []struct {
+		q      QualityThresholds
+		loss   float32
+		jitter time.Duration
+		want   string
+	}{
+		{defaultQualityThresholds, 0.005, 20 * time.Millisecond, "Excellent"},
+		{defaultQualityThresholds, 0.005, 40 * time.Millisecond, "Good"},
+		{defaultQualityThresholds, 0.08, 200 * time.Millisecond, "Fair"},
+		{defaultQualityThresholds, 0.15, 0, "Poor"},
+		{lan, 0.005, 20 * time.Millisecond, "Fair"},
+		{lan, 0.03, 0, "Poor"},
+	} {
+		if got := tt.q.rate(tt.loss, tt.jitter); got != tt.want {
+			t.Errorf("rate(%.3f, %v) with %+v = %s, want %s", tt.loss, tt.jitter, tt.q, got, tt.want)
+		}
+	}
+
+	inverted := defaultQualityThresholds
+	inverted.GoodLossPct = 20 // Looser than Fair
+	if inverted.valid() {
+		t.Error("Good looser than Fair should be invalid")
+	}
+}
+
+func TestReceiveProcessingGatesEachTalker(t *testing.T) {
+	rp := newReceiveProcessor()
+	rp.configure(true, true, -40, 0)
+	for _, id := range []uint16{1, 2} {
+		rp.talkers[id] = &receiveFilters{gate: newNoiseGate(-40)}
+		rp.talkers[id].gate.holdTime = 0 // No wall-clock hold in tests
+	}
+
+	// Talker 1 speaks while talker 2 only sends low hiss
+	var voice, hiss []int16
+	for i := 0; i < 5; i++ {
+		voice = sine(960, 0.5)
+		hiss = sine(960, 0.0003)
+		rp.Process(1, voice)
+		rp.Process(2, hiss)
+	}
+	if peak(voice) == 0 {
+		t.Error("talker above the threshold should pass")
+	}
+	if peak(hiss) != 0 {
+		t.Errorf("hiss should be gated without being held open by the other talker, got peak %d", peak(hiss))
+	}
+
+	// Disabled processing leaves audio alone
+	rp.configure(false, true, -40, 0)
+	hiss = sine(960, 0.0003)
+	rp.Process(2, hiss)
+	if peak(hiss) == 0 {
+		t.Error("disabled receive processing should not touch audio")
+	}
+}
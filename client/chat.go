@@ -0,0 +1,198 @@
+// FILE: client/chat.go
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	chatAckTimeout = 2 * time.Second // Wait this long for chat_ack before resending
+	chatMaxRetries = 3               // Resends before a message is marked failed
+)
+
+// pendingChat is an outgoing chat datagram waiting for a server ack
+type pendingChat struct {
+	message  string
+	payload  []byte // Exact datagram, resent verbatim so the msg_id matches
+	attempts int
+}
+
+var (
+	pendingChats      = make(map[string]*pendingChat)
+	pendingChatsMutex sync.Mutex
+
+	// Messages typed while disconnected, in send order
+	offlineChats      []queuedChat
+	offlineChatsMutex sync.Mutex
+)
+
+// queuedChat is a chat message held until the connection is back
+type queuedChat struct {
+	msgID   string
+	message string
+}
+
+// newChatMsgID generates a random ID for delivery tracking
+func newChatMsgID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		// Extremely unlikely - fall back to a time based ID
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// sendTrackedChat sends a chat datagram and retransmits it until the server acks
+func sendTrackedChat(msgID, message string, payload []byte) error {
+	conn := serverConn
+	if conn == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	// Register before writing so a fast ack can't beat the "sending" state
+	pendingChatsMutex.Lock()
+	pendingChats[msgID] = &pendingChat{message: message, payload: payload}
+	pendingChatsMutex.Unlock()
+	appState.SetChatDelivery(msgID, message, "sending")
+
+	if _, err := conn.Write(payload); err != nil {
+		pendingChatsMutex.Lock()
+		delete(pendingChats, msgID)
+		pendingChatsMutex.Unlock()
+		appState.SetChatDelivery(msgID, message, "failed")
+		return err
+	}
+
+	go retransmitChat(msgID)
+	return nil
+}
+
+// retransmitChat resends an unacknowledged chat message until acked or out of retries
+func retransmitChat(msgID string) {
+	for {
+		select {
+		case <-appCtx.Done():
+			return
+		case <-time.After(chatAckTimeout):
+		}
+
+		pendingChatsMutex.Lock()
+		pending, ok := pendingChats[msgID]
+		if !ok {
+			pendingChatsMutex.Unlock()
+			return // Acked
+		}
+		if pending.attempts >= chatMaxRetries {
+			delete(pendingChats, msgID)
+			pendingChatsMutex.Unlock()
+
+			logger.Warn("Chat message %s not acknowledged after %d retries", msgID, chatMaxRetries)
+			appState.SetChatDelivery(msgID, pending.message, "failed")
+			appState.AddMessage(fmt.Sprintf("Message failed to send: %s", pending.message), "error")
+			return
+		}
+		pending.attempts++
+		attempt := pending.attempts
+		payload := pending.payload
+		pendingChatsMutex.Unlock()
+
+		conn := serverConn
+		if conn == nil {
+			continue // Count the attempt; reconnect may restore the link
+		}
+		logger.Debug("Resending chat message %s (attempt %d/%d)", msgID, attempt, chatMaxRetries)
+		if _, err := conn.Write(payload); err != nil {
+			logger.Error("Failed to resend chat message %s: %v", msgID, err)
+		}
+	}
+}
+
+// failPendingChats marks every unacknowledged message failed and stops
+// resending them, for refusals that retrying can't fix
+func failPendingChats() {
+	pendingChatsMutex.Lock()
+	failed := pendingChats
+	pendingChats = make(map[string]*pendingChat)
+	pendingChatsMutex.Unlock()
+
+	for msgID, pending := range failed {
+		logger.Debug("Chat message %s refused by the server, not resending", msgID)
+		appState.SetChatDelivery(msgID, pending.message, "failed")
+	}
+}
+
+// queueOfflineChat holds a message until the connection and crypto are back
+func queueOfflineChat(msgID, message string) {
+	limit := 0
+	if currentConfig != nil {
+		limit = currentConfig.Chat.OfflineQueueSize
+	}
+
+	offlineChatsMutex.Lock()
+	if len(offlineChats) >= limit {
+		offlineChatsMutex.Unlock()
+		logger.Warn("Offline chat queue full (%d), dropping message", limit)
+		appState.AddMessage("Cannot send chat: not connected", "error")
+		return
+	}
+	offlineChats = append(offlineChats, queuedChat{msgID: msgID, message: message})
+	queued := len(offlineChats)
+	offlineChatsMutex.Unlock()
+
+	logger.Info("Queued chat message while offline (%d queued)", queued)
+	appState.SetChatDelivery(msgID, message, "pending")
+}
+
+// flushOfflineChats sends queued messages, keeping their original msg_ids
+func flushOfflineChats() {
+	offlineChatsMutex.Lock()
+	queued := offlineChats
+	offlineChats = nil
+	offlineChatsMutex.Unlock()
+
+	if len(queued) == 0 {
+		return
+	}
+
+	logger.Info("Sending %d chat messages queued while offline", len(queued))
+	for _, chat := range queued {
+		sendChatMessageWithID(chat.msgID, chat.message)
+	}
+}
+
+// chatSegments builds render data for a received chat message body per config
+func chatSegments(message string) []common.ChatSegment {
+	if currentConfig == nil {
+		return nil
+	}
+
+	switch {
+	case currentConfig.Chat.Markdown:
+		return common.ParseChatSegments(message, currentConfig.Chat.ExpandEmoji)
+	case currentConfig.Chat.ExpandEmoji:
+		return []common.ChatSegment{{Type: common.SegmentText, Text: common.ExpandShortcodes(message)}}
+	}
+	return nil
+}
+
+// handleChatAck marks a chat message as delivered
+func handleChatAck(msgID string) {
+	pendingChatsMutex.Lock()
+	pending, ok := pendingChats[msgID]
+	delete(pendingChats, msgID)
+	pendingChatsMutex.Unlock()
+
+	if !ok {
+		logger.Debug("Ack for unknown or already acked chat message %s", msgID)
+		return
+	}
+
+	logger.Debug("Chat message %s acknowledged", msgID)
+	appState.SetChatDelivery(msgID, pending.message, "sent")
+}
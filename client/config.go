@@ -2,37 +2,247 @@
 package main
 
 import (
+	"ahcli/common"
 	"ahcli/common/logger"
 	"encoding/json"
+	"fmt"
+	"maps"
 	"os"
+	"slices"
+	"time"
 )
 
+type NoiseGateConfig struct {
+	Enabled     bool    `json:"enabled"`
+	ThresholdDB float32 `json:"threshold_db"`
+	LookaheadMs float32 `json:"lookahead_ms"` // Opens this early for word onsets, delaying the mic as much
+}
+
+type CompressorConfig struct {
+	Enabled     bool    `json:"enabled"`
+	ThresholdDB float32 `json:"threshold_db"`
+	Ratio       float32 `json:"ratio"`
+}
+
+type MakeupGainConfig struct {
+	Enabled bool    `json:"enabled"`
+	GainDB  float32 `json:"gain_db"`
+}
+
+type HighPassConfig struct {
+	CutoffHz float64 `json:"cutoff_hz"` // Only used when "high_pass" is in the chain
+}
+
+// ProcessingPreset is a named set of processing parameters defined in the
+// config, selectable like the built-in presets
+type ProcessingPreset struct {
+	NoiseGate  NoiseGateConfig  `json:"noise_gate"`
+	Compressor CompressorConfig `json:"compressor"`
+	MakeupGain MakeupGainConfig `json:"makeup_gain"`
+	HighPass   HighPassConfig   `json:"high_pass"`
+	Chain      []string         `json:"chain,omitempty"` // Empty for the default chain
+	Mix        *float32         `json:"mix,omitempty"`   // Unset for fully processed
+}
+
+// processingLimit is the range a processing parameter is kept in, so a
+// hand-edited or incomplete config can't feed the DSP values it breaks on
+// (a compressor ratio of 0 divides by zero)
+type processingLimit struct {
+	name        string
+	min, max    float32
+	fallback    float32 // Used for NaN, and for 0 when zeroIsUnset
+	zeroIsUnset bool    // 0 means the field was left out, not a real setting
+}
+
+// Noise gate lookahead for configs that predate the setting
+const defaultGateLookaheadMs = 5
+
+var (
+	noiseGateThresholdLimit  = processingLimit{"noise_gate.threshold_db", -80, 0, -40, true}
+	noiseGateLookaheadLimit  = processingLimit{"noise_gate.lookahead_ms", 0, 20, defaultGateLookaheadMs, false}
+	compressorThresholdLimit = processingLimit{"compressor.threshold_db", -60, 0, -18, false}
+	compressorRatioLimit     = processingLimit{"compressor.ratio", 1, 20, 3, true}
+	makeupGainLimit          = processingLimit{"makeup_gain.gain_db", 0, 24, 6, false}
+)
+
+// apply returns value within the limit, warning when it had to change it
+func (l processingLimit) apply(value float32) float32 {
+	switch {
+	case value != value: // NaN
+		logger.Warn("audio_processing.%s is not a number, using %g", l.name, l.fallback)
+		return l.fallback
+	case value == 0 && l.zeroIsUnset:
+		logger.Warn("audio_processing.%s is missing or 0, using %g", l.name, l.fallback)
+		return l.fallback
+	case value < l.min:
+		logger.Warn("audio_processing.%s=%g is below %g, using %g", l.name, value, l.min, l.min)
+		return l.min
+	case value > l.max:
+		logger.Warn("audio_processing.%s=%g is above %g, using %g", l.name, value, l.max, l.max)
+		return l.max
+	}
+	return value
+}
+
+// check reports a value outside the limit, for rejecting imports outright
+func (l processingLimit) check(value float32) error {
+	if value != value || value < l.min || value > l.max {
+		return fmt.Errorf("%s=%g is outside %g to %g", l.name, value, l.min, l.max)
+	}
+	return nil
+}
+
+// sanitizeProcessing keeps the processing parameters within their limits
+func sanitizeProcessing(p *AudioProcessingConfig) {
+	p.NoiseGate.ThresholdDB = noiseGateThresholdLimit.apply(p.NoiseGate.ThresholdDB)
+	p.NoiseGate.LookaheadMs = noiseGateLookaheadLimit.apply(p.NoiseGate.LookaheadMs)
+	p.Compressor.ThresholdDB = compressorThresholdLimit.apply(p.Compressor.ThresholdDB)
+	p.Compressor.Ratio = compressorRatioLimit.apply(p.Compressor.Ratio)
+	p.MakeupGain.GainDB = makeupGainLimit.apply(p.MakeupGain.GainDB)
+	if mix := clampMix(p.Mix); mix != p.Mix {
+		logger.Warn("audio_processing.mix=%.2f is outside 0.0-1.0, using %.1f", p.Mix, mix)
+		p.Mix = mix
+	}
+}
+
 type AudioProcessingConfig struct {
-	NoiseGate struct {
-		Enabled     bool    `json:"enabled"`
-		ThresholdDB float32 `json:"threshold_db"`
-	} `json:"noise_gate"`
-	Compressor struct {
-		Enabled     bool    `json:"enabled"`
-		ThresholdDB float32 `json:"threshold_db"`
-		Ratio       float32 `json:"ratio"`
-	} `json:"compressor"`
-	MakeupGain struct {
-		Enabled bool    `json:"enabled"`
-		GainDB  float32 `json:"gain_db"`
-	} `json:"makeup_gain"`
-	Preset string `json:"preset"`
+	NoiseGate  NoiseGateConfig  `json:"noise_gate"`
+	Compressor CompressorConfig `json:"compressor"`
+	MakeupGain MakeupGainConfig `json:"makeup_gain"`
+	HighPass   HighPassConfig   `json:"high_pass"`
+	Chain      []string         `json:"chain"` // Stage order; empty means noise_gate, compressor, makeup_gain
+	Mix        float32          `json:"mix"`   // Dry/wet blend: 0.0 = raw, 1.0 = fully processed (default)
+
+	// Frames sent per audio packet, 1 (default) to 3. More frames mean less
+	// per-packet overhead but add a frame of latency each.
+	FramesPerPacket int `json:"frames_per_packet"`
+
+	RogerBeep struct {
+		Enabled     bool    `json:"enabled"`      // Local courtesy beep on PTT press/release
+		Transmit    bool    `json:"transmit"`     // Also send a roger beep to others on release
+		FrequencyHz float64 `json:"frequency_hz"` // Tone frequency
+		DurationMs  int     `json:"duration_ms"`  // Tone length
+		Volume      float64 `json:"volume"`       // 0.0 - 1.0
+	} `json:"roger_beep"`
+	SilenceSuppression struct {
+		Enabled     bool    `json:"enabled"`      // Stop sending packets during sustained silence
+		ThresholdDB float32 `json:"threshold_db"` // Frames below this level count as silence
+		HangoverMs  int     `json:"hangover_ms"`  // Silence required before suppressing
+	} `json:"silence_suppression"`
+	ComfortNoise struct {
+		Enabled    bool    `json:"enabled"`     // Fill received silence with background noise
+		FallbackDB float32 `json:"fallback_db"` // Noise level before the talker's floor is known
+		MaxGapMs   int     `json:"max_gap_ms"`  // Stop filling after this long without audio, or when the talker lets go of PTT
+	} `json:"comfort_noise"`
+	DuckOnTransmit struct {
+		Enabled bool    `json:"enabled"` // Lower received audio while PTT is held
+		GainDB  float32 `json:"gain_db"` // How far to lower it, e.g. -12 (the default)
+	} `json:"duck_on_transmit"`
+	ReceiveProcessing struct {
+		Enabled              bool    `json:"enabled"`                 // Clean up received audio before playing it
+		NoiseGate            bool    `json:"noise_gate"`              // Gate out each talker's background noise
+		NoiseGateThresholdDB float32 `json:"noise_gate_threshold_db"` // Default -45
+		HighPassHz           float64 `json:"high_pass_hz"`            // Cut rumble and hum below this; 0 = off
+	} `json:"receive_processing"`
+	ChannelSounds struct {
+		Enabled       bool    `json:"enabled"`         // Local cue when someone joins or leaves our channel
+		Volume        float64 `json:"volume"`          // 0.0 - 1.0
+		MinIntervalMs int     `json:"min_interval_ms"` // Cues closer together than this are skipped
+	} `json:"channel_sounds"`
+	Preset  string                      `json:"preset"`
+	Presets map[string]ProcessingPreset `json:"presets,omitempty"` // User-defined presets by name
 }
 
 type ServerEntry struct {
-	IP string `json:"ip"`
+	IP     string       `json:"ip"`
+	Listen ListenFilter `json:"listen"` // Whose audio to play on this server
+}
+
+// ListenFilter picks which talkers are heard. With an allow list only those
+// users play; blocked users never do. Both empty plays everyone.
+type ListenFilter struct {
+	Allow []string `json:"allow,omitempty"`
+	Block []string `json:"block,omitempty"`
+}
+
+type WebUIConfig struct {
+	AutoLaunch bool   `json:"auto_launch"` // Open the UI on startup (default true)
+	Browser    string `json:"browser"`     // "app" (Chrome/Edge app mode) or "default"
+
+	SessionSummary bool `json:"session_summary"` // Show a recap in the messages on disconnect (default true)
+	BatchUpdates   bool `json:"batch_updates"`   // Collapse a backlog of level/stats updates to the latest (default true)
+
+	// Read-only feed for stream overlays on /spectate.html
+	Spectator      bool   `json:"spectator"`
+	SpectatorToken string `json:"spectator_token"` // Required as ?token= when set
+}
+
+type KeepaliveConfig struct {
+	IntervalSeconds     int `json:"interval_seconds"`      // Ping interval while audio is flowing
+	IdleIntervalSeconds int `json:"idle_interval_seconds"` // Faster pings when idle to keep NAT mappings open
+}
+
+type AudioConfig struct {
+	FrameSizeMs int                `json:"frame_size_ms"` // Preferred packet interval: 10, 20, 40 or 60 (server decides)
+	Stereo      bool               `json:"stereo"`        // Stereo playback with per-user panning
+	Pan         map[string]float64 `json:"pan"`           // nickname -> -1 (left) .. 1 (right)
+
+	InputDevice  string `json:"input_device"`  // Device name, empty for the system default
+	OutputDevice string `json:"output_device"` // Device name, empty for the system default
+
+	OutputFailover       bool `json:"output_failover"`         // Reopen the output device if it disappears
+	FailoverMaxBackoffMs int  `json:"failover_max_backoff_ms"` // Longest wait between reopen attempts
+	FollowDeviceChanges  bool `json:"follow_device_changes"`   // Reopen audio when a device is plugged in or removed
+
+	// Frames queued between the network and the speakers: fewer is lower latency,
+	// more rides out stalls in the output device
+	OutputBufferFrames int    `json:"output_buffer_frames"`
+	OutputOverflow     string `json:"output_overflow"` // When the queue is full: "drop_newest" (default) or "drop_oldest"
+
+	LowData bool `json:"low_data"` // Trade quality for less data on metered connections; see lowdata.go
+
+	// Warn after this long transmitting with a silent mic; 0 turns the warning off
+	NoInputWarningSeconds int `json:"no_input_warning_seconds"`
+
+	// Loss and jitter limits behind the Excellent/Good/Fair/Poor rating
+	Quality QualityThresholds `json:"quality"`
+
+	// Audio packet prefixes as hex, e.g. "0x5541"; must match the server's. Empty for the defaults.
+	AudioMagicHex       string            `json:"audio_magic"`
+	AudioSourceMagicHex string            `json:"audio_source_magic"`
+	AudioMagic          common.AudioMagic `json:"-"` // Parsed from the two above
+}
+
+type ChatConfig struct {
+	ExpandEmoji bool `json:"expand_emoji"` // Turn :smile: shortcodes into emoji
+	Markdown    bool `json:"markdown"`     // Split **bold**, *italic*, `code` into segments for the UI
+
+	OfflineQueueSize int `json:"offline_queue_size"` // Messages held while disconnected, sent on reconnect (0 disables)
+}
+
+type RecordingConfig struct {
+	Directory       string `json:"directory"`         // Where session recordings go (default "recordings")
+	IncludeOwnVoice bool   `json:"include_own_voice"` // Also record what we transmit, to a second file
+	MaxFileMB       int    `json:"max_file_mb"`       // Recording stops when a file reaches this size
+}
+
+type UpdateCheckConfig struct {
+	Enabled bool   `json:"enabled"` // Opt-in: contacts URL once on startup
+	URL     string `json:"url"`     // Returns {"version": "x.y.z", "url": "download page"}
 }
 
 type ClientConfig struct {
 	Nickname        []string               `json:"nickname"`
 	PreferredServer string                 `json:"preferred_server"`
 	PTTKey          string                 `json:"ptt_key"`
+	PanicKey        string                 `json:"panic_key"` // Toggles the panic button; "" uses PAUSE, "NONE" disables
 	AudioProcessing AudioProcessingConfig  `json:"audio_processing"`
+	WebUI           WebUIConfig            `json:"web_ui"`
+	UpdateCheck     UpdateCheckConfig      `json:"update_check"`
+	Keepalive       KeepaliveConfig        `json:"keepalive"`
+	Chat            ChatConfig             `json:"chat"`
+	Audio           AudioConfig            `json:"audio"`
+	Recording       RecordingConfig        `json:"recording"`
 	Servers         map[string]ServerEntry `json:"servers"`
 }
 
@@ -45,18 +255,140 @@ func loadClientConfig(path string) (*ClientConfig, error) {
 		return nil, err
 	}
 
-	var config ClientConfig
+	// Defaults for settings that older config files don't have
+	config := ClientConfig{
+		WebUI: WebUIConfig{
+			AutoLaunch:     true,
+			Browser:        "app",
+			SessionSummary: true,
+			BatchUpdates:   true,
+		},
+		Keepalive: KeepaliveConfig{
+			IntervalSeconds:     maxKeepaliveSeconds,
+			IdleIntervalSeconds: 3,
+		},
+		Chat: ChatConfig{
+			ExpandEmoji: true,
+			Markdown:    true,
+
+			OfflineQueueSize: 20,
+		},
+		Recording: RecordingConfig{
+			Directory: defaultRecordingDirectory,
+			MaxFileMB: defaultRecordingMaxFileMB,
+		},
+		AudioProcessing: AudioProcessingConfig{
+			NoiseGate: NoiseGateConfig{LookaheadMs: defaultGateLookaheadMs},
+			Mix:       1.0,
+		},
+		Audio: AudioConfig{
+			FrameSizeMs: common.DefaultFrameSizeMs,
+
+			OutputFailover:       true,
+			FailoverMaxBackoffMs: 10000,
+			FollowDeviceChanges:  true,
+
+			OutputBufferFrames: defaultOutputBufferFrames,
+			OutputOverflow:     outputDropNewest,
+
+			Quality: defaultQualityThresholds,
+
+			NoInputWarningSeconds: defaultNoInputWarningSecs,
+		},
+	}
 	if err := json.Unmarshal(data, &config); err != nil {
 		logger.Error("Failed to parse JSON in config file %s: %v", path, err)
 		return nil, err
 	}
 
+	if !common.ValidFrameSizeMs(config.Audio.FrameSizeMs) {
+		logger.Warn("audio.frame_size_ms=%d is not supported (10, 20, 40, 60), using %d",
+			config.Audio.FrameSizeMs, common.DefaultFrameSizeMs)
+		config.Audio.FrameSizeMs = common.DefaultFrameSizeMs
+	}
+
+	if n := config.Audio.OutputBufferFrames; n < minOutputBufferFrames || n > maxOutputBufferFrames {
+		logger.Warn("audio.output_buffer_frames=%d is outside %d-%d, using %d",
+			n, minOutputBufferFrames, maxOutputBufferFrames, defaultOutputBufferFrames)
+		config.Audio.OutputBufferFrames = defaultOutputBufferFrames
+	}
+	if config.Audio.NoInputWarningSeconds < 0 {
+		logger.Warn("audio.no_input_warning_seconds=%d is negative, using %d",
+			config.Audio.NoInputWarningSeconds, defaultNoInputWarningSecs)
+		config.Audio.NoInputWarningSeconds = defaultNoInputWarningSecs
+	}
+	switch config.Audio.OutputOverflow {
+	case outputDropNewest, outputDropOldest:
+	case "":
+		config.Audio.OutputOverflow = outputDropNewest
+	default:
+		logger.Warn("audio.output_overflow=%q is not drop_newest or drop_oldest, using %s",
+			config.Audio.OutputOverflow, outputDropNewest)
+		config.Audio.OutputOverflow = outputDropNewest
+	}
+
+	if !config.Audio.Quality.valid() {
+		logger.Warn("audio.quality thresholds %+v must be positive and loosen from excellent to fair, using the defaults",
+			config.Audio.Quality)
+		config.Audio.Quality = defaultQualityThresholds
+	}
+
+	if n := config.Keepalive.IntervalSeconds; n > maxKeepaliveSeconds {
+		logger.Warn("keepalive.interval_seconds=%d would let the server time us out, using %d", n, maxKeepaliveSeconds)
+		config.Keepalive.IntervalSeconds = maxKeepaliveSeconds
+	}
+	if n := config.Keepalive.IdleIntervalSeconds; n > maxKeepaliveSeconds {
+		logger.Warn("keepalive.idle_interval_seconds=%d would let the server time us out, using %d", n, maxKeepaliveSeconds)
+		config.Keepalive.IdleIntervalSeconds = maxKeepaliveSeconds
+	}
+
+	if n := config.Recording.MaxFileMB; n < 1 || n > maxRecordingFileMB {
+		logger.Warn("recording.max_file_mb=%d is outside 1-%d, using %d", n, maxRecordingFileMB, defaultRecordingMaxFileMB)
+		config.Recording.MaxFileMB = defaultRecordingMaxFileMB
+	}
+
+	magic, err := common.ParseAudioMagic(config.Audio.AudioMagicHex, config.Audio.AudioSourceMagicHex)
+	if err != nil {
+		logger.Warn("audio: %v, using the default audio magic %s", err, common.DefaultAudioMagic)
+		magic = common.DefaultAudioMagic
+	}
+	config.Audio.AudioMagic = magic
+
+	sanitizeProcessing(&config.AudioProcessing)
+
+	if n := config.AudioProcessing.FramesPerPacket; n == 0 {
+		config.AudioProcessing.FramesPerPacket = 1
+	} else if n < 1 || n > common.MaxFramesPerPacket {
+		logger.Warn("audio_processing.frames_per_packet=%d is outside 1-%d, using 1", n, common.MaxFramesPerPacket)
+		config.AudioProcessing.FramesPerPacket = 1
+	}
+
 	// Log what was loaded
 	logger.Info("Configuration loaded successfully")
 	logger.Debug("Nicknames: %v", config.Nickname)
 	logger.Debug("Preferred server: %s", config.PreferredServer)
-	logger.Debug("PTT key: %s", config.PTTKey)
-	logger.Debug("Audio preset: %s", config.AudioProcessing.Preset)
+	logger.Debug("PTT key: %s, panic key: %s", config.PTTKey, config.PanicKey)
+	logger.Debug("Audio preset: %s, mix=%.2f, frames per packet: %d",
+		config.AudioProcessing.Preset, config.AudioProcessing.Mix, config.AudioProcessing.FramesPerPacket)
+	logger.Debug("Web UI: auto_launch=%t, browser=%s, session_summary=%t, batch_updates=%t, spectator=%t (token set: %t)",
+		config.WebUI.AutoLaunch, config.WebUI.Browser, config.WebUI.SessionSummary, config.WebUI.BatchUpdates,
+		config.WebUI.Spectator, config.WebUI.SpectatorToken != "")
+	logger.Debug("Keepalive: interval=%ds, idle_interval=%ds",
+		config.Keepalive.IntervalSeconds, config.Keepalive.IdleIntervalSeconds)
+	logger.Debug("Chat: expand_emoji=%t, markdown=%t, offline_queue_size=%d",
+		config.Chat.ExpandEmoji, config.Chat.Markdown, config.Chat.OfflineQueueSize)
+	logger.Debug("Audio: frame_size_ms=%d, stereo=%t, panned users=%d, output_failover=%t (max backoff %dms)",
+		config.Audio.FrameSizeMs, config.Audio.Stereo, len(config.Audio.Pan),
+		config.Audio.OutputFailover, config.Audio.FailoverMaxBackoffMs)
+	logger.Debug("Audio output buffer: %d frames, overflow=%s",
+		config.Audio.OutputBufferFrames, config.Audio.OutputOverflow)
+	logger.Debug("Audio magic: %s, low_data=%t", config.Audio.AudioMagic, config.Audio.LowData)
+	logger.Debug("Audio quality thresholds: %+v", config.Audio.Quality)
+	logger.Debug("Audio devices: input=%q, output=%q, follow_device_changes=%t, no_input_warning=%ds",
+		config.Audio.InputDevice, config.Audio.OutputDevice, config.Audio.FollowDeviceChanges,
+		config.Audio.NoInputWarningSeconds)
+	logger.Debug("Recording: directory=%q, include_own_voice=%t, max_file_mb=%d",
+		config.Recording.Directory, config.Recording.IncludeOwnVoice, config.Recording.MaxFileMB)
 	logger.Debug("Configured servers: %d", len(config.Servers))
 
 	// Log server details
@@ -65,9 +397,10 @@ func loadClientConfig(path string) (*ClientConfig, error) {
 	}
 
 	// Log audio processing settings
-	logger.Debug("Audio processing - NoiseGate: enabled=%t, threshold=%.1fdB",
+	logger.Debug("Audio processing - NoiseGate: enabled=%t, threshold=%.1fdB, lookahead=%.1fms",
 		config.AudioProcessing.NoiseGate.Enabled,
-		config.AudioProcessing.NoiseGate.ThresholdDB)
+		config.AudioProcessing.NoiseGate.ThresholdDB,
+		config.AudioProcessing.NoiseGate.LookaheadMs)
 	logger.Debug("Audio processing - Compressor: enabled=%t, threshold=%.1fdB, ratio=%.1f",
 		config.AudioProcessing.Compressor.Enabled,
 		config.AudioProcessing.Compressor.ThresholdDB,
@@ -75,6 +408,19 @@ func loadClientConfig(path string) (*ClientConfig, error) {
 	logger.Debug("Audio processing - MakeupGain: enabled=%t, gain=%.1fdB",
 		config.AudioProcessing.MakeupGain.Enabled,
 		config.AudioProcessing.MakeupGain.GainDB)
+	logger.Debug("Audio processing - RogerBeep: enabled=%t, transmit=%t, freq=%.0fHz, duration=%dms",
+		config.AudioProcessing.RogerBeep.Enabled,
+		config.AudioProcessing.RogerBeep.Transmit,
+		config.AudioProcessing.RogerBeep.FrequencyHz,
+		config.AudioProcessing.RogerBeep.DurationMs)
+	logger.Debug("Audio processing - SilenceSuppression: enabled=%t, threshold=%.1fdB, hangover=%dms",
+		config.AudioProcessing.SilenceSuppression.Enabled,
+		config.AudioProcessing.SilenceSuppression.ThresholdDB,
+		config.AudioProcessing.SilenceSuppression.HangoverMs)
+	logger.Debug("Audio processing - ComfortNoise: enabled=%t, fallback=%.1fdB, max_gap=%dms",
+		config.AudioProcessing.ComfortNoise.Enabled,
+		config.AudioProcessing.ComfortNoise.FallbackDB,
+		config.AudioProcessing.ComfortNoise.MaxGapMs)
 
 	return &config, nil
 }
@@ -108,46 +454,56 @@ func applyAudioPreset(config *ClientConfig, preset string) {
 	oldPreset := config.AudioProcessing.Preset
 	config.AudioProcessing.Preset = preset
 
-	switch preset {
-	case "off":
-		logger.Debug("Setting audio preset 'off' - disabling all processing")
-		config.AudioProcessing.NoiseGate.Enabled = false
-		config.AudioProcessing.Compressor.Enabled = false
-		config.AudioProcessing.MakeupGain.Enabled = false
-
-	case "light":
-		logger.Debug("Setting audio preset 'light' - minimal processing")
-		config.AudioProcessing.NoiseGate.Enabled = true
-		config.AudioProcessing.NoiseGate.ThresholdDB = -45
-		config.AudioProcessing.Compressor.Enabled = true
-		config.AudioProcessing.Compressor.ThresholdDB = -18
-		config.AudioProcessing.Compressor.Ratio = 2.0
-		config.AudioProcessing.MakeupGain.Enabled = true
-		config.AudioProcessing.MakeupGain.GainDB = 3
-
-	case "balanced":
-		logger.Debug("Setting audio preset 'balanced' - moderate processing")
-		config.AudioProcessing.NoiseGate.Enabled = true
-		config.AudioProcessing.NoiseGate.ThresholdDB = -35
-		config.AudioProcessing.Compressor.Enabled = true
-		config.AudioProcessing.Compressor.ThresholdDB = -18
-		config.AudioProcessing.Compressor.Ratio = 3.0
-		config.AudioProcessing.MakeupGain.Enabled = true
-		config.AudioProcessing.MakeupGain.GainDB = 6
-
-	case "aggressive":
-		logger.Debug("Setting audio preset 'aggressive' - heavy processing")
-		config.AudioProcessing.NoiseGate.Enabled = true
-		config.AudioProcessing.NoiseGate.ThresholdDB = -25
-		config.AudioProcessing.Compressor.Enabled = true
-		config.AudioProcessing.Compressor.ThresholdDB = -18
-		config.AudioProcessing.Compressor.Ratio = 4.0
-		config.AudioProcessing.MakeupGain.Enabled = true
-		config.AudioProcessing.MakeupGain.GainDB = 9
-
-	default:
-		logger.Warn("Unknown audio preset: %s", preset)
-		return
+	// Presets defined in the config take precedence over the built-ins
+	if custom, ok := config.AudioProcessing.Presets[preset]; ok {
+		logger.Debug("Setting config preset '%s'", preset)
+		custom.applyTo(&config.AudioProcessing)
+	} else {
+		switch preset {
+		case "off":
+			logger.Debug("Setting audio preset 'off' - disabling all processing")
+			config.AudioProcessing.NoiseGate.Enabled = false
+			config.AudioProcessing.Compressor.Enabled = false
+			config.AudioProcessing.MakeupGain.Enabled = false
+
+		case "light":
+			logger.Debug("Setting audio preset 'light' - minimal processing")
+			config.AudioProcessing.NoiseGate.Enabled = true
+			config.AudioProcessing.NoiseGate.ThresholdDB = -45
+			config.AudioProcessing.Compressor.Enabled = true
+			config.AudioProcessing.Compressor.ThresholdDB = -18
+			config.AudioProcessing.Compressor.Ratio = 2.0
+			config.AudioProcessing.MakeupGain.Enabled = true
+			config.AudioProcessing.MakeupGain.GainDB = 3
+
+		case "balanced":
+			logger.Debug("Setting audio preset 'balanced' - moderate processing")
+			config.AudioProcessing.NoiseGate.Enabled = true
+			config.AudioProcessing.NoiseGate.ThresholdDB = -35
+			config.AudioProcessing.Compressor.Enabled = true
+			config.AudioProcessing.Compressor.ThresholdDB = -18
+			config.AudioProcessing.Compressor.Ratio = 3.0
+			config.AudioProcessing.MakeupGain.Enabled = true
+			config.AudioProcessing.MakeupGain.GainDB = 6
+
+		case "aggressive":
+			logger.Debug("Setting audio preset 'aggressive' - heavy processing")
+			config.AudioProcessing.NoiseGate.Enabled = true
+			config.AudioProcessing.NoiseGate.ThresholdDB = -25
+			config.AudioProcessing.Compressor.Enabled = true
+			config.AudioProcessing.Compressor.ThresholdDB = -18
+			config.AudioProcessing.Compressor.Ratio = 4.0
+			config.AudioProcessing.MakeupGain.Enabled = true
+			config.AudioProcessing.MakeupGain.GainDB = 9
+
+		default:
+			logger.Warn("Unknown audio preset: %s", preset)
+			return
+		}
+
+		// Built-ins use the default chain at full mix, whatever the last preset set
+		config.AudioProcessing.Chain = nil
+		config.AudioProcessing.Mix = 1.0
 	}
 
 	logger.Info("Audio preset changed: %s -> %s", oldPreset, preset)
@@ -165,6 +521,39 @@ func applyAudioPreset(config *ClientConfig, preset string) {
 		config.AudioProcessing.MakeupGain.GainDB)
 }
 
+// applyTo copies the preset's parameters into the processing config
+func (p ProcessingPreset) applyTo(ap *AudioProcessingConfig) {
+	ap.NoiseGate = p.NoiseGate
+	ap.Compressor = p.Compressor
+	ap.MakeupGain = p.MakeupGain
+	ap.HighPass = p.HighPass
+	ap.Chain = slices.Clone(p.Chain)
+	ap.Mix = 1.0
+	if p.Mix != nil {
+		ap.Mix = clampMix(*p.Mix)
+	}
+}
+
+// isAudioPreset reports whether name is a built-in or config-defined preset
+func isAudioPreset(config *ClientConfig, name string) bool {
+	if builtinAudioPresets[name] {
+		return true
+	}
+	if config == nil {
+		return false
+	}
+	_, ok := config.AudioProcessing.Presets[name]
+	return ok
+}
+
+// customPresetNames lists the config-defined presets, sorted
+func customPresetNames(config *ClientConfig) []string {
+	if config == nil {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(config.AudioProcessing.Presets))
+}
+
 // Apply audio settings to the processor
 func applyAudioConfigToProcessor(config *ClientConfig) {
 	if audioProcessor == nil {
@@ -180,6 +569,9 @@ func applyAudioConfigToProcessor(config *ClientConfig) {
 		config.AudioProcessing.Compressor.Enabled,
 		config.AudioProcessing.MakeupGain.Enabled)
 
+	// Presets and UI edits land here too, so check the values on every apply
+	sanitizeProcessing(&config.AudioProcessing)
+
 	// Update processor settings based on config
 	audioProcessor.enableNoiseGate = config.AudioProcessing.NoiseGate.Enabled
 	audioProcessor.enableCompressor = config.AudioProcessing.Compressor.Enabled
@@ -189,7 +581,9 @@ func applyAudioConfigToProcessor(config *ClientConfig) {
 	if audioProcessor.noiseGate != nil {
 		oldThreshold := audioProcessor.noiseGate.threshold
 		audioProcessor.noiseGate.threshold = config.AudioProcessing.NoiseGate.ThresholdDB
-		logger.Debug("NoiseGate threshold: %.1fdB -> %.1fdB", oldThreshold, config.AudioProcessing.NoiseGate.ThresholdDB)
+		audioProcessor.SetGateLookahead(time.Duration(config.AudioProcessing.NoiseGate.LookaheadMs * float32(time.Millisecond)))
+		logger.Debug("NoiseGate threshold: %.1fdB -> %.1fdB, lookahead %.1fms", oldThreshold,
+			config.AudioProcessing.NoiseGate.ThresholdDB, config.AudioProcessing.NoiseGate.LookaheadMs)
 	} else {
 		logger.Warn("NoiseGate processor is nil, cannot update threshold")
 	}
@@ -219,5 +613,67 @@ func applyAudioConfigToProcessor(config *ClientConfig) {
 		logger.Warn("MakeupGain processor is nil, cannot update gain")
 	}
 
+	if audioProcessor.highPass != nil {
+		audioProcessor.highPass.setCutoff(config.AudioProcessing.HighPass.CutoffHz)
+	}
+	if err := audioProcessor.SetProcessingChain(config.AudioProcessing.Chain); err != nil {
+		logger.Warn("Invalid processing chain, keeping the current one: %v", err)
+	}
+	audioProcessor.SetMix(config.AudioProcessing.Mix)
+
+	suppression := config.AudioProcessing.SilenceSuppression
+	audioProcessor.enableSilenceSuppression = suppression.Enabled
+	if audioProcessor.silenceSuppressor != nil {
+		if suppression.ThresholdDB != 0 {
+			audioProcessor.silenceSuppressor.thresholdDB = suppression.ThresholdDB
+		}
+		if suppression.HangoverMs > 0 {
+			audioProcessor.silenceSuppressor.hangover = time.Duration(suppression.HangoverMs) * time.Millisecond
+		}
+		logger.Debug("SilenceSuppression: enabled=%t, threshold=%.1fdB, hangover=%v",
+			suppression.Enabled, audioProcessor.silenceSuppressor.thresholdDB, audioProcessor.silenceSuppressor.hangover)
+	}
+
+	duck := config.AudioProcessing.DuckOnTransmit
+	audioProcessor.enableDucking = duck.Enabled
+	if audioProcessor.ducker != nil {
+		gainDB := duck.GainDB
+		if gainDB == 0 {
+			gainDB = defaultDuckGainDB
+		}
+		audioProcessor.SetDuckGain(gainDB)
+		logger.Debug("DuckOnTransmit: enabled=%t, gain=%.1fdB", duck.Enabled, gainDB)
+	}
+
+	comfort := config.AudioProcessing.ComfortNoise
+	audioProcessor.enableComfortNoise = comfort.Enabled
+	if audioProcessor.comfortNoise != nil {
+		if comfort.FallbackDB != 0 {
+			audioProcessor.comfortNoise.fallbackDB = comfort.FallbackDB
+		}
+		if comfort.MaxGapMs > 0 {
+			audioProcessor.comfortNoise.maxGap = time.Duration(comfort.MaxGapMs) * time.Millisecond
+		}
+		logger.Debug("ComfortNoise: enabled=%t, fallback=%.1fdB, max_gap=%v",
+			comfort.Enabled, audioProcessor.comfortNoise.fallbackDB, audioProcessor.comfortNoise.maxGap)
+	}
+
+	receive := config.AudioProcessing.ReceiveProcessing
+	if audioProcessor.receive != nil {
+		gateDB := receive.NoiseGateThresholdDB
+		if gateDB == 0 {
+			gateDB = defaultReceiveGateDB
+		}
+		audioProcessor.receive.configure(receive.Enabled, receive.NoiseGate, gateDB, receive.HighPassHz)
+		logger.Debug("ReceiveProcessing: enabled=%t, noise_gate=%t (%.1fdB), high_pass=%.0fHz",
+			receive.Enabled, receive.NoiseGate, gateDB, receive.HighPassHz)
+	}
+
+	audioProcessor.SetQualityThresholds(config.Audio.Quality)
+	audioProcessor.SetJitterTarget(defaultJitterTarget)
+	if config.Audio.LowData {
+		applyLowDataOverrides()
+	}
+
 	logger.Info("Audio configuration applied to processor successfully")
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestProcessingLimitApply(t *testing.T) {
+	nan := float32(math.NaN())
+	for _, tt := range []struct {
+		name  string
+		limit processingLimit
+		in    float32
+		want  float32
+	}{
+		{"in range", compressorRatioLimit, 4, 4},
+		{"NaN falls back", compressorRatioLimit, nan, 3},
+		{"ratio 0 means unset", compressorRatioLimit, 0, 3},
+		{"ratio below 1 clamps", compressorRatioLimit, 0.5, 1},
+		{"ratio above max clamps", compressorRatioLimit, 50, 20},
+		{"unset gate threshold", noiseGateThresholdLimit, 0, -40},
+		{"gate threshold too low", noiseGateThresholdLimit, -120, -80},
+		{"zero lookahead is real", noiseGateLookaheadLimit, 0, 0},
+		{"NaN lookahead", noiseGateLookaheadLimit, nan, defaultGateLookaheadMs},
+		{"zero compressor threshold is real", compressorThresholdLimit, 0, 0},
+		{"positive makeup gain only", makeupGainLimit, -6, 0},
+	} {
+		if got := tt.limit.apply(tt.in); got != tt.want {
+			t.Errorf("%s: apply(%g) = %g, want %g", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeProcessing(t *testing.T) {
+	p := AudioProcessingConfig{Mix: 1.5}
+	p.NoiseGate.ThresholdDB = float32(math.NaN())
+	p.NoiseGate.LookaheadMs = 50
+	p.Compressor.Ratio = 0
+	p.Compressor.ThresholdDB = -100
+	p.MakeupGain.GainDB = 30
+
+	sanitizeProcessing(&p)
+	if p.NoiseGate.ThresholdDB != -40 || p.NoiseGate.LookaheadMs != 20 {
+		t.Errorf("noise gate = %+v, want threshold -40 and lookahead 20", p.NoiseGate)
+	}
+	if p.Compressor.Ratio != 3 || p.Compressor.ThresholdDB != -60 {
+		t.Errorf("compressor = %+v, want ratio 3 and threshold -60", p.Compressor)
+	}
+	if p.MakeupGain.GainDB != 24 || p.Mix != 1 {
+		t.Errorf("makeup gain %g and mix %g, want 24 and 1", p.MakeupGain.GainDB, p.Mix)
+	}
+}
+
+func TestBuiltinPresetResetsChainAndMix(t *testing.T) {
+	mix := float32(0.4)
+	config := &ClientConfig{}
+	config.AudioProcessing.Presets = map[string]ProcessingPreset{
+		"radio": {Chain: []string{"compressor", "noise_gate"}, Mix: &mix},
+	}
+
+	applyAudioPreset(config, "radio")
+	if len(config.AudioProcessing.Chain) != 2 || config.AudioProcessing.Mix != mix {
+		t.Fatalf("custom preset not applied: chain %v, mix %v", config.AudioProcessing.Chain, config.AudioProcessing.Mix)
+	}
+
+	// Going back to a built-in mustn't keep the custom preset's order or blend
+	applyAudioPreset(config, "balanced")
+	if config.AudioProcessing.Chain != nil || config.AudioProcessing.Mix != 1 {
+		t.Errorf("balanced kept chain %v and mix %v, want the default chain at full mix",
+			config.AudioProcessing.Chain, config.AudioProcessing.Mix)
+	}
+}
@@ -0,0 +1,188 @@
+// FILE: client/connstate.go
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+)
+
+// ConnPhase is where the client is in reaching and staying on the server:
+//
+//	Disconnected -> Connecting -> Authenticating -> Connected
+//	Connected -> Reconnecting -> Authenticating
+//
+// Any phase can drop back to Disconnected.
+type ConnPhase string
+
+const (
+	PhaseDisconnected   ConnPhase = "disconnected"
+	PhaseConnecting     ConnPhase = "connecting"     // Sent connect, waiting for accept
+	PhaseAuthenticating ConnPhase = "authenticating" // Accepted, setting up chat encryption
+	PhaseConnected      ConnPhase = "connected"
+	PhaseReconnecting   ConnPhase = "reconnecting" // Link lost, trying to get back on
+)
+
+// connTransitions lists the phases each phase may move to, besides Disconnected
+var connTransitions = map[ConnPhase][]ConnPhase{
+	PhaseDisconnected:   {PhaseConnecting},
+	PhaseConnecting:     {PhaseAuthenticating},
+	PhaseAuthenticating: {PhaseConnected},
+	PhaseConnected:      {PhaseReconnecting},
+	PhaseReconnecting:   {PhaseAuthenticating},
+}
+
+// canTransition reports whether the connection may move from one phase to another
+func canTransition(from, to ConnPhase) bool {
+	if to == PhaseDisconnected {
+		return true
+	}
+	return slices.Contains(connTransitions[from], to)
+}
+
+// label is the phase as shown in the UI and tray
+func (p ConnPhase) label() string {
+	switch p {
+	case PhaseConnecting:
+		return "Connecting"
+	case PhaseAuthenticating:
+		return "Securing connection"
+	case PhaseConnected:
+		return "Connected"
+	case PhaseReconnecting:
+		return "Reconnecting"
+	default:
+		return "Disconnected"
+	}
+}
+
+// enterPhase moves the connection to phase, logging transitions the state
+// machine doesn't allow. Leaving the server also forgets the session's crypto
+// and typing state and its branding, and reports the session summary.
+func enterPhase(phase ConnPhase) error {
+	if err := appState.SetConnectionPhase(phase); err != nil {
+		logger.Error("Connection state: %v", err)
+		return err
+	}
+	if phase == PhaseDisconnected {
+		cryptoReady = false
+		appState.ClearTyping()
+		appState.SetTheme(common.Theme{})
+		reportSessionSummary()
+	}
+	return nil
+}
+
+// errBadTransition reports a phase change the state machine refuses
+func errBadTransition(from, to ConnPhase) error {
+	return fmt.Errorf("cannot go from %s to %s", from, to)
+}
+
+// Wait between reconnect attempts, doubling from the minimum up to the maximum
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// sessionEnd says why a session with the server ended and whether to get back on
+type sessionEnd struct {
+	reason    string
+	reconnect bool
+	after     time.Duration // Wait before the first reconnect attempt
+}
+
+// serverSession is one connection to the server, from its accept until the
+// link is lost or we're sent away. Its goroutines stop with ctx.
+type serverSession struct {
+	conn  *net.UDPConn
+	ctx   context.Context
+	stop  context.CancelFunc
+	ended chan sessionEnd
+
+	early [][]byte // Control messages from before the response handler started
+}
+
+func newServerSession(conn *net.UDPConn) *serverSession {
+	ctx, stop := context.WithCancel(appCtx)
+	return &serverSession{conn: conn, ctx: ctx, stop: stop, ended: make(chan sessionEnd, 1)}
+}
+
+// end reports why the session is over; the first reason wins
+func (s *serverSession) end(end sessionEnd) {
+	select {
+	case s.ended <- end:
+	default:
+	}
+}
+
+// lost ends the session because the link failed, to reconnect straight away
+func (s *serverSession) lost(reason string) {
+	s.end(sessionEnd{reason: reason, reconnect: true, after: reconnectMinDelay})
+}
+
+// wait blocks until the session ends or the app shuts down
+func (s *serverSession) wait() sessionEnd {
+	select {
+	case end := <-s.ended:
+		return end
+	case <-appCtx.Done():
+		return sessionEnd{reason: "shutting down"}
+	}
+}
+
+// close stops the session's goroutines and drops the connection
+func (s *serverSession) close() {
+	s.stop()
+	if serverConn == s.conn {
+		serverConn = nil
+	}
+	s.conn.Close()
+}
+
+// reconnect gets back on the server after a session ended, retrying with
+// backoff. It returns nil when it gives up: the server refused us or the app
+// is shutting down.
+func reconnect(config *ClientConfig, end sessionEnd) *serverSession {
+	channel := currentChannel
+	enterPhase(PhaseReconnecting)
+	appState.SetConnected(false, "", "", "")
+	delay := max(end.after, reconnectMinDelay)
+	if delay > reconnectMinDelay {
+		appState.AddMessage(fmt.Sprintf("%s - reconnecting in about %v", end.reason, delay), "warning")
+	} else {
+		appState.AddMessage(fmt.Sprintf("🔄 %s - reconnecting...", end.reason), "warning")
+	}
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-appCtx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		logger.Info("Reconnect attempt %d", attempt)
+		s, accepted, err := openSession(config, PhaseReconnecting)
+		if err == nil {
+			logger.Info("Reconnected after %d attempts", attempt)
+			appState.AddMessage("✅ Reconnected", "success")
+			if channel != currentChannel && slices.Contains(accepted.Channels, channel) {
+				changeChannel(channel)
+			}
+			return s
+		}
+
+		var reject *rejectError
+		if errors.As(err, &reject) {
+			logger.Error("Reconnect refused: %v", err)
+			appState.AddMessage(fmt.Sprintf("Reconnect failed: %v", err), "error")
+			return nil
+		}
+		delay = min(delay*2, reconnectMaxDelay)
+		logger.Warn("Reconnect attempt %d failed: %v (next in %v)", attempt, err, delay)
+	}
+}
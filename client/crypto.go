@@ -2,6 +2,7 @@
 package main
 
 import (
+	"ahcli/common"
 	"ahcli/common/logger"
 	"crypto/cipher"
 	"crypto/rand"
@@ -20,6 +21,10 @@ type ClientCryptoManager struct {
 	sharedSecret    [32]byte
 	cipher          cipher.AEAD
 	ready           bool
+
+	// Per-message keys when the server agreed to the ratchet; nil means cipher is used
+	send *common.Ratchet // client -> server
+	recv *common.Ratchet // server -> client
 }
 
 var clientCrypto *ClientCryptoManager
@@ -53,8 +58,9 @@ func (ccm *ClientCryptoManager) GetPublicKey() [32]byte {
 	return ccm.publicKey
 }
 
-// CompleteHandshake completes the key exchange with server public key
-func (ccm *ClientCryptoManager) CompleteHandshake(serverPublicKey [32]byte) error {
+// CompleteHandshake completes the key exchange with server public key.
+// With ratchet set, each chat message is sealed under its own key.
+func (ccm *ClientCryptoManager) CompleteHandshake(serverPublicKey [32]byte, ratchet bool) error {
 	logger.Debug("Completing handshake with server public key: %s",
 		base64.StdEncoding.EncodeToString(serverPublicKey[:]))
 
@@ -84,8 +90,14 @@ func (ccm *ClientCryptoManager) CompleteHandshake(serverPublicKey [32]byte) erro
 		return fmt.Errorf("failed to create ChaCha20-Poly1305 cipher: %v", err)
 	}
 
+	ccm.send, ccm.recv = nil, nil
+	if ratchet {
+		ccm.send = common.NewRatchet(derivedKey, common.RatchetClientToServer)
+		ccm.recv = common.NewRatchet(derivedKey, common.RatchetServerToClient)
+	}
+
 	ccm.ready = true
-	logger.Info("Crypto handshake completed successfully - E2E encryption ready")
+	logger.Info("Crypto handshake completed successfully - E2E encryption ready (ratchet: %t)", ratchet)
 
 	return nil
 }
@@ -97,6 +109,16 @@ func (ccm *ClientCryptoManager) EncryptMessage(message string) ([]byte, error) {
 		return nil, fmt.Errorf("crypto not ready - handshake not completed")
 	}
 
+	if ccm.send != nil {
+		encrypted, err := ccm.send.Seal([]byte(message))
+		if err != nil {
+			logger.Error("Ratchet encryption failed: %v", err)
+			return nil, err
+		}
+		logger.Debug("Encrypted message with ratchet key: %d bytes plaintext -> %d bytes", len(message), len(encrypted))
+		return encrypted, nil
+	}
+
 	// Generate random nonce
 	nonce := make([]byte, ccm.cipher.NonceSize())
 	if _, err := rand.Read(nonce); err != nil {
@@ -124,6 +146,16 @@ func (ccm *ClientCryptoManager) DecryptMessage(data []byte) (string, error) {
 		return "", fmt.Errorf("crypto not ready - handshake not completed")
 	}
 
+	if ccm.recv != nil {
+		plaintext, err := ccm.recv.Open(data)
+		if err != nil {
+			logger.Error("Ratchet decryption failed: %v", err)
+			return "", err
+		}
+		logger.Debug("Decrypted message with ratchet key: %d bytes -> %d bytes plaintext", len(data), len(plaintext))
+		return string(plaintext), nil
+	}
+
 	nonceSize := ccm.cipher.NonceSize()
 	if len(data) < nonceSize {
 		logger.Error("Encrypted data too short: %d bytes (need at least %d)", len(data), nonceSize)
@@ -152,6 +184,11 @@ func (ccm *ClientCryptoManager) IsReady() bool {
 	return ready
 }
 
+// UsesRatchet reports whether chat uses per-message keys
+func (ccm *ClientCryptoManager) UsesRatchet() bool {
+	return ccm != nil && ccm.send != nil
+}
+
 // generatePrivateKey generates a random X25519 private key
 func generatePrivateKey() ([32]byte, error) {
 	logger.Debug("Generating new X25519 private key")
@@ -0,0 +1,253 @@
+// FILE: client/diagnostics.go
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// diagnosticsReport is everything worth attaching to a bug report, served by
+// GET /api/diagnostics
+type diagnosticsReport struct {
+	Version     string                `json:"version"`
+	GeneratedAt time.Time             `json:"generatedAt"`
+	Runtime     diagnosticsRuntime    `json:"runtime"`
+	Audio       diagnosticsAudio      `json:"audio"`
+	Processing  diagnosticsProcessing `json:"processing"`
+	Jitter      *JitterBufferState    `json:"jitterBuffer"` // nil before audio is set up
+	Network     diagnosticsNetwork    `json:"network"`
+	Crypto      diagnosticsCrypto     `json:"crypto"`
+	Errors      []string              `json:"recentErrors"` // Latest warnings and errors from the log
+}
+
+type diagnosticsRuntime struct {
+	GoVersion  string `json:"goVersion"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	Goroutines int    `json:"goroutines"`
+	HeapKB     uint64 `json:"heapKB"`
+
+	UIStalled       bool  `json:"uiStalled"`       // The UI watchdog saw broadcasts stop
+	LastBroadcastMs int64 `json:"lastBroadcastMs"` // Since the last UI update went out
+}
+
+type diagnosticsAudio struct {
+	Running    bool              `json:"running"`
+	SampleRate int               `json:"sampleRate"`
+	FrameSize  int               `json:"frameSize"` // Samples per frame
+	FrameMs    int64             `json:"frameMs"`
+	Stereo     bool              `json:"stereo"`
+	Devices    AudioDeviceReport `json:"devices"`
+
+	OutputQueued   int `json:"outputQueued"` // Frames waiting for the speakers
+	OutputCapacity int `json:"outputCapacity"`
+	OutputDropped  int `json:"outputDropped"` // Received frames lost to a full queue
+}
+
+type diagnosticsProcessing struct {
+	Preset     string           `json:"preset"`
+	Bypass     bool             `json:"bypass"`
+	Chain      []string         `json:"chain"`
+	Mix        float32          `json:"mix"`
+	NoiseGate  NoiseGateConfig  `json:"noiseGate"`
+	Compressor CompressorConfig `json:"compressor"`
+	MakeupGain MakeupGainConfig `json:"makeupGain"`
+	HighPass   HighPassConfig   `json:"highPass"`
+	Quality    string           `json:"quality"`
+}
+
+type diagnosticsNetwork struct {
+	Phase        ConnPhase `json:"phase"`
+	Connected    bool      `json:"connected"`
+	Server       string    `json:"server"`
+	Nickname     string    `json:"nickname"`
+	Channel      string    `json:"channel"`
+	ConnectedFor string    `json:"connectedFor,omitempty"`
+	RTTMs        int64     `json:"rttMs"`
+	PacketLoss   float32   `json:"packetLoss"` // 0.0 - 1.0
+	JitterMs     float64   `json:"jitterMs"`
+	PacketsRx    int       `json:"packetsRx"`
+	PacketsTx    int       `json:"packetsTx"`
+}
+
+type diagnosticsCrypto struct {
+	Ready    bool `json:"ready"`
+	Ratchet  bool `json:"ratchet"`  // Per-message chat keys
+	Required bool `json:"required"` // Server refuses plaintext chat
+}
+
+// collectDiagnostics gathers the report from AppState, the audio processor and the runtime
+func collectDiagnostics() diagnosticsReport {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	report := diagnosticsReport{
+		Version:     common.CurrentVersion,
+		GeneratedAt: time.Now(),
+		Runtime: diagnosticsRuntime{
+			GoVersion:  runtime.Version(),
+			OS:         runtime.GOOS,
+			Arch:       runtime.GOARCH,
+			Goroutines: runtime.NumGoroutine(),
+			HeapKB:     mem.HeapAlloc / 1024,
+
+			UIStalled:       uiStalled.Load(),
+			LastBroadcastMs: time.Since(time.Unix(0, lastBroadcast.Load())).Milliseconds(),
+		},
+		Errors: logger.RecentProblems(),
+	}
+
+	audioMutex.Lock()
+	report.Audio.Running = audioCancel != nil
+	audioMutex.Unlock()
+	report.Audio.SampleRate = sampleRate
+	report.Audio.FrameSize = framesPerBuffer()
+	report.Audio.FrameMs = frameDuration().Milliseconds()
+	report.Audio.Stereo = appState.IsStereoOutput()
+	report.Audio.Devices = appState.GetAudioDeviceReport()
+	report.Audio.OutputQueued = len(incomingAudio)
+	report.Audio.OutputCapacity = cap(incomingAudio)
+	report.Audio.OutputDropped = appState.GetOutputDropped()
+
+	webTUI.RLock()
+	report.Processing.Preset = webTUI.AudioPreset
+	webTUI.RUnlock()
+	report.Processing.Chain = defaultProcessingChain
+	if currentConfig != nil {
+		processing := currentConfig.AudioProcessing
+		if len(processing.Chain) > 0 {
+			report.Processing.Chain = processing.Chain
+		}
+		report.Processing.Mix = processing.Mix
+		report.Processing.NoiseGate = processing.NoiseGate
+		report.Processing.Compressor = processing.Compressor
+		report.Processing.MakeupGain = processing.MakeupGain
+		report.Processing.HighPass = processing.HighPass
+	}
+
+	latency, loss := appState.GetNetworkQuality()
+	rx, tx := appState.GetPacketCounts()
+	report.Network = diagnosticsNetwork{
+		RTTMs:      latency.Milliseconds(),
+		PacketLoss: loss,
+		PacketsRx:  rx,
+		PacketsTx:  tx,
+	}
+	appState.mutex.RLock()
+	report.Network.Phase = appState.Phase
+	report.Network.Connected = appState.Connected
+	report.Network.Server = appState.ServerName
+	report.Network.Nickname = appState.Nickname
+	report.Network.Channel = appState.CurrentChannel
+	if appState.Connected && !appState.ConnectionTime.IsZero() {
+		report.Network.ConnectedFor = time.Since(appState.ConnectionTime).Round(time.Second).String()
+	}
+	appState.mutex.RUnlock()
+
+	if audioProcessor != nil {
+		stats := audioProcessor.GetStats()
+		jitter := audioProcessor.GetJitterBufferState()
+		report.Jitter = &jitter
+		report.Network.JitterMs = float64(stats.NetworkJitter) / float64(time.Millisecond)
+		report.Processing.Bypass = audioProcessor.GetBypassState()
+		report.Processing.Quality = stats.AudioQuality
+	}
+
+	report.Crypto = diagnosticsCrypto{
+		Ready:    cryptoReady && clientCrypto != nil && clientCrypto.IsReady(),
+		Ratchet:  clientCrypto.UsesRatchet(),
+		Required: serverRequiresEncryption,
+	}
+
+	return report
+}
+
+// Size of the log tail served by /api/logs unless ?max_kb= asks otherwise
+const (
+	defaultLogTailKB = 512
+	maxLogTailKB     = 8192
+)
+
+// isLocalRequest reports whether a request came from this machine. The web
+// server listens on every interface, and logs hold server addresses, nicknames
+// and chat activity that shouldn't be readable from the LAN.
+func isLocalRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleAPILogs serves the end of the current log file as plain text, as a
+// download with ?download=1
+func handleAPILogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isLocalRequest(r) {
+		logger.Warn("Refused log request from non-local address %s", r.RemoteAddr)
+		http.Error(w, "Logs are only available from this machine", http.StatusForbidden)
+		return
+	}
+
+	maxKB := defaultLogTailKB
+	if s := r.URL.Query().Get("max_kb"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			http.Error(w, "max_kb must be a positive number", http.StatusBadRequest)
+			return
+		}
+		maxKB = min(n, maxLogTailKB)
+	}
+
+	tail, err := logger.Tail(int64(maxKB) * 1024)
+	if err != nil {
+		logger.Error("Failed to read log for API request: %v", err)
+		http.Error(w, "Could not read the log file", http.StatusInternalServerError)
+		return
+	}
+	logger.Debug("API log request from %s: %d bytes", r.RemoteAddr, len(tail))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if r.URL.Query().Get("download") != "" {
+		name := fmt.Sprintf("%s-%s.txt", filepath.Base(logger.GetLogPath()), time.Now().Format("20060102-150405"))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	}
+	w.Write(tail)
+}
+
+// rotateLogs starts a fresh log file, keeping the old one beside it
+func rotateLogs() error {
+	backup, err := logger.Rotate()
+	if err != nil {
+		logger.Error("Log rotation failed: %v", err)
+		return err
+	}
+	appState.AddMessage(fmt.Sprintf("📄 Log rotated - previous log saved as %s", backup), "info")
+	return nil
+}
+
+// handleAPIDiagnostics serves the diagnostics report for bug reports
+func handleAPIDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	logger.Debug("API diagnostics request from %s", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(collectDiagnostics())
+}
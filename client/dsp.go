@@ -0,0 +1,143 @@
+// FILE: client/dsp.go
+package main
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Spectrum analyzer settings for the UI
+const (
+	spectrumBands   = 16
+	spectrumMinHz   = 50.0
+	spectrumMaxHz   = 20000.0
+	spectrumFloorDB = -90.0 // Shown as an empty band
+	spectrumDecay   = 0.85  // Per-frame fall-off so peaks stay visible between pushes
+)
+
+// How often band levels are pushed to the UI
+const spectrumInterval = 100 * time.Millisecond
+
+// fft computes an in-place radix-2 FFT. len(re) must be a power of two.
+func fft(re, im []float64) {
+	n := len(re)
+	if n < 2 {
+		return
+	}
+
+	// Bit-reversal permutation
+	shift := 64 - bits.TrailingZeros(uint(n))
+	for i := 0; i < n; i++ {
+		j := int(bits.Reverse64(uint64(i)) >> shift)
+		if j > i {
+			re[i], re[j] = re[j], re[i]
+			im[i], im[j] = im[j], im[i]
+		}
+	}
+
+	// Butterflies
+	for size := 2; size <= n; size <<= 1 {
+		half := size / 2
+		stepRe, stepIm := math.Cos(-2*math.Pi/float64(size)), math.Sin(-2*math.Pi/float64(size))
+		wr, wi := 1.0, 0.0
+		for k := 0; k < half; k++ {
+			for start := 0; start < n; start += size {
+				a, b := start+k, start+k+half
+				tr := wr*re[b] - wi*im[b]
+				ti := wr*im[b] + wi*re[b]
+				re[b], im[b] = re[a]-tr, im[a]-ti
+				re[a], im[a] = re[a]+tr, im[a]+ti
+			}
+			// Next twiddle by rotation instead of a sin/cos per butterfly
+			wr, wi = wr*stepRe-wi*stepIm, wr*stepIm+wi*stepRe
+		}
+	}
+}
+
+// SpectrumAnalyzer turns input frames into a few log-spaced band levels.
+// Buffers are sized on the first frame and reused, so analysis doesn't allocate.
+type SpectrumAnalyzer struct {
+	frameLen int
+	window   []float64 // Hann window over the frame
+	re, im   []float64 // FFT buffers, zero-padded to a power of two
+	edges    []int     // FFT bin where each band starts; len(bands)+1 entries
+	bands    []float32 // Smoothed levels, 0 (floor) .. 1 (full scale)
+}
+
+func newSpectrumAnalyzer() *SpectrumAnalyzer {
+	return &SpectrumAnalyzer{bands: make([]float32, spectrumBands)}
+}
+
+// resize prepares the window and buffers for a new frame length
+func (sa *SpectrumAnalyzer) resize(frameLen int) {
+	size := 1
+	for size < frameLen {
+		size <<= 1
+	}
+
+	sa.frameLen = frameLen
+	sa.re = make([]float64, size)
+	sa.im = make([]float64, size)
+	sa.window = make([]float64, frameLen)
+	for i := range sa.window {
+		sa.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frameLen-1))
+	}
+
+	// Log-spaced band edges; every band gets at least one bin
+	binHz := float64(sampleRate) / float64(size)
+	sa.edges = make([]int, spectrumBands+1)
+	ratio := math.Pow(spectrumMaxHz/spectrumMinHz, 1.0/spectrumBands)
+	for i := range sa.edges {
+		bin := int(spectrumMinHz * math.Pow(ratio, float64(i)) / binHz)
+		if i > 0 && bin <= sa.edges[i-1] {
+			bin = sa.edges[i-1] + 1
+		}
+		sa.edges[i] = min(bin, size/2)
+	}
+}
+
+// Analyze folds one frame into the band levels and returns them. The returned
+// slice is reused by the next call.
+func (sa *SpectrumAnalyzer) Analyze(samples []int16) []float32 {
+	if len(samples) < 2 {
+		return sa.bands
+	}
+	if len(samples) != sa.frameLen {
+		sa.resize(len(samples))
+	}
+
+	for i := range sa.re {
+		sa.re[i], sa.im[i] = 0, 0
+	}
+	for i, sample := range samples {
+		sa.re[i] = float64(sample) / 32768.0 * sa.window[i]
+	}
+	fft(sa.re, sa.im)
+
+	// Hann window coherent gain is 0.5, so a full-scale sine peaks at frameLen/4
+	norm := float64(sa.frameLen) / 4
+	for band := 0; band < spectrumBands; band++ {
+		var peak float64
+		for bin := sa.edges[band]; bin < sa.edges[band+1]; bin++ {
+			peak = math.Max(peak, math.Hypot(sa.re[bin], sa.im[bin]))
+		}
+
+		level := float32(0)
+		if peak > 0 {
+			db := 20 * math.Log10(peak/norm)
+			level = float32(math.Min(1, math.Max(0, 1-db/spectrumFloorDB)))
+		}
+
+		// Rise instantly, fall slowly
+		sa.bands[band] = max(level, sa.bands[band]*spectrumDecay)
+	}
+	return sa.bands
+}
+
+// Reset clears the band levels, e.g. when transmission stops
+func (sa *SpectrumAnalyzer) Reset() {
+	for i := range sa.bands {
+		sa.bands[i] = 0
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFFTMatchesDFT(t *testing.T) {
+	const n = 16
+	re := make([]float64, n)
+	im := make([]float64, n)
+	for i := range re {
+		re[i] = math.Sin(2*math.Pi*3*float64(i)/n) + 0.5*math.Cos(2*math.Pi*5*float64(i)/n)
+	}
+	input := append([]float64(nil), re...)
+
+	fft(re, im)
+
+	for k := 0; k < n; k++ {
+		var wantRe, wantIm float64
+		for i, x := range input {
+			angle := -2 * math.Pi * float64(k*i) / n
+			wantRe += x * math.Cos(angle)
+			wantIm += x * math.Sin(angle)
+		}
+		if math.Abs(re[k]-wantRe) > 1e-9 || math.Abs(im[k]-wantIm) > 1e-9 {
+			t.Fatalf("bin %d: got %.4f%+.4fi, want %.4f%+.4fi", k, re[k], im[k], wantRe, wantIm)
+		}
+	}
+}
+
+func TestSpectrumFindsTone(t *testing.T) {
+	sa := newSpectrumAnalyzer()
+	bands := sa.Analyze(sine(960, 0.5)) // 1kHz
+
+	loudest := 0
+	for i, level := range bands {
+		if level > bands[loudest] {
+			loudest = i
+		}
+	}
+	lo := spectrumMinHz * math.Pow(spectrumMaxHz/spectrumMinHz, float64(loudest)/spectrumBands)
+	hi := spectrumMinHz * math.Pow(spectrumMaxHz/spectrumMinHz, float64(loudest+1)/spectrumBands)
+	if 1000 < lo*0.9 || 1000 > hi*1.1 {
+		t.Errorf("1kHz tone peaked in band %d (%.0f-%.0fHz)", loudest, lo, hi)
+	}
+	if bands[loudest] < 0.9 {
+		t.Errorf("-6dBFS tone should read near the top of the scale, got %.2f", bands[loudest])
+	}
+
+	// Silence decays rather than dropping straight to zero
+	before := bands[loudest]
+	bands = sa.Analyze(make([]int16, 960))
+	if bands[loudest] >= before || bands[loudest] == 0 {
+		t.Errorf("band should decay after silence: %.2f -> %.2f", before, bands[loudest])
+	}
+}
+
+func BenchmarkSpectrumAnalyze(b *testing.B) {
+	sa := newSpectrumAnalyzer()
+	in := sine(960, 0.5)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sa.Analyze(in)
+	}
+}
+
+func TestMixerSumsTalkers(t *testing.T) {
+	var m audioMixer
+	out := make([]int16, 4)
+
+	// A lone talker passes through untouched, shorter frames leave silence
+	m.mix(out, [][]int16{{1000, -2000, 32767}}, []float64{0}, false)
+	if want := []int16{1000, -2000, 32767, 0}; !slices.Equal(out, want) {
+		t.Errorf("single talker: got %v, want %v", out, want)
+	}
+
+	// Quiet talkers add up exactly
+	m.mix(out, [][]int16{{1000, 2000, 0, 0}, {500, -2500, 0, 0}}, []float64{0, 0}, false)
+	if want := []int16{1500, -500, 0, 0}; !slices.Equal(out, want) {
+		t.Errorf("two talkers: got %v, want %v", out, want)
+	}
+
+	// Loud talkers saturate smoothly instead of wrapping around
+	m.mix(out, [][]int16{{30000, -30000, 20000, 0}, {30000, -30000, 20000, 0}}, []float64{0, 0}, false)
+	if out[0] <= softClipKnee || out[1] >= -softClipKnee || out[0] != -out[1] {
+		t.Errorf("clipped sum should stay loud and symmetric, got %v", out)
+	}
+	if out[2] >= out[0] {
+		t.Errorf("soft clip should keep louder sums louder: %v", out)
+	}
+
+	// Stereo pans each talker before summing
+	m.mix(out, [][]int16{{1000, 1000}, {3000, 3000}}, []float64{-1, 1}, true)
+	if want := []int16{1000, 3000, 1000, 3000}; !slices.Equal(out, want) {
+		t.Errorf("stereo: got %v, want %v", out, want)
+	}
+}
+
+func TestSoftClipIsMonotonic(t *testing.T) {
+	prev := softClip(-200000)
+	for x := int32(-200000); x <= 200000; x += 97 {
+		y := softClip(x)
+		if y < prev {
+			t.Fatalf("softClip(%d) = %d dropped below %d", x, y, prev)
+		}
+		prev = y
+	}
+	if softClip(1<<20) > 32767 || softClip(-1<<20) < -32767 {
+		t.Error("soft clip exceeded full scale")
+	}
+}
+
+func TestTalkerQueueWarmsUp(t *testing.T) {
+	q := newTalkerQueues(10)
+	q.warmup = 3
+	frame := func(source uint16, local bool) audioFrame {
+		return audioFrame{source: source, samples: make([]int16, 4), local: local}
+	}
+
+	// A new talker is held back until its cushion fills
+	q.push(frame(5, false))
+	q.push(frame(5, false))
+	if q.ready(time.Now()) || len(q.popEach(nil)) != 0 {
+		t.Fatal("talker played before warming up")
+	}
+	q.push(frame(5, false))
+	if !q.ready(time.Now()) || len(q.popEach(nil)) != 1 {
+		t.Fatal("talker didn't play with a full cushion")
+	}
+
+	// Local sounds don't wait
+	q.push(frame(0, true))
+	if got := q.popEach(nil); len(got) != 2 {
+		t.Errorf("local sound should mix in at once, got %d frames", len(got))
+	}
+
+	// A short burst plays once its first frame has waited the warm-up time
+	q.popEach(nil)
+	q.push(frame(6, false))
+	if until, ok := q.warmingUntil(); !ok || q.ready(until.Add(-time.Millisecond)) || !q.ready(until) {
+		t.Error("short burst should start when its warm-up time runs out")
+	}
+}
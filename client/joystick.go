@@ -0,0 +1,93 @@
+//go:build windows
+
+// FILE: client/joystick.go
+
+package main
+
+import (
+	"ahcli/common/logger"
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// PTT on a joystick, gamepad or HOTAS button, named like JOY1_BUTTON5. Buttons
+// are read with winmm's joyGetPosEx, which sees every game controller Windows
+// does (XInput pads too, through their DirectInput face), from the same 10ms
+// poll as the keyboard.
+
+const (
+	maxJoysticks       = 16 // joyGetPosEx IDs 0-15
+	maxJoystickButtons = 32 // Buttons reported in dwButtons
+
+	JOY_RETURNBUTTONS = 0x00000080
+	JOYERR_NOERROR    = 0
+)
+
+// JOYINFOEX as joyGetPosEx fills it in
+type JOYINFOEX struct {
+	Size, Flags                uint32
+	X, Y, Z, R, U, V           uint32
+	Buttons, ButtonNumber, POV uint32
+	Reserved1, Reserved2       uint32
+}
+
+// joystickButton is a PTT binding to one button of one controller
+type joystickButton struct {
+	id     uint32 // Controller, 0-based as Windows numbers them
+	button uint32 // Button, 1-based as Windows' game controller settings show them
+}
+
+// parseJoystickButton parses a JOY<n>_BUTTON<m> binding, both 1-based
+func parseJoystickButton(name string) (joystickButton, bool) {
+	joy, button, ok := strings.Cut(strings.TrimPrefix(name, "JOY"), "_BUTTON")
+	if !ok || !strings.HasPrefix(name, "JOY") {
+		return joystickButton{}, false
+	}
+	id, err1 := strconv.Atoi(joy)
+	b, err2 := strconv.Atoi(button)
+	if err1 != nil || err2 != nil || id < 1 || id > maxJoysticks || b < 1 || b > maxJoystickButtons {
+		return joystickButton{}, false
+	}
+	return joystickButton{id: uint32(id - 1), button: uint32(b)}, true
+}
+
+func (j joystickButton) String() string {
+	return fmt.Sprintf("JOY%d_BUTTON%d", j.id+1, j.button)
+}
+
+// down reports whether the button is held. An unplugged controller reads as
+// released; err says why it couldn't be read.
+func (j joystickButton) down() (bool, error) {
+	info := JOYINFOEX{Flags: JOY_RETURNBUTTONS}
+	info.Size = uint32(unsafe.Sizeof(info))
+	ret, _, _ := joyGetPosEx.Call(uintptr(j.id), uintptr(unsafe.Pointer(&info)))
+	if ret != JOYERR_NOERROR {
+		return false, fmt.Errorf("joystick %d unavailable (error %d)", j.id+1, ret)
+	}
+	return info.Buttons&(1<<(j.button-1)) != 0, nil
+}
+
+// joystickPoller reads a joystick PTT binding, logging when the controller
+// goes away or comes back rather than on every failed poll
+type joystickPoller struct {
+	binding joystickButton
+	failing bool
+}
+
+func (p *joystickPoller) pressed() bool {
+	held, err := p.binding.down()
+	if err != nil {
+		if !p.failing {
+			logger.Warn("PTT %s: %v - plug it in or check ptt_key", p.binding, err)
+			p.failing = true
+		}
+		return false
+	}
+	if p.failing {
+		logger.Info("PTT %s: controller found", p.binding)
+		p.failing = false
+	}
+	return held
+}
@@ -0,0 +1,33 @@
+//go:build windows
+
+package main
+
+import "testing"
+
+func TestParseJoystickButton(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want joystickButton
+		ok   bool
+	}{
+		{"JOY1_BUTTON1", joystickButton{id: 0, button: 1}, true},
+		{"JOY2_BUTTON5", joystickButton{id: 1, button: 5}, true},
+		{"JOY16_BUTTON32", joystickButton{id: 15, button: 32}, true},
+		{"JOY0_BUTTON1", joystickButton{}, false},
+		{"JOY17_BUTTON1", joystickButton{}, false},
+		{"JOY1_BUTTON0", joystickButton{}, false},
+		{"JOY1_BUTTON33", joystickButton{}, false},
+		{"JOY1", joystickButton{}, false},
+		{"JOYX_BUTTON1", joystickButton{}, false},
+		{"XJOY1_BUTTON1", joystickButton{}, false},
+		{"F13", joystickButton{}, false},
+	} {
+		got, ok := parseJoystickButton(tt.name)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseJoystickButton(%q) = %+v, %t; want %+v, %t", tt.name, got, ok, tt.want, tt.ok)
+		}
+		if ok && got.String() != tt.name {
+			t.Errorf("%+v.String() = %q, want %q", got, got.String(), tt.name)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// FILE: client/listenfilter.go
+package main
+
+import (
+	"ahcli/common/logger"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// hears reports whether audio from nickname passes the filter
+func (f ListenFilter) hears(nickname string) bool {
+	if slices.Contains(f.Block, nickname) {
+		return false
+	}
+	if len(f.Allow) > 0 {
+		return slices.Contains(f.Allow, nickname)
+	}
+	return true
+}
+
+// clone copies the lists so callers can't modify shared state
+func (f ListenFilter) clone() ListenFilter {
+	return ListenFilter{Allow: slices.Clone(f.Allow), Block: slices.Clone(f.Block)}
+}
+
+// describe summarizes the filter for a chat notice
+func (f ListenFilter) describe() string {
+	var parts []string
+	if len(f.Allow) > 0 {
+		parts = append(parts, "only hearing "+strings.Join(f.Allow, ", "))
+	}
+	if len(f.Block) > 0 {
+		parts = append(parts, "not hearing "+strings.Join(f.Block, ", "))
+	}
+	if len(parts) == 0 {
+		return "hearing everyone"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// listeningToSource reports whether a received frame should be played.
+// Local sounds and talkers we can't name yet always play.
+func listeningToSource(source uint16) bool {
+	if source == 0 {
+		return true
+	}
+	nick := sourceName(source)
+	if nick == "" {
+		return true
+	}
+	return appState.IsListeningTo(nick)
+}
+
+// updateListenFilter applies "allow", "block", "remove" or "clear" for a
+// nickname and saves the result for the current server
+func updateListenFilter(action, nickname string) error {
+	filter := appState.GetListenFilter()
+	without := func(list []string) []string {
+		return slices.DeleteFunc(list, func(n string) bool { return n == nickname })
+	}
+
+	switch action {
+	case "allow":
+		filter.Block = without(filter.Block)
+		if !slices.Contains(filter.Allow, nickname) {
+			filter.Allow = append(filter.Allow, nickname)
+		}
+	case "block":
+		filter.Allow = without(filter.Allow)
+		if !slices.Contains(filter.Block, nickname) {
+			filter.Block = append(filter.Block, nickname)
+		}
+	case "remove":
+		filter.Allow = without(filter.Allow)
+		filter.Block = without(filter.Block)
+	case "clear":
+		filter = ListenFilter{}
+	default:
+		return fmt.Errorf("unknown listen filter action %q", action)
+	}
+
+	logger.Info("Listen filter %s %s: %s", action, nickname, filter.describe())
+	appState.SetListenFilter(filter)
+	appState.AddMessage("Listen filter: "+filter.describe(), "info")
+
+	if currentConfig == nil {
+		return nil
+	}
+	server, ok := currentConfig.Servers[currentConfig.PreferredServer]
+	if !ok {
+		return nil
+	}
+	server.Listen = filter
+	currentConfig.Servers[currentConfig.PreferredServer] = server
+	if err := saveClientConfig("settings.config", currentConfig); err != nil {
+		logger.Error("Failed to save listen filter: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// FILE: client/lowdata.go
+package main
+
+import (
+	"ahcli/common/logger"
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Low data mode is for metered connections such as mobile hotspots. Audio is
+// uncompressed, so the savings come from sending less of it: nothing during
+// silence, a stricter noise gate so background noise doesn't hold the mic
+// open, and as many frames per packet as the server takes. A deeper playout
+// cushion absorbs the patchier delivery those links tend to have.
+const (
+	lowDataGateDB = -40 // Noise gate threshold floor
+	lowDataJitter = 160 * time.Millisecond
+)
+
+// applyLowDataOverrides puts the processor into low data mode. Called after the
+// regular config is applied, so turning the mode off is re-applying the config.
+func applyLowDataOverrides() {
+	audioProcessor.enableSilenceSuppression = true
+	audioProcessor.enableNoiseGate = true
+	if audioProcessor.noiseGate != nil && audioProcessor.noiseGate.threshold < lowDataGateDB {
+		audioProcessor.noiseGate.threshold = lowDataGateDB
+	}
+	audioProcessor.SetJitterTarget(lowDataJitter)
+	logger.Debug("Low data mode: silence suppression on, gate >= %ddB, jitter target %v", lowDataGateDB, lowDataJitter)
+}
+
+// setLowDataMode switches low data mode and saves the choice
+func setLowDataMode(enabled bool) {
+	if currentConfig == nil || currentConfig.Audio.LowData == enabled {
+		return
+	}
+
+	logger.Info("Setting low data mode to: %t", enabled)
+	currentConfig.Audio.LowData = enabled
+	if err := saveClientConfig("settings.config", currentConfig); err != nil {
+		logger.Error("Failed to save low data setting: %v", err)
+	}
+	if audioProcessor != nil {
+		applyAudioConfigToProcessor(currentConfig)
+	}
+	appState.SetLowData(enabled)
+
+	if enabled {
+		appState.AddMessage("📶 Low data mode on", "info")
+	} else {
+		appState.AddMessage("📶 Low data mode off", "info")
+	}
+}
+
+// Bytes sent and received on the server connection, for the usage estimate
+var dataSent, dataReceived atomic.Uint64
+
+// IPv4 and UDP headers on every datagram, which count against a data plan too
+const udpOverheadBytes = 28
+
+// countSent and countReceived record one datagram's payload size
+func countSent(n int)     { dataSent.Add(uint64(n + udpOverheadBytes)) }
+func countReceived(n int) { dataReceived.Add(uint64(n + udpOverheadBytes)) }
+
+// How often the usage estimate updates, and the window it averages over
+const (
+	dataUsageInterval = 5 * time.Second
+	dataUsageWindow   = time.Minute
+)
+
+// runDataUsageMonitor publishes the data used per minute, averaged over the last minute
+func runDataUsageMonitor(ctx context.Context) {
+	type sample struct {
+		at    time.Time
+		total uint64
+	}
+	samples := []sample{{time.Now(), dataSent.Load() + dataReceived.Load()}}
+
+	ticker := time.NewTicker(dataUsageInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			samples = append(samples, sample{now, dataSent.Load() + dataReceived.Load()})
+			for len(samples) > 2 && now.Sub(samples[1].at) >= dataUsageWindow {
+				samples = samples[1:]
+			}
+
+			oldest := samples[0]
+			elapsed := now.Sub(oldest.at)
+			perMinute := float64(samples[len(samples)-1].total-oldest.total) / elapsed.Minutes()
+			appState.SetDataUsage(int64(perMinute))
+		}
+	}
+}
@@ -2,9 +2,12 @@
 package main
 
 import (
+	"ahcli/common"
 	"ahcli/common/logger"
+	"context"
 	"fmt"
 	"os"
+	"sync"
 	"syscall"
 	"time"
 	"unsafe"
@@ -12,7 +15,16 @@ import (
 	"github.com/gordonklaus/portaudio"
 )
 
+var (
+	// Application lifecycle - cancelled when shutdown begins
+	appCtx, appCancel = context.WithCancel(context.Background())
+	shutdownOnce      sync.Once
+)
+
 func main() {
+	// Command line flags only matter for one-shot mode
+	opts := parseOneShotFlags()
+
 	// Initialize unified logging system FIRST
 	err := logger.Init("client")
 	if err != nil {
@@ -21,10 +33,17 @@ func main() {
 	}
 	defer logger.Close()
 
+	// Headless: send or query, then exit before any audio, tray or UI setup
+	if opts.enabled() {
+		code := runOneShot(opts)
+		logger.Close()
+		os.Exit(code)
+	}
+
 	// Enable debug mode for development
 	logger.SetDebugMode(true)
 
-	logger.Info("=== AHCLI Client Starting ===")
+	logger.Info("=== AHCLI Client Starting (v%s) ===", common.CurrentVersion)
 	logger.Info("Log file: %s", logger.GetLogPath())
 
 	// Initialize application state
@@ -49,6 +68,12 @@ func main() {
 
 	// Store config reference for audio controls
 	currentConfig = config
+	setOutputBufferFrames(config.Audio.OutputBufferFrames)
+	appState.SetStereoOutput(config.Audio.Stereo)
+	appState.SetNotificationBatching(config.WebUI.BatchUpdates)
+	appState.SetLowData(config.Audio.LowData)
+	appState.SetUserPans(config.Audio.Pan)
+	appState.SetListenFilter(config.Servers[config.PreferredServer].Listen)
 	logger.Info("Client config loaded successfully")
 
 	// Log audio processing settings
@@ -64,13 +89,28 @@ func main() {
 		config.AudioProcessing.MakeupGain.Enabled,
 		config.AudioProcessing.MakeupGain.GainDB)
 
-	// Set PTT key from config
-	pttKeyCode = keyNameToVKCode(config.PTTKey)
-	if pttKeyCode == 0 {
+	// Set PTT key from config: a keyboard key or a JOY<n>_BUTTON<m>
+	if joystick, ok := parseJoystickButton(config.PTTKey); ok {
+		pttJoystick = &joystick
+		pttKeyCode = 0
+	} else if pttKeyCode = keyNameToVKCode(config.PTTKey); pttKeyCode == 0 {
 		logger.Fatal("Unsupported PTT key: %s", config.PTTKey)
 		return
 	}
 
+	// Panic key: PAUSE unless configured; NONE turns it off
+	panicKey := config.PanicKey
+	if panicKey == "" {
+		panicKey = defaultPanicKey
+	}
+	if panicKey != "NONE" {
+		panicKeyCode = keyNameToVKCode(panicKey)
+		if panicKeyCode == 0 || panicKeyCode == pttKeyCode {
+			logger.Warn("Panic key %q is unsupported or the same as the PTT key - panic key disabled", panicKey)
+			panicKeyCode = 0
+		}
+	}
+
 	StartPTTListener()
 	logger.Info("PTT listener started (key: %s)", config.PTTKey)
 
@@ -87,6 +127,9 @@ func main() {
 		logger.Info("Client crypto system initialized successfully")
 	}
 
+	// Check devices up front so problems show as a clear report, not a stream-open error
+	refreshAudioDevices()
+
 	// Initialize audio system
 	logger.Info("Initializing audio system...")
 	err = InitAudio()
@@ -132,14 +175,13 @@ func main() {
 	}
 	logger.Info("System tray initialized")
 
-	// Set up AppState observer to update tray when connection changes
+	// Set up AppState observer to update tray on connection, transmit and quality changes.
+	// The tray call goes through Explorer, so it runs on its own worker.
+	trayUpdater := newCoalescingWorker(UpdateTrayIcon)
 	appState.AddObserver(func(change StateChange) {
-		if change.Type == "connection" {
-			if data, ok := change.Data.(map[string]interface{}); ok {
-				if connected, ok := data["connected"].(bool); ok {
-					UpdateTrayIcon(connected)
-				}
-			}
+		switch change.Type {
+		case "connection", "connection_phase", "ptt", "muted", "reconnecting", "latency", "packet_loss":
+			trayUpdater.trigger()
 		}
 	})
 	logger.Debug("AppState observer registered for tray icon updates")
@@ -150,6 +192,17 @@ func main() {
 		TestAudioPipeline()
 	}()
 
+	// Estimate data usage for the UI
+	go runDataUsageMonitor(appCtx)
+
+	// Catch the UI silently going stale
+	go runUIWatchdog(appCtx)
+
+	// Optional release check - off by default for privacy
+	if config.UpdateCheck.Enabled {
+		go checkForUpdates(config.UpdateCheck.URL)
+	}
+
 	// Start connection in background
 	go func() {
 		// PURE APPSTATE: Only update AppState - observer handles WebTUI
@@ -173,11 +226,15 @@ func main() {
 	logger.Info("Left-click tray icon to open UI, right-click for menu")
 	logger.Info("🎯 UNIFIED LOGGING MIGRATION COMPLETE - All systems now use common/logger!")
 
-	// Auto-launch UI on startup
-	go func() {
-		time.Sleep(1 * time.Second) // Wait for tray to settle
-		openVoiceChatUI()           // Launch browser automatically
-	}()
+	// Auto-launch UI on startup unless running as a background service
+	if config.WebUI.AutoLaunch {
+		go func() {
+			time.Sleep(1 * time.Second) // Wait for tray to settle
+			openVoiceChatUI()           // Launch browser automatically
+		}()
+	} else {
+		logger.Info("UI auto-launch disabled - open it from the tray icon")
+	}
 
 	// Run Windows message loop
 	runMessageLoop()
@@ -224,6 +281,28 @@ func createHiddenWindow() error {
 	}
 
 	logger.Debug("Hidden window created successfully")
+
+	// Plugging in a headset should switch to it without restarting the app
+	if err := registerAudioDeviceNotifications(); err != nil {
+		logger.Warn("Audio device change detection unavailable: %v", err)
+	}
+	return nil
+}
+
+// registerAudioDeviceNotifications asks Windows to send the hidden window
+// WM_DEVICECHANGE when an audio device is added or removed
+func registerAudioDeviceNotifications() error {
+	filter := DEV_BROADCAST_DEVICEINTERFACE{
+		DbccDeviceType: DBT_DEVTYP_DEVICEINTERFACE,
+		DbccClassGuid:  KSCATEGORY_AUDIO,
+	}
+	filter.DbccSize = uint32(unsafe.Sizeof(filter))
+
+	handle, _, err := registerDeviceNotification.Call(hwnd, uintptr(unsafe.Pointer(&filter)), DEVICE_NOTIFY_WINDOW_HANDLE)
+	if handle == 0 {
+		return err
+	}
+	logger.Debug("Registered for audio device change notifications")
 	return nil
 }
 
@@ -234,6 +313,12 @@ func windowProc(hwnd, msg, wParam, lParam uintptr) uintptr {
 		logger.Debug("Received tray icon message: %d", lParam)
 		HandleTrayMessage(lParam)
 		return 0
+	case WM_DEVICECHANGE:
+		if wParam == DBT_DEVICEARRIVAL || wParam == DBT_DEVICEREMOVECOMPLETE {
+			logger.Debug("Audio device change notification: 0x%x", wParam)
+			onAudioDeviceChange() // Debounced; the rescan runs off the message loop
+		}
+		return 1 // TRUE - we never veto device changes
 	default:
 		ret, _, _ := defWindowProc.Call(hwnd, msg, wParam, lParam)
 		return ret
@@ -257,7 +342,36 @@ func runMessageLoop() {
 		// bRet == -1 is error, but we'll continue
 	}
 
-	// Cleanup before exit
-	CleanupTray()
 	logger.Info("Message loop ended, AHCLI shutting down")
+	shutdownApplication()
+}
+
+// shutdownApplication stops everything in order and exits the process.
+// Safe to call from any goroutine; only the first call does anything.
+func shutdownApplication() {
+	shutdownOnce.Do(func() {
+		logger.Info("Shutting down AHCLI...")
+
+		// 1. Signal long-running goroutines to stop
+		appCancel()
+
+		// 2. Tell the server we're leaving so it drops us immediately
+		sendDisconnect()
+
+		// 3. Stop audio goroutines and release audio devices, then finish any recording
+		StopAudio()
+		portaudio.Terminate()
+		if recording.Load() {
+			stopRecording()
+		}
+
+		// 4. Close UI connections and the tray icon
+		closeWebSocketClients()
+		CleanupTray()
+
+		// 5. Flush logs last
+		logger.Info("AHCLI shutdown complete")
+		logger.Close()
+		os.Exit(0)
+	})
 }
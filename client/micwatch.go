@@ -0,0 +1,53 @@
+// FILE: client/micwatch.go
+package main
+
+import "time"
+
+// The mic watch catches transmitting into a dead input: the wrong device
+// selected, or the mic muted in the OS. Real microphones always pick up some
+// room noise, so a raw level that stays under micSilenceLevel while PTT is
+// held means nothing is being captured.
+const (
+	micSilenceLevel           = 0.0003 // Raw RMS, about -70dBFS
+	defaultNoInputWarningSecs = 3
+	noInputWarningMessage     = "Transmitting but no microphone input detected - check your device."
+)
+
+// micWatch tracks how long the raw input has been silent this transmission
+type micWatch struct {
+	limit  time.Duration // 0 disables the warning
+	silent time.Duration
+	warned bool
+}
+
+// reset starts over for a new transmission
+func (w *micWatch) reset() {
+	w.silent = 0
+	w.warned = false
+}
+
+// observe adds one captured frame and reports whether to warn now. It warns
+// once per transmission, and not again until the mic has picked something up.
+func (w *micWatch) observe(rawLevel float32, frame time.Duration) bool {
+	if w.limit <= 0 {
+		return false
+	}
+	if rawLevel >= micSilenceLevel {
+		w.reset()
+		return false
+	}
+	w.silent += frame
+	if w.silent >= w.limit && !w.warned {
+		w.warned = true
+		return true
+	}
+	return false
+}
+
+// noInputWarningLimit returns the configured silence before warning
+func noInputWarningLimit() time.Duration {
+	if currentConfig == nil {
+		return defaultNoInputWarningSecs * time.Second
+	}
+	return time.Duration(currentConfig.Audio.NoInputWarningSeconds) * time.Second
+}
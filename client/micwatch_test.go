@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMicWatchWarnsOncePerSilence(t *testing.T) {
+	const frame = 20 * time.Millisecond
+	w := micWatch{limit: 100 * time.Millisecond}
+
+	var warnings []int
+	levels := make([]float32, 0, 30)
+	for range 10 {
+		levels = append(levels, 0) // Dead input: warn after 5 frames, once
+	}
+	levels = append(levels, 0.01) // The mic picks something up
+	for range 10 {
+		levels = append(levels, micSilenceLevel/2) // Dead again: warn again
+	}
+	for i, level := range levels {
+		if w.observe(level, frame) {
+			warnings = append(warnings, i)
+		}
+	}
+	if len(warnings) != 2 || warnings[0] != 4 || warnings[1] != 15 {
+		t.Errorf("warned at frames %v, want [4 15]", warnings)
+	}
+
+	off := micWatch{}
+	for range 100 {
+		if off.observe(0, frame) {
+			t.Fatal("limit 0 should disable the warning")
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// FILE: client/mixer.go
+package main
+
+// Mixing simultaneous talkers into one playback frame. Each talker's frame is
+// panned and summed at full precision, then the sum is soft-clipped so two
+// loud voices saturate smoothly instead of wrapping around.
+
+// Soft clipping leaves samples up to the knee alone and squeezes everything
+// louder into the headroom above it
+const (
+	softClipKnee     = 24576 // 0.75 of full scale
+	softClipHeadroom = 32767 - softClipKnee
+)
+
+// panGains returns the left and right gains for a pan position from -1 (left)
+// through 0 (center, both channels full) to 1 (right)
+func panGains(pan float64) (left, right float64) {
+	left, right = 1.0, 1.0
+	if pan < 0 {
+		right = 1.0 + pan
+	} else if pan > 0 {
+		left = 1.0 - pan
+	}
+	return left, right
+}
+
+// softClip converts a mixed sample back to 16 bits, approaching full scale
+// asymptotically above the knee
+func softClip(x int32) int16 {
+	switch {
+	case x > softClipKnee:
+		over := int64(x - softClipKnee)
+		return int16(softClipKnee + over*softClipHeadroom/(over+softClipHeadroom))
+	case x < -softClipKnee:
+		over := int64(-x - softClipKnee)
+		return int16(-softClipKnee - over*softClipHeadroom/(over+softClipHeadroom))
+	default:
+		return int16(x)
+	}
+}
+
+// audioMixer sums talkers' frames into the output buffer, reusing its accumulator
+type audioMixer struct {
+	acc []int32
+}
+
+// mix writes frames into out: mono, or interleaved stereo with each frame at
+// its pan. A lone frame is copied as is; several are summed and soft-clipped.
+// Frames shorter than the output leave silence after them.
+func (m *audioMixer) mix(out []int16, frames [][]int16, pans []float64, stereo bool) {
+	if cap(m.acc) < len(out) {
+		m.acc = make([]int32, len(out))
+	}
+	acc := m.acc[:len(out)]
+	clear(acc)
+
+	for f, samples := range frames {
+		if stereo {
+			left, right := panGains(pans[f])
+			for i, s := range samples {
+				if 2*i+1 >= len(acc) {
+					break
+				}
+				acc[2*i] += int32(float64(s) * left)
+				acc[2*i+1] += int32(float64(s) * right)
+			}
+		} else {
+			for i, s := range samples {
+				if i >= len(acc) {
+					break
+				}
+				acc[i] += int32(s)
+			}
+		}
+	}
+
+	if len(frames) == 1 {
+		for i, v := range acc {
+			out[i] = int16(v)
+		}
+		return
+	}
+	for i, v := range acc {
+		out[i] = softClip(v)
+	}
+}
@@ -3,12 +3,17 @@ package main
 
 import (
 	"ahcli/common/logger"
-	"bytes"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"ahcli/common"
@@ -17,33 +22,153 @@ import (
 var (
 	currentChannel string
 	cryptoReady    bool
+
+	// Optional features the server advertised on accept
+	serverCapabilities []string
+
+	// Server policy: plaintext chat is refused
+	serverRequiresEncryption bool
+
+	// Ping round trip measurement
+	pingMutex  sync.Mutex
+	pingSentAt time.Time
+
+	// IDs from echo_reply packets, for the reachability check after connecting
+	echoReplies = make(chan string, 4)
+
+	// Audio packet prefixes in use; read by the capture and network goroutines
+	audioMagic atomic.Pointer[common.AudioMagic]
+
+	// Received audio that didn't fit our frame size was reported this connection
+	frameMismatchWarned atomic.Bool
 )
 
-func connectToServer(config *ClientConfig) error {
-	target := config.Servers[config.PreferredServer].IP
+// handleServerShutdown ends the session on the server's shutdown notice,
+// reconnecting once the grace period it asked for is over. The old session is
+// gone with the server, so nothing is sent on it meanwhile.
+func handleServerShutdown(s *serverSession, notice common.ServerShutdown) {
+	grace := time.Duration(notice.RetryAfterSec) * time.Second
+	message := notice.Message
+	if message == "" {
+		message = "Server is shutting down"
+	}
+	logger.Warn("%s (retry after %v)", message, grace)
+	s.end(sessionEnd{reason: "🔌 " + message, reconnect: true, after: grace})
+}
+
+// applyServerTheme passes the server's branding to the UI, minus anything
+// that isn't a plain color or http(s) logo
+func applyServerTheme(theme *common.Theme) {
+	if theme == nil {
+		appState.SetTheme(common.Theme{})
+		return
+	}
+	clean, problems := theme.Sanitize()
+	for _, problem := range problems {
+		logger.Debug("Ignoring server theme setting: %v", problem)
+	}
+	logger.Debug("Server theme: name=%q, logo=%q, %d colors", clean.Name, clean.LogoURL, len(clean.Colors))
+	appState.SetTheme(clean)
+}
+
+// currentAudioMagic returns the audio packet prefixes agreed with the server
+func currentAudioMagic() common.AudioMagic {
+	if magic := audioMagic.Load(); magic != nil {
+		return *magic
+	}
+	return common.DefaultAudioMagic
+}
+
+// agreeAudioMagic settles on the server's audio prefixes. A server that doesn't
+// advertise any uses the defaults; a mismatch with our config is reported since
+// it means the two configs drifted.
+func agreeAudioMagic(config *ClientConfig, advertised *common.AudioMagic) {
+	magic := common.DefaultAudioMagic
+	if advertised != nil {
+		magic = *advertised
+	}
+	if err := magic.Validate(); err != nil {
+		logger.Error("Server advertised unusable audio magic %s: %v", magic, err)
+		magic = config.Audio.AudioMagic
+	} else if magic != config.Audio.AudioMagic {
+		logger.Warn("Server uses audio magic %s, settings.config has %s - using the server's", magic, config.Audio.AudioMagic)
+		appState.AddMessage(fmt.Sprintf("Audio magic mismatch: server uses %s, settings.config has %s", magic, config.Audio.AudioMagic), "warning")
+	}
+	audioMagic.Store(&magic)
+}
+
+// dialServer connects to the preferred server and waits for it to accept us.
+// On success the caller owns the returned connection.
+func dialServer(config *ClientConfig) (*net.UDPConn, *common.ConnectAccepted, error) {
+	server, ok := config.Servers[config.PreferredServer]
+	if !ok {
+		return nil, nil, fmt.Errorf("no server named %q in config", config.PreferredServer)
+	}
+	target := server.IP
 	logger.Info("Resolving server address: %s", target)
 
 	raddr, err := net.ResolveUDPAddr("udp", target)
 	if err != nil {
 		logger.Error("Failed to resolve UDP address %s: %v", target, err)
-		return err
+		return nil, nil, err
 	}
 
 	logger.Info("Establishing UDP connection to %s", raddr)
 	conn, err := net.DialUDP("udp", nil, raddr)
 	if err != nil {
 		logger.Error("Failed to dial UDP connection: %v", err)
-		return err
+		return nil, nil, err
 	}
-	defer conn.Close()
 
-	// Send connect request
+	// Only "all nicknames taken" is worth retrying, with numbered variants
+	nicklist := config.Nickname
+	for retry := 0; ; retry++ {
+		accepted, err := requestConnect(conn, config, nicklist)
+		var reject *rejectError
+		if errors.As(err, &reject) && reject.Code == common.CodeNicknameTaken && retry < nicknameRetries {
+			nicklist = numberedNicknames(config.Nickname, retry+2)
+			logger.Info("All nicknames taken, retrying with %v", nicklist)
+			continue
+		}
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		return conn, accepted, nil
+	}
+}
+
+// How many times a connect is retried with numbered nicknames (alice2, alice3...)
+// when the server says every nickname we asked for is taken
+const nicknameRetries = 3
+
+// rejectError is a connect the server refused; Code tells why
+type rejectError struct {
+	common.Reject
+}
+
+func (e *rejectError) Error() string {
+	switch e.Code {
+	case common.CodeBanned:
+		return "connection rejected: you are banned from this server"
+	case common.CodeInvalidNickname:
+		return fmt.Sprintf("connection rejected: %s - change the nickname in settings.config", e.Message)
+	}
+	return "connection rejected: " + e.Message
+}
+
+// requestConnect sends a connect request and waits for accept or reject
+func requestConnect(conn *net.UDPConn, config *ClientConfig, nicklist []string) (*common.ConnectAccepted, error) {
 	req := common.ConnectRequest{
-		Type:     "connect",
-		Nicklist: config.Nickname,
+		Type:     common.MsgConnect,
+		Nicklist: nicklist,
+		Version:  common.CurrentVersion,
+
+		Capabilities: []string{common.CapabilityTyping, common.CapabilityAudioSource, common.CapabilityUserInfo, common.CapabilityCoalesce, common.CapabilityTransmitEnd},
+		FrameSizeMs:  config.Audio.FrameSizeMs,
 	}
 	data, _ := json.Marshal(req)
-	logger.Info("Sending connection request with nicknames: %v", config.Nickname)
+	logger.Info("Sending connection request with nicknames: %v", nicklist)
 	conn.Write(data)
 
 	// Wait for response
@@ -52,76 +177,224 @@ func connectToServer(config *ClientConfig) error {
 	n, _, err := conn.ReadFromUDP(buffer)
 	if err != nil {
 		logger.Error("Connection timeout or error: %v", err)
-		return err
+		return nil, err
 	}
+	conn.SetReadDeadline(time.Time{})
 
 	var resp map[string]interface{}
 	json.Unmarshal(buffer[:n], &resp)
 
 	switch resp["type"] {
-	case "accept":
+	case common.MsgAccept:
 		var accepted common.ConnectAccepted
 		json.Unmarshal(buffer[:n], &accepted)
+		return &accepted, nil
 
-		currentChannel = "General" // Default channel
+	case common.MsgReject:
+		var reject common.Reject
+		json.Unmarshal(buffer[:n], &reject)
+		logger.Error("Connection rejected (%s): %s", reject.Code, reject.Message)
+		return nil, &rejectError{reject}
+	default:
+		logger.Error("Unexpected response type: %v", resp["type"])
+		return nil, fmt.Errorf("unexpected response type: %v", resp["type"])
+	}
+}
 
-		appState.SetConnected(true, accepted.Nickname, accepted.ServerName, accepted.MOTD)
-		appState.SetChannel(currentChannel)
-		appState.SetChannels(accepted.Channels)
+// numberedNicknames appends n to each nickname, shortening it if needed to
+// stay within the server's length limit
+func numberedNicknames(nicknames []string, n int) []string {
+	suffix := strconv.Itoa(n)
+	numbered := make([]string, len(nicknames))
+	for i, nick := range nicknames {
+		if len(nick)+len(suffix) > common.MaxNicknameLength {
+			nick = nick[:common.MaxNicknameLength-len(suffix)]
+		}
+		numbered[i] = nick + suffix
+	}
+	return numbered
+}
 
-		// Initialize channel users - put all users in the default channel for now
-		channelUsers := make(map[string][]string)
-		for _, channel := range accepted.Channels {
-			channelUsers[channel] = make([]string, 0)
+// connectToServer connects to the preferred server and stays on it,
+// reconnecting whenever the link is lost, until we're sent away or the app
+// shuts down. Only a failed first connect is returned as an error.
+func connectToServer(config *ClientConfig) error {
+	s, _, err := openSession(config, PhaseConnecting)
+	if err != nil {
+		enterPhase(PhaseDisconnected)
+		return err
+	}
+
+	for {
+		end := s.wait()
+		s.close()
+		if appCtx.Err() != nil {
+			return nil // Shutdown says goodbye to the server itself
 		}
-		// Put all users in the default channel initially
-		if len(accepted.Channels) > 0 {
-			channelUsers[currentChannel] = accepted.Users
+		logger.Info("Session with server ended: %s", end.reason)
+		if end.reconnect {
+			if s = reconnect(config, end); s != nil {
+				continue
+			}
 		}
+		appState.SetConnected(false, "", "", "")
+		enterPhase(PhaseDisconnected)
+		return nil
+	}
+}
 
-		appState.SetChannelUsers(channelUsers)
+// openSession dials the server and sets up a session on it: server settings,
+// crypto, and the goroutines that keep it going. phase is where the connection
+// state machine is while dialing.
+func openSession(config *ClientConfig, phase ConnPhase) (*serverSession, *common.ConnectAccepted, error) {
+	enterPhase(phase)
+	conn, accepted, err := dialServer(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	s := newServerSession(conn)
+	cryptoReady = false
+
+	currentChannel = "General" // Default channel
+	serverCapabilities = accepted.Capabilities
+	serverRequiresEncryption = accepted.RequireEncryption
+	agreeAudioMagic(config, accepted.AudioMagic)
+	setSourceIDs(accepted.SourceIDs)
+	applyServerTheme(accepted.Theme)
+
+	enterPhase(PhaseAuthenticating)
+	appState.SetConnected(true, accepted.Nickname, accepted.ServerName, accepted.MOTD)
+	appState.SetChannel(currentChannel)
+	appState.SetChannels(accepted.Channels)
+
+	// Initialize channel users - put all users in the default channel for now
+	channelUsers := make(map[string][]common.UserInfo)
+	for _, channel := range accepted.Channels {
+		channelUsers[channel] = make([]common.UserInfo, 0)
+	}
+	// Put all users in the default channel initially
+	if len(accepted.Channels) > 0 {
+		channelUsers[currentChannel] = accepted.Users
+	}
 
-		logger.Info("Connected as: %s", accepted.Nickname)
-		logger.Info("MOTD: %s", accepted.MOTD)
-		logger.Info("Available channels: %v", accepted.Channels)
-		logger.Info("Current users: %v", accepted.Users)
+	appState.SetChannelUsers(channelUsers)
+	appState.SetChannelTopics(accepted.Topics)
 
-		// Initiate crypto handshake after successful connection
-		err = initiateCryptoHandshake(conn)
-		if err != nil {
-			logger.Error("Crypto handshake failed: %v", err)
-			appState.AddMessage("Warning: Chat encryption unavailable", "warning")
+	logger.Info("Connected as: %s", accepted.Nickname)
+	logger.Info("MOTD: %s", accepted.MOTD)
+	if accepted.MOTD != "" {
+		for _, line := range strings.Split(accepted.MOTD, "\n") {
+			appState.AddMessage(line, "info")
 		}
+	}
+	showChannelTopic(currentChannel, accepted.Topics[currentChannel])
+	logger.Info("Available channels: %v", accepted.Channels)
+	logger.Info("Current users: %v", common.UserNicknames(accepted.Users))
+
+	// Warn if the server says this build is too old
+	if accepted.MinClientVersion != "" && common.CompareVersions(common.CurrentVersion, accepted.MinClientVersion) < 0 {
+		logger.Warn("Client version %s is older than server minimum %s", common.CurrentVersion, accepted.MinClientVersion)
+		appState.AddMessage(fmt.Sprintf("Your client (v%s) is outdated - server requires v%s or newer. Please update.",
+			common.CurrentVersion, accepted.MinClientVersion), "warning")
+	}
 
-	case "reject":
-		var reject common.Reject
-		json.Unmarshal(buffer[:n], &reject)
-		logger.Error("Connection rejected: %s", reject.Message)
-		return fmt.Errorf("connection rejected: %s", reject.Message)
-	default:
-		logger.Error("Unexpected response type: %v", resp["type"])
-		return fmt.Errorf("unexpected response type: %v", resp["type"])
+	// Use the server's frame size so relayed packets match ours
+	frameSizeMs := accepted.FrameSizeMs
+	if !common.ValidFrameSizeMs(frameSizeMs) {
+		frameSizeMs = common.DefaultFrameSizeMs // Older server without negotiation
+	}
+	if requested := config.Audio.FrameSizeMs; frameSizeMs != requested {
+		logger.Info("Server uses %dms audio frames (requested %dms)", frameSizeMs, requested)
+	}
+	if err := setFrameSizeMs(frameSizeMs); err != nil {
+		logger.Error("Failed to apply %dms frame size: %v", frameSizeMs, err)
+		appState.AddMessage("Audio restart failed after frame size change", "error")
+	}
+	frameMismatchWarned.Store(false)
+
+	// Initiate crypto handshake after successful connection
+	early, err := initiateCryptoHandshake(conn)
+	s.early = early
+	if err != nil {
+		logger.Error("Crypto handshake failed after %d attempts: %v", cryptoHandshakeAttempts, err)
+		if serverRequiresEncryption {
+			appState.AddMessage("🔓 Chat encryption unavailable and this server requires it - chat is disabled until you reconnect", "error")
+		} else {
+			appState.AddMessage("🔓 Chat encryption unavailable - chat will be sent as plaintext this session", "warning")
+		}
 	}
 
-	conn.SetReadDeadline(time.Time{})
 	serverConn = conn
+	enterPhase(PhaseConnected)
+
+	go handleServerResponses(s)
+	go startPingLoop(s, config.Keepalive)
+	go checkServerReachable(s)
 
-	go handleServerResponses(conn)
-	go startPingLoop(conn)
+	// Connection and crypto are up - send anything typed while offline
+	go flushOfflineChats()
+	go restoreMonitoredChannels(accepted.Channels)
 
-	select {}
+	return s, accepted, nil
 }
 
-func initiateCryptoHandshake(conn *net.UDPConn) error {
+// sendDisconnect tells the server we're leaving and closes the connection
+func sendDisconnect() {
+	conn := serverConn
+	if conn == nil {
+		return
+	}
+
+	data, _ := json.Marshal(map[string]string{"type": common.MsgDisconnect})
+	if _, err := conn.Write(data); err != nil {
+		logger.Error("Failed to send disconnect: %v", err)
+	} else {
+		logger.Info("Sent disconnect to server")
+	}
+
+	serverConn = nil
+	conn.Close()
+	enterPhase(PhaseDisconnected)
+}
+
+// Crypto handshake retries; each attempt waits cryptoHandshakeTimeout for the reply
+const (
+	cryptoHandshakeAttempts = 3
+	cryptoHandshakeTimeout  = 3 * time.Second
+)
+
+// Control messages held back while waiting for the handshake response
+const maxEarlyMessages = 64
+
+// initiateCryptoHandshake sets up chat encryption, retrying lost or garbled
+// exchanges. It returns the control messages that arrived meanwhile, in order,
+// for the response handler to process.
+func initiateCryptoHandshake(conn *net.UDPConn) ([][]byte, error) {
+	var early [][]byte
+	var err error
+	for attempt := 1; attempt <= cryptoHandshakeAttempts; attempt++ {
+		if err = cryptoHandshakeAttempt(conn, &early); err == nil {
+			return early, nil
+		}
+		logger.Warn("Crypto handshake attempt %d/%d failed: %v", attempt, cryptoHandshakeAttempts, err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	return early, err
+}
+
+// cryptoHandshakeAttempt runs one key exchange with the server, adding
+// anything else the server sends meanwhile to early
+func cryptoHandshakeAttempt(conn *net.UDPConn, early *[][]byte) error {
 	logger.Info("Initiating crypto handshake with server")
 
 	// Get client public key
 	clientPubKey := clientCrypto.GetPublicKey()
 
 	// Send handshake request
-	handshake := map[string]string{
-		"type":       "crypto_handshake",
-		"public_key": base64.StdEncoding.EncodeToString(clientPubKey[:]),
+	handshake := common.CryptoHandshake{
+		Type:      common.MsgCryptoHandshake,
+		PublicKey: base64.StdEncoding.EncodeToString(clientPubKey[:]),
+		Ratchet:   true, // Ask for per-message keys; older servers ignore this
 	}
 
 	data, err := json.Marshal(handshake)
@@ -138,31 +411,32 @@ func initiateCryptoHandshake(conn *net.UDPConn) error {
 
 	logger.Debug("Crypto handshake request sent, waiting for response")
 
-	// Wait for handshake response with timeout
+	// Wait for handshake response with timeout. The server may send user list
+	// updates and join notices first; those are kept for the response handler.
+	var response common.CryptoHandshakeResponse
 	buffer := make([]byte, 4096)
-	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
-	n, _, err := conn.ReadFromUDP(buffer)
-	if err != nil {
-		logger.Error("Crypto handshake timeout: %v", err)
-		return fmt.Errorf("handshake timeout: %v", err)
-	}
-
-	var response struct {
-		Type      string `json:"type"`
-		Status    string `json:"status"`
-		PublicKey string `json:"public_key"`
-		Error     string `json:"error"`
-	}
-
-	err = json.Unmarshal(buffer[:n], &response)
-	if err != nil {
-		logger.Error("Invalid crypto handshake response: %v", err)
-		return fmt.Errorf("invalid handshake response: %v", err)
-	}
+	conn.SetReadDeadline(time.Now().Add(cryptoHandshakeTimeout))
+	for {
+		n, _, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			logger.Error("Crypto handshake timeout: %v", err)
+			return fmt.Errorf("handshake timeout: %v", err)
+		}
 
-	if response.Type != "crypto_handshake_response" {
-		logger.Error("Unexpected handshake response type: %s", response.Type)
-		return fmt.Errorf("unexpected response type: %s", response.Type)
+		response = common.CryptoHandshakeResponse{}
+		if err := json.Unmarshal(buffer[:n], &response); err != nil {
+			logger.Debug("Skipping non-JSON packet during crypto handshake") // Audio: stale by the time it'd play
+			continue
+		}
+		if response.Type == common.MsgCryptoHandshakeResponse {
+			break
+		}
+		if len(*early) >= maxEarlyMessages {
+			logger.Warn("Dropping %q received during crypto handshake: %d messages already held", response.Type, maxEarlyMessages)
+			continue
+		}
+		logger.Debug("Holding %q until the crypto handshake is done", response.Type)
+		*early = append(*early, slices.Clone(buffer[:n]))
 	}
 
 	if response.Status != "success" {
@@ -186,14 +460,18 @@ func initiateCryptoHandshake(conn *net.UDPConn) error {
 	copy(serverPubKey[:], serverPubKeyBytes)
 
 	// Complete the handshake
-	err = clientCrypto.CompleteHandshake(serverPubKey)
+	err = clientCrypto.CompleteHandshake(serverPubKey, response.Ratchet)
 	if err != nil {
 		logger.Error("Failed to complete crypto handshake: %v", err)
 		return fmt.Errorf("failed to complete handshake: %v", err)
 	}
 
 	cryptoReady = true
-	appState.AddMessage("🔒 Chat encryption enabled", "success")
+	if response.Ratchet {
+		appState.AddMessage("🔒 Chat encryption enabled (per-message keys)", "success")
+	} else {
+		appState.AddMessage("🔒 Chat encryption enabled", "success")
+	}
 	logger.Info("Crypto handshake completed successfully - E2E encryption active")
 
 	// Clear the read deadline
@@ -209,9 +487,9 @@ func changeChannel(channel string) {
 		return
 	}
 
-	change := map[string]string{
-		"type":    "change_channel",
-		"channel": channel,
+	change := common.ChangeChannel{
+		Type:    common.MsgChangeChannel,
+		Channel: channel,
 	}
 	data, _ := json.Marshal(change)
 	serverConn.Write(data)
@@ -221,16 +499,25 @@ func changeChannel(channel string) {
 
 // Send chat message to server - now with encryption support
 func sendChatMessage(message string) {
-	if serverConn == nil {
-		logger.Error("Cannot send chat: not connected to server")
-		appState.AddMessage("Cannot send chat: not connected", "error")
+	// One msg_id per message; retransmits and queued flushes reuse it so the server can dedup
+	msgID := newChatMsgID()
+
+	if serverConn == nil || !appState.IsConnected() {
+		queueOfflineChat(msgID, message)
 		return
 	}
 
+	sendChatMessageWithID(msgID, message)
+}
+
+// sendChatMessageWithID sends a chat message under an existing msg_id.
+// The error only says whether it went out; delivery is tracked via chat_ack.
+func sendChatMessageWithID(msgID, message string) error {
+
 	if currentChannel == "" {
 		logger.Error("Cannot send chat: no current channel")
 		appState.AddMessage("Cannot send chat: no channel", "error")
-		return
+		return fmt.Errorf("no current channel")
 	}
 
 	// Get current user nickname
@@ -241,41 +528,56 @@ func sendChatMessage(message string) {
 
 	// Try encrypted chat first if crypto is ready
 	if cryptoReady && clientCrypto.IsReady() {
-		err := sendEncryptedChatMessage(message, nickname)
-		if err != nil {
+		err := sendEncryptedChatMessage(msgID, message, nickname)
+		if err == nil {
+			logger.Info("✅ Sent encrypted chat message: %s", message)
+			appState.CountChatSent()
+			return nil
+		}
+		if serverRequiresEncryption {
+			logger.Error("Encrypted chat failed: %v", err)
+		} else {
 			logger.Error("Encrypted chat failed, falling back to plaintext: %v", err)
 			appState.AddMessage("Encryption failed, sent as plaintext", "warning")
 			// Fall through to plaintext
-		} else {
-			logger.Info("✅ Sent encrypted chat message: %s", message)
-			return
 		}
 	}
 
+	// Never fall back to plaintext when the server forbids it
+	if serverRequiresEncryption {
+		logger.Warn("Not sending chat: server requires encryption and it isn't available")
+		appState.SetChatDelivery(msgID, message, "failed")
+		appState.AddMessage("Message not sent: this server requires encrypted chat", "error")
+		return fmt.Errorf("server requires encrypted chat")
+	}
+
 	// Fallback to plaintext chat
-	chatMsg := map[string]string{
-		"type":     "chat",
-		"channel":  currentChannel,
-		"message":  message,
-		"username": nickname,
+	chatMsg := common.Chat{
+		Type:     common.MsgChat,
+		Channel:  currentChannel,
+		Message:  message,
+		Username: nickname,
+		MsgID:    msgID,
 	}
 
 	data, err := json.Marshal(chatMsg)
 	if err != nil {
 		logger.Error("Failed to marshal chat message: %v", err)
-		return
+		return err
 	}
 
-	_, err = serverConn.Write(data)
+	err = sendTrackedChat(msgID, message, data)
 	if err != nil {
 		logger.Error("Failed to send chat message: %v", err)
 		appState.AddMessage("Failed to send chat message", "error")
-	} else {
-		logger.Info("✅ Sent plaintext chat message: %s", message)
+		return err
 	}
+	logger.Info("✅ Sent plaintext chat message: %s", message)
+	appState.CountChatSent()
+	return nil
 }
 
-func sendEncryptedChatMessage(message, username string) error {
+func sendEncryptedChatMessage(msgID, message, username string) error {
 	logger.Debug("Encrypting chat message for transmission")
 
 	// Encrypt the message
@@ -285,11 +587,12 @@ func sendEncryptedChatMessage(message, username string) error {
 	}
 
 	// Create encrypted chat message
-	encryptedMsg := map[string]interface{}{
-		"type":      "encrypted_chat",
-		"channel":   currentChannel,
-		"encrypted": true,
-		"payload":   base64.StdEncoding.EncodeToString(encryptedData),
+	encryptedMsg := common.EncryptedChat{
+		Type:      common.MsgEncryptedChat,
+		Channel:   currentChannel,
+		Encrypted: true,
+		Payload:   base64.StdEncoding.EncodeToString(encryptedData),
+		MsgID:     msgID,
 	}
 
 	data, err := json.Marshal(encryptedMsg)
@@ -297,7 +600,7 @@ func sendEncryptedChatMessage(message, username string) error {
 		return fmt.Errorf("failed to marshal encrypted message: %v", err)
 	}
 
-	_, err = serverConn.Write(data)
+	err = sendTrackedChat(msgID, message, data)
 	if err != nil {
 		return fmt.Errorf("failed to send encrypted message: %v", err)
 	}
@@ -306,65 +609,399 @@ func sendEncryptedChatMessage(message, username string) error {
 	return nil
 }
 
-func handleServerResponses(conn *net.UDPConn) {
+// sendTyping tells the channel we're composing. No-op on servers without typing support.
+func sendTyping() {
+	conn := serverConn
+	if conn == nil || currentChannel == "" || !common.HasCapability(serverCapabilities, common.CapabilityTyping) {
+		return
+	}
+
+	typingMsg := map[string]string{
+		"type":    common.MsgTyping,
+		"channel": currentChannel,
+	}
+	data, err := json.Marshal(typingMsg)
+	if err != nil {
+		return
+	}
+	if _, err := conn.Write(data); err != nil {
+		logger.Debug("Failed to send typing hint: %v", err)
+	}
+}
+
+// sendTransmitEnd tells listeners we released push-to-talk. No-op on servers
+// that don't relay it.
+func sendTransmitEnd() {
+	conn := serverConn
+	if conn == nil || !common.HasCapability(serverCapabilities, common.CapabilityTransmitEnd) {
+		return
+	}
+
+	data, err := json.Marshal(map[string]string{"type": common.MsgTransmitEnd})
+	if err != nil {
+		return
+	}
+	if _, err := conn.Write(data); err != nil {
+		logger.Debug("Failed to send transmit end: %v", err)
+	}
+}
+
+// sendControl writes a JSON control message to the server
+func sendControl(msg map[string]interface{}) error {
+	conn := serverConn
+	if conn == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(data); err != nil {
+		return fmt.Errorf("failed to send %s: %v", msg["type"], err)
+	}
+	return nil
+}
+
+// sendStatus sets our presence (online/away/busy) with an optional message
+func sendStatus(status, message string) error {
+	if err := sendControl(map[string]interface{}{
+		"type":    common.MsgSetStatus,
+		"status":  status,
+		"message": message,
+	}); err != nil {
+		return err
+	}
+
+	logger.Info("Set status: %s %s", status, message)
+	return nil
+}
+
+// sendMonitorChannel starts or stops hearing another channel's audio. The
+// server answers with the full list of monitored channels, or an error.
+func sendMonitorChannel(channel string, monitor bool) error {
+	if !common.HasCapability(serverCapabilities, common.CapabilityMonitor) {
+		return fmt.Errorf("this server doesn't allow monitoring other channels")
+	}
+	if monitor && channel == currentChannel {
+		return fmt.Errorf("you are already in #%s", channel)
+	}
+	logger.Info("Requested monitoring of #%s: %t", channel, monitor)
+	return sendControl(map[string]interface{}{
+		"type":    common.MsgMonitorChannel,
+		"channel": channel,
+		"monitor": monitor,
+	})
+}
+
+// restoreMonitoredChannels asks a fresh connection to monitor the channels we
+// monitored before it, forgetting any the server doesn't have or allow
+func restoreMonitoredChannels(channels []string) {
+	var restore []string
+	for _, channel := range appState.GetMonitoredChannels() {
+		if slices.Contains(channels, channel) && channel != currentChannel {
+			restore = append(restore, channel)
+		}
+	}
+	appState.SetMonitoredChannels(nil)
+	if !common.HasCapability(serverCapabilities, common.CapabilityMonitor) {
+		return
+	}
+	for _, channel := range restore {
+		if err := sendMonitorChannel(channel, true); err != nil {
+			logger.Warn("Could not monitor #%s again: %v", channel, err)
+		}
+	}
+}
+
+// showChannelTopic prints a channel's topic on joining it
+func showChannelTopic(channel, topic string) {
+	if topic != "" {
+		appState.AddMessage(fmt.Sprintf("📌 #%s: %s", channel, topic), "info")
+	}
+}
+
+// sendSetTopic changes a channel's topic; the server checks we're allowed to
+func sendSetTopic(channel, topic string) error {
+	logger.Info("Set topic of #%s: %s", channel, topic)
+	return sendControl(map[string]interface{}{
+		"type":    common.MsgSetTopic,
+		"channel": channel,
+		"topic":   topic,
+	})
+}
+
+// sendStatsRequest asks the server for its usage stats (admins only)
+func sendStatsRequest() error {
+	return sendControl(map[string]interface{}{"type": common.MsgStats})
+}
+
+// formatServerStats summarizes a stats reply for the chat pane
+func formatServerStats(s common.ServerStats) string {
+	uptime := time.Duration(s.UptimeSec) * time.Second
+	return fmt.Sprintf("📊 Up %v - %d users (peak %d), %d connections, %d audio packets and %d chat messages relayed (%.1f MB)",
+		uptime, s.Users, s.PeakUsers, s.Connections, s.AudioRelayed, s.ChatRelayed, float64(s.BytesRelayed)/(1024*1024))
+}
+
+// sendKick asks the server to disconnect a user (moderators and admins only)
+func sendKick(nickname, reason string) error {
+	logger.Info("Kick %s: %s", nickname, reason)
+	return sendControl(map[string]interface{}{
+		"type":     common.MsgKick,
+		"nickname": nickname,
+		"reason":   reason,
+	})
+}
+
+// sendMuteUser server-mutes a user (duration 0 = until unmuted), or unmutes them
+func sendMuteUser(nickname string, mute bool, duration time.Duration, reason string) error {
+	msgType := common.MsgUnmuteUser
+	if mute {
+		msgType = common.MsgMuteUser
+	}
+	logger.Info("%s %s for %v: %s", msgType, nickname, duration, reason)
+	return sendControl(map[string]interface{}{
+		"type":         msgType,
+		"nickname":     nickname,
+		"duration_sec": int(duration / time.Second),
+		"reason":       reason,
+	})
+}
+
+// sendBan asks the server to ban a user's address, or a raw IP (admins only)
+func sendBan(ban bool, target, reason string) error {
+	msg := map[string]interface{}{"type": common.MsgUnban, "reason": reason}
+	if ban {
+		msg["type"] = common.MsgBan
+	}
+	if net.ParseIP(target) != nil {
+		msg["ip"] = target
+	} else {
+		msg["nickname"] = target
+	}
+	logger.Info("%s %s: %s", msg["type"], target, reason)
+	return sendControl(msg)
+}
+
+// sendSetRole asks the server to assign a role (admins only)
+func sendSetRole(nickname, role string) error {
+	logger.Info("Set role of %s to %s", nickname, role)
+	return sendControl(map[string]interface{}{
+		"type":     common.MsgSetRole,
+		"nickname": nickname,
+		"role":     role,
+	})
+}
+
+func handleServerResponses(s *serverSession) {
 	logger.Info("Starting server response handler")
+	conn := s.conn
 
-	buffer := make([]byte, 4096)
+	buffer := make([]byte, common.MaxPacketSize)
 	var networkFrameCount int
 	var lastSeqNum uint16 = 0
 	var packetsReceived int
 	var packetsLost int
 
+	// Messages that arrived during the crypto handshake come first
+	early := s.early
+	s.early = nil
+
 	for {
-		n, _, err := conn.ReadFromUDP(buffer)
-		if err != nil {
-			logger.Error("Disconnected from server: %v", err)
-			appState.SetConnected(false, "", "", "")
-			appState.AddMessage("Disconnected from server", "error")
-			cryptoReady = false // Reset crypto state on disconnect
-			return
+		var n int
+		if len(early) > 0 {
+			n = copy(buffer, early[0])
+			early = early[1:]
+		} else {
+			var err error
+			n, _, err = conn.ReadFromUDP(buffer)
+			if err != nil {
+				if s.ctx.Err() != nil {
+					logger.Debug("Server response handler stopped with its session")
+					return
+				}
+				logger.Error("Disconnected from server: %v", err)
+				s.lost("Lost connection to server")
+				return
+			}
 		}
+		countReceived(n)
 
-		// Try to parse JSON first (control messages including chat)
+		// Control messages (including chat) are JSON; audio skips the parse attempt
+		magic := currentAudioMagic()
 		var msg map[string]interface{}
-		if err := json.Unmarshal(buffer[:n], &msg); err == nil {
+		if !magic.IsAudio(buffer[:n]) && json.Unmarshal(buffer[:n], &msg) == nil {
 			switch msg["type"] {
-			case "channel_changed":
+			case common.MsgChannelChanged:
 				channelName := msg["channel"].(string)
 				currentChannel = channelName
 
+				appState.ClearTyping()
 				appState.SetChannel(channelName)
 				logger.Info("Channel changed to: %s", channelName)
 
-			case "error":
-				errorMsg := msg["message"].(string)
-				appState.AddMessage(fmt.Sprintf("Server error: %s", errorMsg), "error")
-				logger.Error("Server error: %s", errorMsg)
+				// The server stops monitoring a channel once we're in it
+				if monitored := appState.GetMonitoredChannels(); slices.Contains(monitored, channelName) {
+					appState.SetMonitoredChannels(slices.DeleteFunc(monitored, func(c string) bool { return c == channelName }))
+				}
+
+				// Older servers don't send a topic; keep what we know then
+				if topic, ok := msg["topic"].(string); ok {
+					appState.SetChannelTopic(channelName, topic)
+					showChannelTopic(channelName, topic)
+				}
+
+			case common.MsgChannelTopic:
+				channel, _ := msg["channel"].(string)
+				topic, _ := msg["topic"].(string)
+				appState.SetChannelTopic(channel, topic)
+				logger.Info("Topic of #%s is now: %s", channel, topic)
+
+			case common.MsgError:
+				var serverErr common.ErrorMessage
+				json.Unmarshal(buffer[:n], &serverErr)
+				appState.AddMessage(fmt.Sprintf("Server error: %s", serverErr.Message), "error")
+				logger.Error("Server error (%s): %s", serverErr.Code, serverErr.Message)
+
+				// Resending won't help while muted or without encryption;
+				// rate-limited chat is left to the retransmits
+				switch serverErr.Code {
+				case common.CodeMuted, common.CodeEncryptionRequired:
+					failPendingChats()
+				case common.CodeFrameSizeMismatch:
+					logger.Warn("Server dropped our audio: we send %dms frames", frameDuration().Milliseconds())
+				case common.CodeNotConnected:
+					// Timed out on the server (or it restarted): our session is gone
+					s.lost("Server no longer knows this client")
+					return
+				}
 
-			case "pong":
-				logger.Debug("Received pong from server")
+			case common.MsgEchoReply:
+				if id, ok := msg["id"].(string); ok {
+					select {
+					case echoReplies <- id:
+					default: // Nobody waiting
+					}
+				}
 
-			case "channel_users_update":
+			case common.MsgPong:
+				pingMutex.Lock()
+				sentAt := pingSentAt
+				pingSentAt = time.Time{}
+				pingMutex.Unlock()
+
+				if !sentAt.IsZero() {
+					rtt := time.Since(sentAt)
+					appState.SetLatency(rtt)
+					logger.Debug("Received pong from server (rtt: %v)", rtt)
+				} else {
+					logger.Debug("Received pong from server")
+				}
+
+			case common.MsgChannelUsersUpdate:
 				var update struct {
-					ChannelUsers map[string][]string `json:"channelUsers"`
+					ChannelUsers map[string][]common.UserInfo `json:"channelUsers"`
+					SourceIDs    map[string]uint16            `json:"sourceIds"`
 				}
 				if err := json.Unmarshal(buffer[:n], &update); err == nil {
+					setSourceIDs(update.SourceIDs)
 					appState.SetChannelUsers(update.ChannelUsers)
 					logger.Debug("Channel users updated")
 				}
 
-			case "chat_message":
+			case common.MsgChatMessage:
 				logger.Info("Received chat message from server")
 				handleIncomingChatMessage(buffer[:n])
 
-			case "encrypted_chat":
+			case common.MsgEncryptedChat:
 				logger.Info("Received encrypted chat message from server")
 				handleIncomingEncryptedChatMessage(buffer[:n])
 
-			case "chat_history":
+			case common.MsgChatHistory:
 				logger.Info("Received chat history from server")
 				handleChatHistory(buffer[:n])
 
+			case common.MsgSystemMessage:
+				message, _ := msg["message"].(string)
+				timestamp, _ := msg["timestamp"].(string)
+				announcement, _ := msg["announcement"].(bool)
+				if message != "" {
+					ts := parseChatTimestamp(timestamp).Local().Format("15:04")
+					if announcement {
+						// Operator announcements go to every channel and stand out
+						appState.AddMessage(fmt.Sprintf("[%s] 📢 %s", ts, message), "announcement")
+						logger.Info("Server announcement: %s", message)
+					} else {
+						appState.AddMessage(fmt.Sprintf("[%s] *** %s ***", ts, message), "system")
+						logger.Debug("System message: %s", message)
+					}
+				}
+				// Joins and leaves in our channel get an optional sound cue
+				event, _ := msg["event"].(string)
+				if channel, _ := msg["channel"].(string); event != "" && channel == currentChannel {
+					playChannelSound(event)
+				}
+
+			case common.MsgTransmitEnded:
+				if source, ok := msg["source"].(float64); ok {
+					select {
+					case transmitEnds <- uint16(source):
+					default: // Playback isn't keeping up; the gap times out on its own
+					}
+				}
+
+			case common.MsgTypingUpdate:
+				username, _ := msg["username"].(string)
+				channel, _ := msg["channel"].(string)
+				if username != "" && channel == currentChannel {
+					appState.SetUserTyping(username)
+				}
+
+			case common.MsgChatAck:
+				if msgID, ok := msg["msg_id"].(string); ok {
+					handleChatAck(msgID)
+				}
+
+			case common.MsgModerationAck:
+				action, _ := msg["action"].(string)
+				target, _ := msg["target"].(string)
+				appState.AddMessage(fmt.Sprintf("Done: %s %s", action, target), "info")
+
+			case common.MsgMonitoring:
+				var monitoring common.Monitoring
+				if err := json.Unmarshal(buffer[:n], &monitoring); err == nil {
+					appState.SetMonitoredChannels(monitoring.Channels)
+					if len(monitoring.Channels) == 0 {
+						appState.AddMessage("👂 Not monitoring other channels", "info")
+					} else {
+						appState.AddMessage(fmt.Sprintf("👂 Monitoring #%s (%d of %d)",
+							strings.Join(monitoring.Channels, ", #"), len(monitoring.Channels), monitoring.Max), "info")
+					}
+				}
+
+			case common.MsgStatsReply:
+				var reply common.ServerStats
+				if err := json.Unmarshal(buffer[:n], &reply); err == nil {
+					appState.AddMessage(formatServerStats(reply), "info")
+				}
+
+			case common.MsgKicked:
+				by, _ := msg["by"].(string)
+				reason, _ := msg["reason"].(string)
+				notice := fmt.Sprintf("You were kicked by %s", by)
+				if reason != "" {
+					notice += ": " + reason
+				}
+				logger.Warn("%s", notice)
+				appState.AddMessage(notice, "error")
+				s.end(sessionEnd{reason: "kicked"})
+
+			case common.MsgServerShutdown:
+				var notice common.ServerShutdown
+				if err := json.Unmarshal(buffer[:n], &notice); err == nil {
+					handleServerShutdown(s, notice)
+				}
+
 			default:
 				logger.Debug("Unknown server message type: %v", msg["type"])
 			}
@@ -377,96 +1014,110 @@ func handleServerResponses(conn *net.UDPConn) {
 			continue
 		}
 
-		// Validate audio packet prefix
+		// Validate audio packet prefix; tagged packets carry the talker's source ID
 		prefix := binary.LittleEndian.Uint16(buffer[0:2])
-		if prefix != 0x5541 { // 'AU'
+		headerLen := 4
+		var source uint16
+		switch prefix {
+		case magic.Audio:
+		case magic.Source:
+			if n < 8 {
+				logger.Debug("Dropped malformed tagged packet (too small): %d bytes", n)
+				continue
+			}
+			source = binary.LittleEndian.Uint16(buffer[4:6])
+			headerLen = 6
+		default:
 			logger.Debug("Dropped packet with invalid prefix: 0x%04X", prefix)
 			continue
 		}
 
-		// Extract sequence number (premium packets)
-		seqNum := binary.LittleEndian.Uint16(buffer[2:4])
-
-		// Calculate audio payload size
-		sampleCount := (n - 4) / 2 // Skip 4 bytes (prefix + seq), 2 bytes per sample
-		if sampleCount != framesPerBuffer {
-			logger.Debug("Dropped frame with wrong length: got %d samples, expected %d", sampleCount, framesPerBuffer)
+		// Sequence number of the packet's first frame (premium packets)
+		firstSeq := binary.LittleEndian.Uint16(buffer[2:4])
+
+		// A packet carries one frame, or several consecutive ones if the talker coalesces
+		sampleCount := framesPerBuffer()
+		frames := common.AudioFrameCount(n-headerLen, int(frameDuration().Milliseconds()))
+		if frames == 0 {
+			logger.Debug("Dropped packet with wrong length: %d bytes of audio, frames are %d samples", n-headerLen, sampleCount)
+			// Servers that negotiate frame sizes filter these out; an older
+			// one relays whatever its clients send
+			if !frameMismatchWarned.Swap(true) {
+				logger.Warn("Receiving audio that isn't whole %dms frames; it can't be played", frameDuration().Milliseconds())
+				appState.AddMessage("Some audio can't be played: a talker uses a different frame size. Updating the server or that client fixes it.", "warning")
+			}
 			continue
 		}
 
-		// Decode audio samples
-		samples := make([]int16, sampleCount)
-		err = binary.Read(bytes.NewReader(buffer[4:n]), binary.LittleEndian, &samples)
-		if err != nil {
-			logger.Error("Failed to decode audio samples: %v", err)
-			continue
-		}
+		for f := 0; f < frames; f++ {
+			seqNum := firstSeq + uint16(f)
 
-		// Track packet statistics for network quality
-		packetsReceived++
-		if packetsReceived > 1 { // Skip first packet for sequence analysis
-			expectedSeq := lastSeqNum + 1
-			if seqNum != expectedSeq {
-				if seqNum > expectedSeq {
-					// Packets were lost
-					lost := int(seqNum - expectedSeq)
-					packetsLost += lost
-					logger.Debug("Packet loss detected: expected %d, got %d (%d packets lost)",
-						expectedSeq, seqNum, lost)
-				} else {
-					// Out of order packet (late arrival)
-					logger.Debug("Out-of-order packet: expected %d, got %d", expectedSeq, seqNum)
+			// Decode audio samples into a recycled frame
+			samples := getReceivedFrame(sampleCount)
+			payload := buffer[headerLen+f*sampleCount*2 : n]
+			for i := range samples {
+				samples[i] = int16(binary.LittleEndian.Uint16(payload[i*2:]))
+			}
+
+			// Track packet statistics for network quality
+			packetsReceived++
+			if packetsReceived > 1 { // Skip first packet for sequence analysis
+				expectedSeq := lastSeqNum + 1
+				if seqNum != expectedSeq {
+					if seqNum > expectedSeq {
+						// Packets were lost
+						lost := int(seqNum - expectedSeq)
+						packetsLost += lost
+						logger.Debug("Packet loss detected: expected %d, got %d (%d packets lost)",
+							expectedSeq, seqNum, lost)
+					} else {
+						// Out of order packet (late arrival)
+						logger.Debug("Out-of-order packet: expected %d, got %d", expectedSeq, seqNum)
+					}
 				}
 			}
-		}
-		lastSeqNum = seqNum
+			lastSeqNum = seqNum
 
-		// Update network statistics
-		appState.IncrementRX()
+			// Update network statistics
+			appState.IncrementRX()
 
-		// Calculate and log network quality metrics
-		if packetsReceived%100 == 0 && packetsReceived > 0 {
-			lossRate := float32(packetsLost) / float32(packetsReceived)
-			logger.Info("Network Quality - Received: %d, Lost: %d (%.2f%%), Seq: %d",
-				packetsReceived, packetsLost, lossRate*100, seqNum)
+			// Calculate and log network quality metrics
+			if packetsReceived%100 == 0 && packetsReceived > 0 {
+				lossRate := float32(packetsLost) / float32(packetsReceived)
+				appState.SetPacketLoss(lossRate)
+				logger.Info("Network Quality - Received: %d, Lost: %d (%.2f%%), Seq: %d",
+					packetsReceived, packetsLost, lossRate*100, seqNum)
 
-			// Report significant packet loss
-			if lossRate > 0.05 { // More than 5% loss
-				appState.AddMessage(fmt.Sprintf("High packet loss: %.1f%%", lossRate*100), "warning")
+				// Report significant packet loss
+				if lossRate > 0.05 { // More than 5% loss
+					appState.AddMessage(fmt.Sprintf("High packet loss: %.1f%%", lossRate*100), "warning")
+				}
 			}
-		}
 
-		// Send audio to premium jitter buffer for processing
-		audioProcessor.AddToJitterBuffer(seqNum, samples)
+			// Measure interarrival jitter for the quality rating
+			audioProcessor.RecordArrival(source, seqNum, time.Now())
 
-		// QUICK FIX: Also send directly to playback channel
-		select {
-		case incomingAudio <- samples:
-			// Successfully queued for playback
-		default:
-			// Channel full, skip to prevent blocking network thread
-			logger.Debug("Playback channel full, dropping frame")
-		}
+			// Send audio to premium jitter buffer for processing
+			audioProcessor.AddToJitterBuffer(seqNum, samples)
+
+			// Calculate max amplitude for logging (but don't set audio level here - jitter buffer handles that).
+			// Done before queueing: once queued, playback owns the frame.
+			maxAmp := maxAmplitude(samples)
+
+			// QUICK FIX: Also send directly to playback channel
+			queueReceivedFrame(audioFrame{source: source, samples: samples, pooled: true})
 
-		// Calculate max amplitude for logging (but don't set audio level here - jitter buffer handles that)
-		maxAmp := maxAmplitude(samples)
-		networkFrameCount++
-		if maxAmp > 50 && networkFrameCount%50 == 0 {
-			logger.Debug("Receiving audio (seq: %d, amplitude: %d)", seqNum, maxAmp)
+			networkFrameCount++
+			if maxAmp > 50 && networkFrameCount%50 == 0 {
+				logger.Debug("Receiving audio (seq: %d, amplitude: %d)", seqNum, maxAmp)
+			}
 		}
 	}
 }
 
 // Handle incoming chat messages - FIXED PARSING
 func handleIncomingChatMessage(data []byte) {
-	var chatMsg struct {
-		Type      string `json:"type"`
-		GUID      string `json:"guid"`
-		Channel   string `json:"channel"`
-		Username  string `json:"username"`
-		Message   string `json:"message"`
-		Timestamp string `json:"timestamp"`
-	}
+	var chatMsg common.ChatMessage
 
 	if err := json.Unmarshal(data, &chatMsg); err != nil {
 		logger.Error("Failed to parse incoming chat message: %v", err)
@@ -476,38 +1127,19 @@ func handleIncomingChatMessage(data []byte) {
 	logger.Debug("Chat message - Channel: %s, User: %s, Message: %s, Timestamp: %s",
 		chatMsg.Channel, chatMsg.Username, chatMsg.Message, chatMsg.Timestamp)
 
-	// Create consistent format: [HH:MM] <username> message
-	// Use the timestamp from server, but ensure consistent format
-	var formattedTimestamp string
-	if len(chatMsg.Timestamp) == 5 && chatMsg.Timestamp[2] == ':' {
-		// Already HH:MM format
-		formattedTimestamp = fmt.Sprintf("[%s]", chatMsg.Timestamp)
-	} else {
-		// Use current time if server timestamp is weird
-		now := time.Now()
-		formattedTimestamp = fmt.Sprintf("[%02d:%02d]", now.Hour(), now.Minute())
-	}
+	appState.ClearUserTyping(chatMsg.Username)
 
-	// CONSISTENT FORMAT: [HH:MM] <username> message
-	chatDisplayMsg := fmt.Sprintf("%s <%s> %s", formattedTimestamp, chatMsg.Username, chatMsg.Message)
+	chatDisplayMsg := formatChatLine(parseChatTimestamp(chatMsg.Timestamp), chatMsg.Username, chatMsg.Message)
 
 	// Add to app state as a chat message - ONLY ONCE
-	appState.AddMessage(chatDisplayMsg, "chat")
+	appState.AddChatMessage(chatDisplayMsg, chatSegments(chatMsg.Message))
 
 	logger.Info("Added chat message: %s", chatDisplayMsg)
 }
 
 // Handle incoming encrypted chat messages
 func handleIncomingEncryptedChatMessage(data []byte) {
-	var encryptedMsg struct {
-		Type      string `json:"type"`
-		GUID      string `json:"guid"`
-		Channel   string `json:"channel"`
-		Username  string `json:"username"`
-		Encrypted bool   `json:"encrypted"`
-		Payload   string `json:"payload"`
-		Timestamp string `json:"timestamp"`
-	}
+	var encryptedMsg common.EncryptedChat
 
 	if err := json.Unmarshal(data, &encryptedMsg); err != nil {
 		logger.Error("Failed to parse encrypted chat message: %v", err)
@@ -538,36 +1170,19 @@ func handleIncomingEncryptedChatMessage(data []byte) {
 
 	logger.Debug("Decrypted message: %s", decryptedMessage)
 
-	// Create consistent format: [HH:MM] <username> message
-	var formattedTimestamp string
-	if len(encryptedMsg.Timestamp) == 5 && encryptedMsg.Timestamp[2] == ':' {
-		formattedTimestamp = fmt.Sprintf("[%s]", encryptedMsg.Timestamp)
-	} else {
-		now := time.Now()
-		formattedTimestamp = fmt.Sprintf("[%02d:%02d]", now.Hour(), now.Minute())
-	}
+	appState.ClearUserTyping(encryptedMsg.Username)
 
-	// CONSISTENT FORMAT: [HH:MM] <username> message
-	chatDisplayMsg := fmt.Sprintf("%s <%s> %s", formattedTimestamp, encryptedMsg.Username, decryptedMessage)
+	chatDisplayMsg := formatChatLine(parseChatTimestamp(encryptedMsg.Timestamp), encryptedMsg.Username, decryptedMessage)
 
 	// Add to app state as a chat message
-	appState.AddMessage(chatDisplayMsg, "chat")
+	appState.AddChatMessage(chatDisplayMsg, chatSegments(decryptedMessage))
 
 	logger.Info("Added decrypted chat message: %s", chatDisplayMsg)
 }
 
 // Handle chat history - FIXED PARSING
 func handleChatHistory(data []byte) {
-	var historyMsg struct {
-		Type     string `json:"type"`
-		GUID     string `json:"guid"`
-		Channel  string `json:"channel"`
-		Messages []struct {
-			Username  string    `json:"username"`
-			Message   string    `json:"message"`
-			Timestamp time.Time `json:"timestamp"`
-		} `json:"messages"`
-	}
+	var historyMsg common.ChatHistory
 
 	if err := json.Unmarshal(data, &historyMsg); err != nil {
 		logger.Error("Failed to parse chat history: %v", err)
@@ -578,14 +1193,10 @@ func handleChatHistory(data []byte) {
 
 	// Add history messages with consistent formatting
 	for _, msg := range historyMsg.Messages {
-		// Format timestamp consistently as [HH:MM]
-		timestamp := fmt.Sprintf("[%02d:%02d]", msg.Timestamp.Hour(), msg.Timestamp.Minute())
-
-		// CONSISTENT FORMAT: [HH:MM] <username> message
-		chatDisplayMsg := fmt.Sprintf("%s <%s> %s", timestamp, msg.Username, msg.Message)
+		chatDisplayMsg := formatChatLine(msg.Timestamp, msg.Username, msg.Message)
 
 		// Add as chat message
-		appState.AddMessage(chatDisplayMsg, "chat")
+		appState.AddChatMessage(chatDisplayMsg, chatSegments(msg.Message))
 		logger.Debug("Added history message: %s", chatDisplayMsg)
 	}
 
@@ -594,14 +1205,142 @@ func handleChatHistory(data []byte) {
 	}
 }
 
-func startPingLoop(conn *net.UDPConn) {
-	logger.Debug("Starting ping loop to maintain connection")
+// parseChatTimestamp parses the server's RFC3339 chat timestamp.
+// Falls back to the current time if the server sent something unexpected.
+func parseChatTimestamp(raw string) time.Time {
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		logger.Debug("Invalid chat timestamp %q, using local time: %v", raw, err)
+		return time.Now()
+	}
+	return t
+}
+
+// formatChatLine renders a chat message as "[HH:MM] <username> message" in local time
+func formatChatLine(timestamp time.Time, username, message string) string {
+	return fmt.Sprintf("[%s] <%s> %s", timestamp.Local().Format("15:04"), username, message)
+}
+
+// Reachability check: attempts and how long to wait for each echo
+const (
+	echoAttempts = 3
+	echoTimeout  = time.Second
+)
+
+// checkServerReachable sends a tagged echo right after connecting and waits for
+// it to come back. This confirms packets flow both ways and gives an RTT before
+// the first keepalive ping.
+func checkServerReachable(s *serverSession) {
+	conn := s.conn
+	if !common.HasCapability(serverCapabilities, common.CapabilityEcho) {
+		logger.Debug("Server doesn't support echo, skipping reachability check")
+		return
+	}
+
+	// Each attempt gets its own ID so a late reply still yields the right RTT
+	base := newChatMsgID()
+	sent := make(map[string]time.Time, echoAttempts)
+
+	for attempt := 1; attempt <= echoAttempts; attempt++ {
+		id := fmt.Sprintf("%s-%d", base, attempt)
+		data, _ := json.Marshal(map[string]string{"type": common.MsgEcho, "id": id})
+		sent[id] = time.Now()
+		if _, err := conn.Write(data); err != nil {
+			logger.Error("Failed to send echo: %v", err)
+			return
+		}
+
+		timeout := time.After(echoTimeout)
+	wait:
+		for {
+			select {
+			case reply := <-echoReplies:
+				sentAt, ok := sent[reply]
+				if !ok {
+					continue // Reply to an earlier connection
+				}
+				rtt := time.Since(sentAt)
+				logger.Info("Server reachable, RTT %v (after %d attempts)", rtt, attempt)
+				appState.SetLatency(rtt)
+				appState.AddMessage(fmt.Sprintf("Server reachable, RTT %dms", rtt.Milliseconds()), "success")
+				return
+			case <-timeout:
+				logger.Debug("No echo reply within %v (attempt %d/%d)", echoTimeout, attempt, echoAttempts)
+				break wait
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}
+
+	logger.Warn("Server did not answer %d echo packets - UDP may be blocked in one direction", echoAttempts)
+	appState.AddMessage("Server isn't answering - UDP may be blocked one way (check firewall/NAT)", "warning")
+}
+
+// Unanswered pings in a row before the server counts as lost
+const pingMissLimit = 3
+
+// Longest gap between pings. Servers drop clients after at least 15s of
+// silence, so this leaves room for two pings to go missing in between.
+const maxKeepaliveSeconds = 5
+
+// startPingLoop keeps the connection (and any NAT mapping) alive.
+// Pings are frequent while idle and back off while audio traffic already keeps the mapping open.
+func startPingLoop(s *serverSession, keepalive KeepaliveConfig) {
+	conn := s.conn
+	activeInterval := time.Duration(keepalive.IntervalSeconds) * time.Second
+	if activeInterval <= 0 || activeInterval > maxKeepaliveSeconds*time.Second {
+		activeInterval = maxKeepaliveSeconds * time.Second
+	}
+	idleInterval := time.Duration(keepalive.IdleIntervalSeconds) * time.Second
+	if idleInterval <= 0 || idleInterval > activeInterval {
+		idleInterval = activeInterval
+	}
+
+	logger.Debug("Starting ping loop to maintain connection (active: %v, idle: %v)", activeInterval, idleInterval)
+
+	pingMutex.Lock()
+	pingSentAt = time.Time{}
+	pingMutex.Unlock()
 
+	lastRx, lastTx := appState.GetPacketCounts()
+	missed := 0
 	for {
-		ping := map[string]string{"type": "ping"}
+		ping := map[string]string{"type": common.MsgPing}
 		data, _ := json.Marshal(ping)
+
+		// A server that stops answering without an ICMP error is only
+		// noticed here: the previous ping is still waiting for its pong
+		pingMutex.Lock()
+		if pingSentAt.IsZero() {
+			missed = 0
+		} else {
+			missed++
+		}
+		pingSentAt = time.Now()
+		pingMutex.Unlock()
+
+		if missed >= pingMissLimit {
+			logger.Error("No pong for %d pings in a row", missed)
+			s.lost("Server stopped answering")
+			return
+		}
 		conn.Write(data)
-		logger.Debug("Sent ping to server")
-		time.Sleep(10 * time.Second)
+
+		// Audio moved since the last ping? Then traffic is keeping the mapping warm.
+		rx, tx := appState.GetPacketCounts()
+		interval := idleInterval
+		if rx != lastRx || tx != lastTx {
+			interval = activeInterval
+		}
+		lastRx, lastTx = rx, tx
+
+		logger.Debug("Sent ping to server (next in %v)", interval)
+		select {
+		case <-s.ctx.Done():
+			logger.Debug("Ping loop stopped")
+			return
+		case <-time.After(interval):
+		}
 	}
 }
@@ -0,0 +1,280 @@
+// FILE: client/oneshot.go
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// One-shot mode connects, sends one chat message or prints the server status,
+// then disconnects - no audio, tray or web UI. For cron jobs and monitoring scripts:
+//
+//	ahcli-client.exe -send "Server restart at 22:00" -channel General -nick Announcer
+//	ahcli-client.exe -status -json
+type oneShotOptions struct {
+	send    string
+	channel string
+	status  bool
+	json    bool
+	server  string
+	nick    string
+	config  string
+}
+
+// How long to wait for a channel switch or the user list
+const oneShotTimeout = 5 * time.Second
+
+// parseOneShotFlags reads the command line. Without -send or -status the client starts normally.
+func parseOneShotFlags() oneShotOptions {
+	var opts oneShotOptions
+	flag.StringVar(&opts.send, "send", "", "Send one chat message and exit")
+	flag.StringVar(&opts.channel, "channel", "", "Channel to send to (default: the server's default channel)")
+	flag.BoolVar(&opts.status, "status", false, "Print the server's channels and users and exit")
+	flag.BoolVar(&opts.json, "json", false, "With -status, print JSON")
+	flag.StringVar(&opts.server, "server", "", "Server name from the config (default: preferred_server)")
+	flag.StringVar(&opts.nick, "nick", "", "Nickname to connect as (default: the config's nicknames)")
+	flag.StringVar(&opts.config, "config", "settings.config", "Client config file")
+	flag.Parse()
+	return opts
+}
+
+// enabled reports whether a one-shot action was requested
+func (o oneShotOptions) enabled() bool {
+	return o.send != "" || o.status
+}
+
+// runOneShot performs the requested action and returns the process exit code
+func runOneShot(opts oneShotOptions) int {
+	attachParentConsole()
+	logger.SetConsoleOutput(false) // Stdout is for the result; details go to the log file
+	logger.Info("One-shot mode: send=%t, status=%t", opts.send != "", opts.status)
+
+	InitAppState()
+
+	config, err := loadClientConfig(opts.config)
+	if err != nil {
+		return oneShotFailed(err)
+	}
+	currentConfig = config
+	if opts.server != "" {
+		config.PreferredServer = opts.server
+	}
+	if opts.nick != "" {
+		config.Nickname = []string{opts.nick}
+	}
+
+	if err := InitClientCrypto(); err != nil {
+		return oneShotFailed(err)
+	}
+
+	connectStart := time.Now()
+	conn, accepted, err := dialServer(config)
+	if err != nil {
+		return oneShotFailed(err)
+	}
+	connectTime := time.Since(connectStart)
+
+	serverConn = conn
+	defer sendDisconnect()
+
+	currentChannel = "General" // Default channel, as in connectToServer
+	serverCapabilities = accepted.Capabilities
+	serverRequiresEncryption = accepted.RequireEncryption
+	appState.SetConnected(true, accepted.Nickname, accepted.ServerName, accepted.MOTD)
+	logger.Info("One-shot connected to %s as %s", accepted.ServerName, accepted.Nickname)
+
+	if opts.status {
+		err = printServerStatus(conn, accepted, connectTime, opts.json)
+	} else {
+		err = sendOneShotChat(conn, opts.channel, opts.send)
+	}
+	if err != nil {
+		return oneShotFailed(err)
+	}
+	return 0
+}
+
+// oneShotFailed reports an error on stderr and returns the failure exit code
+func oneShotFailed(err error) int {
+	logger.Error("One-shot failed: %v", err)
+	fmt.Fprintf(os.Stderr, "ahcli: %v\n", err)
+	return 1
+}
+
+// sendOneShotChat joins a channel if asked, sets up encryption and sends one
+// message, waiting for the server's chat_ack
+func sendOneShotChat(conn *net.UDPConn, channel, message string) error {
+	if channel != "" && channel != currentChannel {
+		changeChannel(channel)
+		err := awaitServerMessage(conn, oneShotTimeout, func(msg map[string]interface{}, _ []byte) (bool, error) {
+			switch msg["type"] {
+			case common.MsgChannelChanged:
+				currentChannel, _ = msg["channel"].(string)
+				return true, nil
+			case common.MsgError:
+				return true, fmt.Errorf("server error: %v", msg["message"])
+			}
+			return false, nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not join #%s: %v", channel, err)
+		}
+	}
+
+	// Plaintext is still fine unless the server requires encryption; the send path decides
+	if _, err := initiateCryptoHandshake(conn); err != nil {
+		logger.Warn("One-shot crypto handshake failed: %v", err)
+	}
+
+	msgID := newChatMsgID()
+	if err := sendChatMessageWithID(msgID, message); err != nil {
+		return fmt.Errorf("message not sent: %v", err)
+	}
+
+	// Retransmits run in the background; give them all a chance before giving up
+	ackWait := chatAckTimeout * (chatMaxRetries + 1)
+	err := awaitServerMessage(conn, ackWait, func(msg map[string]interface{}, _ []byte) (bool, error) {
+		switch msg["type"] {
+		case common.MsgChatAck:
+			if msg["msg_id"] == msgID {
+				handleChatAck(msgID)
+				return true, nil
+			}
+		case common.MsgError:
+			return true, fmt.Errorf("server error: %v", msg["message"])
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("message not delivered: %v", err)
+	}
+
+	fmt.Printf("Sent to #%s\n", currentChannel)
+	return nil
+}
+
+// oneShotStatus is the -status -json output
+type oneShotStatus struct {
+	Server        string                 `json:"server"`
+	ServerVersion string                 `json:"server_version,omitempty"`
+	ConnectMs     int64                  `json:"connect_ms"`
+	Channels      []oneShotChannelStatus `json:"channels"`
+}
+
+type oneShotChannelStatus struct {
+	Name  string   `json:"name"`
+	Topic string   `json:"topic,omitempty"`
+	Users []string `json:"users"`
+}
+
+// printServerStatus prints each channel with its users. Our own connection is
+// left out of the lists.
+func printServerStatus(conn *net.UDPConn, accepted *common.ConnectAccepted, connectTime time.Duration, asJSON bool) error {
+	channelUsers := map[string][]common.UserInfo{currentChannel: accepted.Users}
+
+	// The server follows the accept with per-channel user lists; older info is fine if it doesn't
+	awaitServerMessage(conn, time.Second, func(msg map[string]interface{}, raw []byte) (bool, error) {
+		if msg["type"] != common.MsgChannelUsersUpdate {
+			return false, nil
+		}
+		var update struct {
+			ChannelUsers map[string][]common.UserInfo `json:"channelUsers"`
+		}
+		if err := json.Unmarshal(raw, &update); err == nil {
+			channelUsers = update.ChannelUsers
+		}
+		return true, nil
+	})
+
+	status := oneShotStatus{
+		Server:        accepted.ServerName,
+		ServerVersion: accepted.ServerVersion,
+		ConnectMs:     connectTime.Milliseconds(),
+	}
+	for _, channel := range accepted.Channels {
+		users := []string{}
+		for _, nick := range common.UserNicknames(channelUsers[channel]) {
+			if nick != accepted.Nickname {
+				users = append(users, nick)
+			}
+		}
+		status.Channels = append(status.Channels, oneShotChannelStatus{
+			Name:  channel,
+			Topic: accepted.Topics[channel],
+			Users: users,
+		})
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("%s", status.Server)
+	if status.ServerVersion != "" {
+		fmt.Printf(" (v%s)", status.ServerVersion)
+	}
+	fmt.Printf(" - connected in %dms\n", status.ConnectMs)
+	for _, channel := range status.Channels {
+		fmt.Printf("#%s (%d)", channel.Name, len(channel.Users))
+		if channel.Topic != "" {
+			fmt.Printf(" - %s", channel.Topic)
+		}
+		fmt.Println()
+		if len(channel.Users) > 0 {
+			fmt.Printf("  %s\n", strings.Join(channel.Users, ", "))
+		}
+	}
+	return nil
+}
+
+// awaitServerMessage reads control messages until match reports done or the
+// timeout passes. Audio packets are skipped.
+func awaitServerMessage(conn *net.UDPConn, timeout time.Duration, match func(msg map[string]interface{}, raw []byte) (bool, error)) error {
+	buffer := make([]byte, common.MaxPacketSize)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	for {
+		n, _, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return fmt.Errorf("no reply within %v", timeout)
+			}
+			return err
+		}
+
+		var msg map[string]interface{}
+		if json.Unmarshal(buffer[:n], &msg) != nil {
+			continue
+		}
+		if done, err := match(msg, buffer[:n]); done || err != nil {
+			return err
+		}
+	}
+}
+
+// attachParentConsole makes output visible when the GUI-subsystem release
+// build is run from a terminal. Redirected output already works as-is.
+func attachParentConsole() {
+	if _, err := os.Stdout.Stat(); err == nil {
+		return
+	}
+	if ok, _, _ := attachConsole.Call(ATTACH_PARENT_PROCESS); ok == 0 {
+		return
+	}
+	if console, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0); err == nil {
+		os.Stdout, os.Stderr = console, console
+	}
+}
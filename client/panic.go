@@ -0,0 +1,71 @@
+// FILE: client/panic.go
+package main
+
+import (
+	"ahcli/common/logger"
+	"sync"
+	"sync/atomic"
+)
+
+// The panic button silences everything at once - feedback, a blast of noise,
+// the wrong moment - by closing both audio streams. Nothing is sent or played
+// until it's pressed again. The connection stays up, so chat keeps working.
+
+// Key that toggles the panic button unless panic_key says otherwise
+const defaultPanicKey = "PAUSE"
+
+var (
+	audioPanicked atomic.Bool // Checked by startAudio and the network reader
+	panicMu       sync.Mutex  // Serializes presses so streams open and close in order
+)
+
+// toggleAudioPanic stops all audio, or brings it back if already stopped
+func toggleAudioPanic() {
+	panicMu.Lock()
+	defer panicMu.Unlock()
+	setAudioPanicLocked(!audioPanicked.Load())
+}
+
+// setAudioPanicLocked stops or restores all audio. Call with panicMu held.
+func setAudioPanicLocked(stopped bool) {
+	if audioPanicked.Load() == stopped {
+		return
+	}
+
+	if stopped {
+		// Set first so nothing reopens the streams or queues audio meanwhile
+		audioPanicked.Store(true)
+		StopAudio()
+		drainReceivedAudio()
+		logger.Warn("Panic button: all audio stopped")
+		appState.SetAudioPanic(true)
+		appState.AddMessage("🛑 All audio stopped - press the panic key or RESUME AUDIO to bring it back", "warning")
+		return
+	}
+
+	audioPanicked.Store(false)
+	drainReceivedAudio()
+	if err := startAudio(); err != nil {
+		logger.Error("Panic button: failed to restart audio: %v", err)
+		appState.AddMessage("Audio could not be restarted - try Rescan devices", "error")
+	} else {
+		logger.Info("Panic button: audio restored")
+		appState.AddMessage("▶ Audio restored", "success")
+	}
+	appState.SetAudioPanic(false)
+}
+
+// drainReceivedAudio throws away frames still waiting for playback, so the
+// speakers don't resume with audio from before the panic
+func drainReceivedAudio() {
+	for {
+		select {
+		case frame := <-incomingAudio:
+			if frame.pooled {
+				putReceivedFrame(frame.samples)
+			}
+		default:
+			return
+		}
+	}
+}
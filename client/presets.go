@@ -0,0 +1,115 @@
+// FILE: client/presets.go
+package main
+
+import (
+	"ahcli/common/logger"
+	"fmt"
+	"slices"
+)
+
+// sharedPreset is the export/import format: a named preset as one JSON object,
+// e.g. {"name": "broadcast voice", "noise_gate": {...}, "compressor": {...}, ...}
+type sharedPreset struct {
+	Name string `json:"name"`
+	ProcessingPreset
+}
+
+// Longest preset name accepted on import
+const maxPresetNameLength = 32
+
+// Name an export gets when none is given and the current preset is a
+// built-in one, which import would refuse
+const defaultExportName = "my preset"
+
+// validate keeps imported presets within ranges the processor handles sensibly
+func (p sharedPreset) validate() error {
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("preset needs a name")
+	case len(p.Name) > maxPresetNameLength:
+		return fmt.Errorf("preset name longer than %d characters", maxPresetNameLength)
+	case builtinAudioPresets[p.Name]:
+		return fmt.Errorf("%q is a built-in preset, pick another name", p.Name)
+	}
+
+	for _, err := range []error{
+		noiseGateThresholdLimit.check(p.NoiseGate.ThresholdDB),
+		compressorThresholdLimit.check(p.Compressor.ThresholdDB),
+		compressorRatioLimit.check(p.Compressor.Ratio),
+		makeupGainLimit.check(p.MakeupGain.GainDB),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	if c := p.HighPass.CutoffHz; c != 0 && (c < 20 || c > 1000) { // 0 keeps the default cutoff
+		return fmt.Errorf("high_pass.cutoff_hz=%g is outside 20 to 1000", c)
+	}
+	if p.Mix != nil && (*p.Mix < 0 || *p.Mix > 1) {
+		return fmt.Errorf("mix=%g is outside 0 to 1", *p.Mix)
+	}
+
+	for i, stage := range p.Chain {
+		if _, ok := processingStages[stage]; !ok {
+			return fmt.Errorf("unknown processing stage %q (known: %s)", stage, knownStages())
+		}
+		if slices.Contains(p.Chain[:i], stage) {
+			return fmt.Errorf("processing stage %q appears twice", stage)
+		}
+	}
+	return nil
+}
+
+// exportPreset captures the current processing settings as a shareable preset
+func exportPreset(name string) (sharedPreset, error) {
+	if currentConfig == nil {
+		return sharedPreset{}, fmt.Errorf("no configuration loaded")
+	}
+
+	settings := currentConfig.AudioProcessing
+	if name == "" {
+		name = settings.Preset
+		if builtinAudioPresets[name] {
+			name = defaultExportName
+		}
+	} else if builtinAudioPresets[name] {
+		return sharedPreset{}, fmt.Errorf("%q is a built-in preset, pick another name", name)
+	}
+	mix := settings.Mix
+	preset := sharedPreset{
+		Name: name,
+		ProcessingPreset: ProcessingPreset{
+			NoiseGate:  settings.NoiseGate,
+			Compressor: settings.Compressor,
+			MakeupGain: settings.MakeupGain,
+			HighPass:   settings.HighPass,
+			Chain:      slices.Clone(settings.Chain),
+			Mix:        &mix,
+		},
+	}
+
+	logger.Info("Exported audio settings as preset %q", name)
+	return preset, nil
+}
+
+// importPreset saves a validated preset to the config and switches to it
+func importPreset(preset sharedPreset) error {
+	if currentConfig == nil {
+		return fmt.Errorf("no configuration loaded")
+	}
+
+	_, replaced := currentConfig.AudioProcessing.Presets[preset.Name]
+	if currentConfig.AudioProcessing.Presets == nil {
+		currentConfig.AudioProcessing.Presets = make(map[string]ProcessingPreset)
+	}
+	currentConfig.AudioProcessing.Presets[preset.Name] = preset.ProcessingPreset
+	logger.Info("Imported preset %q (replaced existing: %t)", preset.Name, replaced)
+
+	webTUI.Lock()
+	webTUI.AudioPresets = customPresetNames(currentConfig)
+	webTUI.Unlock()
+
+	// Applies, saves and reports like picking it from the menu
+	handleAudioPreset(preset.Name)
+	return nil
+}
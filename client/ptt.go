@@ -5,6 +5,8 @@
 package main
 
 import (
+	"ahcli/common/logger"
+	"fmt"
 	"sync"
 	"time"
 )
@@ -13,6 +15,10 @@ var (
 	isPressedMu sync.RWMutex
 	isPressed   bool
 	pttKeyCode  uint16 = 0xA0 // VK_LSHIFT, change to F1 = 0x70, Space = 0x20, etc.
+
+	pttJoystick *joystickButton // Set instead of pttKeyCode for a JOY<n>_BUTTON<m> binding
+
+	panicKeyCode uint16 // 0 = no panic key
 )
 
 func keyNameToVKCode(key string) uint16 {
@@ -214,16 +220,51 @@ func keyNameToVKCode(key string) uint16 {
 	}
 }
 
-// StartPTTListener starts polling the PTT key state.
+// StartPTTListener starts polling the PTT key (or joystick button) state, and
+// the panic key alongside it.
 func StartPTTListener() {
+	binding := fmt.Sprintf("key 0x%02X", pttKeyCode)
+	var joystick *joystickPoller
+	if pttJoystick != nil {
+		binding = pttJoystick.String()
+		joystick = &joystickPoller{binding: *pttJoystick}
+	}
+
 	go func() {
+		var panicHeld bool
 		for {
 			time.Sleep(10 * time.Millisecond)
-			pressed := isKeyDown(pttKeyCode)
+
+			// The panic button acts on the press, once per press
+			if panicKeyCode != 0 {
+				held := isKeyDown(panicKeyCode)
+				if held && !panicHeld {
+					logger.Debug("Panic key 0x%02X pressed", panicKeyCode)
+					go toggleAudioPanic() // Closing streams mustn't stall the PTT poll
+				}
+				panicHeld = held
+			}
+
+			var pressed bool
+			if joystick != nil {
+				pressed = joystick.pressed()
+			} else {
+				pressed = isKeyDown(pttKeyCode)
+			}
 
 			isPressedMu.Lock()
+			changed := pressed != isPressed
 			isPressed = pressed
 			isPressedMu.Unlock()
+
+			// Only transitions are worth a line; the poll itself runs every 10ms
+			if changed {
+				action := "released"
+				if pressed {
+					action = "pressed"
+				}
+				logger.Debug("PTT %s %s", binding, action)
+			}
 		}
 	}()
 }
@@ -0,0 +1,94 @@
+// FILE: client/receiveproc.go
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Receive processing cleans up what other people send, for when a talker's
+// mic picks up hum, rumble or background noise they can't hear themselves.
+// Each talker gets their own filter state, so one person's noise never opens
+// or closes the gate on another's voice.
+
+// Receive gate threshold when noise_gate_threshold_db isn't set
+const defaultReceiveGateDB = -45.0
+
+// Talker filters unused for this long are forgotten
+const receiveFilterIdle = time.Minute
+
+// receiveFilters is one talker's receive-side filter state
+type receiveFilters struct {
+	gate     *NoiseGate
+	highPass *HighPassFilter
+	lastUsed time.Time
+}
+
+// ReceiveProcessor applies the listener's own noise gate and high-pass to
+// received audio before it is mixed
+type ReceiveProcessor struct {
+	mu sync.Mutex
+
+	enabled     bool
+	gateEnabled bool
+	gateDB      float32
+	highPassHz  float64 // 0 = off
+
+	talkers   map[uint16]*receiveFilters
+	lastPrune time.Time
+}
+
+func newReceiveProcessor() *ReceiveProcessor {
+	return &ReceiveProcessor{talkers: make(map[uint16]*receiveFilters)}
+}
+
+// configure replaces the settings; talkers start over with fresh filter state
+func (rp *ReceiveProcessor) configure(enabled, gateEnabled bool, gateDB float32, highPassHz float64) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	rp.enabled = enabled
+	rp.gateEnabled = gateEnabled
+	rp.gateDB = gateDB
+	rp.highPassHz = highPassHz
+	clear(rp.talkers)
+}
+
+// Process filters one talker's frame in place
+func (rp *ReceiveProcessor) Process(source uint16, samples []int16) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if !rp.enabled || (!rp.gateEnabled && rp.highPassHz <= 0) {
+		return
+	}
+
+	now := time.Now()
+	filters := rp.talkers[source]
+	if filters == nil {
+		filters = &receiveFilters{}
+		if rp.gateEnabled {
+			filters.gate = newNoiseGate(rp.gateDB)
+		}
+		if rp.highPassHz > 0 {
+			filters.highPass = newHighPassFilter(rp.highPassHz)
+		}
+		rp.talkers[source] = filters
+	}
+	filters.lastUsed = now
+
+	// Rumble out first, so it can't hold the gate open
+	if filters.highPass != nil {
+		filters.highPass.Process(samples)
+	}
+	if filters.gate != nil {
+		filters.gate.Process(samples)
+	}
+
+	if now.Sub(rp.lastPrune) > receiveFilterIdle {
+		for id, f := range rp.talkers {
+			if now.Sub(f.lastUsed) > receiveFilterIdle {
+				delete(rp.talkers, id)
+			}
+		}
+		rp.lastPrune = now
+	}
+}
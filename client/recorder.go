@@ -0,0 +1,272 @@
+// FILE: client/recorder.go
+package main
+
+import (
+	"ahcli/common/logger"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Session recording writes what we hear, and optionally what we send, to
+// 16-bit mono WAV files at the audio sample rate. Silence between frames is
+// filled in so the files run in real time alongside each other.
+
+// Recording defaults for fields left zero in the config
+const (
+	defaultRecordingDirectory = "recordings"
+	defaultRecordingMaxFileMB = 500
+	maxRecordingFileMB        = 4000 // WAV sizes are 32-bit
+)
+
+const wavHeaderSize = 44
+
+var errRecordingFull = errors.New("file size limit reached")
+
+// wavWriter streams samples into a WAV file, fixing up the header sizes on close
+type wavWriter struct {
+	path    string
+	file    *os.File
+	w       *bufio.Writer
+	started time.Time
+	samples int64 // Written so far, including filled-in silence
+	max     int64 // Sample limit from the file size cap
+	scratch []byte
+}
+
+// createWAV starts a WAV file with placeholder sizes
+func createWAV(path string, maxBytes int64) (*wavWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	ww := &wavWriter{
+		path:    path,
+		file:    file,
+		w:       bufio.NewWriterSize(file, 64*1024),
+		started: time.Now(),
+		max:     (maxBytes - wavHeaderSize) / 2,
+	}
+	if _, err := ww.w.Write(wavHeader(0)); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return ww, nil
+}
+
+// wavHeader builds the 44-byte header for dataBytes of mono 16-bit PCM
+func wavHeader(dataBytes uint32) []byte {
+	h := make([]byte, wavHeaderSize)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], 36+dataBytes)
+	copy(h[8:], "WAVE")
+	copy(h[12:], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)           // fmt chunk size
+	binary.LittleEndian.PutUint16(h[20:], 1)            // PCM
+	binary.LittleEndian.PutUint16(h[22:], 1)            // Mono
+	binary.LittleEndian.PutUint32(h[24:], sampleRate)   // Sample rate
+	binary.LittleEndian.PutUint32(h[28:], sampleRate*2) // Byte rate
+	binary.LittleEndian.PutUint16(h[32:], 2)            // Block align
+	binary.LittleEndian.PutUint16(h[34:], 16)           // Bits per sample
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], dataBytes)
+	return h
+}
+
+// write appends samples, first padding with silence up to now if the file has
+// fallen behind real time
+func (ww *wavWriter) write(now time.Time, samples []int16) error {
+	behind := int64(now.Sub(ww.started).Seconds()*sampleRate) - int64(len(samples)) - ww.samples
+	if behind > 0 {
+		if err := ww.writeSamples(nil, behind); err != nil {
+			return err
+		}
+	}
+	return ww.writeSamples(samples, int64(len(samples)))
+}
+
+// writeSamples writes n samples from samples, or n zeros when samples is nil
+func (ww *wavWriter) writeSamples(samples []int16, n int64) error {
+	if ww.samples+n > ww.max {
+		return errRecordingFull
+	}
+	if samples == nil {
+		zero := make([]byte, 4096)
+		for left := n * 2; left > 0; left -= int64(len(zero)) {
+			if _, err := ww.w.Write(zero[:min(left, int64(len(zero)))]); err != nil {
+				return err
+			}
+		}
+	} else {
+		if cap(ww.scratch) < len(samples)*2 {
+			ww.scratch = make([]byte, len(samples)*2)
+		}
+		buf := ww.scratch[:len(samples)*2]
+		for i, s := range samples {
+			binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+		}
+		if _, err := ww.w.Write(buf); err != nil {
+			return err
+		}
+	}
+	ww.samples += n
+	return nil
+}
+
+// close flushes the file and writes the final sizes into the header
+func (ww *wavWriter) close() error {
+	err := ww.w.Flush()
+	if err == nil {
+		_, err = ww.file.WriteAt(wavHeader(uint32(ww.samples*2)), 0)
+	}
+	if closeErr := ww.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// sessionRecorder owns the files of the recording in progress, if any
+type sessionRecorder struct {
+	mu          sync.Mutex
+	received    *wavWriter
+	transmitted *wavWriter // nil unless our own voice is recorded
+	started     time.Time
+}
+
+var (
+	recorder  sessionRecorder
+	recording atomic.Bool // Fast check for the audio goroutines
+)
+
+// recordingSettings returns the configured directory and per-file byte cap
+func recordingSettings() (string, int64) {
+	dir, maxMB := defaultRecordingDirectory, defaultRecordingMaxFileMB
+	if currentConfig != nil {
+		if currentConfig.Recording.Directory != "" {
+			dir = currentConfig.Recording.Directory
+		}
+		if currentConfig.Recording.MaxFileMB > 0 {
+			maxMB = currentConfig.Recording.MaxFileMB
+		}
+	}
+	return dir, int64(maxMB) << 20
+}
+
+// startRecording opens timestamped WAV files for received audio and, if
+// ownVoice, for what we transmit
+func startRecording(ownVoice bool) error {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if recorder.received != nil {
+		return fmt.Errorf("already recording to %s", recorder.received.path)
+	}
+
+	dir, maxBytes := recordingSettings()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create recording folder: %v", err)
+	}
+	base := filepath.Join(dir, "ahcli-"+time.Now().Format("20060102-150405"))
+
+	received, err := createWAV(base+"-received.wav", maxBytes)
+	if err != nil {
+		return fmt.Errorf("cannot start recording: %v", err)
+	}
+	var transmitted *wavWriter
+	if ownVoice {
+		if transmitted, err = createWAV(base+"-transmitted.wav", maxBytes); err != nil {
+			received.close()
+			os.Remove(received.path)
+			return fmt.Errorf("cannot start recording: %v", err)
+		}
+	}
+
+	recorder.received, recorder.transmitted = received, transmitted
+	recorder.started = received.started
+	recording.Store(true)
+
+	logger.Info("Recording started: %s (own voice: %t, cap %dMB per file)", received.path, ownVoice, maxBytes>>20)
+	appState.SetRecording(true, received.path)
+	appState.AddMessage(fmt.Sprintf("⏺ Recording to %s", received.path), "info")
+	return nil
+}
+
+// stopRecording finishes the recording in progress
+func stopRecording() error {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if recorder.received == nil {
+		return fmt.Errorf("not recording")
+	}
+	return recorder.stopLocked("")
+}
+
+// stopLocked closes the files and reports the result; reason is set when the
+// recording ended on its own. Call with recorder.mu held.
+func (r *sessionRecorder) stopLocked(reason string) error {
+	recording.Store(false)
+	duration := time.Since(r.started).Round(time.Second)
+	path := r.received.path
+
+	err := r.received.close()
+	if r.transmitted != nil {
+		if txErr := r.transmitted.close(); err == nil {
+			err = txErr
+		}
+	}
+	r.received, r.transmitted = nil, nil
+
+	appState.SetRecording(false, "")
+	switch {
+	case err != nil:
+		logger.Error("Recording %s not finalized: %v", path, err)
+		appState.AddMessage(fmt.Sprintf("Recording stopped, but %s may be incomplete: %v", path, err), "error")
+	case reason != "":
+		logger.Warn("Recording stopped after %v: %s", duration, reason)
+		appState.AddMessage(fmt.Sprintf("⏹ Recording stopped after %v (%s) - saved %s", duration, reason, path), "warning")
+	default:
+		logger.Info("Recording stopped after %v: %s", duration, path)
+		appState.AddMessage(fmt.Sprintf("⏹ Recording saved: %s (%v)", path, duration), "success")
+	}
+	return err
+}
+
+// recordReceived adds a played frame to the recording, if one is running
+func recordReceived(samples []int16) {
+	if recording.Load() {
+		recordFrame(func(r *sessionRecorder) *wavWriter { return r.received }, samples)
+	}
+}
+
+// recordTransmitted adds a sent frame to the recording, if it includes our voice
+func recordTransmitted(samples []int16) {
+	if recording.Load() {
+		recordFrame(func(r *sessionRecorder) *wavWriter { return r.transmitted }, samples)
+	}
+}
+
+// recordFrame writes to one of the recording's files, ending the recording on
+// a disk error or when a file reaches its size cap
+func recordFrame(pick func(*sessionRecorder) *wavWriter, samples []int16) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	ww := pick(&recorder)
+	if ww == nil {
+		return
+	}
+	if err := ww.write(time.Now(), samples); err != nil {
+		if err != errRecordingFull {
+			err = fmt.Errorf("write failed: %v", err)
+		}
+		recorder.stopLocked(err.Error())
+	}
+}
@@ -0,0 +1,128 @@
+// FILE: client/session.go
+package main
+
+import (
+	"ahcli/common/logger"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sessionStats accumulates one connection's numbers for the recap shown when
+// it ends. Guarded by the AppState mutex.
+type sessionStats struct {
+	started time.Time // Zero when no session is running
+	server  string
+
+	rxAtStart, txAtStart int // Packet counters when the session began
+
+	latencySum   time.Duration
+	latencyCount int
+	peakLatency  time.Duration
+	packetLoss   float32 // Latest rate, which covers the whole session
+
+	messagesSent int
+	channels     []string // In the order first visited
+}
+
+// SessionSummary is the recap of a finished connection
+type SessionSummary struct {
+	Server       string        `json:"server"`
+	Duration     time.Duration `json:"duration"`
+	PacketsRx    int           `json:"packetsRx"`
+	PacketsTx    int           `json:"packetsTx"`
+	AvgLatency   time.Duration `json:"avgLatency"`
+	PeakLatency  time.Duration `json:"peakLatency"`
+	PacketLoss   float32       `json:"packetLoss"` // 0.0 - 1.0
+	MessagesSent int           `json:"messagesSent"`
+	Channels     []string      `json:"channels"`
+}
+
+// startSession resets the session stats. Call with as.mutex held.
+func (as *AppState) startSession(server string) {
+	as.session = sessionStats{
+		started:   time.Now(),
+		server:    server,
+		rxAtStart: as.PacketsRx,
+		txAtStart: as.PacketsTx,
+	}
+}
+
+// recordLatency adds a ping round trip to the session. Call with as.mutex held.
+func (as *AppState) recordLatency(latency time.Duration) {
+	if as.session.started.IsZero() || latency <= 0 {
+		return
+	}
+	as.session.latencySum += latency
+	as.session.latencyCount++
+	as.session.peakLatency = max(as.session.peakLatency, latency)
+}
+
+// recordChannel notes a channel the session visited. Call with as.mutex held.
+func (as *AppState) recordChannel(channel string) {
+	if as.session.started.IsZero() || channel == "" || slices.Contains(as.session.channels, channel) {
+		return
+	}
+	as.session.channels = append(as.session.channels, channel)
+}
+
+// CountChatSent counts a chat message we sent this session
+func (as *AppState) CountChatSent() {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	if !as.session.started.IsZero() {
+		as.session.messagesSent++
+	}
+}
+
+// endSession closes the running session and returns its summary, or nil if
+// none was running
+func (as *AppState) endSession() *SessionSummary {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	s := as.session
+	if s.started.IsZero() {
+		return nil
+	}
+	as.session = sessionStats{}
+
+	summary := &SessionSummary{
+		Server:       s.server,
+		Duration:     time.Since(s.started).Round(time.Second),
+		PacketsRx:    as.PacketsRx - s.rxAtStart,
+		PacketsTx:    as.PacketsTx - s.txAtStart,
+		PeakLatency:  s.peakLatency,
+		PacketLoss:   s.packetLoss,
+		MessagesSent: s.messagesSent,
+		Channels:     s.channels,
+	}
+	if s.latencyCount > 0 {
+		summary.AvgLatency = s.latencySum / time.Duration(s.latencyCount)
+	}
+	return summary
+}
+
+// String is the one-line recap used in the log and the message list
+func (s *SessionSummary) String() string {
+	latency := "no pings"
+	if s.AvgLatency > 0 {
+		latency = fmt.Sprintf("%dms avg / %dms peak", s.AvgLatency.Milliseconds(), s.PeakLatency.Milliseconds())
+	}
+	return fmt.Sprintf("%s for %v - %d packets sent, %d received, %.1f%% loss, %s, %d messages sent, channels: %s",
+		s.Server, s.Duration, s.PacketsTx, s.PacketsRx, s.PacketLoss*100, latency, s.MessagesSent, strings.Join(s.Channels, ", "))
+}
+
+// reportSessionSummary logs the recap of the session that just ended, and
+// shows it unless web_ui.session_summary is off
+func reportSessionSummary() {
+	summary := appState.endSession()
+	if summary == nil {
+		return
+	}
+	logger.Info("Session summary: %s", summary)
+	if currentConfig == nil || currentConfig.WebUI.SessionSummary {
+		appState.AddMessage("📋 Session: "+summary.String(), "info")
+	}
+}
@@ -0,0 +1,170 @@
+// FILE: client/spectator.go
+package main
+
+import (
+	"ahcli/common/logger"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// The spectator feed is a read-only view of the current channel for stream
+// overlays: who's there and who's talking, our mic level and the chat. No
+// audio, no commands, and nothing from the rest of the UI state. It's off
+// unless web_ui.spectator is set, and asks for web_ui.spectator_token when
+// one is configured, since the web UI port is reachable from the LAN.
+
+// Chat lines sent to spectators
+const spectatorChatLines = 20
+
+type spectatorState struct {
+	Connected  bool            `json:"connected"`
+	ServerName string          `json:"serverName"`
+	Channel    string          `json:"channel"`
+	Users      []spectatorUser `json:"users"`
+	Talking    bool            `json:"talking"`    // Our push-to-talk
+	AudioLevel int             `json:"audioLevel"` // Our mic level, 0-100
+	Chat       []WebMessage    `json:"chat"`
+}
+
+type spectatorUser struct {
+	Nickname string `json:"nickname"`
+	Speaking bool   `json:"speaking,omitempty"`
+	Muted    bool   `json:"muted,omitempty"`
+}
+
+var (
+	spectators     = make(map[*websocket.Conn]bool)
+	spectatorMutex sync.Mutex
+	lastSpectated  []byte // Last payload sent, to skip unchanged updates
+)
+
+// spectatorView picks what spectators may see out of the UI state
+func spectatorView(state *WebTUIState) spectatorState {
+	view := spectatorState{
+		Connected:  state.Connected,
+		ServerName: state.ServerName,
+		Channel:    state.CurrentChannel,
+		Users:      []spectatorUser{},
+		Talking:    state.PTTActive,
+		AudioLevel: state.AudioLevel,
+		Chat:       []WebMessage{},
+	}
+	for _, user := range state.ChannelUsers[state.CurrentChannel] {
+		view.Users = append(view.Users, spectatorUser{Nickname: user.Nickname, Speaking: user.Speaking, Muted: user.Muted})
+	}
+	for _, msg := range state.Messages {
+		if msg.Type == "chat" || msg.Type == "announcement" {
+			view.Chat = append(view.Chat, msg)
+		}
+	}
+	if len(view.Chat) > spectatorChatLines {
+		view.Chat = view.Chat[len(view.Chat)-spectatorChatLines:]
+	}
+	return view
+}
+
+// spectatorAllowed reports whether the feed is on and the request carries the token
+func spectatorAllowed(r *http.Request) (bool, int) {
+	if currentConfig == nil || !currentConfig.WebUI.Spectator {
+		return false, http.StatusNotFound
+	}
+	token := currentConfig.WebUI.SpectatorToken
+	if token != "" && subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(token)) != 1 {
+		return false, http.StatusForbidden
+	}
+	return true, http.StatusOK
+}
+
+// handleSpectatorWebSocket serves the spectator feed on /spectate/ws
+func handleSpectatorWebSocket(w http.ResponseWriter, r *http.Request) {
+	if ok, status := spectatorAllowed(r); !ok {
+		logger.Debug("Refused spectator connection from %s (%d)", r.RemoteAddr, status)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("Spectator WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	webTUI.RLock()
+	view := spectatorView(webTUI)
+	webTUI.RUnlock()
+
+	spectatorMutex.Lock()
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	err = conn.WriteJSON(view)
+	if err == nil {
+		spectators[conn] = true
+	}
+	count := len(spectators)
+	spectatorMutex.Unlock()
+	if err != nil {
+		logger.Debug("Failed to send initial state to spectator: %v", err)
+		return
+	}
+	logger.Info("Spectator connected from %s (total: %d)", r.RemoteAddr, count)
+
+	// Read-only: anything the spectator sends is discarded
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	spectatorMutex.Lock()
+	delete(spectators, conn)
+	count = len(spectators)
+	spectatorMutex.Unlock()
+	logger.Debug("Spectator disconnected from %s (remaining: %d)", r.RemoteAddr, count)
+}
+
+// broadcastSpectators sends the spectator view of state, if it changed
+func broadcastSpectators(state *WebTUIState) {
+	spectatorMutex.Lock()
+	defer spectatorMutex.Unlock()
+
+	if len(spectators) == 0 {
+		return
+	}
+	payload, err := json.Marshal(spectatorView(state))
+	if err != nil {
+		logger.Error("Failed to encode spectator state: %v", err)
+		return
+	}
+	if bytes.Equal(payload, lastSpectated) {
+		return
+	}
+	lastSpectated = payload
+
+	for conn := range spectators {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+			logger.Debug("Spectator write failed, removing: %v", err)
+			conn.Close()
+			delete(spectators, conn)
+		}
+	}
+}
+
+// closeSpectators sends a close frame to every spectator (used on shutdown)
+func closeSpectators() {
+	spectatorMutex.Lock()
+	defer spectatorMutex.Unlock()
+
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "AHCLI shutting down")
+	for conn := range spectators {
+		conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+		conn.Close()
+		delete(spectators, conn)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"ahcli/common/logger"
 	"fmt"
 	"os/exec"
+	"sync"
 	"syscall"
 	"unsafe"
 )
@@ -63,55 +64,122 @@ func InitTray(port int) error {
 	return nil
 }
 
-// UpdateTrayIcon updates the tray icon based on connection status
-func UpdateTrayIcon(connected bool) {
-	logger.Debug("Updating tray icon - connected: %t", connected)
+// Tray icon states, in priority order when several apply
+type trayState int
 
-	var hIcon uintptr
+const (
+	trayDisconnected trayState = iota
+	trayConnecting
+	trayReconnecting
+	trayMuted
+	trayTransmitting
+	trayIdle
+)
 
-	// Try to load custom icon first
-	if connected {
-		// For connected state, try to load custom icon
-		hIcon, _, _ = loadImage.Call(
-			0,
-			uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr("ahcli.ico"))),
-			1, 0, 0, LR_LOADFROMFILE,
-		)
-		if hIcon != 0 {
-			logger.Debug("Using custom icon for connected state")
-		}
+// trayIcons maps each state to its icon file and system icon fallback
+var trayIcons = map[trayState]struct {
+	file     string
+	systemID uintptr
+	label    string
+}{
+	trayDisconnected: {"ahcli-disconnected.ico", 32513, "Disconnected"}, // IDI_ERROR
+	trayConnecting:   {"ahcli-reconnecting.ico", 32514, "Connecting"},   // IDI_QUESTION
+	trayReconnecting: {"ahcli-reconnecting.ico", 32514, "Reconnecting"}, // IDI_QUESTION
+	trayMuted:        {"ahcli-muted.ico", 32515, "Muted"},               // IDI_WARNING
+	trayTransmitting: {"ahcli-tx.ico", 32517, "Transmitting"},           // IDI_WINLOGO
+	trayIdle:         {"ahcli.ico", 32516, "Connected"},                 // IDI_INFORMATION
+}
+
+var (
+	trayIconCache   = make(map[trayState]uintptr)
+	trayIconCacheMu sync.Mutex
+)
+
+// currentTrayState derives the tray state from AppState
+func currentTrayState() trayState {
+	state := appState.GetState()
+	phase, _ := state["phase"].(ConnPhase)
+	muted, _ := state["muted"].(bool)
+	pttActive, _ := state["pttActive"].(bool)
+
+	switch {
+	case phase == PhaseReconnecting:
+		return trayReconnecting
+	case phase == PhaseConnecting || phase == PhaseAuthenticating:
+		return trayConnecting
+	case phase != PhaseConnected:
+		return trayDisconnected
+	case muted:
+		return trayMuted
+	case pttActive:
+		return trayTransmitting
+	default:
+		return trayIdle
+	}
+}
+
+// loadTrayIcon loads (and caches) the icon for a tray state, falling back to a system icon
+func loadTrayIcon(ts trayState) uintptr {
+	trayIconCacheMu.Lock()
+	defer trayIconCacheMu.Unlock()
+
+	if hIcon, ok := trayIconCache[ts]; ok {
+		return hIcon
 	}
 
-	// Fallback to system icons if custom icon not available
-	if hIcon == 0 {
+	icon := trayIcons[ts]
+	hIcon, _, _ := loadImage.Call(
+		0,
+		uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(icon.file))),
+		1, 0, 0, LR_LOADFROMFILE,
+	)
+	if hIcon != 0 {
+		logger.Debug("Loaded tray icon %s", icon.file)
+	} else {
 		hInstance, _, _ := getModuleHandle.Call(0)
-		var iconID uintptr = 32513 // IDI_ERROR (disconnected - red-ish)
-		if connected {
-			iconID = 32516 // IDI_WINLOGO (connected - green-ish)
-		}
-		hIcon, _, _ = loadIcon.Call(hInstance, iconID)
-		logger.Debug("Using system icon %d for connection state", iconID)
+		hIcon, _, _ = loadIcon.Call(hInstance, icon.systemID)
+		logger.Debug("Tray icon %s not found, using system icon %d", icon.file, icon.systemID)
 	}
 
+	trayIconCache[ts] = hIcon
+	return hIcon
+}
+
+// UpdateTrayIcon refreshes the tray icon and tooltip from current AppState
+func UpdateTrayIcon() {
+	ts := currentTrayState()
+	logger.Debug("Updating tray icon - state: %s", trayIcons[ts].label)
+
 	nid := NOTIFYICONDATA{
 		CbSize: uint32(unsafe.Sizeof(NOTIFYICONDATA{})),
 		Hwnd:   hwnd,
 		UID:    trayIconID,
 		UFlags: NIF_ICON | NIF_TIP,
-		HIcon:  hIcon,
+		HIcon:  loadTrayIcon(ts),
 	}
 
 	// Update tooltip
-	tooltip := "AHCLI Voice Chat - Disconnected"
-	if connected {
-		tooltip = "AHCLI Voice Chat - Connected"
-	}
-	copy(nid.SzTip[:], syscall.StringToUTF16(tooltip))
+	tooltip := trayTooltip(ts)
+	copy(nid.SzTip[:len(nid.SzTip)-1], syscall.StringToUTF16(tooltip))
 
 	shellNotifyIcon.Call(NIM_MODIFY, uintptr(unsafe.Pointer(&nid)))
 	logger.Debug("Tray icon updated with tooltip: %s", tooltip)
 }
 
+// trayTooltip builds the tooltip text, including a connection quality summary when known
+func trayTooltip(ts trayState) string {
+	label := "AHCLI Voice Chat - " + trayIcons[ts].label
+	if ts == trayDisconnected || ts == trayConnecting || ts == trayReconnecting {
+		return label
+	}
+
+	latency, loss := appState.GetNetworkQuality()
+	if latency == 0 {
+		return label
+	}
+	return fmt.Sprintf("%s — %dms, %.1f%% loss", label, latency.Milliseconds(), loss*100)
+}
+
 // ShowTrayMenu shows the context menu when right-clicking the tray icon
 func ShowTrayMenu() {
 	logger.Debug("Showing tray context menu")
@@ -128,6 +196,12 @@ func ShowTrayMenu() {
 	state := appState.GetState()
 	connected := state["connected"].(bool)
 	currentChannel := state["currentChannel"]
+	muted, _ := state["muted"].(bool)
+
+	muteLabel := "🔇 Mute Microphone"
+	if muted {
+		muteLabel = "🎤 Unmute Microphone"
+	}
 
 	logger.Debug("Building menu - connected: %t, channel: %v", connected, currentChannel)
 
@@ -164,6 +238,7 @@ func ShowTrayMenu() {
 		id   uintptr
 	}{
 		{"", 0}, // Separator
+		{muteLabel, 1003},
 		{"Exit AHCLI", 1002},
 	}...)
 
@@ -206,6 +281,9 @@ func ShowTrayMenu() {
 	case 1002: // Exit
 		logger.Info("Tray menu: Exiting application")
 		exitApplication()
+	case 1003: // Mute toggle
+		logger.Info("Tray menu: Toggling mute (currently %t)", muted)
+		setMuted(!muted)
 	default:
 		if cmd != 0 {
 			logger.Debug("Tray menu: Unknown command %d", cmd)
@@ -219,13 +297,17 @@ func openVoiceChatUI() {
 
 	logger.Info("Opening Voice Chat UI: %s", url)
 
-	// Try Chrome app mode first (cleanest)
+	// Try Chrome app mode first (cleanest), unless the user prefers their default browser
 	browsers := [][]string{
 		{"chrome", "--app=" + url, "--disable-web-security", "--disable-features=TranslateUI"},
 		{"msedge", "--app=" + url, "--disable-web-security"},
 		{"C:\\Program Files\\Google\\Chrome\\Application\\chrome.exe", "--app=" + url},
 		{"C:\\Program Files (x86)\\Microsoft\\Edge\\Application\\msedge.exe", "--app=" + url},
 	}
+	if currentConfig != nil && currentConfig.WebUI.Browser == "default" {
+		logger.Debug("Browser preference is 'default', skipping app mode")
+		browsers = nil
+	}
 
 	for i, browser := range browsers {
 		logger.Debug("Trying browser %d: %s", i+1, browser[0])
@@ -255,23 +337,7 @@ func openVoiceChatUI() {
 func exitApplication() {
 	logger.Info("Exit requested from system tray")
 	appState.AddMessage("AHCLI shutting down...", "info")
-
-	// Remove tray icon
-	nid := NOTIFYICONDATA{
-		CbSize: uint32(unsafe.Sizeof(NOTIFYICONDATA{})),
-		Hwnd:   hwnd,
-		UID:    trayIconID,
-	}
-
-	ret, _, _ := shellNotifyIcon.Call(NIM_DELETE, uintptr(unsafe.Pointer(&nid)))
-	if ret != 0 {
-		logger.Debug("Tray icon removed successfully")
-	} else {
-		logger.Error("Failed to remove tray icon")
-	}
-
-	logger.Info("AHCLI shutdown complete")
-	syscall.Exit(0)
+	shutdownApplication()
 }
 
 // HandleTrayMessage processes tray icon messages
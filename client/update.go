@@ -0,0 +1,64 @@
+// FILE: client/update.go
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// releaseInfo is the JSON document served at update_check.url
+type releaseInfo struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+}
+
+// checkForUpdates fetches the latest release info and tells the user if a newer build exists.
+// Only called when update_check.enabled is set - nothing leaves the machine otherwise.
+func checkForUpdates(url string) {
+	if url == "" {
+		logger.Warn("Update check enabled but no URL configured")
+		return
+	}
+
+	logger.Info("Checking for updates at %s", url)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		logger.Warn("Update check failed: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Warn("Update check failed: HTTP %d", resp.StatusCode)
+		return
+	}
+
+	var latest releaseInfo
+	if err := json.NewDecoder(resp.Body).Decode(&latest); err != nil {
+		logger.Warn("Update check returned invalid JSON: %v", err)
+		return
+	}
+
+	if latest.Version == "" {
+		logger.Warn("Update check response has no version")
+		return
+	}
+
+	if common.CompareVersions(common.CurrentVersion, latest.Version) >= 0 {
+		logger.Info("Client is up to date (v%s, latest v%s)", common.CurrentVersion, latest.Version)
+		return
+	}
+
+	logger.Info("Update available: v%s -> v%s", common.CurrentVersion, latest.Version)
+	message := fmt.Sprintf("⬆️ Update available: v%s (you have v%s)", latest.Version, common.CurrentVersion)
+	if latest.URL != "" {
+		message += " - " + latest.URL
+	}
+	appState.AddMessage(message, "info")
+}
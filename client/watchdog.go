@@ -0,0 +1,80 @@
+// FILE: client/watchdog.go
+package main
+
+import (
+	"ahcli/common/logger"
+	"context"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// The UI watchdog catches the observer chain or the websocket broadcaster
+// getting stuck, which otherwise just leaves the UI showing old numbers. It
+// sends a heartbeat through AppState on a timer; the heartbeat's broadcast
+// stamps lastBroadcast, and a stamp that stops moving while we're connected
+// is logged with every goroutine's stack.
+const (
+	uiHeartbeatInterval = 2 * time.Second
+	uiStaleAfter        = 10 * time.Second
+)
+
+var (
+	lastBroadcast    atomic.Int64 // Unix nanoseconds of the last finished broadcastUpdate
+	heartbeatPending atomic.Bool  // A heartbeat is still on its way through the observers
+	uiStalled        atomic.Bool  // Reported as stalled and not yet recovered
+)
+
+// markBroadcast records a finished broadcast, noting recovery from a stall
+func markBroadcast() {
+	lastBroadcast.Store(time.Now().UnixNano())
+	if uiStalled.Swap(false) {
+		logger.Info("UI updates resumed")
+	}
+}
+
+// runUIWatchdog sends heartbeats and checks that broadcasts keep up
+func runUIWatchdog(ctx context.Context) {
+	markBroadcast()
+	ticker := time.NewTicker(uiHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			checkUIHeartbeat(now)
+		}
+	}
+}
+
+// checkUIHeartbeat sends the next heartbeat and reports a stall once
+func checkUIHeartbeat(now time.Time) {
+	// The heartbeat runs on its own goroutine so a stuck observer can't stop
+	// the watchdog; at most one is in flight
+	if !heartbeatPending.Swap(true) {
+		go func() {
+			defer heartbeatPending.Store(false)
+			appState.notifyObservers("heartbeat", now)
+		}()
+	}
+
+	since := now.Sub(time.Unix(0, lastBroadcast.Load()))
+	if since < uiStaleAfter || !watchdogConnected() || uiStalled.Swap(true) {
+		return
+	}
+	stacks := make([]byte, 1<<20)
+	stacks = stacks[:runtime.Stack(stacks, true)]
+	logger.Error("UI updates stalled: no broadcast for %v (heartbeat pending: %t). Goroutines:\n%s",
+		since.Round(time.Second), heartbeatPending.Load(), stacks)
+}
+
+// watchdogConnected reports whether we're on a server. A state lock that
+// can't be had right now counts as connected: it may be the stall itself.
+func watchdogConnected() bool {
+	if !appState.mutex.TryRLock() {
+		return true
+	}
+	defer appState.mutex.RUnlock()
+	return appState.Connected
+}
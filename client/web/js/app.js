@@ -150,14 +150,20 @@ const App = {
         this.sendCommand(command, args);
     },
     
-    // Send command to server
+    // Send command to the client backend. Resolves to {success, error, code}.
     sendCommand(command, args = '') {
-        fetch('/api/command', {
+        return fetch('/api/command', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ command, args })
+        }).then(response => response.json()).then(result => {
+            if (!result.success) {
+                console.error(`Command ${command} failed (${result.code}):`, result.error);
+            }
+            return result;
         }).catch(error => {
             console.error('Failed to send command:', error);
+            return { success: false, error: String(error), code: 'network' };
         });
     },
     
@@ -181,6 +187,9 @@ const App = {
         // Update connection status
         this.updateConnectionStatus();
         
+        // Apply the server's branding, if any
+        this.applyTheme(newState.theme);
+        
         // Update user info
         this.updateUserInfo();
         
@@ -224,12 +233,52 @@ const App = {
         const statusDot = document.getElementById('connectionStatus');
         const statusText = document.getElementById('statusText');
         
-        if (this.state.connected) {
-            statusDot?.classList.add('connected');
-            if (statusText) statusText.textContent = `Connected to ${this.state.serverName}`;
+        const phase = this.state.phase || (this.state.connected ? 'connected' : 'disconnected');
+        statusDot?.classList.toggle('connected', phase === 'connected');
+        statusDot?.classList.toggle('connecting', phase !== 'connected' && phase !== 'disconnected');
+        if (!statusText) return;
+        if (phase === 'connected') {
+            statusText.textContent = `Connected to ${this.state.serverName}`;
         } else {
-            statusDot?.classList.remove('connected');
-            if (statusText) statusText.textContent = 'Disconnected';
+            statusText.textContent = this.state.phaseLabel || 'Disconnected';
+        }
+    },
+    
+    // Theme color roles -> the CSS variables they override
+    themeColorVars: {
+        background: ['--bg-primary'],
+        panel: ['--bg-secondary', '--bg-accent'],
+        text: ['--text-primary'],
+        accent: ['--accent-pink'],
+        success: ['--accent-green'],
+        warning: ['--accent-orange'],
+        error: ['--accent-red']
+    },
+    
+    // Apply server branding: header name, logo and colors. An empty theme
+    // restores the stylesheet's defaults.
+    applyTheme(theme) {
+        theme = theme || {};
+        const key = JSON.stringify(theme);
+        if (key === this.appliedTheme) return;
+        this.appliedTheme = key;
+        
+        const title = document.querySelector('.header h1');
+        if (title) {
+            title.textContent = theme.name || 'AHCLI Voice Chat';
+            if (theme.logo_url) {
+                const logo = document.createElement('img');
+                logo.className = 'theme-logo';
+                logo.alt = '';
+                logo.src = theme.logo_url;
+                title.prepend(logo);
+            }
+        }
+        
+        const root = document.documentElement.style;
+        for (const [role, vars] of Object.entries(this.themeColorVars)) {
+            const color = theme.colors?.[role];
+            vars.forEach(v => color ? root.setProperty(v, color) : root.removeProperty(v));
         }
     },
     
@@ -240,16 +289,36 @@ const App = {
         
         if (nickname) nickname.textContent = this.state.nickname || '-';
         if (currentChannel) currentChannel.textContent = this.state.currentChannel || 'None';
+        
+        // Keep our presence selector in sync unless the user is editing it
+        const own = this.findUser(this.state.nickname) || {};
+        const statusSelect = document.getElementById('userStatus');
+        const statusMessage = document.getElementById('userStatusMessage');
+        if (statusSelect && document.activeElement !== statusSelect) statusSelect.value = own.status || 'online';
+        if (statusMessage && document.activeElement !== statusMessage) statusMessage.value = own.status_message || '';
+    },
+    
+    // Look up a user's list entry ({nickname, muted, speaking, status, status_message, role}) in any channel
+    findUser(nickname) {
+        for (const users of Object.values(this.state.channelUsers || {})) {
+            const user = (users || []).find(u => u.nickname === nickname);
+            if (user) return user;
+        }
+        return null;
     },
     
     // Update network statistics
     updateNetworkStats() {
         const packetsRx = document.getElementById('packetsRx');
         const packetsTx = document.getElementById('packetsTx');
+        const outputDropped = document.getElementById('outputDropped');
+        const dataUsage = document.getElementById('dataUsage');
         const pttKeyText = document.getElementById('pttKeyText');
         
         if (packetsRx) packetsRx.textContent = this.state.packetsRx || 0;
         if (packetsTx) packetsTx.textContent = this.state.packetsTx || 0;
+        if (outputDropped) outputDropped.textContent = this.state.outputDropped || 0;
+        if (dataUsage) dataUsage.textContent = `${((this.state.dataPerMinute || 0) / 1048576).toFixed(2)} MB/min`;
         if (pttKeyText) pttKeyText.textContent = `Hold ${this.state.pttKey || 'LSHIFT'} to transmit`;
     },
     
@@ -258,7 +327,10 @@ const App = {
         const pttIndicator = document.getElementById('pttIndicator');
         const pttText = document.getElementById('pttText');
         
-        if (this.state.pttActive) {
+        if (this.state.audioPanic) {
+            pttIndicator?.classList.remove('active');
+            if (pttText) pttText.textContent = 'Audio stopped';
+        } else if (this.state.pttActive) {
             pttIndicator?.classList.add('active');
             if (pttText) pttText.textContent = 'Transmitting';
         } else {
@@ -268,6 +340,13 @@ const App = {
         
         // Update audio bar
         this.updateAudioBar(this.state.audioLevel || 0);
+        
+        // Panic button doubles as the resume button
+        const panicButton = document.getElementById('panicButton');
+        if (panicButton) {
+            panicButton.classList.toggle('active', !!this.state.audioPanic);
+            panicButton.textContent = this.state.audioPanic ? '▶ RESUME AUDIO' : '🛑 PANIC';
+        }
     },
     
     // Update channels and users
@@ -286,14 +365,62 @@ const App = {
                 ${channel}
             `;
             channelDiv.onclick = () => this.joinChannel(channel);
+            
+            // Hear another channel without joining it, if the server allows it
+            if (channel !== this.state.currentChannel && this.state.connected) {
+                channelDiv.appendChild(this.createMonitorToggle(channel));
+            }
             container.appendChild(channelDiv);
             
+            // Channel topic, set in the server config or with /set_topic
+            const topic = this.state.channelTopics && this.state.channelTopics[channel];
+            if (topic) {
+                const topicDiv = document.createElement('div');
+                topicDiv.className = 'channel-topic';
+                topicDiv.textContent = topic;
+                topicDiv.title = topic;
+                container.appendChild(topicDiv);
+            }
+            
             // Channel users
             if (this.state.channelUsers && this.state.channelUsers[channel]) {
                 this.state.channelUsers[channel].forEach(user => {
+                    const nick = user.nickname;
                     const userDiv = document.createElement('div');
-                    userDiv.className = `user-item ${user === this.state.nickname ? 'self' : ''}`;
-                    userDiv.innerHTML = `├─ ${user}${user === this.state.nickname ? ' (you)' : ''}`;
+                    userDiv.className = `user-item ${nick === this.state.nickname ? 'self' : ''} ${user.speaking ? 'speaking' : ''}`;
+                    userDiv.innerHTML = `├─ ${nick}${nick === this.state.nickname ? ' (you)' : ''}`;
+                    
+                    if (user.role) {
+                        const role = document.createElement('span');
+                        role.className = 'user-role';
+                        role.textContent = user.role;
+                        userDiv.appendChild(role);
+                    }
+                    if (user.muted) {
+                        const muted = document.createElement('span');
+                        muted.className = 'user-muted';
+                        muted.textContent = '🔇';
+                        userDiv.appendChild(muted);
+                    }
+                    
+                    // Filtered out by our /listen_allow or /listen_block lists
+                    if (nick !== this.state.nickname && !this.isListeningTo(nick)) {
+                        const filtered = document.createElement('span');
+                        filtered.className = 'user-filtered';
+                        filtered.textContent = '🙉';
+                        filtered.title = `Not hearing ${nick}`;
+                        userDiv.appendChild(filtered);
+                    }
+                    
+                    // Away/busy badge and message
+                    if (user.status) {
+                        userDiv.appendChild(this.createStatusBadge(user));
+                    }
+                    
+                    // Per-user stereo position for other talkers
+                    if (this.state.stereo && nick !== this.state.nickname) {
+                        userDiv.appendChild(this.createPanControls(nick));
+                    }
                     container.appendChild(userDiv);
                 });
             } else if (channel === this.state.currentChannel && this.state.nickname) {
@@ -306,6 +433,66 @@ const App = {
         });
     },
     
+    // Ear button that starts or stops monitoring a channel
+    createMonitorToggle(channel) {
+        const monitored = (this.state.monitoredChannels || []).includes(channel);
+        const toggle = document.createElement('span');
+        toggle.className = `channel-monitor ${monitored ? 'active' : ''}`;
+        toggle.textContent = '👂';
+        toggle.title = monitored ? `Stop monitoring #${channel}` : `Monitor #${channel} without leaving this channel`;
+        toggle.onclick = (event) => {
+            event.stopPropagation();
+            this.sendCommand(monitored ? 'unmonitor' : 'monitor', channel);
+        };
+        return toggle;
+    },
+    
+    // Mirror of the client's listen filter: blocked never, allow list only
+    isListeningTo(nick) {
+        const listen = this.state.listen || {};
+        if (listen.block && listen.block.includes(nick)) return false;
+        if (listen.allow && listen.allow.length > 0) return listen.allow.includes(nick);
+        return true;
+    },
+    
+    // Build the presence badge shown after a nickname
+    createStatusBadge(user) {
+        const badge = document.createElement('span');
+        badge.className = `user-status status-${user.status}`;
+        badge.textContent = user.status;
+        
+        if (user.status_message) {
+            const message = document.createElement('span');
+            message.className = 'user-status-message';
+            message.textContent = user.status_message;
+            badge.appendChild(message);
+        }
+        return badge;
+    },
+    
+    // Build L/C/R pan buttons for a user
+    createPanControls(user) {
+        const pan = (this.state.userPans && this.state.userPans[user]) || 0;
+        const current = pan < 0 ? 'left' : pan > 0 ? 'right' : 'center';
+        
+        const controls = document.createElement('span');
+        controls.className = 'pan-controls';
+        
+        [['left', 'L'], ['center', 'C'], ['right', 'R']].forEach(([position, label]) => {
+            const button = document.createElement('button');
+            button.className = `pan-button ${position === current ? 'active' : ''}`;
+            button.textContent = label;
+            button.title = `Pan ${user} ${position}`;
+            button.onclick = (e) => {
+                e.stopPropagation();
+                this.sendCommand('set_pan', `${user}:${position}`);
+            };
+            controls.appendChild(button);
+        });
+        
+        return controls;
+    },
+    
     // Update audio level bar
     updateAudioBar(level) {
         const audioBar = document.getElementById('audioBar');
@@ -365,6 +552,16 @@ const App = {
         }
     },
     
+    // Set our presence from the sidebar selector
+    setStatus() {
+        const status = document.getElementById('userStatus')?.value || 'online';
+        const message = status === 'online' ? '' : (document.getElementById('userStatusMessage')?.value || '').trim();
+        
+        this.sendCommand('set_status', { status, message }).then(result => {
+            if (!result.success) this.updateUserInfo();
+        });
+    },
+    
     // Join a channel
     joinChannel(channel) {
         if (channel !== this.state.currentChannel) {
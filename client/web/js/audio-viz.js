@@ -34,6 +34,13 @@ const AudioViz = {
         // Update PROCESSED input level (after processing)
         this.updateProcessedInputLevel(state.inputLevel || 0);
         
+        // Update the compact sidebar meters: what we send and what we hear
+        this.updateMeter('inputMeterFill', state.inputLevel || 0);
+        this.updateMeter('outputMeterFill', state.outputLevel || 0);
+        
+        // Update mic spectrum analyzer
+        this.updateSpectrum(state.spectrum || []);
+        
         // Update noise gate status with visual activity
         this.updateGateStatus(state.gateOpen || false);
         
@@ -44,15 +51,89 @@ const AudioViz = {
         this.updateSensitivity(state.rawInputLevel || 0, state.inputLevel || 0);
         
         // Update audio quality indicator
-        this.updateAudioQuality(state.audioQuality || 'Unknown');
+        this.updateAudioQuality(state.audioQuality || 'Unknown', state);
         
         // Update bypass status
         this.updateBypassStatus(state.bypassProcessing || false);
         
+        // Update dry/wet mix, unless the user is dragging the slider
+        const mixSlider = document.getElementById('processingMix');
+        if (mixSlider && state.processingMix !== undefined && document.activeElement !== mixSlider) {
+            mixSlider.value = state.processingMix;
+            this.updateSliderValue('mix', 'level', state.processingMix);
+        }
+        
+        // Record button shows whether a session recording is running
+        this.recording = !!state.recording;
+        document.querySelectorAll('.record-btn').forEach(button => {
+            button.textContent = this.recording ? '⏹ Stop Recording' : '⏺ Record';
+            button.title = this.recording ? `Recording to ${state.recordingFile}` : 'Record this session to WAV';
+        });
+        
+        // Update stereo toggle
+        const stereoCheckbox = document.getElementById('stereoOutput');
+        if (stereoCheckbox) {
+            stereoCheckbox.checked = !!state.stereo;
+        }
+        
+        // Update low data toggle
+        const lowDataCheckbox = document.getElementById('lowDataMode');
+        if (lowDataCheckbox) {
+            lowDataCheckbox.checked = !!state.lowData;
+        }
+        
+        // Presets from the config join the built-in options
+        if (state.audioPresets) {
+            this.updatePresetOptions(state.audioPresets);
+        }
+        
         // Update preset status
         if (state.audioPreset) {
             this.updatePresetDisplay(state.audioPreset);
         }
+        
+        // Update device diagnostics
+        if (state.audioDevices) {
+            this.updateDeviceReport(state.audioDevices);
+        }
+    },
+    
+    // Render the startup audio device check
+    updateDeviceReport(report) {
+        const selected = document.getElementById('deviceSelected');
+        const warnings = document.getElementById('deviceWarnings');
+        const list = document.getElementById('deviceList');
+        if (!selected || !warnings || !list) return;
+        
+        selected.textContent = `🎤 ${report.input || 'unknown'} · 🔊 ${report.output || 'unknown'} · ${report.sampleRate || 0} Hz`;
+        
+        warnings.innerHTML = '';
+        (report.warnings || []).forEach(warning => {
+            const div = document.createElement('div');
+            div.className = 'device-warning';
+            div.textContent = `⚠ ${warning}`;
+            warnings.appendChild(div);
+        });
+        
+        list.innerHTML = '';
+        (report.devices || []).forEach(device => {
+            const li = document.createElement('li');
+            const usable = device.inputOk || device.outputOk;
+            li.className = usable ? 'device-ok' : 'device-unusable';
+            li.textContent = `${device.name} [${device.hostApi}] in:${device.inputs}${device.inputOk ? '✓' : ''} out:${device.outputs}${device.outputOk ? '✓' : ''}`;
+            list.appendChild(li);
+        });
+    },
+    
+    // Show/hide the device diagnostics panel
+    toggleDeviceDiagnostics() {
+        const report = document.getElementById('deviceReport');
+        const arrow = document.getElementById('deviceToggleArrow');
+        if (!report) return;
+        
+        const hidden = report.style.display === 'none';
+        report.style.display = hidden ? 'block' : 'none';
+        if (arrow) arrow.textContent = hidden ? '▲' : '▼';
     },
     
     // Update RAW input level (before any processing)
@@ -70,6 +151,32 @@ const AudioViz = {
         }
     },
     
+    // Update a simple level bar (0..1)
+    updateMeter(id, level) {
+        const fill = document.getElementById(id);
+        if (fill) fill.style.width = `${Math.min(level * 100, 100)}%`;
+    },
+    
+    // Update the mic spectrum bars (band levels 0..1, low to high frequency)
+    updateSpectrum(bands) {
+        const container = document.getElementById('spectrumBars');
+        if (!container) return;
+        
+        // Bars are created on first use so the band count comes from the backend
+        if (container.children.length !== bands.length) {
+            container.innerHTML = '';
+            bands.forEach(() => {
+                const bar = document.createElement('div');
+                bar.className = 'spectrum-bar';
+                container.appendChild(bar);
+            });
+        }
+        
+        bands.forEach((level, i) => {
+            container.children[i].style.height = `${Math.round(Math.min(level, 1) * 100)}%`;
+        });
+    },
+    
     // Update PROCESSED input level (after processing)
     updateProcessedInputLevel(level) {
         const inputLevel = Math.min(level * 100, 100);
@@ -170,20 +277,16 @@ const AudioViz = {
     toggleBypass(bypass) {
         console.log('Toggling bypass mode:', bypass);
         
-        // Send bypass command to server
-        fetch('/api/command', {
-            method: 'POST',
-            headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({
-                command: 'bypass_processing',
-                args: bypass ? 'true' : 'false'
-            })
-        }).catch(error => {
-            console.error('Failed to toggle bypass:', error);
-        });
-        
-        // Update UI immediately
+        // Update UI immediately, revert if the backend refuses
         this.updateBypassStatus(bypass);
+        
+        App.sendCommand('bypass_processing', bypass ? 'true' : 'false').then(result => {
+            if (!result.success) {
+                const checkbox = document.getElementById('bypassProcessing');
+                if (checkbox) checkbox.checked = !bypass;
+                this.updateBypassStatus(!bypass);
+            }
+        });
     },
     
     // Update bypass status display
@@ -228,13 +331,21 @@ const AudioViz = {
         }
     },
     
-    // Update audio quality indicator (from Go audio processor)
-    updateAudioQuality(quality) {
+    // Update audio quality indicator (from Go audio processor), with the raw numbers beside it
+    updateAudioQuality(quality, state) {
         const qualityElement = document.getElementById('audioQuality');
         if (qualityElement) {
             qualityElement.textContent = quality;
             qualityElement.className = `quality-${quality.toLowerCase()}`;
         }
+        
+        const detailElement = document.getElementById('audioQualityDetail');
+        if (detailElement) {
+            const loss = (state.packetLossPct || 0).toFixed(1);
+            const jitter = Math.round(state.jitterMs || 0);
+            const buffer = Math.round(state.bufferMs || 0);
+            detailElement.textContent = `${loss}% / ${jitter}ms / ${buffer}ms`;
+        }
     },
     
     // Toggle advanced controls panel
@@ -256,21 +367,19 @@ const AudioViz = {
     changePreset(preset) {
         console.log('Changing audio preset to:', preset);
         
-        // Send preset change to server
-        fetch('/api/command', {
-            method: 'POST',
-            headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({
-                command: 'audio_preset',
-                args: preset
-            })
-        }).catch(error => {
-            console.error('Failed to change preset:', error);
-        });
-        
         // Update UI immediately for responsiveness
+        const previous = App.state.audioPreset;
         this.updatePresetDisplay(preset);
         this.updateControlsFromPreset(preset);
+        
+        App.sendCommand('audio_preset', preset).then(result => {
+            if (!result.success && previous) {
+                const presetSelect = document.getElementById('audioPreset');
+                if (presetSelect) presetSelect.value = previous;
+                this.updatePresetDisplay(previous);
+                this.updateControlsFromPreset(previous);
+            }
+        });
     },
     
     // Update individual audio setting
@@ -297,6 +406,22 @@ const AudioViz = {
         });
     },
     
+    // Set the dry/wet mix; unlike the other settings it doesn't switch the preset to custom
+    setMix(value) {
+        console.log('Setting processing mix:', value);
+        
+        fetch('/api/command', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                command: 'audio_setting',
+                args: JSON.stringify({ section: 'mix', param: 'level', value: String(value) })
+            })
+        }).catch(error => {
+            console.error('Failed to update mix:', error);
+        });
+    },
+    
     // Update slider display values
     updateSliderValue(section, param, value) {
         switch (section) {
@@ -321,6 +446,12 @@ const AudioViz = {
                     if (element) element.textContent = `+${value}dB`;
                 }
                 break;
+            case 'mix':
+                if (param === 'level') {
+                    const element = document.getElementById('processingMixValue');
+                    if (element) element.textContent = `${Math.round(value * 100)}%`;
+                }
+                break;
         }
     },
     
@@ -380,6 +511,19 @@ const AudioViz = {
         }
     },
     
+    // Add an option per config-defined preset to the preset dropdowns
+    updatePresetOptions(names) {
+        document.querySelectorAll('select#audioPreset').forEach(select => {
+            names.forEach(name => {
+                if (select.querySelector(`option[value="${CSS.escape(name)}"]`)) return;
+                const option = document.createElement('option');
+                option.value = name;
+                option.textContent = name;
+                select.appendChild(option);
+            });
+        });
+    },
+    
     // Update preset status display
     updatePresetDisplay(preset) {
         const statusElement = document.getElementById('presetStatus');
@@ -403,6 +547,9 @@ const AudioViz = {
             case 'custom':
                 statusElement.textContent = 'Processing: Custom';
                 break;
+            default:
+                statusElement.textContent = `Processing: ${preset}`;
+                break;
         }
     },
     
@@ -421,6 +568,49 @@ const AudioViz = {
         });
     },
     
+    // Play a chime through the output device
+    testOutput() {
+        console.log('Testing output...');
+        fetch('/api/command', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                command: 'test_output',
+                args: ''
+            })
+        }).catch(error => {
+            console.error('Failed to test output:', error);
+        });
+    },
+    
+    // Start or stop recording the session to WAV
+    toggleRecording() {
+        App.sendCommand(this.recording ? 'record_stop' : 'record_start');
+    },
+    
+    // Copy the current settings to the clipboard as a shareable preset
+    exportPreset() {
+        // Built-in names can't be imported, so only a custom preset's name is offered
+        const custom = (App.state.audioPresets || []).includes(App.state.audioPreset);
+        const name = prompt('Name for the exported preset:', custom ? App.state.audioPreset : '');
+        if (name === null) return;
+        App.sendCommand('export_preset', name).then(result => {
+            if (!result.success) return;
+            const json = JSON.stringify(result.result, null, 2);
+            navigator.clipboard.writeText(json).then(
+                () => console.log('Preset copied to clipboard'),
+                () => prompt('Copy this preset:', json)
+            );
+        });
+    },
+    
+    // Import a preset pasted from someone's export
+    importPreset() {
+        const json = prompt('Paste a preset:');
+        if (!json) return;
+        App.sendCommand('import_preset', json);
+    },
+    
     // Reset to defaults
     resetDefaults() {
         if (confirm('Reset all audio settings to defaults?')) {
@@ -8,6 +8,12 @@ const UserChat = {
     channelMessages: new Map(), // Store messages per channel
     processedMessageIds: new Set(), // Track processed message IDs globally
     lastAppStateMessageCount: 0, // Track appState messages processed
+    deliveryStatus: null,
+    pendingDeliveries: 0, // Outgoing messages still awaiting server ack
+    sentStatusTimer: null,
+    typingStatus: null,
+    lastTypingSent: 0, // Debounce typing hints to the server
+    typingInterval: 3000,
     
     // Initialize user chat
     init() {
@@ -15,6 +21,8 @@ const UserChat = {
             document.querySelector('#messages-container .user-chat-container');
         this.input = document.getElementById('chatInput') ||
             document.querySelector('#messages-container .chat-input');
+        this.deliveryStatus = document.getElementById('chatDeliveryStatus');
+        this.typingStatus = document.getElementById('chatTypingStatus');
             
         if (this.input) {
             this.setupChatInput();
@@ -37,10 +45,20 @@ const UserChat = {
                 if (message) {
                     this.sendMessage(message);
                     e.target.value = '';
+                    this.lastTypingSent = 0;
                 }
             }
         });
         
+        // Let the channel know we're composing, at most once per typingInterval
+        this.input.addEventListener('input', (e) => {
+            const now = Date.now();
+            if (e.target.value.trim() && App.state.connected && now - this.lastTypingSent > this.typingInterval) {
+                this.lastTypingSent = now;
+                App.sendCommand('typing');
+            }
+        });
+        
         this.updateInputPlaceholder();
     },
     
@@ -55,11 +73,7 @@ const UserChat = {
     
     // Send message to server
     sendMessage(message) {
-        if (!App.state.connected) {
-            this.addSystemMessage('⚠️ Cannot send chat: not connected to server');
-            return;
-        }
-        
+        // While offline the client queues the message and sends it on reconnect
         // Send via existing command system
         App.sendCommand('chat', message);
         
@@ -109,22 +123,80 @@ const UserChat = {
             newMessages.forEach(msg => {
                 if (msg.type === 'chat') {
                     this.processNewChatMessage(msg.message);
+                } else if (msg.type === 'system') {
+                    this.addServerNotice(msg.message);
+                } else if (msg.type === 'announcement') {
+                    this.addAnnouncement(msg.message);
                 }
             });
             
             this.lastAppStateMessageCount = newState.messages.length;
         }
         
-        // Update input state
+        // Update "X is typing…" hint
+        this.updateTypingStatus(newState.typingUsers || []);
+        
+        // Update outgoing message delivery state
+        if (newState.chatDeliveries) {
+            this.updateDeliveryStatus(newState.chatDeliveries);
+        }
+        
+        // Update input state - stays enabled offline so messages can be queued
         if (!newState.connected && this.input) {
-            this.input.placeholder = 'Connect to server to chat...';
-            this.input.disabled = true;
+            this.input.placeholder = 'Offline - messages will be sent on reconnect...';
         } else if (this.input) {
-            this.input.disabled = false;
             this.updateInputPlaceholder();
         }
     },
     
+    // Show which other users are composing
+    updateTypingStatus(users) {
+        if (!this.typingStatus) return;
+        
+        const others = users.filter(u => u !== App.state.nickname);
+        if (others.length === 0) {
+            this.typingStatus.textContent = '';
+        } else if (others.length === 1) {
+            this.typingStatus.textContent = `${others[0]} is typing…`;
+        } else if (others.length <= 3) {
+            this.typingStatus.textContent = `${others.join(', ')} are typing…`;
+        } else {
+            this.typingStatus.textContent = 'Several people are typing…';
+        }
+    },
+    
+    // Show sending… / sent / failed for our outgoing messages
+    updateDeliveryStatus(deliveries) {
+        if (!this.deliveryStatus) return;
+        
+        const all = Object.values(deliveries);
+        const sending = all.filter(d => d.status === 'sending');
+        const failed = all.filter(d => d.status === 'failed');
+        const pending = all.filter(d => d.status === 'pending');
+        
+        clearTimeout(this.sentStatusTimer);
+        
+        if (failed.length > 0) {
+            this.deliveryStatus.className = 'chat-delivery-status chat-delivery-failed';
+            this.deliveryStatus.textContent = `⚠️ Failed to send: ${failed[failed.length - 1].message}`;
+        } else if (pending.length > 0) {
+            this.deliveryStatus.className = 'chat-delivery-status chat-delivery-pending';
+            this.deliveryStatus.textContent = `⏸ ${pending.length} queued - will send when reconnected`;
+        } else if (sending.length > 0) {
+            this.deliveryStatus.className = 'chat-delivery-status chat-delivery-sending';
+            this.deliveryStatus.textContent = sending.length > 1 ? `sending ${sending.length} messages…` : 'sending…';
+        } else if (this.pendingDeliveries > 0) {
+            // Everything we were waiting on was acknowledged
+            this.deliveryStatus.className = 'chat-delivery-status chat-delivery-sent';
+            this.deliveryStatus.textContent = '✓ sent';
+            this.sentStatusTimer = setTimeout(() => {
+                this.deliveryStatus.textContent = '';
+            }, 2000);
+        }
+        
+        this.pendingDeliveries = sending.length + pending.length;
+    },
+    
     // Process a new chat message with deduplication
     processNewChatMessage(messageText) {
         const messageId = this.createMessageId(messageText, this.currentChannel);
@@ -220,6 +292,26 @@ const UserChat = {
                     <span class="chat-message">${content}</span>
                 `;
             }
+        } else if (timestampMatch && messageText.includes('📢')) {
+            // Operator announcement: [HH:MM] 📢 Server restarting in 5 minutes
+            chatLine.className = 'chat-line chat-line-announcement';
+            const [, timestamp] = timestampMatch;
+            const announcement = messageText.slice(timestampMatch[0].length).trim();
+            chatLine.innerHTML = `
+                <span class="chat-timestamp-notification">[${timestamp}]</span>
+                <span class="chat-separator"> </span>
+                <span class="chat-announcement">${announcement}</span>
+            `;
+        } else if (timestampMatch && messageText.includes('***')) {
+            // Server notice: [HH:MM] *** alice joined #General ***
+            chatLine.className = 'chat-line chat-line-notification';
+            const [, timestamp] = timestampMatch;
+            const notice = messageText.slice(timestampMatch[0].length).trim();
+            chatLine.innerHTML = `
+                <span class="chat-timestamp-notification">[${timestamp}]</span>
+                <span class="chat-separator"> </span>
+                <span class="chat-notification">${notice}</span>
+            `;
         } else {
             // Fallback for malformed messages
             chatLine.innerHTML = `<span class="chat-message">${messageText}</span>`;
@@ -293,6 +385,28 @@ const UserChat = {
         this.scrollToBottom();
     },
     
+    // Add server notice (user joined/left) - stored with the channel like chat
+    addServerNotice(messageText) {
+        const targetChannel = this.currentChannel || 'General';
+        
+        if (!this.channelMessages.has(targetChannel)) {
+            this.channelMessages.set(targetChannel, []);
+        }
+        this.channelMessages.get(targetChannel).push(messageText);
+        
+        this.displayMessage(messageText);
+    },
+    
+    // Add operator announcement - shown in every channel, not just the current one
+    addAnnouncement(messageText) {
+        this.channelMessages.forEach(messages => messages.push(messageText));
+        if (!this.channelMessages.has(this.currentChannel || 'General')) {
+            this.channelMessages.set(this.currentChannel || 'General', [messageText]);
+        }
+        
+        this.displayMessage(messageText);
+    },
+    
     // Add channel notification
     addChannelNotification(channel) {
         if (!this.container) return;
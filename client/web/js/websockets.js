@@ -5,9 +5,26 @@ const WebSocketManager = {
     maxReconnectAttempts: 10,
     reconnectDelay: 1000,
     
+    // The client sends a heartbeat every 2s; this long without any update
+    // while connected means the client's update path is stuck
+    staleAfterMs: 10000,
+    lastMessageAt: 0,
+    
     // Initialize WebSocket connection
     init() {
         this.connect();
+        setInterval(() => this.checkStale(), 2000);
+    },
+    
+    // Flag the UI when updates stop arriving over an open socket
+    checkStale() {
+        const open = this.ws && this.ws.readyState === WebSocket.OPEN;
+        const stale = open && App.state?.connected && Date.now() - this.lastMessageAt > this.staleAfterMs;
+        document.body.classList.toggle('ui-stale', !!stale);
+        if (stale) {
+            const statusText = document.getElementById('statusText');
+            if (statusText) statusText.textContent = '⚠ UI not updating - see client log';
+        }
     },
     
     // Connect to WebSocket
@@ -32,6 +49,7 @@ const WebSocketManager = {
         };
         
         this.ws.onmessage = (event) => {
+            this.lastMessageAt = Date.now();
             try {
                 const state = JSON.parse(event.data);
                 App.updateUI(state);
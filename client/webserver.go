@@ -2,6 +2,7 @@
 package main
 
 import (
+	"ahcli/common"
 	"ahcli/common/logger"
 	"embed"
 	"encoding/json"
@@ -21,19 +22,51 @@ var webFiles embed.FS
 
 type WebTUIState struct {
 	sync.RWMutex
-	Connected      bool                `json:"connected"`
-	Nickname       string              `json:"nickname"`
-	ServerName     string              `json:"serverName"`
-	CurrentChannel string              `json:"currentChannel"`
-	Channels       []string            `json:"channels"`
-	ChannelUsers   map[string][]string `json:"channelUsers"`
-	PTTActive      bool                `json:"pttActive"`
-	AudioLevel     int                 `json:"audioLevel"`
-	PacketsRx      int                 `json:"packetsRx"`
-	PacketsTx      int                 `json:"packetsTx"`
-	ConnectionTime time.Time           `json:"connectionTime"`
-	Messages       []WebMessage        `json:"messages"`
-	PTTKey         string              `json:"pttKey"`
+	Connected      bool                         `json:"connected"`
+	Phase          ConnPhase                    `json:"phase"`
+	PhaseLabel     string                       `json:"phaseLabel"`
+	Nickname       string                       `json:"nickname"`
+	ServerName     string                       `json:"serverName"`
+	Theme          common.Theme                 `json:"theme"` // Server branding; empty keeps the default look
+	CurrentChannel string                       `json:"currentChannel"`
+	Channels       []string                     `json:"channels"`
+	ChannelUsers   map[string][]common.UserInfo `json:"channelUsers"`
+	ChannelTopics  map[string]string            `json:"channelTopics"`
+	Monitored      []string                     `json:"monitoredChannels"` // Heard without joining
+	PTTActive      bool                         `json:"pttActive"`
+	Muted          bool                         `json:"muted"`
+	AudioPanic     bool                         `json:"audioPanic"` // Panic button: all audio stopped
+	AudioLevel     int                          `json:"audioLevel"`
+	PacketsRx      int                          `json:"packetsRx"`
+	PacketsTx      int                          `json:"packetsTx"`
+	OutputDropped  int                          `json:"outputDropped"`
+	DataPerMinute  int64                        `json:"dataPerMinute"` // Bytes, both directions
+	LowData        bool                         `json:"lowData"`
+	ConnectionTime time.Time                    `json:"connectionTime"`
+	Messages       []WebMessage                 `json:"messages"`
+	PTTKey         string                       `json:"pttKey"`
+	Heartbeat      time.Time                    `json:"heartbeat"` // Refreshed every few seconds; see watchdog.go
+
+	// Outgoing chat messages that are unacknowledged or failed
+	ChatDeliveries map[string]ChatDelivery `json:"chatDeliveries"`
+	TypingUsers    []string                `json:"typingUsers"`
+
+	// Stereo playback and per-user pan (-1 left .. 1 right)
+	Stereo   bool               `json:"stereo"`
+	UserPans map[string]float64 `json:"userPans"`
+
+	// Per-server allow/block lists for received audio
+	Listen ListenFilter `json:"listen"`
+
+	// Audio device diagnostics from the startup check
+	AudioDevices AudioDeviceReport `json:"audioDevices"`
+
+	// Presets defined in the config, offered next to the built-ins
+	AudioPresets []string `json:"audioPresets"`
+
+	// Session recording in progress and its received-audio file
+	Recording     bool   `json:"recording"`
+	RecordingFile string `json:"recordingFile"`
 
 	// Real-time audio processing stats
 	AudioPreset   string  `json:"audioPreset"`
@@ -43,27 +76,39 @@ type WebTUIState struct {
 	GainReduction float32 `json:"gainReduction"`
 	AudioQuality  string  `json:"audioQuality"`
 
+	// The numbers behind the quality rating
+	PacketLossPct float32 `json:"packetLossPct"`
+	JitterMs      float32 `json:"jitterMs"`
+	BufferMs      float32 `json:"bufferMs"`
+
 	// Detailed processing stats for debugging
 	NoiseGateThreshold float32 `json:"noiseGateThreshold"`
 	CompressorRatio    float32 `json:"compressorRatio"`
 	MakeupGainDB       float32 `json:"makeupGainDB"`
+	ProcessingMix      float32 `json:"processingMix"`
 
 	RawInputLevel       float32 `json:"rawInputLevel"`
 	ProcessedInputLevel float32 `json:"processedInputLevel"`
 	BypassProcessing    bool    `json:"bypassProcessing"`
+
+	Spectrum []float32 `json:"spectrum"` // Mic band levels (0..1), low to high frequency
 }
 
 type WebMessage struct {
 	Timestamp string `json:"timestamp"`
 	Message   string `json:"message"`
-	Type      string `json:"type"` // "info", "error", "success", "ptt", "chat"
+	Type      string `json:"type"` // "info", "error", "success", "ptt", "chat", "system", "announcement"
+
+	// Styled spans of the chat text (message body only, without timestamp/user)
+	Segments []common.ChatSegment `json:"segments,omitempty"`
 }
 
 var (
 	webTUI = &WebTUIState{
-		ChannelUsers: make(map[string][]string),
-		Messages:     make([]WebMessage, 0),
-		PTTKey:       "LSHIFT",
+		ChannelUsers:   make(map[string][]common.UserInfo),
+		Messages:       make([]WebMessage, 0),
+		ChatDeliveries: make(map[string]ChatDelivery),
+		PTTKey:         "LSHIFT",
 	}
 	upgrader = websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool { return true },
@@ -91,9 +136,13 @@ func StartWebServer() (int, error) {
 	logger.Debug("Web filesystem configured with embedded files")
 
 	// API endpoints
+	registerAPICommands()
 	http.HandleFunc("/api/state", handleAPIState)
 	http.HandleFunc("/api/command", handleAPICommand)
+	http.HandleFunc("/api/diagnostics", handleAPIDiagnostics)
+	http.HandleFunc("/api/logs", handleAPILogs)
 	http.HandleFunc("/ws", handleWebSocket)
+	http.HandleFunc("/spectate/ws", handleSpectatorWebSocket)
 	logger.Debug("Web API endpoints registered")
 
 	logger.Info("Starting web server on port %d", port)
@@ -129,6 +178,40 @@ func setupAppStateObservers() {
 				broadcastUpdate()
 			}
 
+		case "muted":
+			if muted, ok := change.Data.(bool); ok {
+				logger.Debug("Observer: Mute state changed to %t", muted)
+				webTUI.Lock()
+				webTUI.Muted = muted
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		case "audio_panic":
+			if stopped, ok := change.Data.(bool); ok {
+				webTUI.Lock()
+				webTUI.AudioPanic = stopped
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		case "typing":
+			if users, ok := change.Data.([]string); ok {
+				webTUI.Lock()
+				webTUI.TypingUsers = users
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		case "chat_delivery":
+			if delivery, ok := change.Data.(ChatDelivery); ok {
+				logger.Debug("Observer: Chat %s is %s", delivery.MsgID, delivery.Status)
+				webTUI.Lock()
+				webTUI.ChatDeliveries = appState.GetChatDeliveries()
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
 		case "audio_level":
 			if level, ok := change.Data.(int); ok {
 				webTUI.Lock()
@@ -157,6 +240,25 @@ func setupAppStateObservers() {
 				broadcastUpdate()
 			}
 
+		case "recording":
+			if data, ok := change.Data.(map[string]interface{}); ok {
+				webTUI.Lock()
+				webTUI.Recording, _ = data["active"].(bool)
+				webTUI.RecordingFile, _ = data["path"].(string)
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		case "connection_phase":
+			if phase, ok := change.Data.(ConnPhase); ok {
+				logger.Debug("Observer: Connection phase %s", phase)
+				webTUI.Lock()
+				webTUI.Phase = phase
+				webTUI.PhaseLabel = phase.label()
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
 		case "channel":
 			if channel, ok := change.Data.(string); ok {
 				logger.Debug("Observer: Channel changed to %s", channel)
@@ -176,7 +278,7 @@ func setupAppStateObservers() {
 			}
 
 		case "channel_users":
-			if channelUsers, ok := change.Data.(map[string][]string); ok {
+			if channelUsers, ok := change.Data.(map[string][]common.UserInfo); ok {
 				logger.Debug("Observer: Channel users updated")
 				webTUI.Lock()
 				webTUI.ChannelUsers = channelUsers
@@ -184,6 +286,38 @@ func setupAppStateObservers() {
 				broadcastUpdate()
 			}
 
+		case "channel_topics":
+			if topics, ok := change.Data.(map[string]string); ok {
+				webTUI.Lock()
+				webTUI.ChannelTopics = topics
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		case "heartbeat":
+			if at, ok := change.Data.(time.Time); ok {
+				webTUI.Lock()
+				webTUI.Heartbeat = at
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		case "theme":
+			if theme, ok := change.Data.(common.Theme); ok {
+				webTUI.Lock()
+				webTUI.Theme = theme
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		case "monitored_channels":
+			if channels, ok := change.Data.([]string); ok {
+				webTUI.Lock()
+				webTUI.Monitored = channels
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
 		case "message":
 			if msg, ok := change.Data.(AppMessage); ok {
 				logger.Debug("Observer: New message - %s", msg.Message)
@@ -192,6 +326,7 @@ func setupAppStateObservers() {
 					Timestamp: msg.Timestamp,
 					Message:   msg.Message,
 					Type:      msg.Type,
+					Segments:  msg.Segments,
 				}
 				webTUI.Messages = append(webTUI.Messages, webMsg)
 
@@ -230,6 +365,14 @@ func setupAppStateObservers() {
 				broadcastUpdate()
 			}
 
+		case "output_dropped":
+			if dropped, ok := change.Data.(int); ok {
+				webTUI.Lock()
+				webTUI.OutputDropped = dropped
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
 		// Audio processing stats observer
 		case "audio_stats":
 			if stats, ok := change.Data.(AudioStats); ok {
@@ -238,16 +381,19 @@ func setupAppStateObservers() {
 
 				webTUI.Lock()
 				webTUI.InputLevel = stats.InputLevel
-				webTUI.OutputLevel = stats.InputLevel // For now, use input level for both
 				webTUI.GateOpen = stats.NoiseGateOpen
 				webTUI.GainReduction = 1.0 - stats.CompressionGain // Convert to reduction amount
 				webTUI.AudioQuality = stats.AudioQuality
+				webTUI.PacketLossPct = stats.PacketLoss * 100
+				webTUI.JitterMs = float32(stats.NetworkJitter) / float32(time.Millisecond)
+				webTUI.BufferMs = float32(stats.BufferLatency) / float32(time.Millisecond)
 
 				// Update current processing settings for UI display
 				if audioProcessor != nil {
 					webTUI.NoiseGateThreshold = audioProcessor.noiseGate.threshold
 					webTUI.CompressorRatio = audioProcessor.compressor.ratio
 					webTUI.MakeupGainDB = audioProcessor.makeupGain.gainDB
+					webTUI.ProcessingMix = audioProcessor.mix
 				}
 				webTUI.Unlock()
 
@@ -266,6 +412,24 @@ func setupAppStateObservers() {
 				// Don't broadcast every input level - too frequent
 			}
 
+		// Received audio level, already throttled by the playback loop
+		case "output_level":
+			if level, ok := change.Data.(float32); ok {
+				webTUI.Lock()
+				webTUI.OutputLevel = level
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		// Mic spectrum, already throttled by the audio loop
+		case "spectrum":
+			if bands, ok := change.Data.([]float32); ok {
+				webTUI.Lock()
+				webTUI.Spectrum = bands
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
 		// Noise gate status updates
 		case "gate_status":
 			if open, ok := change.Data.(bool); ok {
@@ -274,9 +438,70 @@ func setupAppStateObservers() {
 				webTUI.Unlock()
 				broadcastUpdate()
 			}
+
+		case "low_data":
+			if enabled, ok := change.Data.(bool); ok {
+				webTUI.Lock()
+				webTUI.LowData = enabled
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		case "data_usage":
+			if perMinute, ok := change.Data.(int64); ok {
+				webTUI.Lock()
+				webTUI.DataPerMinute = perMinute
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		case "stereo_output":
+			if stereo, ok := change.Data.(bool); ok {
+				webTUI.Lock()
+				webTUI.Stereo = stereo
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		case "user_pans":
+			if pans, ok := change.Data.(map[string]float64); ok {
+				webTUI.Lock()
+				webTUI.UserPans = pans
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		case "listen_filter":
+			if filter, ok := change.Data.(ListenFilter); ok {
+				webTUI.Lock()
+				webTUI.Listen = filter
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
+
+		case "audio_devices":
+			if report, ok := change.Data.(AudioDeviceReport); ok {
+				webTUI.Lock()
+				webTUI.AudioDevices = report
+				webTUI.Unlock()
+				broadcastUpdate()
+			}
 		}
 	})
 
+	// Settings applied from config before the observer existed
+	webTUI.Lock()
+	webTUI.Phase = appState.GetConnectionPhase()
+	webTUI.PhaseLabel = webTUI.Phase.label()
+	webTUI.Stereo = appState.IsStereoOutput()
+	webTUI.LowData = appState.IsLowData()
+	webTUI.Monitored = appState.GetMonitoredChannels()
+	webTUI.UserPans = appState.GetUserPans()
+	webTUI.Listen = appState.GetListenFilter()
+	webTUI.AudioPresets = customPresetNames(currentConfig)
+	webTUI.AudioDevices = appState.GetAudioDeviceReport()
+	webTUI.Unlock()
+
 	observersSetup = true
 	logger.Info("WebTUI observers setup complete - now pure observer of AppState!")
 }
@@ -307,63 +532,6 @@ func handleAPIState(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(webTUI)
 }
 
-func handleAPICommand(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		logger.Debug("API command rejected: method %s not allowed", r.Method)
-		http.Error(w, "Method not allowed", 405)
-		return
-	}
-
-	var cmd struct {
-		Command string `json:"command"`
-		Args    string `json:"args"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
-		logger.Error("Invalid JSON in API command: %v", err)
-		http.Error(w, "Invalid JSON", 400)
-		return
-	}
-
-	logger.Info("API command received: %s with args: %s", cmd.Command, cmd.Args)
-
-	switch cmd.Command {
-	case "join":
-		changeChannel(cmd.Args)
-		appState.AddMessage(fmt.Sprintf("Joining channel: %s", cmd.Args), "info")
-
-	case "quit":
-		logger.Info("Quit command received from web interface")
-		appState.AddMessage("Disconnecting...", "info")
-		// Could trigger graceful shutdown here
-
-	case "audio_preset":
-		handleAudioPreset(cmd.Args)
-
-	case "audio_setting":
-		handleAudioSetting(cmd.Args)
-
-	case "bypass_processing":
-		handleBypassToggle(cmd.Args)
-
-	case "test_microphone":
-		handleTestMicrophone()
-
-	case "save_custom_preset":
-		handleSaveCustomPreset()
-
-	case "chat":
-		// NEW: Handle chat messages from UI
-		handleChatCommand(cmd.Args)
-
-	default:
-		logger.Error("Unknown API command: %s", cmd.Command)
-		appState.AddMessage(fmt.Sprintf("Unknown command: %s", cmd.Command), "error")
-	}
-
-	w.WriteHeader(200)
-}
-
 // NEW: Handle chat messages from the web UI
 func handleChatCommand(message string) {
 	if message == "" {
@@ -414,18 +582,7 @@ func handleAudioPreset(preset string) {
 }
 
 // Individual audio setting handler
-func handleAudioSetting(argsJSON string) {
-	var setting struct {
-		Section string      `json:"section"`
-		Param   string      `json:"param"`
-		Value   interface{} `json:"value"`
-	}
-
-	if err := json.Unmarshal([]byte(argsJSON), &setting); err != nil {
-		logger.Error("Invalid audio setting JSON: %v", err)
-		return
-	}
-
+func handleAudioSetting(setting audioSettingArgs) {
 	logger.Info("Updating audio setting: %s.%s = %v", setting.Section, setting.Param, setting.Value)
 
 	if currentConfig == nil {
@@ -482,12 +639,20 @@ func handleAudioSetting(argsJSON string) {
 				}
 			}
 		}
+
+	case "mix":
+		if setting.Param == "level" {
+			if level, ok := setting.Value.(string); ok {
+				if val, err := strconv.ParseFloat(level, 32); err == nil {
+					currentConfig.AudioProcessing.Mix = clampMix(float32(val))
+				}
+			}
+		}
 	}
 
-	// Set preset to custom when individual settings change
+	// Set preset to custom when individual settings change, the mix included
 	currentConfig.AudioProcessing.Preset = "custom"
 
-	// Update UI state
 	webTUI.Lock()
 	webTUI.AudioPreset = "custom"
 	webTUI.Unlock()
@@ -548,23 +713,27 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	wsMutex.Lock()
-	wsClients[conn] = true
-	clientCount := len(wsClients)
-	wsMutex.Unlock()
-
-	logger.Info("WebSocket client connected from %s (total: %d)", r.RemoteAddr, clientCount)
-
-	// Send initial state
+	// Send initial state. The broadcaster writes to registered clients, so
+	// register under the same lock to keep writes to this one from overlapping.
 	webTUI.RLock()
 	initialState := *webTUI
 	webTUI.RUnlock()
 
-	if err := conn.WriteJSON(initialState); err != nil {
+	wsMutex.Lock()
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	err = conn.WriteJSON(initialState)
+	if err == nil {
+		wsClients[conn] = true
+	}
+	clientCount := len(wsClients)
+	wsMutex.Unlock()
+	if err != nil {
 		logger.Error("Failed to send initial state to WebSocket client: %v", err)
 		return
 	}
 
+	logger.Info("WebSocket client connected from %s (total: %d)", r.RemoteAddr, clientCount)
+
 	// Keep connection alive and handle disconnection
 	for {
 		_, _, err := conn.ReadMessage()
@@ -580,16 +749,47 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// closeWebSocketClients sends a close frame to every UI connection (used on shutdown)
+func closeWebSocketClients() {
+	wsMutex.Lock()
+	defer wsMutex.Unlock()
+
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "AHCLI shutting down")
+	for client := range wsClients {
+		client.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+		client.Close()
+		delete(wsClients, client)
+	}
+	closeSpectators()
+	logger.Debug("WebSocket clients closed")
+}
+
+// A websocket client that can't take an update within this long is dropped
+const wsWriteTimeout = 2 * time.Second
+
+// broadcaster sends the UI state to websocket clients off the observers'
+// goroutines, so a slow client can't hold up whoever changed the state
+var broadcaster = newCoalescingWorker(writeStateToClients)
+
+// broadcastUpdate schedules sending the current state to every UI client
 func broadcastUpdate() {
+	broadcaster.trigger()
+}
+
+// writeStateToClients sends the current state to the UI and spectator clients
+func writeStateToClients() {
 	webTUI.RLock()
 	state := *webTUI
 	webTUI.RUnlock()
 
+	broadcastSpectators(&state)
+
 	wsMutex.Lock()
 	defer wsMutex.Unlock()
 
 	activeClients := 0
 	for client := range wsClients {
+		client.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
 		if err := client.WriteJSON(state); err != nil {
 			logger.Debug("WebSocket client write failed, removing: %v", err)
 			client.Close()
@@ -602,6 +802,7 @@ func broadcastUpdate() {
 	if activeClients > 0 {
 		logger.Debug("Broadcasted update to %d WebSocket clients", activeClients)
 	}
+	markBroadcast()
 }
 
 // LEGACY WebTUI functions - keeping for backward compatibility during transition
@@ -624,7 +825,7 @@ func WebTUISetChannels(channels []string) {
 	// Observer handles this now, but keeping function for compatibility
 }
 
-func WebTUISetChannelUsers(channelUsers map[string][]string) {
+func WebTUISetChannelUsers(channelUsers map[string][]common.UserInfo) {
 	// Observer handles this now, but keeping function for compatibility
 }
 
@@ -669,9 +870,7 @@ func WebTUISetPTTKey(keyName string) {
 }
 
 // Handle bypass processing toggle
-func handleBypassToggle(args string) {
-	bypass := args == "true"
-
+func handleBypassToggle(bypass bool) {
 	logger.Info("Setting audio processing bypass to: %t", bypass)
 
 	if audioProcessor == nil {
@@ -695,3 +894,15 @@ func handleBypassToggle(args string) {
 
 	logger.Info("Audio processing bypass set to: %t", bypass)
 }
+
+// setMuted mutes or unmutes the microphone (shared by web UI and tray menu)
+func setMuted(muted bool) {
+	logger.Info("Setting microphone mute to: %t", muted)
+	appState.SetMuted(muted)
+
+	if muted {
+		appState.AddMessage("🔇 Microphone muted", "warning")
+	} else {
+		appState.AddMessage("🎤 Microphone unmuted", "success")
+	}
+}
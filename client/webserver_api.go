@@ -0,0 +1,519 @@
+// FILE: client/webserver_api.go
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiError is a failed command: an HTTP status plus a machine-readable code
+type apiError struct {
+	Code    string // "bad_request", "unknown_command", "invalid_args", "not_connected", "forbidden", "failed"
+	Message string
+	status  int
+}
+
+func (e *apiError) Error() string { return e.Message }
+
+// invalidArgs reports a well-formed request whose arguments don't make sense
+func invalidArgs(format string, args ...interface{}) *apiError {
+	return &apiError{Code: "invalid_args", Message: fmt.Sprintf(format, args...), status: http.StatusBadRequest}
+}
+
+// apiResponse is the body of every /api/command reply
+type apiResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Result  any    `json:"result,omitempty"` // Only from query commands
+}
+
+// apiArgsValidator is implemented by arg types that check their own values
+type apiArgsValidator interface {
+	validate() error
+}
+
+// apiHandler decodes a command's raw args and runs it, returning a result for queries
+type apiHandler func(raw json.RawMessage) (any, error)
+
+// Registered web UI commands by name
+var apiCommands = make(map[string]apiHandler)
+
+// Commands only accepted from this machine, like the log endpoint
+var localOnlyCommands = map[string]bool{"rotate_logs": true}
+
+// noArgs is the arg type for commands that take nothing
+type noArgs struct{}
+
+// registerAPICommand adds a command whose args decode into T.
+// Decoding and validation errors come back as invalid_args without reaching the handler.
+func registerAPICommand[T any](name string, handler func(args T) error) {
+	registerAPIQuery(name, func(args T) (any, error) {
+		return nil, handler(args)
+	})
+}
+
+// registerAPIQuery adds a command that also returns a result, sent back as "result"
+func registerAPIQuery[T any](name string, handler func(args T) (any, error)) {
+	apiCommands[name] = func(raw json.RawMessage) (any, error) {
+		var args T
+		if err := decodeAPIArgs(raw, &args); err != nil {
+			return nil, invalidArgs("Invalid args for %s: %v", name, err)
+		}
+		if v, ok := any(&args).(apiArgsValidator); ok {
+			if err := v.validate(); err != nil {
+				return nil, invalidArgs("%v", err)
+			}
+		}
+		return handler(args)
+	}
+}
+
+// decodeAPIArgs decodes command args into target. The UI sends most args as
+// strings ("true", "left", or stringified JSON), so a string is also accepted
+// wherever a bool or object is expected.
+func decodeAPIArgs(raw json.RawMessage, target interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	err := json.Unmarshal(raw, target)
+	if err == nil {
+		return nil
+	}
+
+	var s string
+	if json.Unmarshal(raw, &s) != nil {
+		return err
+	}
+	if s == "" {
+		return nil
+	}
+
+	if b, ok := target.(*bool); ok {
+		v, parseErr := strconv.ParseBool(s)
+		if parseErr != nil {
+			return fmt.Errorf("expected true or false, got %q", s)
+		}
+		*b = v
+		return nil
+	}
+	return json.Unmarshal([]byte(s), target)
+}
+
+// dispatchAPICommand runs a registered command, returning its result (nil for
+// plain commands) or the error
+func dispatchAPICommand(name string, raw json.RawMessage) (any, *apiError) {
+	handler, ok := apiCommands[name]
+	if !ok {
+		return nil, &apiError{Code: "unknown_command", Message: fmt.Sprintf("Unknown command: %s", name), status: http.StatusBadRequest}
+	}
+
+	result, err := handler(raw)
+	if err != nil {
+		var apiErr *apiError
+		if errors.As(err, &apiErr) {
+			return nil, apiErr
+		}
+		return nil, &apiError{Code: "failed", Message: err.Error(), status: http.StatusInternalServerError}
+	}
+	return result, nil
+}
+
+func handleAPICommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		logger.Debug("API command rejected: method %s not allowed", r.Method)
+		writeAPIResponse(w, nil, &apiError{Code: "bad_request", Message: "Method not allowed", status: http.StatusMethodNotAllowed})
+		return
+	}
+
+	var cmd struct {
+		Command string          `json:"command"`
+		Args    json.RawMessage `json:"args"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+		logger.Error("Invalid JSON in API command: %v", err)
+		writeAPIResponse(w, nil, &apiError{Code: "bad_request", Message: "Invalid JSON", status: http.StatusBadRequest})
+		return
+	}
+
+	logger.Info("API command received: %s with args: %s", cmd.Command, cmd.Args)
+
+	if localOnlyCommands[cmd.Command] && !isLocalRequest(r) {
+		logger.Warn("Refused %s from non-local address %s", cmd.Command, r.RemoteAddr)
+		writeAPIResponse(w, nil, &apiError{Code: "forbidden", Message: cmd.Command + " is only available from this machine", status: http.StatusForbidden})
+		return
+	}
+
+	result, apiErr := dispatchAPICommand(cmd.Command, cmd.Args)
+	if apiErr != nil {
+		logger.Error("API command %s failed: %s", cmd.Command, apiErr.Message)
+		appState.AddMessage(apiErr.Message, "error")
+		writeAPIResponse(w, nil, apiErr)
+		return
+	}
+
+	writeAPIResponse(w, result, nil)
+}
+
+// writeAPIResponse sends {"success":true} (with "result" for queries) or
+// {"success":false,"error":...} with a matching status
+func writeAPIResponse(w http.ResponseWriter, result any, apiErr *apiError) {
+	response := apiResponse{Success: true, Result: result}
+	status := http.StatusOK
+	if apiErr != nil {
+		response = apiResponse{Error: apiErr.Message, Code: apiErr.Code}
+		status = apiErr.status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// whenConnected wraps a handler for commands that need a server connection,
+// failing with 503 instead of silently doing nothing while offline
+func whenConnected[T any](handler func(args T) error) func(args T) error {
+	return func(args T) error {
+		if !appState.IsConnected() {
+			return &apiError{Code: "not_connected", Message: "Not connected to a server", status: http.StatusServiceUnavailable}
+		}
+		return handler(args)
+	}
+}
+
+// audioSettingArgs changes one processing parameter from the advanced controls
+type audioSettingArgs struct {
+	Section string      `json:"section"` // noiseGate, compressor, makeupGain, mix
+	Param   string      `json:"param"`
+	Value   interface{} `json:"value"` // bool for "enabled", numeric string for levels
+}
+
+func (a audioSettingArgs) validate() error {
+	switch a.Section {
+	case "noiseGate", "compressor", "makeupGain", "mix":
+	default:
+		return fmt.Errorf("unknown audio section %q", a.Section)
+	}
+	if a.Param == "" {
+		return errors.New("audio setting needs a param")
+	}
+	return nil
+}
+
+// panArgs sets a talker's stereo position. Also accepts the "nickname:position" string form.
+type panArgs struct {
+	Nickname string `json:"nickname"`
+	Position string `json:"position"` // left, center, right
+}
+
+func (p *panArgs) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		nickname, position, _ := strings.Cut(s, ":")
+		p.Nickname, p.Position = nickname, position
+		return nil
+	}
+
+	type plain panArgs
+	return json.Unmarshal(data, (*plain)(p))
+}
+
+func (p panArgs) validate() error {
+	if p.Nickname == "" {
+		return errors.New("usage: set_pan nickname:left|center|right")
+	}
+	_, err := parsePanPosition(p.Position)
+	return err
+}
+
+// statusArgs sets our presence. Also accepts "away" or "away gone to lunch" as a string.
+type statusArgs struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func (s *statusArgs) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		status, message, _ := strings.Cut(strings.TrimSpace(str), " ")
+		s.Status, s.Message = status, strings.TrimSpace(message)
+		return nil
+	}
+
+	type plain statusArgs
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+func (s statusArgs) validate() error {
+	if !common.ValidStatus(s.Status) {
+		return errors.New("usage: set_status online|away|busy [message]")
+	}
+	if len(s.Message) > common.MaxStatusMessageLength {
+		return fmt.Errorf("status message is limited to %d characters", common.MaxStatusMessageLength)
+	}
+	return nil
+}
+
+// targetArgs names a user plus free text (kick reason, role). Also accepts "nickname rest of text".
+type targetArgs struct {
+	Nickname string `json:"nickname"`
+	Text     string `json:"text"`
+}
+
+func (t *targetArgs) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		nickname, text, _ := strings.Cut(strings.TrimSpace(s), " ")
+		t.Nickname, t.Text = nickname, strings.TrimSpace(text)
+		return nil
+	}
+
+	type plain targetArgs
+	return json.Unmarshal(data, (*plain)(t))
+}
+
+func (t targetArgs) validate() error {
+	if t.Nickname == "" {
+		return errors.New("a nickname is required")
+	}
+	return nil
+}
+
+// parseMuteDuration splits an optional leading duration ("10m", "90s" or plain
+// seconds) off a mute reason
+func parseMuteDuration(text string) (time.Duration, string) {
+	first, rest, _ := strings.Cut(text, " ")
+	if d, err := time.ParseDuration(first); err == nil && d > 0 {
+		return d, strings.TrimSpace(rest)
+	}
+	if secs, err := strconv.Atoi(first); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second, strings.TrimSpace(rest)
+	}
+	return 0, text
+}
+
+// Built-in preset names accepted by audio_preset; the config can define more
+var builtinAudioPresets = map[string]bool{"off": true, "light": true, "balanced": true, "aggressive": true, "custom": true}
+
+// registerAPICommands sets up every command the web UI can send
+func registerAPICommands() {
+	registerAPICommand("join", whenConnected(func(channel string) error {
+		if channel == "" {
+			return invalidArgs("Channel name required")
+		}
+		changeChannel(channel)
+		appState.AddMessage(fmt.Sprintf("Joining channel: %s", channel), "info")
+		return nil
+	}))
+
+	// Hear another channel's audio without leaving ours; the arg is the channel
+	registerAPICommand("monitor", whenConnected(func(channel string) error {
+		if channel = strings.TrimPrefix(strings.TrimSpace(channel), "#"); channel == "" {
+			return invalidArgs("usage: monitor channel")
+		}
+		return sendMonitorChannel(channel, true)
+	}))
+
+	registerAPICommand("unmonitor", whenConnected(func(channel string) error {
+		if channel = strings.TrimPrefix(strings.TrimSpace(channel), "#"); channel == "" {
+			return invalidArgs("usage: unmonitor channel")
+		}
+		return sendMonitorChannel(channel, false)
+	}))
+
+	registerAPICommand("quit", func(noArgs) error {
+		logger.Info("Quit command received from web interface")
+		appState.AddMessage("Disconnecting...", "info")
+		// Could trigger graceful shutdown here
+		return nil
+	})
+
+	registerAPICommand("audio_preset", func(preset string) error {
+		if !isAudioPreset(currentConfig, preset) {
+			return invalidArgs("Unknown audio preset: %s", preset)
+		}
+		handleAudioPreset(preset)
+		return nil
+	})
+
+	// Current settings as a shareable preset; the optional arg names it
+	registerAPIQuery("export_preset", func(name string) (any, error) {
+		return exportPreset(strings.TrimSpace(name))
+	})
+
+	// A preset from export_preset, as an object or a JSON string
+	registerAPICommand("import_preset", func(preset sharedPreset) error {
+		return importPreset(preset)
+	})
+
+	registerAPICommand("audio_setting", func(setting audioSettingArgs) error {
+		handleAudioSetting(setting)
+		return nil
+	})
+
+	registerAPICommand("bypass_processing", func(bypass bool) error {
+		handleBypassToggle(bypass)
+		return nil
+	})
+
+	registerAPICommand("mute", func(muted bool) error {
+		setMuted(muted)
+		return nil
+	})
+
+	registerAPICommand("panic", func(noArgs) error {
+		toggleAudioPanic()
+		return nil
+	})
+
+	registerAPICommand("stereo", func(stereo bool) error {
+		setStereoOutput(stereo)
+		return nil
+	})
+
+	registerAPICommand("low_data", func(enabled bool) error {
+		setLowDataMode(enabled)
+		return nil
+	})
+
+	registerAPICommand("set_pan", func(pan panArgs) error {
+		setUserPan(pan.Nickname, pan.Position)
+		return nil
+	})
+
+	// Per-server filter on whose audio we hear; the arg is a nickname
+	for _, action := range []string{"allow", "block", "remove"} {
+		registerAPICommand("listen_"+action, func(nickname string) error {
+			nickname = strings.TrimSpace(nickname)
+			if nickname == "" {
+				return invalidArgs("usage: listen_%s nickname", action)
+			}
+			return updateListenFilter(action, nickname)
+		})
+	}
+
+	registerAPICommand("listen_clear", func(noArgs) error {
+		return updateListenFilter("clear", "")
+	})
+
+	registerAPICommand("test_microphone", func(noArgs) error {
+		handleTestMicrophone()
+		return nil
+	})
+
+	// Plays a chime locally to check the speakers, independent of the connection
+	registerAPICommand("test_output", func(noArgs) error {
+		if err := playOutputTest(); err != nil {
+			return err
+		}
+		appState.AddMessage("🔊 Playing test tone - you should hear a short chime", "info")
+		return nil
+	})
+
+	// Session recording; record_start takes "true"/"false" for our own voice,
+	// empty for recording.include_own_voice
+	registerAPICommand("record_start", func(ownVoice string) error {
+		include := currentConfig != nil && currentConfig.Recording.IncludeOwnVoice
+		if ownVoice != "" {
+			v, err := strconv.ParseBool(ownVoice)
+			if err != nil {
+				return invalidArgs("usage: record_start [true|false]")
+			}
+			include = v
+		}
+		return startRecording(include)
+	})
+
+	registerAPICommand("record_stop", func(noArgs) error {
+		return stopRecording()
+	})
+
+	registerAPICommand("rescan_audio", func(noArgs) error {
+		go func() {
+			if err := rescanAudioDevices(); err != nil {
+				appState.AddMessage(fmt.Sprintf("Audio rescan failed: %v", err), "error")
+			}
+		}()
+		return nil
+	})
+
+	registerAPICommand("rotate_logs", func(noArgs) error {
+		return rotateLogs()
+	})
+
+	registerAPICommand("save_custom_preset", func(noArgs) error {
+		handleSaveCustomPreset()
+		return nil
+	})
+
+	// Works offline too - messages are queued and sent on reconnect
+	registerAPICommand("chat", func(message string) error {
+		if strings.TrimSpace(message) == "" {
+			return invalidArgs("Chat message is empty")
+		}
+		handleChatCommand(message)
+		return nil
+	})
+
+	registerAPICommand("set_status", whenConnected(func(status statusArgs) error {
+		return sendStatus(status.Status, status.Message)
+	}))
+
+	// Moderation; the server checks our role and answers with moderation_ack or an error
+	registerAPICommand("kick", whenConnected(func(target targetArgs) error {
+		return sendKick(target.Nickname, target.Text)
+	}))
+
+	// "nickname [duration] [reason]", e.g. "bob 10m spamming"; no duration mutes until unmuted
+	registerAPICommand("mute_user", whenConnected(func(target targetArgs) error {
+		duration, reason := parseMuteDuration(target.Text)
+		return sendMuteUser(target.Nickname, true, duration, reason)
+	}))
+
+	registerAPICommand("unmute_user", whenConnected(func(target targetArgs) error {
+		return sendMuteUser(target.Nickname, false, 0, "")
+	}))
+
+	// Target is a nickname or an IP address
+	registerAPICommand("ban", whenConnected(func(target targetArgs) error {
+		return sendBan(true, target.Nickname, target.Text)
+	}))
+
+	registerAPICommand("unban", whenConnected(func(target targetArgs) error {
+		return sendBan(false, target.Nickname, "")
+	}))
+
+	// Uptime and usage counters; the server answers admins only
+	registerAPICommand("server_stats", whenConnected(func(noArgs) error {
+		return sendStatsRequest()
+	}))
+
+	// Topic of the current channel; empty clears it
+	registerAPICommand("set_topic", whenConnected(func(topic string) error {
+		return sendSetTopic(currentChannel, strings.TrimSpace(topic))
+	}))
+
+	registerAPICommand("set_role", whenConnected(func(target targetArgs) error {
+		if !common.ValidRole(target.Text) {
+			return invalidArgs("usage: set_role nickname admin|moderator|user")
+		}
+		return sendSetRole(target.Nickname, target.Text)
+	}))
+
+	// Debounced by the UI while the user is composing
+	registerAPICommand("typing", whenConnected(func(noArgs) error {
+		sendTyping()
+		return nil
+	}))
+
+	logger.Debug("Registered %d API commands", len(apiCommands))
+}
@@ -8,12 +8,13 @@ import (
 	"syscall"
 )
 
-// Consolidated Windows API declarations - used by ptt.go, tray.go, and main.go
+// Consolidated Windows API declarations - used by ptt.go, joystick.go, tray.go, and main.go
 var (
 	// DLLs
 	user32   = syscall.NewLazyDLL("user32.dll")
 	shell32  = syscall.NewLazyDLL("shell32.dll")
 	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+	winmm    = syscall.NewLazyDLL("winmm.dll")
 
 	// User32 functions
 	procGetKeyState     = user32.NewProc("GetAsyncKeyState")
@@ -33,11 +34,17 @@ var (
 	loadIcon            = user32.NewProc("LoadIconW")
 	loadImage           = user32.NewProc("LoadImageW")
 
+	registerDeviceNotification = user32.NewProc("RegisterDeviceNotificationW")
+
 	// Shell32 functions
 	shellNotifyIcon = shell32.NewProc("Shell_NotifyIconW")
 
 	// Kernel32 functions
 	getModuleHandle = kernel32.NewProc("GetModuleHandleW")
+	attachConsole   = kernel32.NewProc("AttachConsole")
+
+	// Winmm functions
+	joyGetPosEx = winmm.NewProc("joyGetPosEx")
 )
 
 // Windows constants
@@ -48,6 +55,13 @@ const (
 	WM_LBUTTONUP = 0x0202
 	WM_RBUTTONUP = 0x0205
 
+	// Device change notifications
+	WM_DEVICECHANGE             = 0x0219
+	DBT_DEVICEARRIVAL           = 0x8000
+	DBT_DEVICEREMOVECOMPLETE    = 0x8004
+	DBT_DEVTYP_DEVICEINTERFACE  = 5
+	DEVICE_NOTIFY_WINDOW_HANDLE = 0
+
 	// Tray icon operations
 	NIM_ADD    = 0
 	NIM_MODIFY = 1
@@ -63,6 +77,9 @@ const (
 
 	// LoadImage flags
 	LR_LOADFROMFILE = 0x10
+
+	// AttachConsole target: the console of whoever started us
+	ATTACH_PARENT_PROCESS = 0xFFFFFFFF
 )
 
 // Windows structures
@@ -108,6 +125,24 @@ type NOTIFYICONDATA struct {
 	HBalloonIcon     uintptr
 }
 
+type GUID struct {
+	Data1 uint32
+	Data2 uint16
+	Data3 uint16
+	Data4 [8]byte
+}
+
+// KSCATEGORY_AUDIO - every audio endpoint's device interface class
+var KSCATEGORY_AUDIO = GUID{0x6994AD04, 0x93EF, 0x11D0, [8]byte{0xA3, 0xCC, 0x00, 0xA0, 0xC9, 0x22, 0x31, 0x96}}
+
+type DEV_BROADCAST_DEVICEINTERFACE struct {
+	DbccSize       uint32
+	DbccDeviceType uint32
+	DbccReserved   uint32
+	DbccClassGuid  GUID
+	DbccName       [1]uint16
+}
+
 type POINT struct {
 	X, Y int32
 }
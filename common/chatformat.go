@@ -0,0 +1,199 @@
+package common
+
+import "strings"
+
+// Segment types produced by ParseChatSegments
+const (
+	SegmentText   = "text"
+	SegmentBold   = "bold"
+	SegmentItalic = "italic"
+	SegmentCode   = "code"
+)
+
+// ChatSegment is one styled span of a chat message. The raw message is always
+// kept alongside, so clients that don't render segments lose nothing.
+type ChatSegment struct {
+	Type string `json:"type"` // "text", "bold", "italic", "code"
+	Text string `json:"text"`
+}
+
+// emojiShortcodes maps :name: shortcodes to Unicode emoji
+var emojiShortcodes = map[string]string{
+	"smile":        "😄",
+	"grin":         "😁",
+	"joy":          "😂",
+	"laughing":     "😆",
+	"wink":         "😉",
+	"blush":        "😊",
+	"heart_eyes":   "😍",
+	"thinking":     "🤔",
+	"neutral_face": "😐",
+	"sweat_smile":  "😅",
+	"cry":          "😢",
+	"sob":          "😭",
+	"angry":        "😠",
+	"rage":         "😡",
+	"scream":       "😱",
+	"sunglasses":   "😎",
+	"sleeping":     "😴",
+	"skull":        "💀",
+	"thumbsup":     "👍",
+	"+1":           "👍",
+	"thumbsdown":   "👎",
+	"-1":           "👎",
+	"clap":         "👏",
+	"wave":         "👋",
+	"pray":         "🙏",
+	"muscle":       "💪",
+	"eyes":         "👀",
+	"ok_hand":      "👌",
+	"heart":        "❤️",
+	"broken_heart": "💔",
+	"fire":         "🔥",
+	"100":          "💯",
+	"tada":         "🎉",
+	"star":         "⭐",
+	"sparkles":     "✨",
+	"rocket":       "🚀",
+	"warning":      "⚠️",
+	"check":        "✅",
+	"x":            "❌",
+	"question":     "❓",
+	"zzz":          "💤",
+	"coffee":       "☕",
+	"beer":         "🍺",
+	"pizza":        "🍕",
+	"headphones":   "🎧",
+	"microphone":   "🎤",
+	"mute":         "🔇",
+	"speaker":      "🔊",
+	"gg":           "🎮",
+}
+
+// ExpandShortcodes replaces known :name: shortcodes with emoji. Unknown
+// shortcodes are left untouched.
+func ExpandShortcodes(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(s, ':')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start+1:], ':')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+
+		if emoji, ok := emojiShortcodes[s[start+1:end]]; ok {
+			b.WriteString(s[:start])
+			b.WriteString(emoji)
+			s = s[end+1:]
+		} else {
+			// The closing colon may open the next shortcode ("a:b:smile:")
+			b.WriteString(s[:end])
+			s = s[end:]
+		}
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// ParseChatSegments splits a chat message into text, **bold**, *italic*
+// (or _italic_) and `code` spans. Spans don't nest and unmatched markers stay
+// literal. When expandEmoji is set, shortcodes are expanded in every span
+// except code.
+func ParseChatSegments(msg string, expandEmoji bool) []ChatSegment {
+	var segments []ChatSegment
+	var text strings.Builder
+
+	flushText := func() {
+		if text.Len() > 0 {
+			segments = append(segments, ChatSegment{Type: SegmentText, Text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(msg); {
+		if kind, marker := openingMarker(msg, i); kind != "" {
+			contentStart := i + len(marker)
+			if end := closingMarker(msg, contentStart, marker); end >= 0 {
+				flushText()
+				segments = append(segments, ChatSegment{Type: kind, Text: msg[contentStart:end]})
+				i = end + len(marker)
+				continue
+			}
+		}
+		text.WriteByte(msg[i])
+		i++
+	}
+	flushText()
+
+	if expandEmoji {
+		for i := range segments {
+			if segments[i].Type != SegmentCode {
+				segments[i].Text = ExpandShortcodes(segments[i].Text)
+			}
+		}
+	}
+	return segments
+}
+
+// openingMarker reports the span type and marker starting at msg[i], if any
+func openingMarker(msg string, i int) (string, string) {
+	var kind, marker string
+	switch {
+	case msg[i] == '`':
+		return SegmentCode, "`"
+	case strings.HasPrefix(msg[i:], "**"):
+		kind, marker = SegmentBold, "**"
+	case msg[i] == '*':
+		kind, marker = SegmentItalic, "*"
+	case msg[i] == '_':
+		// snake_case words are not emphasis
+		if i > 0 && isWordByte(msg[i-1]) {
+			return "", ""
+		}
+		kind, marker = SegmentItalic, "_"
+	default:
+		return "", ""
+	}
+
+	// "2 * 3" is not emphasis - content must hug the marker
+	next := i + len(marker)
+	if next >= len(msg) || msg[next] == ' ' {
+		return "", ""
+	}
+	return kind, marker
+}
+
+// closingMarker finds the end of a span opened with marker, or -1
+func closingMarker(msg string, from int, marker string) int {
+	if marker == "`" {
+		end := strings.IndexByte(msg[from:], '`')
+		if end <= 0 {
+			return -1 // No close, or empty span
+		}
+		return from + end
+	}
+
+	for j := from + 1; j+len(marker) <= len(msg); j++ {
+		if msg[j:j+len(marker)] != marker || msg[j-1] == ' ' {
+			continue
+		}
+		after := j + len(marker)
+		if marker == "*" && after < len(msg) && msg[after] == '*' {
+			continue // Part of a bold marker
+		}
+		if marker == "_" && after < len(msg) && isWordByte(msg[after]) {
+			continue // Intraword underscore
+		}
+		return j
+	}
+	return -1
+}
+
+// isWordByte treats ASCII letters/digits and any non-ASCII byte as word characters
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b >= 0x80
+}
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandShortcodes(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"hello :smile:", "hello 😄"},
+		{":thumbsup::fire:", "👍🔥"},
+		{"unknown :notanemoji: stays", "unknown :notanemoji: stays"},
+		{"a:b:smile:", "a:b😄"},
+		{"time 10:30", "time 10:30"},
+		{"trailing colon:", "trailing colon:"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ExpandShortcodes(tt.in); got != tt.want {
+			t.Errorf("ExpandShortcodes(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseChatSegments(t *testing.T) {
+	text := func(s string) ChatSegment { return ChatSegment{Type: SegmentText, Text: s} }
+	bold := func(s string) ChatSegment { return ChatSegment{Type: SegmentBold, Text: s} }
+	italic := func(s string) ChatSegment { return ChatSegment{Type: SegmentItalic, Text: s} }
+	code := func(s string) ChatSegment { return ChatSegment{Type: SegmentCode, Text: s} }
+
+	tests := []struct {
+		name  string
+		in    string
+		emoji bool
+		want  []ChatSegment
+	}{
+		{"plain", "just text", false, []ChatSegment{text("just text")}},
+		{"bold", "this is **loud** ok", false, []ChatSegment{text("this is "), bold("loud"), text(" ok")}},
+		{"italic star", "*soft*", false, []ChatSegment{italic("soft")}},
+		{"italic underscore", "so _very_ nice", false, []ChatSegment{text("so "), italic("very"), text(" nice")}},
+		{"code", "run `go test`", false, []ChatSegment{text("run "), code("go test")}},
+		{"code keeps markers", "`**not bold**`", false, []ChatSegment{code("**not bold**")}},
+		{"mixed", "**a** *b* `c`", false, []ChatSegment{bold("a"), text(" "), italic("b"), text(" "), code("c")}},
+		{"snake case", "my_var_name is fine", false, []ChatSegment{text("my_var_name is fine")}},
+		{"spaced stars", "2 * 3 * 4", false, []ChatSegment{text("2 * 3 * 4")}},
+		{"unmatched", "**open and `tick", false, []ChatSegment{text("**open and `tick")}},
+		{"empty code", "``", false, []ChatSegment{text("``")}},
+		{"emoji in text and bold", ":fire: **:tada:**", true, []ChatSegment{text("🔥 "), bold("🎉")}},
+		{"no emoji in code", "`:smile:`", true, []ChatSegment{code(":smile:")}},
+		{"emoji disabled", ":smile:", false, []ChatSegment{text(":smile:")}},
+		{"empty", "", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseChatSegments(tt.in, tt.emoji)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseChatSegments(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
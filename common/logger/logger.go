@@ -2,7 +2,9 @@
 package logger
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
@@ -37,6 +39,10 @@ type Logger struct {
 	logFile    *os.File
 	fileLogger *log.Logger
 	debugMode  bool
+	quiet      bool // No console output, e.g. for one-shot CLI runs
+
+	// Last warnings and errors, for diagnostics reports
+	recent []string
 
 	// Console colors
 	colors map[int]string
@@ -85,39 +91,122 @@ func SetDebugMode(enabled bool) {
 	}
 }
 
+// SetConsoleOutput turns console logging on or off; the log file is unaffected
+func SetConsoleOutput(enabled bool) {
+	if globalLogger != nil {
+		globalLogger.mu.Lock()
+		globalLogger.quiet = !enabled
+		globalLogger.mu.Unlock()
+	}
+}
+
 // GetLogPath returns the current log file path
 func GetLogPath() string {
-	if globalLogger != nil && globalLogger.logFile != nil {
+	if globalLogger == nil {
+		return ""
+	}
+	globalLogger.mu.RLock()
+	defer globalLogger.mu.RUnlock()
+	if globalLogger.logFile != nil {
 		return globalLogger.logFile.Name()
 	}
 	return ""
 }
 
+// Tail returns up to maxBytes from the end of the current log file, starting
+// at a line boundary when it had to cut
+func Tail(maxBytes int64) ([]byte, error) {
+	if globalLogger == nil {
+		return nil, fmt.Errorf("logger not initialized")
+	}
+
+	// Holding the lock keeps writes and rotation out while we read
+	globalLogger.mu.RLock()
+	defer globalLogger.mu.RUnlock()
+	if globalLogger.logFile == nil {
+		return nil, fmt.Errorf("logger not initialized")
+	}
+
+	file, err := os.Open(globalLogger.logFile.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := max(info.Size()-maxBytes, 0)
+	data := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if offset > 0 {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	return data, nil
+}
+
 // Elite auto-context logging functions - zero manual typing required
 func Fatal(format string, args ...interface{}) {
 	component := getComponent()
-	logWithLevel(FATAL, component, format, args...)
+	logWithLevel(FATAL, component, "", format, args...)
 	os.Exit(1)
 }
 
 func Error(format string, args ...interface{}) {
 	component := getComponent()
-	logWithLevel(ERROR, component, format, args...)
+	logWithLevel(ERROR, component, "", format, args...)
 }
 
 func Warn(format string, args ...interface{}) {
 	component := getComponent()
-	logWithLevel(WARN, component, format, args...)
+	logWithLevel(WARN, component, "", format, args...)
 }
 
 func Info(format string, args ...interface{}) {
 	component := getComponent()
-	logWithLevel(INFO, component, format, args...)
+	logWithLevel(INFO, component, "", format, args...)
 }
 
 func Debug(format string, args ...interface{}) {
 	component := getComponent()
-	logWithLevel(DEBUG, component, format, args...)
+	logWithLevel(DEBUG, component, "", format, args...)
+}
+
+// Context tags log lines with a field, such as a client's session ID, so one
+// client's lines can be picked out of a busy log. The zero value adds nothing.
+type Context struct {
+	field string
+}
+
+// With returns a Context whose lines carry field, e.g. "sess=3f9a1c"
+func With(field string) Context {
+	return Context{field: field}
+}
+
+func (c Context) Error(format string, args ...interface{}) {
+	component := getComponent()
+	logWithLevel(ERROR, component, c.field, format, args...)
+}
+
+func (c Context) Warn(format string, args ...interface{}) {
+	component := getComponent()
+	logWithLevel(WARN, component, c.field, format, args...)
+}
+
+func (c Context) Info(format string, args ...interface{}) {
+	component := getComponent()
+	logWithLevel(INFO, component, c.field, format, args...)
+}
+
+func (c Context) Debug(format string, args ...interface{}) {
+	component := getComponent()
+	logWithLevel(DEBUG, component, c.field, format, args...)
 }
 
 // Elite runtime call stack detection with performance caching
@@ -171,8 +260,9 @@ func mapFileToComponent(file string) string {
 	}
 }
 
-// logWithLevel handles the actual logging logic
-func logWithLevel(level int, component, format string, args ...interface{}) {
+// logWithLevel handles the actual logging logic. A non-empty field is shown
+// in brackets before the message.
+func logWithLevel(level int, component, field, format string, args ...interface{}) {
 	if globalLogger == nil {
 		// Fallback to console if logger not initialized
 		fmt.Printf("[UNINITIALIZED] "+format+"\n", args...)
@@ -191,30 +281,40 @@ func logWithLevel(level int, component, format string, args ...interface{}) {
 	}
 
 	message := fmt.Sprintf(format, args...)
+	if field != "" {
+		message = "[" + field + "] " + message
+	}
 
 	// Always log to file
 	globalLogger.logToFile(level, component, message)
 
+	if level <= WARN {
+		globalLogger.remember(level, component, message)
+	}
+
 	// Log to console for important messages (INFO and above)
-	if level <= INFO {
+	globalLogger.mu.RLock()
+	quiet := globalLogger.quiet
+	globalLogger.mu.RUnlock()
+	if level <= INFO && !quiet {
 		globalLogger.logToConsole(level, component, message)
 	}
 }
 
 // logToFile writes structured logs to the file
 func (l *Logger) logToFile(level int, component, message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if l.fileLogger == nil {
 		return
 	}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
-
 	// Get timestamp and level
 	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
 	levelStr := getLevelString(level)
 
 	// Elite format: 2025-01-08 15:04:05.123 [INFO ] [AUDIO] message
+	// or, with a context field: ... [SERVER] [sess=3f9a1c] message
 	var logLine string
 	if component != "" {
 		logLine = fmt.Sprintf("%s [%-5s] [%s] %s", timestamp, levelStr, component, message)
@@ -225,6 +325,32 @@ func (l *Logger) logToFile(level int, component, message string) {
 	l.fileLogger.Println(logLine)
 }
 
+// How many warnings and errors RecentProblems keeps
+const recentProblemLines = 20
+
+// remember keeps a warning or error for RecentProblems, dropping the oldest
+func (l *Logger) remember(level int, component, message string) {
+	line := fmt.Sprintf("%s [%s] [%s] %s", time.Now().Format("15:04:05"), getLevelString(level), component, message)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.recent) == recentProblemLines {
+		copy(l.recent, l.recent[1:])
+		l.recent = l.recent[:recentProblemLines-1]
+	}
+	l.recent = append(l.recent, line)
+}
+
+// RecentProblems returns the latest warnings and errors, oldest first
+func RecentProblems() []string {
+	if globalLogger == nil {
+		return nil
+	}
+	globalLogger.mu.RLock()
+	defer globalLogger.mu.RUnlock()
+	return append([]string(nil), globalLogger.recent...)
+}
+
 // logToConsole writes colored logs to the console
 func (l *Logger) logToConsole(level int, component, message string) {
 	timestamp := time.Now().Format("15:04:05")
@@ -268,14 +394,18 @@ func Close() {
 	}
 }
 
-// Rotate rotates the current log file (for future log rotation feature)
-func Rotate() error {
-	if globalLogger == nil || globalLogger.logFile == nil {
-		return fmt.Errorf("logger not initialized")
+// Rotate renames the current log file with a timestamp and starts a fresh
+// one, returning the old file's new name
+func Rotate() (string, error) {
+	if globalLogger == nil {
+		return "", fmt.Errorf("logger not initialized")
 	}
 
 	globalLogger.mu.Lock()
-	defer globalLogger.mu.Unlock()
+	if globalLogger.logFile == nil {
+		globalLogger.mu.Unlock()
+		return "", fmt.Errorf("logger not initialized")
+	}
 
 	// Close current file
 	oldFileName := globalLogger.logFile.Name()
@@ -284,17 +414,27 @@ func Rotate() error {
 	// Rename current log with timestamp
 	timestamp := time.Now().Format("20060102-150405")
 	backupName := fmt.Sprintf("%s.%s", oldFileName, timestamp)
-	os.Rename(oldFileName, backupName)
+	renameErr := os.Rename(oldFileName, backupName)
 
 	// Create new log file
 	newFile, err := os.OpenFile(oldFileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
-		return fmt.Errorf("failed to create new log file: %v", err)
+		// Nowhere left to write; logToFile skips a nil fileLogger
+		globalLogger.logFile = nil
+		globalLogger.fileLogger = nil
+		globalLogger.mu.Unlock()
+		return "", fmt.Errorf("failed to create new log file: %v", err)
 	}
 
 	globalLogger.logFile = newFile
 	globalLogger.fileLogger = log.New(newFile, "", 0)
+	globalLogger.mu.Unlock()
 
-	globalLogger.logToFile(INFO, "SYSTEM", "Log file rotated")
-	return nil
+	// logToFile takes the lock itself
+	if renameErr != nil {
+		globalLogger.logToFile(WARN, "SYSTEM", fmt.Sprintf("Log rotation could not rename %s: %v", oldFileName, renameErr))
+		return "", fmt.Errorf("failed to rename log file: %v", renameErr)
+	}
+	globalLogger.logToFile(INFO, "SYSTEM", "Log file rotated, previous log saved as "+backupName)
+	return backupName, nil
 }
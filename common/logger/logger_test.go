@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTailAndRotate(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := Init("test"); err != nil {
+		t.Fatal(err)
+	}
+	SetConsoleOutput(false)
+
+	for i := 0; i < 100; i++ {
+		Info("line %03d with some padding to make it longer", i)
+	}
+
+	tail, err := Tail(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tail) > 200 {
+		t.Errorf("tail is %d bytes, want at most 200", len(tail))
+	}
+	if !strings.Contains(string(tail), "line 099") {
+		t.Errorf("tail should end with the latest line, got %q", tail)
+	}
+	if strings.Contains(string(tail), "line 000") {
+		t.Error("tail should not reach the start of the file")
+	}
+	if !strings.HasPrefix(string(tail), "20") {
+		t.Errorf("tail should start at a line boundary, got %q", tail[:20])
+	}
+
+	backup, err := Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := os.ReadFile(backup)
+	if err != nil || !strings.Contains(string(old), "line 099") {
+		t.Fatalf("rotated log should keep the old lines (err %v)", err)
+	}
+
+	// Logging keeps working into the fresh file
+	Info("after rotation")
+	tail, err = Tail(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(tail), "line 099") || !strings.Contains(string(tail), "after rotation") {
+		t.Errorf("new log should hold only lines since rotation, got %q", tail)
+	}
+	Close()
+}
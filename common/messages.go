@@ -0,0 +1,136 @@
+package common
+
+import "time"
+
+// Wire formats of the control messages both sides build and parse. Type is
+// always the matching Msg* constant.
+
+// CryptoHandshake starts the chat key exchange (client -> server)
+type CryptoHandshake struct {
+	Type      string `json:"type"`
+	PublicKey string `json:"public_key"`        // base64 X25519 public key
+	Ratchet   bool   `json:"ratchet,omitempty"` // Client wants per-message ratchet keys
+}
+
+// CryptoHandshakeResponse completes the key exchange (server -> client)
+type CryptoHandshakeResponse struct {
+	Type      string `json:"type"`
+	Status    string `json:"status"` // "success" or "error"
+	PublicKey string `json:"public_key,omitempty"`
+	Ratchet   bool   `json:"ratchet,omitempty"` // Server agreed to the ratchet
+	Error     string `json:"error,omitempty"`
+}
+
+// ChangeChannel asks to move to another channel (client -> server)
+type ChangeChannel struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+}
+
+// ChannelChanged confirms a channel switch (server -> client). Topic is always
+// present, empty when the channel has none; servers before topics leave it out.
+type ChannelChanged struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	Topic   string `json:"topic"`
+}
+
+// MonitorChannel starts or stops hearing another channel's audio besides our
+// own, without joining it (client -> server)
+type MonitorChannel struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	Monitor bool   `json:"monitor"` // false stops monitoring
+}
+
+// Monitoring lists the channels a client now monitors, answering
+// monitor_channel (server -> client)
+type Monitoring struct {
+	Type     string   `json:"type"`
+	Channels []string `json:"channels"`
+	Max      int      `json:"max"` // How many the server allows at once
+}
+
+// Chat is a plaintext chat message from a client
+type Chat struct {
+	Type     string `json:"type"`
+	Channel  string `json:"channel"`
+	Message  string `json:"message"`
+	Username string `json:"username"`
+	MsgID    string `json:"msg_id,omitempty"` // Client-generated ID for ack and dedup
+}
+
+// ChatMessage is a plaintext chat message relayed to a channel (server -> client)
+type ChatMessage struct {
+	Type      string `json:"type"`
+	GUID      string `json:"guid"`
+	Channel   string `json:"channel"`
+	Username  string `json:"username"`
+	Message   string `json:"message"`
+	Timestamp string `json:"timestamp"` // RFC3339 UTC
+}
+
+// EncryptedChat carries a sealed chat message in either direction. From the
+// client only Channel, Payload and MsgID are set; the server fills in the
+// sender and timestamp when relaying.
+type EncryptedChat struct {
+	Type      string `json:"type"`
+	GUID      string `json:"guid,omitempty"`
+	Channel   string `json:"channel"`
+	Username  string `json:"username,omitempty"`
+	Encrypted bool   `json:"encrypted"`
+	Payload   string `json:"payload"` // base64 sealed message
+	MsgID     string `json:"msg_id,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"` // RFC3339 UTC
+}
+
+// ChatRecord is one stored chat message, as kept by the server and sent in history
+type ChatRecord struct {
+	GUID      string    `json:"guid"`      // Channel GUID for routing
+	Channel   string    `json:"channel"`   // Human-readable channel name
+	Username  string    `json:"username"`  // User who sent the message
+	Message   string    `json:"message"`   // The actual message content
+	Timestamp time.Time `json:"timestamp"` // When the message was sent
+}
+
+// ChatHistory is a channel's recent messages, sent on joining it (server -> client)
+type ChatHistory struct {
+	Type     string       `json:"type"`
+	GUID     string       `json:"guid"`
+	Channel  string       `json:"channel"`
+	Messages []ChatRecord `json:"messages"`
+}
+
+// ChatAck confirms a chat message was delivered (server -> client)
+type ChatAck struct {
+	Type  string `json:"type"`
+	MsgID string `json:"msg_id"`
+}
+
+// ServerStats is the server's usage since it started, answering an admin's
+// stats query (server -> client)
+type ServerStats struct {
+	Type         string `json:"type"`
+	StartedAt    string `json:"started_at"` // RFC3339 UTC
+	UptimeSec    int64  `json:"uptime_sec"`
+	Connections  uint64 `json:"connections"` // Connects accepted
+	Users        int    `json:"users"`       // Connected now
+	PeakUsers    int    `json:"peak_users"`
+	AudioRelayed uint64 `json:"audio_relayed"` // Audio packets forwarded
+	ChatRelayed  uint64 `json:"chat_relayed"`  // Chat messages broadcast
+	BytesRelayed uint64 `json:"bytes_relayed"` // Audio and chat bytes sent to recipients
+}
+
+// ServerShutdown warns every client that the server is stopping (server -> client)
+type ServerShutdown struct {
+	Type          string `json:"type"`
+	Message       string `json:"message"`
+	RetryAfterSec int    `json:"retry_after_sec"` // Don't try to reconnect sooner than this
+}
+
+// ErrorMessage reports a refused request (server -> client)
+type ErrorMessage struct {
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"` // A common.Code* value
+	Message string `json:"message"`
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessageWireFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		msg  any
+		want string
+	}{
+		{
+			"client encrypted chat leaves out relay fields",
+			EncryptedChat{Type: MsgEncryptedChat, Channel: "General", Encrypted: true, Payload: "AAAA", MsgID: "m1"},
+			`{"type":"encrypted_chat","channel":"General","encrypted":true,"payload":"AAAA","msg_id":"m1"}`,
+		},
+		{
+			"empty topic is still sent so clients can clear it",
+			ChannelChanged{Type: MsgChannelChanged, Channel: "AFK"},
+			`{"type":"channel_changed","channel":"AFK","topic":""}`,
+		},
+		{
+			"failed handshake carries no key",
+			CryptoHandshakeResponse{Type: MsgCryptoHandshakeResponse, Status: "error", Error: "Handshake failed"},
+			`{"type":"crypto_handshake_response","status":"error","error":"Handshake failed"}`,
+		},
+		{
+			"older clients without msg_id",
+			Chat{Type: MsgChat, Channel: "General", Message: "hi", Username: "alice"},
+			`{"type":"chat","channel":"General","message":"hi","username":"alice"}`,
+		},
+	} {
+		data, err := json.Marshal(tc.msg)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if string(data) != tc.want {
+			t.Errorf("%s:\n got %s\nwant %s", tc.name, data, tc.want)
+		}
+	}
+}
+
+func TestChatHistoryRoundTrip(t *testing.T) {
+	in := ChatHistory{
+		Type:    MsgChatHistory,
+		GUID:    "g1",
+		Channel: "General",
+		Messages: []ChatRecord{
+			{GUID: "g1", Channel: "General", Username: "alice", Message: "hi", Timestamp: time.Date(2025, 1, 8, 15, 4, 5, 0, time.UTC)},
+		},
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out ChatHistory
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
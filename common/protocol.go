@@ -1,20 +1,443 @@
 package common
 
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Largest datagram either side reads. Fits a 60ms audio frame (2880 samples).
+const MaxPacketSize = 8192
+
+// Audio frame size in milliseconds of 48kHz mono per packet. The server picks
+// one for everyone so relayed packets always match the receivers' expectations.
+const DefaultFrameSizeMs = 20
+
+// AudioSampleRate is the rate of the 16-bit mono PCM in audio packets
+const AudioSampleRate = 48000
+
+// AudioPacketSize is the length of an untagged audio packet, prefix(2) seq(2)
+// plus one frame of PCM, for a frame size in milliseconds
+func AudioPacketSize(frameSizeMs int) int {
+	return 4 + 2*AudioSampleRate*frameSizeMs/1000
+}
+
+// Audio packets may coalesce up to MaxFramesPerPacket consecutive frames,
+// as long as together they are no longer than MaxPacketMs and so fit in
+// MaxPacketSize. Frame i of a packet has sequence number seq+i.
+const (
+	MaxFramesPerPacket = 3
+	MaxPacketMs        = 60
+)
+
+// FramesPerPacketLimit returns how many frames of frameSizeMs one packet may carry
+func FramesPerPacketLimit(frameSizeMs int) int {
+	if frameSizeMs <= 0 {
+		return 1
+	}
+	return max(1, min(MaxFramesPerPacket, MaxPacketMs/frameSizeMs))
+}
+
+// AudioFrameCount returns how many frames an audio payload (the PCM after the
+// header) carries, or 0 if it isn't a whole number of frames within the limit
+func AudioFrameCount(payloadBytes, frameSizeMs int) int {
+	frameBytes := AudioPacketSize(frameSizeMs) - 4
+	if frameBytes <= 0 || payloadBytes <= 0 || payloadBytes%frameBytes != 0 {
+		return 0
+	}
+	frames := payloadBytes / frameBytes
+	if frames > FramesPerPacketLimit(frameSizeMs) {
+		return 0
+	}
+	return frames
+}
+
+// SplitAudioPacket turns a packet of several frames into one packet per frame,
+// each with a copy of the header (whose sequence number is at bytes 2-4)
+// numbered on from the original's
+func SplitAudioPacket(packet []byte, headerLen, frames int) [][]byte {
+	header, payload := packet[:headerLen], packet[headerLen:]
+	frameBytes := len(payload) / frames
+	seq := binary.LittleEndian.Uint16(packet[2:4])
+
+	split := make([][]byte, frames)
+	for i := range split {
+		p := make([]byte, headerLen+frameBytes)
+		copy(p, header)
+		binary.LittleEndian.PutUint16(p[2:4], seq+uint16(i))
+		copy(p[headerLen:], payload[i*frameBytes:(i+1)*frameBytes])
+		split[i] = p
+	}
+	return split
+}
+
+// ValidFrameSizeMs reports whether a frame size is one peers may agree on
+func ValidFrameSizeMs(ms int) bool {
+	switch ms {
+	case 10, 20, 40, 60:
+		return true
+	}
+	return false
+}
+
+// Control message types: the "type" field of every JSON datagram. Untyped so they
+// compare equal to the plain strings a map[string]interface{} decodes to.
+const (
+	// Client -> server
+	MsgConnect         = "connect"
+	MsgCryptoHandshake = "crypto_handshake"
+	MsgChangeChannel   = "change_channel"
+	MsgChat            = "chat"
+	MsgEncryptedChat   = "encrypted_chat" // Also server -> client
+	MsgTyping          = "typing"
+	MsgSetStatus       = "set_status"
+	MsgPing            = "ping"
+	MsgEcho            = "echo"
+	MsgDisconnect      = "disconnect"
+	MsgAnnounce        = "announce"
+	MsgSetRole         = "set_role"
+	MsgKick            = "kick"
+	MsgBan             = "ban"
+	MsgUnban           = "unban"
+	MsgMuteUser        = "mute_user"
+	MsgUnmuteUser      = "unmute_user"
+	MsgSetTopic        = "set_topic"
+	MsgStats           = "stats"
+	MsgMonitorChannel  = "monitor_channel"
+	MsgTransmitEnd     = "transmit_end" // Push-to-talk released
+
+	// Server -> client
+	MsgAccept                  = "accept"
+	MsgReject                  = "reject"
+	MsgCryptoHandshakeResponse = "crypto_handshake_response"
+	MsgChannelChanged          = "channel_changed"
+	MsgChannelUsersUpdate      = "channel_users_update"
+	MsgChannelTopic            = "channel_topic"
+	MsgChatMessage             = "chat_message"
+	MsgChatHistory             = "chat_history"
+	MsgChatAck                 = "chat_ack"
+	MsgSystemMessage           = "system_message"
+	MsgTypingUpdate            = "typing_update"
+	MsgPong                    = "pong"
+	MsgEchoReply               = "echo_reply"
+	MsgAnnounceAck             = "announce_ack"
+	MsgModerationAck           = "moderation_ack"
+	MsgStatsReply              = "stats_reply"
+	MsgMonitoring              = "monitoring"
+	MsgKicked                  = "kicked"
+	MsgServerShutdown          = "server_shutdown"
+	MsgTransmitEnded           = "transmit_ended" // A talker released push-to-talk; carries its source ID
+	MsgError                   = "error"
+)
+
+// Events tagged on system_message notices, so clients can react (e.g. play a
+// sound) without parsing the text. Other notices carry no event.
+const (
+	SystemEventJoin  = "join"  // Someone joined the channel
+	SystemEventLeave = "leave" // Someone left the channel or disconnected
+)
+
+// Optional protocol features, advertised in connect/accept so older peers are skipped
+const (
+	CapabilityTyping      = "typing"       // typing / typing_update messages
+	CapabilityAudioSource = "audio_source" // relayed audio carries the talker's source ID
+	CapabilityUserInfo    = "user_info"    // user lists carry UserInfo objects instead of bare nicknames
+	CapabilityEcho        = "echo"         // echo packets are answered straight back (reachability check)
+	CapabilityMonitor     = "monitor"      // monitor_channel relays other channels' audio, receive-only
+	CapabilityCoalesce    = "coalesce"     // audio packets may carry several frames
+	CapabilityTransmitEnd = "transmit_end" // transmit_end is relayed to listeners as transmit_ended
+)
+
+// Audio packet prefixes, little-endian uint16 at the start of the datagram.
+//
+//	AudioPrefix:       prefix(2) seq(2) PCM...            client -> server, and relay to older clients
+//	AudioSourcePrefix: prefix(2) seq(2) source(2) PCM...  server -> clients with CapabilityAudioSource
+const (
+	AudioPrefix       = 0x5541 // "AU"
+	AudioSourcePrefix = 0x5341 // "AS"
+)
+
+// AudioMagic is the pair of audio packet prefixes a deployment uses. Client and
+// server must agree; the server advertises its pair in accept.
+type AudioMagic struct {
+	Audio  uint16 `json:"audio"`
+	Source uint16 `json:"source"`
+}
+
+// DefaultAudioMagic is used when a config doesn't set its own prefixes
+var DefaultAudioMagic = AudioMagic{Audio: AudioPrefix, Source: AudioSourcePrefix}
+
+// ParseAudioMagic reads the audio_magic / audio_source_magic config values, hex
+// like "0x5541". Empty values keep the defaults.
+func ParseAudioMagic(audio, source string) (AudioMagic, error) {
+	magic := DefaultAudioMagic
+	for _, field := range []struct {
+		name  string
+		value string
+		dest  *uint16
+	}{
+		{"audio_magic", audio, &magic.Audio},
+		{"audio_source_magic", source, &magic.Source},
+	} {
+		if field.value == "" {
+			continue
+		}
+		digits := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(field.value)), "0x")
+		parsed, err := strconv.ParseUint(digits, 16, 16)
+		if err != nil {
+			return DefaultAudioMagic, fmt.Errorf("%s=%q is not a 16-bit hex value", field.name, field.value)
+		}
+		*field.dest = uint16(parsed)
+	}
+	return magic, magic.Validate()
+}
+
+// Validate checks that audio packets stay distinguishable from each other and from JSON
+func (m AudioMagic) Validate() error {
+	switch {
+	case m.Audio == 0 || m.Source == 0:
+		return fmt.Errorf("audio magic can't be zero")
+	case m.Audio == m.Source:
+		return fmt.Errorf("audio and source magic must differ (both 0x%04X)", m.Audio)
+	case byte(m.Audio) == '{' || byte(m.Source) == '{':
+		// The low byte goes first on the wire; '{' would look like a control message
+		return fmt.Errorf("audio magic can't start with '{' (low byte 0x7B)")
+	}
+	return nil
+}
+
+// IsAudio reports whether a datagram carries either audio prefix. Validate keeps
+// '{' out of the prefixes, so this never claims a control message and receivers
+// can skip the JSON parse attempt for audio.
+func (m AudioMagic) IsAudio(packet []byte) bool {
+	if len(packet) < 2 {
+		return false
+	}
+	prefix := binary.LittleEndian.Uint16(packet)
+	return prefix == m.Audio || prefix == m.Source
+}
+
+// String formats the pair for logs
+func (m AudioMagic) String() string {
+	return fmt.Sprintf("0x%04X/0x%04X", m.Audio, m.Source)
+}
+
+// Theme is optional branding for the client web UI, set by the server
+// operator and sent in accept. Anything left out keeps the UI's own look.
+type Theme struct {
+	Name    string            `json:"name,omitempty"`     // Shown in the UI header
+	LogoURL string            `json:"logo_url,omitempty"` // http(s) image shown next to the name
+	Colors  map[string]string `json:"colors,omitempty"`   // Role (see ThemeColorRoles) -> "#rgb" or "#rrggbb"
+}
+
+// ThemeColorRoles are the UI colors a theme can set
+var ThemeColorRoles = []string{"background", "panel", "text", "accent", "success", "warning", "error"}
+
+// MaxThemeNameLength caps the branding name so it fits the header
+const MaxThemeNameLength = 48
+
+// IsZero reports whether the theme sets nothing
+func (t Theme) IsZero() bool {
+	return t.Name == "" && t.LogoURL == "" && len(t.Colors) == 0
+}
+
+// Sanitize returns the theme without the settings that are invalid, and what
+// was wrong with each. Colors end up in CSS and the logo in an img tag, so
+// both sides run this: the server on its config, the client on what it's sent.
+func (t Theme) Sanitize() (Theme, []error) {
+	var problems []error
+	clean := Theme{Name: strings.TrimSpace(t.Name), LogoURL: strings.TrimSpace(t.LogoURL)}
+
+	if len(clean.Name) > MaxThemeNameLength {
+		problems = append(problems, fmt.Errorf("theme name is longer than %d characters", MaxThemeNameLength))
+		clean.Name = ""
+	}
+	if clean.LogoURL != "" && !strings.HasPrefix(clean.LogoURL, "https://") && !strings.HasPrefix(clean.LogoURL, "http://") {
+		problems = append(problems, fmt.Errorf("theme logo_url %q must be an http or https URL", clean.LogoURL))
+		clean.LogoURL = ""
+	}
+	for role, color := range t.Colors {
+		switch {
+		case !slices.Contains(ThemeColorRoles, role):
+			problems = append(problems, fmt.Errorf("theme color %q is not one of %s", role, strings.Join(ThemeColorRoles, ", ")))
+		case !validHexColor(color):
+			problems = append(problems, fmt.Errorf("theme color %s=%q is not #rgb or #rrggbb", role, color))
+		default:
+			if clean.Colors == nil {
+				clean.Colors = make(map[string]string)
+			}
+			clean.Colors[role] = color
+		}
+	}
+	return clean, problems
+}
+
+// validHexColor accepts CSS hex colors without alpha: #rgb or #rrggbb
+func validHexColor(s string) bool {
+	if len(s) != 4 && len(s) != 7 || s[0] != '#' {
+		return false
+	}
+	_, err := strconv.ParseUint(s[1:], 16, 32)
+	return err == nil
+}
+
 type ConnectRequest struct {
-	Type     string   `json:"type"` // should be "connect"
-	Nicklist []string `json:"nicklist"`
+	Type         string   `json:"type"` // MsgConnect
+	Nicklist     []string `json:"nicklist"`
+	Version      string   `json:"version,omitempty"`       // Client build version
+	Capabilities []string `json:"capabilities,omitempty"`  // Optional features the client understands
+	FrameSizeMs  int      `json:"frame_size_ms,omitempty"` // Preferred audio frame size
 }
 
 type ConnectAccepted struct {
-	Type       string   `json:"type"` // should be "accept"
-	Nickname   string   `json:"nickname"`
-	ServerName string   `json:"server_name"`
-	MOTD       string   `json:"motd"`
-	Channels   []string `json:"channels"`
-	Users      []string `json:"users"`
+	Type       string     `json:"type"` // MsgAccept
+	Nickname   string     `json:"nickname"`
+	ServerName string     `json:"server_name"`
+	MOTD       string     `json:"motd"`
+	Channels   []string   `json:"channels"`
+	Users      []UserInfo `json:"users"` // Bare nicknames for clients without CapabilityUserInfo
+
+	ServerVersion    string `json:"server_version,omitempty"`
+	MinClientVersion string `json:"min_client_version,omitempty"` // Clients older than this should upgrade
+
+	Capabilities []string          `json:"capabilities,omitempty"`  // Optional features the server supports
+	FrameSizeMs  int               `json:"frame_size_ms,omitempty"` // Audio frame size all clients must use
+	SourceIDs    map[string]uint16 `json:"source_ids,omitempty"`    // nickname -> audio source ID
+	Topics       map[string]string `json:"topics,omitempty"`        // channel -> topic, for channels that have one
+
+	RequireEncryption bool `json:"require_encryption,omitempty"` // Server refuses plaintext chat
+
+	AudioMagic *AudioMagic `json:"audio_magic,omitempty"` // Audio packet prefixes; nil means the defaults
+	Theme      *Theme      `json:"theme,omitempty"`       // Branding for the web UI; nil when the server has none
+}
+
+// HasCapability reports whether a capability list contains the given capability
+func HasCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// User presence, set with set_status and carried in channel_users_update
+const (
+	StatusOnline = "online"
+	StatusAway   = "away"
+	StatusBusy   = "busy"
+)
+
+// Longest nickname the server accepts. Nicknames end up in the chat log
+// format and the UI, so they're kept short.
+const MaxNicknameLength = 32
+
+// Longest presence message the server accepts
+const MaxStatusMessageLength = 100
+
+// Longest channel topic the server accepts
+const MaxTopicLength = 200
+
+// UserStatus is a user's presence shown next to their nickname
+type UserStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// UserInfo is one entry of a user list: the nickname plus what the UI shows next to it
+type UserInfo struct {
+	Nickname      string `json:"nickname"`
+	Muted         bool   `json:"muted,omitempty"`
+	Speaking      bool   `json:"speaking,omitempty"`
+	Status        string `json:"status,omitempty"` // away/busy, empty means online
+	StatusMessage string `json:"status_message,omitempty"`
+	Role          string `json:"role,omitempty"`
+}
+
+// UnmarshalJSON also accepts a bare nickname string, which is what servers
+// without CapabilityUserInfo send
+func (u *UserInfo) UnmarshalJSON(data []byte) error {
+	var nickname string
+	if err := json.Unmarshal(data, &nickname); err == nil {
+		*u = UserInfo{Nickname: nickname}
+		return nil
+	}
+
+	type plain UserInfo
+	return json.Unmarshal(data, (*plain)(u))
+}
+
+// UserNicknames returns just the nicknames of a user list, for older peers
+func UserNicknames(users []UserInfo) []string {
+	nicks := make([]string, len(users))
+	for i, u := range users {
+		nicks[i] = u.Nickname
+	}
+	return nicks
+}
+
+// User roles. Admins can do everything; moderators can act on plain users in their own channel.
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleUser      = "user"
+)
+
+// ValidRole reports whether r is a role that can be assigned
+func ValidRole(r string) bool {
+	switch r {
+	case RoleAdmin, RoleModerator, RoleUser:
+		return true
+	}
+	return false
 }
 
+// RoleRank orders roles by privilege: admin > moderator > user (and unknown)
+func RoleRank(r string) int {
+	switch r {
+	case RoleAdmin:
+		return 2
+	case RoleModerator:
+		return 1
+	}
+	return 0
+}
+
+// ValidStatus reports whether s is a presence value clients may set
+func ValidStatus(s string) bool {
+	switch s {
+	case StatusOnline, StatusAway, StatusBusy:
+		return true
+	}
+	return false
+}
+
+// Reasons carried in the code field of reject and error messages, so clients
+// can react without matching the text. Servers before codes leave it empty.
+const (
+	// Reject: the connect was refused
+	CodeBanned          = "banned"
+	CodeNicknameTaken   = "nickname_taken"   // Every requested nickname is in use; others may work
+	CodeInvalidNickname = "invalid_nickname" // No requested nickname is allowed at all
+
+	// Error: a request was refused
+	CodeNotAllowed         = "not_allowed"         // Our role doesn't permit it
+	CodeNotFound           = "not_found"           // No such user, channel or ban
+	CodeInvalidRequest     = "invalid_request"     // Malformed or meaningless arguments
+	CodeNotConnected       = "not_connected"       // The server doesn't know this address
+	CodeRateLimited        = "rate_limited"        // Too many requests; retrying later works
+	CodeMuted              = "muted"               // Chat refused while server-muted
+	CodeEncryptionRequired = "encryption_required" // Plaintext chat refused
+	CodeLimitReached       = "limit_reached"       // A per-user limit is used up
+	CodeDisabled           = "disabled"            // The feature is off on this server
+	CodeFrameSizeMismatch  = "frame_size_mismatch" // Audio wasn't whole frames at the server's frame size
+)
+
 type Reject struct {
-	Type    string `json:"type"` // "reject"
+	Type    string `json:"type"` // MsgReject
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
-}
\ No newline at end of file
+}
@@ -0,0 +1,193 @@
+package common
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestUserInfoAcceptsBothForms(t *testing.T) {
+	var users []UserInfo
+	data := `["alice", {"nickname": "bob", "muted": true, "status": "away", "status_message": "lunch"}]`
+	if err := json.Unmarshal([]byte(data), &users); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	want := []UserInfo{
+		{Nickname: "alice"},
+		{Nickname: "bob", Muted: true, Status: StatusAway, StatusMessage: "lunch"},
+	}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("got %+v, want %+v", users, want)
+	}
+	if nicks := UserNicknames(users); !reflect.DeepEqual(nicks, []string{"alice", "bob"}) {
+		t.Errorf("UserNicknames = %v", nicks)
+	}
+}
+
+func TestUserInfoRoundTrip(t *testing.T) {
+	in := UserInfo{Nickname: "carol", Speaking: true, Role: "admin"}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(data) != `{"nickname":"carol","speaking":true,"role":"admin"}` {
+		t.Errorf("unexpected encoding %s", data)
+	}
+
+	var out UserInfo
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if out != in {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestAudioMagicIsAudio(t *testing.T) {
+	magic := DefaultAudioMagic
+	for _, tc := range []struct {
+		packet []byte
+		want   bool
+	}{
+		{[]byte{0x41, 0x55, 0, 0}, true}, // "AU"
+		{[]byte{0x41, 0x53, 0, 0}, true}, // "AS"
+		{[]byte(`{"type":"ping"}`), false},
+		{[]byte{0x41}, false},
+		{nil, false},
+	} {
+		if got := magic.IsAudio(tc.packet); got != tc.want {
+			t.Errorf("IsAudio(% x) = %t, want %t", tc.packet, got, tc.want)
+		}
+	}
+}
+
+// The receive loops used to try json.Unmarshal on every datagram; audio always
+// failed it. Compare that attempt with the prefix check that now comes first.
+func BenchmarkAudioPacketDiscrimination(b *testing.B) {
+	packet := make([]byte, AudioPacketSize(DefaultFrameSizeMs))
+	packet[0], packet[1] = 0x41, 0x55
+	for i := 4; i < len(packet); i++ {
+		packet[i] = byte(i * 7)
+	}
+
+	b.Run("json_attempt", func(b *testing.B) {
+		var msg map[string]interface{}
+		for i := 0; i < b.N; i++ {
+			if json.Unmarshal(packet, &msg) == nil {
+				b.Fatal("audio parsed as JSON")
+			}
+		}
+	})
+	b.Run("prefix_check", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if !DefaultAudioMagic.IsAudio(packet) {
+				b.Fatal("audio not recognized")
+			}
+		}
+	})
+}
+
+func TestParseAudioMagic(t *testing.T) {
+	magic, err := ParseAudioMagic("", "")
+	if err != nil || magic != DefaultAudioMagic {
+		t.Errorf("empty config: got %v, %v", magic, err)
+	}
+
+	magic, err = ParseAudioMagic("0xBEEF", "cafe")
+	if err != nil || magic != (AudioMagic{Audio: 0xBEEF, Source: 0xCAFE}) {
+		t.Errorf("custom magic: got %v, %v", magic, err)
+	}
+
+	for _, bad := range [][2]string{
+		{"0x10000", ""},    // Too wide
+		{"xyz", ""},        // Not hex
+		{"0", ""},          // Zero
+		{"0x5341", ""},     // Same as the default source prefix
+		{"0x417B", "0x01"}, // Starts with '{' on the wire
+	} {
+		if _, err := ParseAudioMagic(bad[0], bad[1]); err == nil {
+			t.Errorf("ParseAudioMagic(%q, %q) should fail", bad[0], bad[1])
+		}
+	}
+}
+
+func TestThemeSanitize(t *testing.T) {
+	theme, problems := Theme{
+		Name:    "  Bunker  ",
+		LogoURL: "https://example.com/logo.png",
+		Colors:  map[string]string{"accent": "#ff8800", "text": "#fff"},
+	}.Sanitize()
+	if len(problems) != 0 {
+		t.Errorf("valid theme reported problems: %v", problems)
+	}
+	if theme.Name != "Bunker" || theme.LogoURL == "" || len(theme.Colors) != 2 {
+		t.Errorf("valid theme changed: %+v", theme)
+	}
+
+	theme, problems = Theme{
+		LogoURL: "javascript:alert(1)",
+		Colors: map[string]string{
+			"accent":     "#12345",             // Wrong length
+			"background": "red; display: none", // Not a hex color
+			"border":     "#000000",            // Unknown role
+			"error":      "#c00",
+		},
+	}.Sanitize()
+	if len(problems) != 4 {
+		t.Errorf("got %d problems, want 4: %v", len(problems), problems)
+	}
+	if theme.LogoURL != "" {
+		t.Errorf("non-http logo kept: %q", theme.LogoURL)
+	}
+	if len(theme.Colors) != 1 || theme.Colors["error"] != "#c00" {
+		t.Errorf("only the valid color should survive, got %v", theme.Colors)
+	}
+	if !(Theme{}).IsZero() || theme.IsZero() {
+		t.Error("IsZero is wrong")
+	}
+}
+
+func TestAudioFrameCount(t *testing.T) {
+	frameBytes := AudioPacketSize(20) - 4
+	for _, tc := range []struct {
+		payload, want int
+	}{
+		{frameBytes, 1},
+		{2 * frameBytes, 2},
+		{3 * frameBytes, 3},
+		{4 * frameBytes, 0}, // Over 60ms
+		{frameBytes + 2, 0},
+		{0, 0},
+	} {
+		if got := AudioFrameCount(tc.payload, 20); got != tc.want {
+			t.Errorf("AudioFrameCount(%d, 20) = %d, want %d", tc.payload, got, tc.want)
+		}
+	}
+	if got := AudioFrameCount(2*(AudioPacketSize(40)-4), 40); got != 0 {
+		t.Errorf("two 40ms frames exceed %dms, got %d", MaxPacketMs, got)
+	}
+}
+
+func TestSplitAudioPacket(t *testing.T) {
+	for frames := 1; frames <= 3; frames++ {
+		// Header: prefix, seq 65534 (so the numbering wraps), then a source ID
+		packet := []byte{0x41, 0x53, 0xFE, 0xFF, 0x07, 0x00}
+		for i := 0; i < frames; i++ {
+			packet = append(packet, byte(i), byte(i), byte(i), byte(i))
+		}
+
+		split := SplitAudioPacket(packet, 6, frames)
+		if len(split) != frames {
+			t.Fatalf("%d frames split into %d packets", frames, len(split))
+		}
+		for i, p := range split {
+			want := []byte{0x41, 0x53, 0, 0, 0x07, 0x00, byte(i), byte(i), byte(i), byte(i)}
+			binary.LittleEndian.PutUint16(want[2:4], 65534+uint16(i))
+			if !reflect.DeepEqual(p, want) {
+				t.Errorf("%d frames: packet %d = %v, want %v", frames, i, p, want)
+			}
+		}
+	}
+}
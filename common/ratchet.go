@@ -0,0 +1,161 @@
+package common
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Chat key ratchet labels, one chain per direction. Both sides derive the same
+// chains from the session secret; the client sends on c2s, the server on s2c.
+const (
+	RatchetClientToServer = "ahcli-chat-ratchet-c2s"
+	RatchetServerToClient = "ahcli-chat-ratchet-s2c"
+)
+
+// How far ahead of the chain a received counter may be, and how many keys for
+// lost or reordered messages are kept. UDP chat can arrive out of order.
+const RatchetMaxSkip = 256
+
+// Ratchet is a symmetric hash ratchet: every message is sealed with a fresh key
+// and the chain key is hashed forward, so a leaked message key exposes nothing
+// else and a leaked chain key exposes nothing earlier.
+//
+// Sealed format: counter (8 bytes, big-endian) | nonce | ciphertext. The counter
+// is authenticated as associated data.
+type Ratchet struct {
+	mu      sync.Mutex
+	chain   [32]byte
+	counter uint64              // Counter of the next key the chain yields
+	skipped map[uint64][32]byte // Keys for counters we passed without a message
+}
+
+// NewRatchet starts a chain from a session secret and a direction label
+func NewRatchet(secret [32]byte, label string) *Ratchet {
+	h, _ := blake2b.New256(nil) // Unkeyed New256 never fails
+	h.Write(secret[:])
+	h.Write([]byte(label))
+
+	r := &Ratchet{skipped: make(map[uint64][32]byte)}
+	copy(r.chain[:], h.Sum(nil))
+	return r
+}
+
+// ratchetStep derives the message key for a chain key and the next chain key
+func ratchetStep(chain [32]byte) (messageKey, next [32]byte) {
+	mk, _ := blake2b.New256(chain[:]) // A 32-byte key is always valid
+	mk.Write([]byte{0x01})
+	copy(messageKey[:], mk.Sum(nil))
+
+	ck, _ := blake2b.New256(chain[:])
+	ck.Write([]byte{0x02})
+	copy(next[:], ck.Sum(nil))
+	return messageKey, next
+}
+
+// Seal encrypts one message under the next key in the chain
+func (r *Ratchet) Seal(plaintext []byte) ([]byte, error) {
+	r.mu.Lock()
+	key, next := ratchetStep(r.chain)
+	counter := r.counter
+	r.chain, r.counter = next, r.counter+1
+	r.mu.Unlock()
+
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 8+aead.NonceSize(), 8+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	binary.BigEndian.PutUint64(out[:8], counter)
+	nonce := out[8:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return aead.Seal(out, nonce, plaintext, out[:8]), nil
+}
+
+// Open decrypts a message from the other side's chain. Messages may arrive out of
+// order; each key works once. The chain only moves forward when a message authenticates,
+// so forged counters can't push it out of sync.
+func (r *Ratchet) Open(data []byte) ([]byte, error) {
+	if len(data) < 8+chacha20poly1305.NonceSizeX {
+		return nil, errors.New("ratchet message too short")
+	}
+	counter := binary.BigEndian.Uint64(data[:8])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// An earlier message that arrived late
+	if counter < r.counter {
+		key, ok := r.skipped[counter]
+		if !ok {
+			return nil, fmt.Errorf("message key %d already used or expired", counter)
+		}
+		plaintext, err := openWithKey(key, data)
+		if err != nil {
+			return nil, err
+		}
+		delete(r.skipped, counter)
+		return plaintext, nil
+	}
+
+	if counter-r.counter > RatchetMaxSkip {
+		return nil, fmt.Errorf("message counter %d is too far ahead of %d", counter, r.counter)
+	}
+
+	// Walk the chain to the message's key without committing yet
+	chain := r.chain
+	passed := make([][32]byte, 0, counter-r.counter)
+	var key [32]byte
+	for i := r.counter; ; i++ {
+		var next [32]byte
+		key, next = ratchetStep(chain)
+		chain = next
+		if i == counter {
+			break
+		}
+		passed = append(passed, key)
+	}
+
+	plaintext, err := openWithKey(key, data)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, skippedKey := range passed {
+		r.skipped[r.counter+uint64(i)] = skippedKey
+	}
+	r.chain, r.counter = chain, counter+1
+	r.pruneSkipped()
+	return plaintext, nil
+}
+
+// pruneSkipped forgets the oldest skipped keys beyond RatchetMaxSkip. Caller holds the lock.
+func (r *Ratchet) pruneSkipped() {
+	for counter := range r.skipped {
+		if r.counter-counter > RatchetMaxSkip {
+			delete(r.skipped, counter)
+		}
+	}
+}
+
+// openWithKey decrypts a sealed message with one message key
+func openWithKey(key [32]byte, data []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		return nil, err
+	}
+	nonce := data[8 : 8+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, data[8+aead.NonceSize():], data[:8])
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed: %v", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,97 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newRatchetPair() (*Ratchet, *Ratchet) {
+	var secret [32]byte
+	copy(secret[:], "shared session secret for tests")
+	return NewRatchet(secret, RatchetClientToServer), NewRatchet(secret, RatchetClientToServer)
+}
+
+func TestRatchetInOrder(t *testing.T) {
+	sender, receiver := newRatchetPair()
+
+	var sealed [][]byte
+	for _, msg := range []string{"one", "two", "three"} {
+		data, err := sender.Seal([]byte(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed = append(sealed, data)
+
+		got, err := receiver.Open(data)
+		if err != nil || string(got) != msg {
+			t.Fatalf("open %q: got %q, %v", msg, got, err)
+		}
+	}
+
+	// Each message has its own key: identical plaintexts never share ciphertext,
+	// and a replayed message doesn't open twice
+	if bytes.Equal(sealed[0][8:], sealed[1][8:]) {
+		t.Error("ciphertexts should differ")
+	}
+	if _, err := receiver.Open(sealed[1]); err == nil {
+		t.Error("replayed message opened a second time")
+	}
+}
+
+func TestRatchetOutOfOrderAndLoss(t *testing.T) {
+	sender, receiver := newRatchetPair()
+
+	var sealed [][]byte
+	for i := 0; i < 5; i++ {
+		data, _ := sender.Seal([]byte{byte(i)})
+		sealed = append(sealed, data)
+	}
+
+	// 0 is lost, 3 arrives before 1 and 2
+	for _, i := range []int{3, 1, 2, 4} {
+		got, err := receiver.Open(sealed[i])
+		if err != nil || got[0] != byte(i) {
+			t.Fatalf("message %d: got %v, %v", i, got, err)
+		}
+	}
+	if len(receiver.skipped) != 1 {
+		t.Errorf("only the lost message's key should be kept, have %d", len(receiver.skipped))
+	}
+}
+
+func TestRatchetRejectsForgeriesWithoutDesync(t *testing.T) {
+	sender, receiver := newRatchetPair()
+	data, _ := sender.Seal([]byte("real"))
+
+	forged := append([]byte(nil), data...)
+	forged[len(forged)-1] ^= 0xff
+	if _, err := receiver.Open(forged); err == nil {
+		t.Fatal("tampered message opened")
+	}
+
+	// A forged counter far ahead must not move the chain
+	far := append([]byte(nil), data...)
+	far[7] = 50
+	receiver.Open(far)
+
+	if got, err := receiver.Open(data); err != nil || string(got) != "real" {
+		t.Errorf("genuine message after forgeries: got %q, %v", got, err)
+	}
+
+	ahead := append([]byte(nil), data...)
+	ahead[6] = 0xff // Counter way past RatchetMaxSkip
+	if _, err := receiver.Open(ahead); err == nil {
+		t.Error("counter beyond the skip window should be refused")
+	}
+}
+
+func TestRatchetDirectionsDiffer(t *testing.T) {
+	var secret [32]byte
+	c2s := NewRatchet(secret, RatchetClientToServer)
+	s2c := NewRatchet(secret, RatchetServerToClient)
+
+	data, _ := c2s.Seal([]byte("hello"))
+	if _, err := s2c.Open(data); err == nil {
+		t.Error("a message on one direction's chain opened on the other")
+	}
+}
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CurrentVersion is the release version of this build (client and server ship together)
+const CurrentVersion = "1.0.0"
+
+// CompareVersions compares two dotted versions like "1.2.3" (a leading "v" is ignored).
+// Returns -1 if a < b, 0 if equal, 1 if a > b. Missing or non-numeric parts count as 0.
+func CompareVersions(a, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var av, bv int
+		if i < len(aParts) {
+			av, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bv, _ = strconv.Atoi(bParts[i])
+		}
+		if av < bv {
+			return -1
+		}
+		if av > bv {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,230 @@
+// FILE: server/bans.go
+
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Used when ban_file isn't set in config.json
+const defaultBanFile = "bans.json"
+
+// How often a dropped packet from a banned address is logged, per address
+const banLogInterval = time.Minute
+
+// BanEntry is one banned address as stored in the ban file
+type BanEntry struct {
+	IP       string    `json:"ip"`
+	Nickname string    `json:"nickname,omitempty"` // Who was using the address when banned
+	Reason   string    `json:"reason,omitempty"`
+	By       string    `json:"by"`
+	BannedAt time.Time `json:"banned_at"`
+}
+
+// banList holds bans by IP. There are no accounts, so an address is all we can ban.
+type banList struct {
+	sync.Mutex
+	path    string
+	entries map[string]BanEntry // IP -> ban
+	logged  map[string]time.Time
+}
+
+var bans = &banList{
+	entries: make(map[string]BanEntry),
+	logged:  make(map[string]time.Time),
+}
+
+// loadBans reads the ban file. A missing file just means nobody is banned yet.
+func loadBans(path string) error {
+	bans.Lock()
+	defer bans.Unlock()
+
+	bans.path = path
+	bans.entries = make(map[string]BanEntry)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries []BanEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("parse %s: %v", path, err)
+	}
+	for _, entry := range entries {
+		bans.entries[entry.IP] = entry
+	}
+	return nil
+}
+
+// saveLocked writes the ban list back to disk. Caller holds the lock.
+func (b *banList) saveLocked() error {
+	if b.path == "" {
+		return nil
+	}
+
+	entries := make([]BanEntry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		entries = append(entries, entry)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so a crash never leaves a half-written ban file
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// isBanned reports whether packets from ip should be refused
+func (b *banList) isBanned(ip net.IP) bool {
+	b.Lock()
+	defer b.Unlock()
+	_, banned := b.entries[ip.String()]
+	return banned
+}
+
+// add bans an address and persists the list
+func (b *banList) add(entry BanEntry) error {
+	b.Lock()
+	defer b.Unlock()
+	b.entries[entry.IP] = entry
+	return b.saveLocked()
+}
+
+// remove lifts a ban by IP or by the nickname recorded with it. Returns the
+// lifted entry, or false if nothing matched.
+func (b *banList) remove(target string) (BanEntry, bool, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	for ip, entry := range b.entries {
+		if ip == target || (entry.Nickname != "" && entry.Nickname == target) {
+			delete(b.entries, ip)
+			delete(b.logged, ip)
+			return entry, true, b.saveLocked()
+		}
+	}
+	return BanEntry{}, false, nil
+}
+
+// shouldLogDrop rate-limits "dropped packet from banned address" logging
+func (b *banList) shouldLogDrop(ip string, now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+	if last, ok := b.logged[ip]; ok && now.Sub(last) < banLogInterval {
+		return false
+	}
+	b.logged[ip] = now
+	return true
+}
+
+// isConnectPacket reports whether a datagram is a connect request, the only
+// thing a banned address gets an answer to
+func isConnectPacket(data []byte) bool {
+	var msg struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(data, &msg) == nil && msg.Type == common.MsgConnect
+}
+
+// handleBan bans an IP, given directly or as a connected user's nickname.
+// Connected clients at that address are kicked. Admins only.
+func handleBan(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
+	var req struct {
+		Key      string `json:"key"`
+		Nickname string `json:"nickname"`
+		IP       string `json:"ip"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return
+	}
+
+	sender, ok := resolveActor(addr, req.Key, config)
+	if !ok || sender.Role != common.RoleAdmin {
+		sendModerationError(conn, addr, common.CodeNotAllowed, "Only admins can ban")
+		return
+	}
+
+	entry := BanEntry{Nickname: req.Nickname, Reason: req.Reason, By: sender.Name, BannedAt: time.Now()}
+	switch {
+	case req.Nickname != "":
+		target, ok := findClientByNickname(req.Nickname)
+		if !ok {
+			sendModerationError(conn, addr, common.CodeNotFound, "No user named %s", req.Nickname)
+			return
+		}
+		entry.IP = target.Addr.IP.String()
+	case net.ParseIP(req.IP) != nil:
+		entry.IP = net.ParseIP(req.IP).String()
+	default:
+		sendModerationError(conn, addr, common.CodeInvalidRequest, "Ban needs a nickname or a valid ip")
+		return
+	}
+
+	// Ban first so a kicked client can't slip back in before the ban lands
+	if err := bans.add(entry); err != nil {
+		logger.Error("Failed to save ban list: %v", err)
+	}
+	logger.Info("%s banned %s (%s): %s", sender.Name, entry.IP, entry.Nickname, entry.Reason)
+
+	reason := "banned"
+	if req.Reason != "" {
+		reason = "banned: " + req.Reason
+	}
+	for _, client := range clientsAtIP(entry.IP) {
+		kickClient(conn, client, sender.Name, reason)
+	}
+
+	sendModerationAck(conn, addr, "ban", entry.IP)
+}
+
+// handleUnban lifts a ban by IP or by the nickname it was recorded with. Admins only.
+func handleUnban(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
+	var req struct {
+		Key      string `json:"key"`
+		Nickname string `json:"nickname"`
+		IP       string `json:"ip"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return
+	}
+
+	sender, ok := resolveActor(addr, req.Key, config)
+	if !ok || sender.Role != common.RoleAdmin {
+		sendModerationError(conn, addr, common.CodeNotAllowed, "Only admins can unban")
+		return
+	}
+
+	target := req.IP
+	if target == "" {
+		target = req.Nickname
+	}
+	entry, found, err := bans.remove(target)
+	if !found {
+		sendModerationError(conn, addr, common.CodeNotFound, "No ban matches %q", target)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to save ban list: %v", err)
+	}
+
+	logger.Info("%s unbanned %s (%s)", sender.Name, entry.IP, entry.Nickname)
+	sendModerationAck(conn, addr, "unban", entry.IP)
+}
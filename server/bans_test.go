@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBanListPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	if err := loadBans(path); err != nil {
+		t.Fatalf("loading a missing ban file should succeed: %v", err)
+	}
+	defer loadBans("")
+
+	ip := net.ParseIP("203.0.113.7")
+	if err := bans.add(BanEntry{IP: ip.String(), Nickname: "mallory", By: "admin", BannedAt: time.Now()}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	// Reload from disk as a restart would
+	if err := loadBans(path); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !bans.isBanned(ip) {
+		t.Fatal("ban did not survive a reload")
+	}
+	if bans.isBanned(net.ParseIP("203.0.113.8")) {
+		t.Error("unrelated address is banned")
+	}
+
+	// Unban by the nickname recorded with the ban
+	if _, found, err := bans.remove("mallory"); !found || err != nil {
+		t.Fatalf("remove by nickname: found=%t err=%v", found, err)
+	}
+	if err := loadBans(path); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if bans.isBanned(ip) {
+		t.Error("unban did not persist")
+	}
+}
+
+func TestBanDropLoggingIsThrottled(t *testing.T) {
+	now := time.Now()
+	ip := "198.51.100.1"
+
+	if !bans.shouldLogDrop(ip, now) {
+		t.Fatal("first drop should be logged")
+	}
+	if bans.shouldLogDrop(ip, now.Add(time.Second)) {
+		t.Error("second drop within the interval should not be logged")
+	}
+	if !bans.shouldLogDrop(ip, now.Add(banLogInterval+time.Second)) {
+		t.Error("drop after the interval should be logged")
+	}
+}
+
+func TestIsConnectPacket(t *testing.T) {
+	if !isConnectPacket([]byte(`{"type":"connect","nicklist":["a"]}`)) {
+		t.Error("connect not recognised")
+	}
+	if isConnectPacket([]byte(`{"type":"chat"}`)) || isConnectPacket([]byte{0x41, 0x55, 0, 0}) {
+		t.Error("non-connect packet treated as connect")
+	}
+}
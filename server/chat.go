@@ -3,6 +3,7 @@
 package main
 
 import (
+	"ahcli/common"
 	"ahcli/common/logger"
 	"bufio"
 	"crypto/rand"
@@ -15,14 +16,9 @@ import (
 	"time"
 )
 
-// ChatMessage represents a single chat message
-type ChatMessage struct {
-	GUID      string    `json:"guid"`      // Channel GUID for routing
-	Channel   string    `json:"channel"`   // Human-readable channel name
-	Username  string    `json:"username"`  // User who sent the message
-	Message   string    `json:"message"`   // The actual message content
-	Timestamp time.Time `json:"timestamp"` // When the message was sent
-}
+// ChatMessage represents a single chat message. Shared with the client, which
+// receives these in chat_history.
+type ChatMessage = common.ChatRecord
 
 // ChatStorage manages all chat functionality
 type ChatStorage struct {
@@ -34,6 +30,7 @@ type ChatStorage struct {
 	// Configuration
 	enabled      bool
 	logFile      string
+	logFormat    string // chatLogText or chatLogJSON
 	maxMessages  int
 	recentOnJoin int
 
@@ -44,6 +41,17 @@ type ChatStorage struct {
 // Global chat storage instance
 var chatStorage *ChatStorage
 
+// Chat log formats. Loading accepts both regardless of the setting, so
+// switching formats keeps existing history readable.
+const (
+	chatLogText = "text"
+	chatLogJSON = "json"
+)
+
+// maxRecentOnJoin is a hard cap on history sent when joining a channel,
+// regardless of load_recent_on_join, so joins never produce huge bursts
+const maxRecentOnJoin = 500
+
 // InitChatStorage initializes the chat system
 func InitChatStorage(config *ServerConfig) error {
 	if !config.Chat.Enabled {
@@ -55,6 +63,7 @@ func InitChatStorage(config *ServerConfig) error {
 		messages:     make(map[string][]ChatMessage),
 		enabled:      config.Chat.Enabled,
 		logFile:      config.Chat.LogFile,
+		logFormat:    config.Chat.LogFormat,
 		maxMessages:  config.Chat.MaxMessages,
 		recentOnJoin: config.Chat.LoadRecentOnJoin,
 	}
@@ -137,7 +146,7 @@ func (cs *ChatStorage) StoreMessage(guid, channel, username, message string) err
 		Channel:   channel,
 		Username:  username,
 		Message:   message,
-		Timestamp: time.Now(),
+		Timestamp: time.Now().UTC(),
 	}
 
 	cs.Lock()
@@ -174,15 +183,27 @@ func (cs *ChatStorage) writeToLog(msg ChatMessage) error {
 		return fmt.Errorf("log file not open")
 	}
 
-	// Log format: 2025-06-03T05:25:30Z [guid:a1b2c3d4] [General] <username> message
-	logLine := fmt.Sprintf("%s [guid:%s] [%s] <%s> %s\n",
-		msg.Timestamp.UTC().Format(time.RFC3339),
-		msg.GUID,
-		msg.Channel,
-		msg.Username,
-		msg.Message)
-
-	_, err := cs.logFileHandle.WriteString(logLine)
+	var logLine []byte
+	if cs.logFormat == chatLogJSON {
+		// One JSON object per line, trivially consumable by external tools
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		logLine = append(data, '\n')
+	} else {
+		// Log format: 2025-06-03T05:25:30Z [v2] [guid:a1b2c3d4] [General] <username> message
+		// Backslashes and line breaks in the message are escaped so one message stays one line
+		logLine = []byte(fmt.Sprintf("%s %s [guid:%s] [%s] <%s> %s\n",
+			msg.Timestamp.UTC().Format(time.RFC3339Nano),
+			textLogEscapedMarker,
+			msg.GUID,
+			msg.Channel,
+			msg.Username,
+			escapeLogText(msg.Message)))
+	}
+
+	_, err := cs.logFileHandle.Write(logLine)
 	if err != nil {
 		return err
 	}
@@ -237,13 +258,14 @@ func (cs *ChatStorage) loadHistoryFromLog() error {
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // Long messages shouldn't stop the load
 	lineCount := 0
 	loadedCount := 0
 
 	for scanner.Scan() {
 		lineCount++
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
 			continue
 		}
 
@@ -276,9 +298,31 @@ func (cs *ChatStorage) loadHistoryFromLog() error {
 	return nil
 }
 
-// parseLogLine parses a log line back into a ChatMessage
+// parseLogLine parses a log line back into a ChatMessage. Each line is
+// detected as JSON or text on its own, so mixed-format logs load fine.
 func (cs *ChatStorage) parseLogLine(line string) (*ChatMessage, error) {
-	// Expected format: 2025-06-03T05:25:30Z [guid:a1b2c3d4] [General] <username> message
+	if strings.HasPrefix(line, "{") {
+		var msg ChatMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			return nil, fmt.Errorf("invalid JSON log line: %v", err)
+		}
+		if msg.GUID == "" {
+			return nil, fmt.Errorf("missing GUID")
+		}
+		return &msg, nil
+	}
+
+	return parseTextLogLine(line)
+}
+
+// Marks text log lines whose messages are escaped. Lines without it predate
+// escaping and are read verbatim, backslashes included.
+const textLogEscapedMarker = "[v2]"
+
+// parseTextLogLine parses the text log format
+func parseTextLogLine(line string) (*ChatMessage, error) {
+	// Expected format: 2025-06-03T05:25:30Z [v2] [guid:a1b2c3d4] [General] <username> message
+	// Older lines have no [v2]
 
 	// Parse timestamp
 	parts := strings.SplitN(line, " ", 2)
@@ -292,6 +336,10 @@ func (cs *ChatStorage) parseLogLine(line string) (*ChatMessage, error) {
 	}
 
 	remaining := parts[1]
+	escaped := strings.HasPrefix(remaining, textLogEscapedMarker+" ")
+	if escaped {
+		remaining = remaining[len(textLogEscapedMarker)+1:]
+	}
 
 	// Parse GUID
 	if !strings.HasPrefix(remaining, "[guid:") {
@@ -304,7 +352,7 @@ func (cs *ChatStorage) parseLogLine(line string) (*ChatMessage, error) {
 	}
 
 	guid := remaining[6:guidEnd] // Skip "[guid:"
-	remaining = strings.TrimSpace(remaining[guidEnd+1:])
+	remaining = strings.TrimLeft(remaining[guidEnd+1:], " ")
 
 	// Parse channel name
 	if !strings.HasPrefix(remaining, "[") {
@@ -317,7 +365,7 @@ func (cs *ChatStorage) parseLogLine(line string) (*ChatMessage, error) {
 	}
 
 	channel := remaining[1:channelEnd] // Skip "["
-	remaining = strings.TrimSpace(remaining[channelEnd+1:])
+	remaining = strings.TrimLeft(remaining[channelEnd+1:], " ")
 
 	// Parse username
 	if !strings.HasPrefix(remaining, "<") {
@@ -330,7 +378,10 @@ func (cs *ChatStorage) parseLogLine(line string) (*ChatMessage, error) {
 	}
 
 	username := remaining[1:usernameEnd] // Skip "<"
-	message := strings.TrimSpace(remaining[usernameEnd+1:])
+	message := strings.TrimPrefix(remaining[usernameEnd+1:], " ")
+	if escaped {
+		message = unescapeLogText(message)
+	}
 
 	return &ChatMessage{
 		GUID:      guid,
@@ -341,6 +392,42 @@ func (cs *ChatStorage) parseLogLine(line string) (*ChatMessage, error) {
 	}, nil
 }
 
+// escapeLogText makes a message safe for a single text log line
+func escapeLogText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+// unescapeLogText reverses escapeLogText
+func unescapeLogText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// chatTimestamp formats a chat timestamp for the wire. All chat messages
+// (live and history) carry RFC3339 UTC; clients convert to local time.
+func chatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
 // GetChannelGUID returns the GUID for a channel name
 func GetChannelGUID(channelName string) string {
 	for _, channel := range serverConfig.Channels {
@@ -363,8 +450,16 @@ func GetChannelName(guid string) string {
 
 // CloseChatStorage properly closes the chat storage system
 func CloseChatStorage() {
-	if chatStorage != nil && chatStorage.logFileHandle != nil {
+	if chatStorage == nil {
+		return
+	}
+	// Under the lock so a message being stored finishes its write first
+	chatStorage.Lock()
+	defer chatStorage.Unlock()
+	if chatStorage.logFileHandle != nil {
+		chatStorage.logFileHandle.Sync()
 		chatStorage.logFileHandle.Close()
+		chatStorage.logFileHandle = nil
 		logger.Info("Chat storage closed")
 	}
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestChatStorage opens a chat store backed by a log file in a temp dir
+func newTestChatStorage(t *testing.T, logFile, format string) *ChatStorage {
+	t.Helper()
+
+	cs := &ChatStorage{
+		messages:    make(map[string][]ChatMessage),
+		enabled:     true,
+		logFile:     logFile,
+		logFormat:   format,
+		maxMessages: 100000,
+	}
+	handle, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	cs.logFileHandle = handle
+	t.Cleanup(func() { handle.Close() })
+	return cs
+}
+
+var roundTripMessages = []string{
+	"plain message",
+	"closing ] bracket",
+	"[guid:fake] [Other] <mallory> spoofed",
+	"arrows -> and >> and <tags>",
+	"first line\nsecond line",
+	"windows\r\nline ending",
+	"  padded with spaces  ",
+	`quotes "and" \backslashes\`,
+	"émoji 🎧 ünïcode",
+	`literal \n is not a newline`,
+	"trailing backslash \\",
+}
+
+func TestChatLogRoundTripText(t *testing.T) {
+	testChatLogRoundTrip(t, chatLogText)
+}
+
+func TestChatLogRoundTripJSON(t *testing.T) {
+	testChatLogRoundTrip(t, chatLogJSON)
+}
+
+func testChatLogRoundTrip(t *testing.T, format string) {
+	logFile := filepath.Join(t.TempDir(), "chat.log")
+	guid := "bd6dea33-5ce9-9647-52e4-b26a15d2fd25"
+	messages := roundTripMessages
+
+	writer := newTestChatStorage(t, logFile, format)
+	for _, msg := range messages {
+		if err := writer.StoreMessage(guid, "General", "alice", msg); err != nil {
+			t.Fatalf("StoreMessage(%q): %v", msg, err)
+		}
+	}
+	writer.logFileHandle.Close()
+
+	reader := newTestChatStorage(t, logFile, format)
+	if err := reader.loadHistoryFromLog(); err != nil {
+		t.Fatalf("loadHistoryFromLog: %v", err)
+	}
+
+	got := reader.GetRecentMessages(guid, len(messages)+10)
+	if len(got) != len(messages) {
+		t.Fatalf("loaded %d messages, want %d", len(got), len(messages))
+	}
+	want := writer.GetRecentMessages(guid, len(messages))
+	for i := range want {
+		if got[i].Message != want[i].Message {
+			t.Errorf("message %d = %q, want %q", i, got[i].Message, want[i].Message)
+		}
+		if got[i].Username != "alice" || got[i].Channel != "General" || got[i].GUID != guid {
+			t.Errorf("message %d metadata = %+v", i, got[i])
+		}
+		if !got[i].Timestamp.Equal(want[i].Timestamp) {
+			t.Errorf("message %d timestamp = %v, want %v", i, got[i].Timestamp, want[i].Timestamp)
+		}
+	}
+}
+
+func TestChatLogMixedFormats(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "chat.log")
+	guid := "a1b2c3d4"
+
+	// Switching log_format mid-life leaves both kinds of line in one file
+	text := newTestChatStorage(t, logFile, chatLogText)
+	text.StoreMessage(guid, "General", "alice", "from text")
+	text.logFileHandle.Close()
+	jsonLog := newTestChatStorage(t, logFile, chatLogJSON)
+	jsonLog.StoreMessage(guid, "General", "bob", "from json")
+	jsonLog.logFileHandle.Close()
+
+	reader := newTestChatStorage(t, logFile, chatLogText)
+	if err := reader.loadHistoryFromLog(); err != nil {
+		t.Fatalf("loadHistoryFromLog: %v", err)
+	}
+	got := reader.GetRecentMessages(guid, 10)
+	if len(got) != 2 || got[0].Message != "from text" || got[1].Message != "from json" {
+		t.Errorf("loaded %+v", got)
+	}
+}
+
+func TestParseLegacyLogLine(t *testing.T) {
+	cs := &ChatStorage{}
+	msg, err := cs.parseLogLine("2025-06-03T05:25:30Z [guid:a1b2c3d4] [General] <bob> hello there")
+	if err != nil {
+		t.Fatalf("parseLogLine: %v", err)
+	}
+	if msg.GUID != "a1b2c3d4" || msg.Channel != "General" || msg.Username != "bob" || msg.Message != "hello there" {
+		t.Errorf("parsed %+v", msg)
+	}
+}
+
+func TestParseLegacyLogLineKeepsBackslashes(t *testing.T) {
+	cs := &ChatStorage{}
+	msg, err := cs.parseLogLine(`2025-06-03T05:25:30Z [guid:a1b2c3d4] [General] <bob> C:\new\temp \n`)
+	if err != nil {
+		t.Fatalf("parseLogLine: %v", err)
+	}
+	if want := `C:\new\temp \n`; msg.Message != want {
+		t.Errorf("legacy line read as %q, want %q verbatim", msg.Message, want)
+	}
+}
+
+func TestParseLogLineRejectsGarbage(t *testing.T) {
+	cs := &ChatStorage{}
+	for _, line := range []string{"not a log line", `{"message":"no guid"}`, `{broken json`} {
+		if _, err := cs.parseLogLine(line); err == nil {
+			t.Errorf("parseLogLine(%q) succeeded, want error", line)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// FILE: server/chatfilter.go
+
+package main
+
+import (
+	"ahcli/common/logger"
+	"strings"
+	"unicode"
+)
+
+// ChatFilter rewrites chat messages before they are stored and broadcast.
+// Filter returns the (possibly) modified message and whether anything changed.
+type ChatFilter interface {
+	Filter(message string) (string, bool)
+}
+
+// Active filter chain, nil when filtering is off
+var chatFilters []ChatFilter
+
+// WordListFilter masks whole words from a fixed list, case-insensitively.
+// "class" is not touched by a list containing "ass" - only complete words match.
+type WordListFilter struct {
+	words map[string]bool // lowercased
+}
+
+// NewWordListFilter builds a filter from a word list. Blank entries are ignored.
+func NewWordListFilter(words []string) *WordListFilter {
+	f := &WordListFilter{words: make(map[string]bool)}
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w != "" {
+			f.words[w] = true
+		}
+	}
+	return f
+}
+
+// Filter replaces each listed word with asterisks of the same length
+func (f *WordListFilter) Filter(message string) (string, bool) {
+	if len(f.words) == 0 {
+		return message, false
+	}
+
+	var b strings.Builder
+	runes := []rune(message)
+	changed := false
+
+	for i := 0; i < len(runes); {
+		if !isFilterWordRune(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		// Collect the whole word so substrings never match
+		start := i
+		for i < len(runes) && isFilterWordRune(runes[i]) {
+			i++
+		}
+		word := string(runes[start:i])
+
+		if f.words[strings.ToLower(word)] {
+			b.WriteString(strings.Repeat("*", i-start))
+			changed = true
+		} else {
+			b.WriteString(word)
+		}
+	}
+
+	if !changed {
+		return message, false
+	}
+	return b.String(), true
+}
+
+func isFilterWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// InitChatFilter sets up content filtering from config
+func InitChatFilter(config *ServerConfig) {
+	chatFilters = nil
+
+	if len(config.Chat.FilterWords) > 0 {
+		chatFilters = append(chatFilters, NewWordListFilter(config.Chat.FilterWords))
+		logger.Info("Chat word filter enabled with %d words", len(config.Chat.FilterWords))
+	}
+}
+
+// applyChatFilters runs a message through every configured filter
+func applyChatFilters(username, message string) string {
+	for _, filter := range chatFilters {
+		filtered, changed := filter.Filter(message)
+		if changed {
+			logger.Debug("Filtered chat message from %s", username)
+			message = filtered
+		}
+	}
+	return message
+}
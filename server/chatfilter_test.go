@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestWordListFilter(t *testing.T) {
+	filter := NewWordListFilter([]string{"darn", "Heck", " ass ", ""})
+
+	tests := []struct {
+		in          string
+		want        string
+		wantChanged bool
+	}{
+		{"well darn it", "well **** it", true},
+		{"DARN", "****", true},
+		{"what the heck!", "what the ****!", true},
+		{"HeCk, darn.", "****, ****.", true},
+		{"you ass", "you ***", true},
+		{"first class passage", "first class passage", false},
+		{"darned heckler", "darned heckler", false},
+		{"assessment", "assessment", false},
+		{"", "", false},
+		{"darn_it", "****_it", true},
+		{"émoji darn ünïcode", "émoji **** ünïcode", true},
+	}
+
+	for _, tt := range tests {
+		got, changed := filter.Filter(tt.in)
+		if got != tt.want || changed != tt.wantChanged {
+			t.Errorf("Filter(%q) = %q, %t; want %q, %t", tt.in, got, changed, tt.want, tt.wantChanged)
+		}
+	}
+}
+
+func TestWordListFilterEmpty(t *testing.T) {
+	filter := NewWordListFilter(nil)
+	if got, changed := filter.Filter("anything goes"); got != "anything goes" || changed {
+		t.Errorf("empty filter changed message: %q", got)
+	}
+}
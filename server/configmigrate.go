@@ -0,0 +1,111 @@
+// FILE: server/configmigrate.go
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// config_version written by this server. Bump it and append a migration
+// whenever a new field needs a default that older files can't express.
+const serverConfigVersion = 1
+
+// Chat history defaults, also what older config files fall back to
+const (
+	defaultChatLogFile      = "chat.log"
+	defaultChatMaxMessages  = 100000
+	defaultChatRecentOnJoin = 100
+	minChatMaxMessages      = 20000 // The circular buffer drops 10k at a time
+)
+
+// configKeys reports whether a config file set a key, given as a dotted path
+// such as "chat.max_messages". Migrations use it to tell a field that is
+// missing from one deliberately set to zero.
+type configKeys map[string]any
+
+func (k configKeys) has(path string) bool {
+	var node any = map[string]any(k)
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := node.(map[string]any)
+		if !ok {
+			return false
+		}
+		if node, ok = obj[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// serverConfigMigrations[i] upgrades a config from version i to i+1
+var serverConfigMigrations = []func(config *ServerConfig, keys configKeys){
+	// 0 -> 1: spell out the defaults that unversioned files got from zero values
+	func(config *ServerConfig, keys configKeys) {
+		if !keys.has("frame_size_ms") {
+			config.FrameSizeMs = common.DefaultFrameSizeMs
+		}
+		if !keys.has("client_timeout_seconds") {
+			config.ClientTimeoutSeconds = int(defaultClientTimeout.Seconds())
+		}
+		if !keys.has("chat.log_file") {
+			config.Chat.LogFile = defaultChatLogFile
+		}
+		if !keys.has("chat.max_messages") {
+			config.Chat.MaxMessages = defaultChatMaxMessages
+		}
+		if !keys.has("chat.load_recent_on_join") {
+			config.Chat.LoadRecentOnJoin = defaultChatRecentOnJoin
+		}
+		if !keys.has("chat.log_format") {
+			config.Chat.LogFormat = chatLogText
+		}
+	},
+}
+
+// migrateServerConfig brings a config decoded from data up to the current
+// version. It reports whether anything changed, in which case the caller
+// should save the config.
+func migrateServerConfig(data []byte, config *ServerConfig) (bool, error) {
+	from := config.ConfigVersion
+	if from > serverConfigVersion {
+		logger.Warn("config_version %d is newer than this server understands (%d) - settings it added are ignored",
+			from, serverConfigVersion)
+		return false, nil
+	}
+	if from == serverConfigVersion {
+		return false, nil
+	}
+	if from < 0 {
+		return false, fmt.Errorf("config_version %d is invalid", from)
+	}
+
+	var keys configKeys
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return false, err
+	}
+	for v := from; v < serverConfigVersion; v++ {
+		serverConfigMigrations[v](config, keys)
+	}
+	config.ConfigVersion = serverConfigVersion
+	logger.Info("Migrated config from version %d to %d", from, serverConfigVersion)
+	return true, nil
+}
+
+// rewriteMigratedConfig saves a migrated config over the original, keeping
+// the original beside it as path.v<version>.bak
+func rewriteMigratedConfig(path string, original []byte, fromVersion int, config *ServerConfig) {
+	backup := fmt.Sprintf("%s.v%d.bak", path, fromVersion)
+	if err := os.WriteFile(backup, original, 0644); err != nil {
+		logger.Warn("Not rewriting migrated config: cannot back up %s: %v", path, err)
+		return
+	}
+	if err := saveServerConfig(path, config); err != nil {
+		logger.Warn("Failed to save migrated config to %s: %v", path, err)
+		return
+	}
+	logger.Info("Saved migrated config to %s (previous version kept as %s)", path, backup)
+}
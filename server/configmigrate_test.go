@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadServerConfigMigratesUnversionedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	original := `{
+  "server_name": "old box",
+  "listen_port": 4422,
+  "channels": [{"guid": "g1", "name": "General", "allow_speak": true, "allow_listen": true}],
+  "chat": {"enabled": true, "load_recent_on_join": 0}
+}`
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadServerConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ConfigVersion != serverConfigVersion {
+		t.Errorf("config_version = %d, want %d", config.ConfigVersion, serverConfigVersion)
+	}
+	if config.Chat.MaxMessages != defaultChatMaxMessages || config.Chat.LogFile != defaultChatLogFile {
+		t.Errorf("missing chat settings should get defaults, got max_messages=%d log_file=%q",
+			config.Chat.MaxMessages, config.Chat.LogFile)
+	}
+	if config.Chat.LoadRecentOnJoin != 0 {
+		t.Errorf("an explicit load_recent_on_join of 0 should be kept, got %d", config.Chat.LoadRecentOnJoin)
+	}
+
+	// The file is rewritten at the new version, the original kept as a backup
+	var saved ServerConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.ConfigVersion != serverConfigVersion || saved.ClientTimeoutSeconds != 45 || saved.FrameSizeMs != 20 {
+		t.Errorf("rewritten config missing migrated fields: %+v", saved)
+	}
+	if saved.PacketWorkers != 0 || saved.MaxAudioPacketBytes != 0 {
+		t.Error("per-run defaults should not be written into the file")
+	}
+	backup, err := os.ReadFile(path + ".v0.bak")
+	if err != nil || string(backup) != original {
+		t.Errorf("original should be kept as a backup (err %v)", err)
+	}
+
+	// Loading again finds nothing to migrate
+	if _, err := loadServerConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".v1.bak"); !os.IsNotExist(err) {
+		t.Error("a current config should not be migrated again")
+	}
+}
+
+func TestConfigKeysHas(t *testing.T) {
+	var keys configKeys
+	json.Unmarshal([]byte(`{"chat": {"max_messages": 0}, "motd": ""}`), &keys)
+
+	for path, want := range map[string]bool{
+		"motd":              true,
+		"chat.max_messages": true,
+		"chat.log_file":     false,
+		"motd.x":            false,
+		"frame_size_ms":     false,
+	} {
+		if got := keys.has(path); got != want {
+			t.Errorf("has(%q) = %t, want %t", path, got, want)
+		}
+	}
+}
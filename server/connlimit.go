@@ -0,0 +1,81 @@
+// FILE: server/connlimit.go
+
+package main
+
+import (
+	"ahcli/common/logger"
+	"sync"
+	"time"
+)
+
+// Connect flood protection: at most connectPerIPLimit attempts per source IP per
+// connectRateWindow, and connectGlobalLimit attempts across all sources.
+const (
+	connectPerIPLimit  = 5
+	connectGlobalLimit = 50
+	connectRateWindow  = 10 * time.Second
+)
+
+// How often a summary of dropped connect attempts is logged
+const connectDropLogInterval = 10 * time.Second
+
+// connectLimiter tracks recent connect attempts by source IP and overall
+type connectLimiter struct {
+	sync.Mutex
+	perIP  map[string][]time.Time
+	global []time.Time
+
+	dropped    int
+	lastLogged time.Time
+	lastSweep  time.Time
+}
+
+var connectLimits = &connectLimiter{perIP: make(map[string][]time.Time)}
+
+// pruneWindow drops timestamps older than the window, reusing the slice
+func pruneWindow(times []time.Time, now time.Time) []time.Time {
+	recent := times[:0]
+	for _, t := range times {
+		if now.Sub(t) < connectRateWindow {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// allow records a connect attempt from ip and reports whether it may proceed.
+// Refused attempts aren't recorded, so a flood can't lock a source out forever.
+func (l *connectLimiter) allow(ip string, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	// Once per window, forget sources that have gone quiet
+	if now.Sub(l.lastSweep) >= connectRateWindow {
+		for source, times := range l.perIP {
+			if recent := pruneWindow(times, now); len(recent) > 0 {
+				l.perIP[source] = recent
+			} else {
+				delete(l.perIP, source)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	l.global = pruneWindow(l.global, now)
+	recent := pruneWindow(l.perIP[ip], now)
+
+	if len(l.global) >= connectGlobalLimit || len(recent) >= connectPerIPLimit {
+		l.dropped++
+		if now.Sub(l.lastLogged) >= connectDropLogInterval {
+			logger.Warn("Connect flood: dropped %d attempts in the last %v (latest from %s)",
+				l.dropped, connectDropLogInterval, ip)
+			l.dropped = 0
+			l.lastLogged = now
+		}
+		return false
+	}
+
+	l.global = append(l.global, now)
+	l.perIP[ip] = append(recent, now)
+	return true
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestConnectLimiterPerIP(t *testing.T) {
+	l := &connectLimiter{perIP: make(map[string][]time.Time)}
+	now := time.Now()
+
+	// One source hammering connect: the first connectPerIPLimit get through
+	for i := 0; i < connectPerIPLimit*10; i++ {
+		allowed := l.allow("192.0.2.1", now.Add(time.Duration(i)*time.Millisecond))
+		if want := i < connectPerIPLimit; allowed != want {
+			t.Fatalf("attempt %d: allowed=%t, want %t", i, allowed, want)
+		}
+	}
+
+	// Other sources are unaffected
+	if !l.allow("192.0.2.2", now) {
+		t.Error("second source should be allowed")
+	}
+
+	// Once the window passes the flooder may try again
+	if !l.allow("192.0.2.1", now.Add(connectRateWindow+time.Second)) {
+		t.Error("source should be allowed after the window")
+	}
+}
+
+func TestConnectLimiterGlobalCap(t *testing.T) {
+	l := &connectLimiter{perIP: make(map[string][]time.Time)}
+	now := time.Now()
+
+	// A spread-out flood, one attempt per source, still hits the global cap
+	allowed := 0
+	for i := 0; i < connectGlobalLimit*4; i++ {
+		if l.allow(fmt.Sprintf("10.0.%d.%d", i/256, i%256), now) {
+			allowed++
+		}
+	}
+	if allowed != connectGlobalLimit {
+		t.Errorf("allowed %d attempts, want global cap %d", allowed, connectGlobalLimit)
+	}
+
+	if !l.allow("10.9.9.9", now.Add(connectRateWindow+time.Second)) {
+		t.Error("new connects should be allowed after the window")
+	}
+	if len(l.perIP) != 1 {
+		t.Errorf("limiter tracks %d addresses, expected quiet ones to be forgotten", len(l.perIP))
+	}
+}
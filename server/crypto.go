@@ -3,6 +3,7 @@
 package main
 
 import (
+	"ahcli/common"
 	"ahcli/common/logger"
 	"crypto/cipher"
 	"crypto/rand"
@@ -22,6 +23,10 @@ type ClientCrypto struct {
 	SharedSecret    [32]byte
 	Cipher          cipher.AEAD
 	Ready           bool
+
+	// Per-message keys when the client negotiated the ratchet; nil means Cipher is used
+	Send *common.Ratchet // server -> client
+	Recv *common.Ratchet // client -> server
 }
 
 // Server manages crypto for all clients
@@ -58,8 +63,9 @@ func InitServerCrypto() error {
 	return nil
 }
 
-// HandleHandshake processes client handshake and establishes shared secret
-func (scm *ServerCryptoManager) HandleHandshake(addr *net.UDPAddr, clientPublicKey [32]byte) ([32]byte, error) {
+// HandleHandshake processes client handshake and establishes shared secret.
+// With ratchet set, chat uses a fresh key per message instead of one session key.
+func (scm *ServerCryptoManager) HandleHandshake(addr *net.UDPAddr, clientPublicKey [32]byte, ratchet bool) ([32]byte, error) {
 	scm.mutex.Lock()
 	defer scm.mutex.Unlock()
 
@@ -88,14 +94,19 @@ func (scm *ServerCryptoManager) HandleHandshake(addr *net.UDPAddr, clientPublicK
 	}
 
 	// Store client crypto context
-	scm.clients[addrStr] = &ClientCrypto{
+	context := &ClientCrypto{
 		ClientPublicKey: clientPublicKey,
 		SharedSecret:    sharedSecret,
 		Cipher:          aead,
 		Ready:           true,
 	}
+	if ratchet {
+		context.Send = common.NewRatchet(derivedKey, common.RatchetServerToClient)
+		context.Recv = common.NewRatchet(derivedKey, common.RatchetClientToServer)
+	}
+	scm.clients[addrStr] = context
 
-	logger.Info("Established crypto context for client %s", addrStr)
+	logger.Info("Established crypto context for client %s (ratchet: %t)", addrStr, ratchet)
 	return scm.publicKey, nil
 }
 
@@ -109,6 +120,15 @@ func (scm *ServerCryptoManager) EncryptForClient(addr *net.UDPAddr, message stri
 		return nil, fmt.Errorf("no crypto context for client %s", addr.String())
 	}
 
+	if clientCrypto.Send != nil {
+		encrypted, err := clientCrypto.Send.Seal([]byte(message))
+		if err != nil {
+			return nil, err
+		}
+		logger.Debug("Encrypted %d bytes for client %s (ratchet)", len(message), addr.String())
+		return encrypted, nil
+	}
+
 	// Generate random nonce
 	nonce := make([]byte, clientCrypto.Cipher.NonceSize())
 	if _, err := rand.Read(nonce); err != nil {
@@ -138,6 +158,15 @@ func (scm *ServerCryptoManager) DecryptFromClient(addr *net.UDPAddr, data []byte
 		return "", fmt.Errorf("no crypto context for client %s", addr.String())
 	}
 
+	if clientCrypto.Recv != nil {
+		plaintext, err := clientCrypto.Recv.Open(data)
+		if err != nil {
+			return "", err
+		}
+		logger.Debug("Decrypted %d bytes from client %s (ratchet)", len(plaintext), addr.String())
+		return string(plaintext), nil
+	}
+
 	nonceSize := clientCrypto.Cipher.NonceSize()
 	if len(data) < nonceSize {
 		return "", fmt.Errorf("encrypted data too short")
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"ahcli/common"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/curve25519"
+)
+
+// clientSessionKey derives the client's view of the session key, as client/crypto.go does
+func clientSessionKey(clientPrivate, serverPublic [32]byte) [32]byte {
+	var shared, key [32]byte
+	curve25519.ScalarMult(&shared, &clientPrivate, &serverPublic)
+	h, _ := blake2b.New256(nil)
+	h.Write(shared[:])
+	h.Write([]byte("ahcli-chat-encryption"))
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+func TestRatchetHandshakeRoundTrip(t *testing.T) {
+	if err := InitServerCrypto(); err != nil {
+		t.Fatal(err)
+	}
+	clientPrivate, _ := generatePrivateKey()
+	var clientPublic [32]byte
+	curve25519.ScalarBaseMult(&clientPublic, &clientPrivate)
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40000}
+
+	serverPublic, err := serverCrypto.HandleHandshake(addr, clientPublic, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := clientSessionKey(clientPrivate, serverPublic)
+	clientSend := common.NewRatchet(key, common.RatchetClientToServer)
+	clientRecv := common.NewRatchet(key, common.RatchetServerToClient)
+
+	for _, msg := range []string{"first", "second"} {
+		sealed, _ := clientSend.Seal([]byte(msg))
+		got, err := serverCrypto.DecryptFromClient(addr, sealed)
+		if err != nil || got != msg {
+			t.Fatalf("server decrypt %q: got %q, %v", msg, got, err)
+		}
+
+		reply, err := serverCrypto.EncryptForClient(addr, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opened, err := clientRecv.Open(reply)
+		if err != nil || string(opened) != msg {
+			t.Fatalf("client decrypt %q: got %q, %v", msg, opened, err)
+		}
+	}
+
+	// A client that doesn't ask for the ratchet keeps the static session key
+	legacy := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40001}
+	serverCrypto.HandleHandshake(legacy, clientPublic, false)
+	sealed, _ := clientSend.Seal([]byte("ratcheted"))
+	if _, err := serverCrypto.DecryptFromClient(legacy, sealed); err == nil {
+		t.Error("legacy context opened a ratchet message")
+	}
+}
+
+func TestUndecryptableChatIsNotAckedOnRetransmit(t *testing.T) {
+	if err := InitServerCrypto(); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sender, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	addr := sender.LocalAddr().(*net.UDPAddr)
+	reserveNickname("garbled", addr, nil)
+	defer removeClientByAddr(addr)
+
+	clientPrivate, _ := generatePrivateKey()
+	var clientPublic [32]byte
+	curve25519.ScalarBaseMult(&clientPublic, &clientPrivate)
+	if _, err := serverCrypto.HandleHandshake(addr, clientPublic, true); err != nil {
+		t.Fatal(err)
+	}
+	defer serverCrypto.RemoveClient(addr)
+
+	// Corrupt payload, then the client's retransmit of it: neither may be acked
+	packet := []byte(`{"type":"encrypted_chat","msg_id":"m-corrupt","payload":"%%% not base64"}`)
+	buffer := make([]byte, common.MaxPacketSize)
+	for attempt := 1; attempt <= 2; attempt++ {
+		handleEncryptedChatMessage(conn, packet, addr, &ServerConfig{})
+		sender.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if n, _, err := sender.ReadFromUDP(buffer); err == nil {
+			t.Fatalf("attempt %d got %s, want no ack for a message that wasn't delivered", attempt, buffer[:n])
+		}
+	}
+}
+
+func TestRequiredEncryptionWithholdsPlaintextRelay(t *testing.T) {
+	if err := InitServerCrypto(); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	recipient, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recipient.Close()
+	addr := recipient.LocalAddr().(*net.UDPAddr)
+	reserveNickname("no-crypto", addr, nil) // Its handshake never finished
+	defer removeClientByAddr(addr)
+
+	read := func() map[string]interface{} {
+		buffer := make([]byte, common.MaxPacketSize)
+		recipient.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := recipient.ReadFromUDP(buffer)
+		if err != nil {
+			t.Fatalf("recipient got nothing: %v", err)
+		}
+		var msg map[string]interface{}
+		json.Unmarshal(buffer[:n], &msg)
+		return msg
+	}
+
+	broadcastEncryptedChatMessage(conn, "guid", "General", "alice", "secret plans", &ServerConfig{RequireEncryption: true})
+	if msg := read(); msg["type"] != common.MsgError || msg["code"] != common.CodeEncryptionRequired {
+		t.Errorf("got %v, want an encryption_required notice instead of the message", msg)
+	}
+
+	broadcastEncryptedChatMessage(conn, "guid", "General", "alice", "hello", &ServerConfig{})
+	if msg := read(); msg["type"] != common.MsgChatMessage || msg["message"] != "hello" {
+		t.Errorf("got %v, want the plaintext fallback when encryption isn't required", msg)
+	}
+}
@@ -3,18 +3,24 @@
 package main
 
 import (
+	"ahcli/common"
 	"ahcli/common/logger"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 type Channel struct {
-	GUID        string `json:"guid"`         // Permanent channel identifier
-	Name        string `json:"name"`         // Human-readable name (changeable)
-	AllowSpeak  bool   `json:"allow_speak"`  // Can users transmit voice
-	AllowListen bool   `json:"allow_listen"` // Can users receive voice
+	GUID        string `json:"guid"`            // Permanent channel identifier
+	Name        string `json:"name"`            // Human-readable name (changeable)
+	AllowSpeak  bool   `json:"allow_speak"`     // Can users transmit voice
+	AllowListen bool   `json:"allow_listen"`    // Can users receive voice
+	Topic       string `json:"topic,omitempty"` // Shown to users when they join
 }
 
 type ChatConfig struct {
@@ -22,16 +28,44 @@ type ChatConfig struct {
 	LogFile          string `json:"log_file"`            // Chat log file path
 	MaxMessages      int    `json:"max_messages"`        // Circular buffer size
 	LoadRecentOnJoin int    `json:"load_recent_on_join"` // Messages to load when joining channel
+
+	FilterWords []string `json:"filter_words"` // Whole words masked with asterisks (case-insensitive)
+	LogFormat   string   `json:"log_format"`   // "text" (default) or "json" lines
 }
 
 type ServerConfig struct {
+	ConfigVersion int `json:"config_version"` // Schema version, upgraded on load; see configmigrate.go
+
 	ServerName string     `json:"server_name"`
 	ListenPort int        `json:"listen_port"`
 	SharedKey  string     `json:"shared_key"`
 	AdminKey   string     `json:"admin_key"`
 	MOTD       string     `json:"motd"`
+	MOTDFile   string     `json:"motd_file"` // Multi-line MOTD, re-read on change or SIGHUP; falls back to motd
+	BanFile    string     `json:"ban_file"`  // Persisted IP bans, defaults to bans.json
 	Channels   []Channel  `json:"channels"`
 	Chat       ChatConfig `json:"chat"`
+
+	MinClientVersion string `json:"min_client_version"` // Advertised to clients; empty disables the check
+	FrameSizeMs      int    `json:"frame_size_ms"`      // Audio frame size for all clients: 10, 20, 40 or 60
+	PacketWorkers    int    `json:"packet_workers"`     // Goroutines handling packets; 0 picks one per CPU (at least 4)
+
+	RequireEncryption bool `json:"require_encryption"` // Refuse plaintext chat; advertised so clients never fall back
+	NicknameSuffixes  bool `json:"nickname_suffixes"`  // When all requested nicknames are taken, accept as alice2, alice3...
+
+	MaxAudioPacketBytes int `json:"max_audio_packet_bytes"` // Larger audio packets aren't relayed; 0 = as many frames as a client may coalesce
+
+	ClientTimeoutSeconds int           `json:"client_timeout_seconds"` // Drop clients silent this long; 0 = 45
+	ClientTimeout        time.Duration `json:"-"`
+
+	MaxMonitorChannels int `json:"max_monitor_channels"` // Other channels a user may hear at once, receive-only; 0 disables
+
+	// Audio packet prefixes as hex, e.g. "0x5541"; empty for the defaults. Clients must use the same.
+	AudioMagicHex       string            `json:"audio_magic"`
+	AudioSourceMagicHex string            `json:"audio_source_magic"`
+	AudioMagic          common.AudioMagic `json:"-"` // Parsed from the two above
+
+	Theme common.Theme `json:"theme"` // Optional branding for clients' web UI
 }
 
 var (
@@ -48,9 +82,142 @@ func loadServerConfig(path string) (*ServerConfig, error) {
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, err
 	}
+
+	// Upgrade older files before the defaults below fill in for this run only
+	fromVersion := config.ConfigVersion
+	migrated, err := migrateServerConfig(data, &config)
+	if err != nil {
+		return nil, err
+	}
+	if migrated {
+		rewriteMigratedConfig(path, data, fromVersion, &config)
+	}
+
+	if config.Chat.MaxMessages < minChatMaxMessages {
+		logger.Warn("chat.max_messages=%d is below the minimum %d, using %d",
+			config.Chat.MaxMessages, minChatMaxMessages, defaultChatMaxMessages)
+		config.Chat.MaxMessages = defaultChatMaxMessages
+	}
+	if config.Chat.LogFile == "" {
+		config.Chat.LogFile = defaultChatLogFile
+	}
+
+	if config.Chat.LoadRecentOnJoin > maxRecentOnJoin {
+		logger.Warn("chat.load_recent_on_join=%d is too high, capping at %d",
+			config.Chat.LoadRecentOnJoin, maxRecentOnJoin)
+		config.Chat.LoadRecentOnJoin = maxRecentOnJoin
+	} else if config.Chat.LoadRecentOnJoin < 0 {
+		logger.Warn("chat.load_recent_on_join=%d is negative, using 0", config.Chat.LoadRecentOnJoin)
+		config.Chat.LoadRecentOnJoin = 0
+	}
+
+	switch config.Chat.LogFormat {
+	case "":
+		config.Chat.LogFormat = chatLogText
+	case chatLogText, chatLogJSON:
+	default:
+		logger.Warn("chat.log_format=%q is not supported (text, json), using text", config.Chat.LogFormat)
+		config.Chat.LogFormat = chatLogText
+	}
+
+	if config.PacketWorkers <= 0 {
+		config.PacketWorkers = defaultPacketWorkers()
+	}
+
+	magic, err := common.ParseAudioMagic(config.AudioMagicHex, config.AudioSourceMagicHex)
+	if err != nil {
+		logger.Warn("%v, using the default audio magic %s", err, common.DefaultAudioMagic)
+		magic = common.DefaultAudioMagic
+	}
+	config.AudioMagic = magic
+
+	if config.BanFile == "" {
+		config.BanFile = defaultBanFile
+	}
+
+	if config.FrameSizeMs == 0 {
+		config.FrameSizeMs = common.DefaultFrameSizeMs
+	} else if !common.ValidFrameSizeMs(config.FrameSizeMs) {
+		logger.Warn("frame_size_ms=%d is not supported (10, 20, 40, 60), using %d",
+			config.FrameSizeMs, common.DefaultFrameSizeMs)
+		config.FrameSizeMs = common.DefaultFrameSizeMs
+	}
+
+	frameBytes := common.AudioPacketSize(config.FrameSizeMs)
+	coalescedBytes := common.AudioPacketSize(config.FrameSizeMs * common.FramesPerPacketLimit(config.FrameSizeMs))
+	if config.MaxAudioPacketBytes == 0 {
+		config.MaxAudioPacketBytes = coalescedBytes
+	} else if config.MaxAudioPacketBytes < frameBytes || config.MaxAudioPacketBytes > common.MaxPacketSize {
+		logger.Warn("max_audio_packet_bytes=%d must be between %d and %d, using %d",
+			config.MaxAudioPacketBytes, frameBytes, common.MaxPacketSize, coalescedBytes)
+		config.MaxAudioPacketBytes = coalescedBytes
+	}
+
+	config.ClientTimeout = defaultClientTimeout
+	if config.ClientTimeoutSeconds != 0 {
+		timeout := time.Duration(config.ClientTimeoutSeconds) * time.Second
+		if timeout < minClientTimeout {
+			logger.Warn("client_timeout_seconds=%d is below the minimum %d, using %d",
+				config.ClientTimeoutSeconds, int(minClientTimeout.Seconds()), int(defaultClientTimeout.Seconds()))
+		} else {
+			config.ClientTimeout = timeout
+		}
+	}
+
+	if config.MaxMonitorChannels < 0 {
+		logger.Warn("max_monitor_channels=%d is negative, disabling monitoring", config.MaxMonitorChannels)
+		config.MaxMonitorChannels = 0
+	}
+
+	theme, problems := config.Theme.Sanitize()
+	for _, problem := range problems {
+		logger.Warn("%v, leaving it out", problem)
+	}
+	config.Theme = theme
+
 	return &config, nil
 }
 
+// How long clients are asked to wait before reconnecting after a shutdown;
+// long enough for a restart
+const shutdownRetryAfter = 15 * time.Second
+
+// broadcastShutdown tells every connected client the server is stopping.
+// Returns how many were told.
+func broadcastShutdown(conn *net.UDPConn) int {
+	notice := common.ServerShutdown{
+		Type:          common.MsgServerShutdown,
+		Message:       "Server is shutting down",
+		RetryAfterSec: int(shutdownRetryAfter.Seconds()),
+	}
+	recipients := allClientAddrs()
+	for _, addr := range recipients {
+		if err := sendJSON(conn, addr, notice); err != nil {
+			logger.Debug("Failed to send shutdown notice to %s: %v", addr, err)
+		}
+	}
+	return len(recipients)
+}
+
+// watchShutdownSignal exits cleanly on SIGINT or SIGTERM: clients hear about it
+// instead of timing out, and the chat log and server log are closed
+func watchShutdownSignal(conn *net.UDPConn) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		logger.Info("Received %v, shutting down", sig)
+		told := broadcastShutdown(conn)
+		logger.Info("Shutdown notice sent to %d clients", told)
+
+		CloseChatStorage()
+		logger.Info("=== AHCLI Server Stopped ===")
+		logger.Close()
+		os.Exit(0)
+	}()
+}
+
 func main() {
 	// Parse command line flags FIRST
 	flag.Parse()
@@ -66,7 +233,7 @@ func main() {
 	// Set debug mode from command line flag
 	logger.SetDebugMode(*debugMode)
 
-	logger.Info("=== AHCLI Server Starting ===")
+	logger.Info("=== AHCLI Server Starting (v%s) ===", common.CurrentVersion)
 	if *debugMode {
 		logger.Debug("Debug mode enabled")
 	}
@@ -84,13 +251,26 @@ func main() {
 	logger.Debug("Server Name: %s", config.ServerName)
 	logger.Debug("Port: %d", config.ListenPort)
 	logger.Debug("MOTD: %s", config.MOTD)
-	logger.Debug("Chat enabled: %t", config.Chat.Enabled)
+	logger.Debug("MOTD file: %s", config.MOTDFile)
+	logger.Debug("Audio frame size: %dms, magic: %s", config.FrameSizeMs, config.AudioMagic)
+	logger.Debug("Max monitored channels per user: %d", config.MaxMonitorChannels)
+	logger.Debug("Theme: name=%q, logo=%q, %d colors", config.Theme.Name, config.Theme.LogoURL, len(config.Theme.Colors))
+	logger.Debug("Chat enabled: %t (log format: %s, require encryption: %t)",
+		config.Chat.Enabled, config.Chat.LogFormat, config.RequireEncryption)
 
 	for _, ch := range config.Channels {
 		logger.Debug("Channel: %s (GUID: %s, speak: %t, listen: %t)",
 			ch.Name, ch.GUID, ch.AllowSpeak, ch.AllowListen)
 	}
 
+	loadChannelTopics(config.Channels)
+
+	if err := loadBans(config.BanFile); err != nil {
+		logger.Fatal("Failed to load ban list: %v", err)
+		return
+	}
+	logger.Info("Ban list loaded - %s", config.BanFile)
+
 	// Initialize chat storage system
 	err = InitChatStorage(config)
 	if err != nil {
@@ -101,6 +281,11 @@ func main() {
 	logger.Info("Chat system initialized - log: %s, max messages: %d",
 		config.Chat.LogFile, config.Chat.MaxMessages)
 
+	InitChatFilter(config)
+
+	reloadMOTD(config)
+	watchReloadSignal(config)
+
 	// Initialize server crypto system
 	err = InitServerCrypto()
 	if err != nil {
@@ -0,0 +1,232 @@
+// FILE: server/moderation.go
+
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// actor is whoever sent a moderation command
+type actor struct {
+	Name    string // nickname, or the address of a key holder who isn't connected
+	Role    string
+	Channel string // empty for key holders who aren't connected
+}
+
+// resolveActor works out the sender's role. A valid admin key makes the sender an
+// admin even if they aren't connected; otherwise their client's role applies.
+func resolveActor(addr *net.UDPAddr, key string, config *ServerConfig) (actor, bool) {
+	client, connected := findClientByAddr(addr)
+
+	if key != "" && config.AdminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(config.AdminKey)) == 1 {
+		a := actor{Name: addr.String(), Role: common.RoleAdmin}
+		if connected {
+			a.Name, a.Channel = client.Nickname, client.Channel
+		}
+		return a, true
+	}
+
+	if !connected {
+		return actor{}, false
+	}
+	return actor{Name: client.Nickname, Role: client.Role, Channel: client.Channel}, true
+}
+
+// canModerate reports whether the actor may act on target: admins on anyone,
+// moderators only on lower-ranked users in their own channel
+func (a actor) canModerate(target Client) bool {
+	switch a.Role {
+	case common.RoleAdmin:
+		return true
+	case common.RoleModerator:
+		return target.Channel == a.Channel && common.RoleRank(target.Role) < common.RoleRank(a.Role)
+	}
+	return false
+}
+
+// sendModerationError tells the sender why a moderation command was refused;
+// code is a common.Code* value
+func sendModerationError(conn *net.UDPConn, addr *net.UDPAddr, code, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	sessionLog(addr).Warn("Moderation command from %s refused: %s", addr, message)
+	sendJSON(conn, addr, common.ErrorMessage{
+		Type:    common.MsgError,
+		Code:    code,
+		Message: message,
+	})
+}
+
+// sendModerationAck confirms a moderation command to the sender
+func sendModerationAck(conn *net.UDPConn, addr *net.UDPAddr, action, target string) {
+	sendJSON(conn, addr, map[string]interface{}{
+		"type":   common.MsgModerationAck,
+		"action": action,
+		"target": target,
+	})
+}
+
+// handleSetRole assigns admin/moderator/user to a connected client. Admins only.
+func handleSetRole(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
+	var req struct {
+		Key      string `json:"key"`
+		Nickname string `json:"nickname"`
+		Role     string `json:"role"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return
+	}
+
+	sender, ok := resolveActor(addr, req.Key, config)
+	if !ok || sender.Role != common.RoleAdmin {
+		sendModerationError(conn, addr, common.CodeNotAllowed, "Only admins can assign roles")
+		return
+	}
+	if !common.ValidRole(req.Role) {
+		sendModerationError(conn, addr, common.CodeInvalidRequest, "Unknown role %q (use admin, moderator or user)", req.Role)
+		return
+	}
+
+	target, ok := findClientByNickname(req.Nickname)
+	if !ok || !setClientRole(req.Nickname, req.Role) {
+		sendModerationError(conn, addr, common.CodeNotFound, "No user named %s", req.Nickname)
+		return
+	}
+
+	logger.Info("%s set role of %s to %s", sender.Name, req.Nickname, req.Role)
+	sendModerationAck(conn, addr, "set_role", req.Nickname)
+	broadcastChannelUserUpdate(conn)
+	broadcastSystemMessage(conn, target.Channel, nil, fmt.Sprintf("%s is now %s", req.Nickname, req.Role))
+}
+
+// handleKick disconnects a user. Moderators can kick users in their own channel.
+func handleKick(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
+	var req struct {
+		Key      string `json:"key"`
+		Nickname string `json:"nickname"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return
+	}
+
+	sender, ok := resolveActor(addr, req.Key, config)
+	if !ok {
+		sendModerationError(conn, addr, common.CodeNotAllowed, "Not allowed to kick")
+		return
+	}
+	target, ok := findClientByNickname(req.Nickname)
+	if !ok {
+		sendModerationError(conn, addr, common.CodeNotFound, "No user named %s", req.Nickname)
+		return
+	}
+	if !sender.canModerate(target) {
+		sendModerationError(conn, addr, common.CodeNotAllowed, "Not allowed to kick %s", req.Nickname)
+		return
+	}
+
+	kickClient(conn, target, sender.Name, req.Reason)
+	sendModerationAck(conn, addr, "kick", req.Nickname)
+}
+
+// kickClient removes a client and tells them and their channel why
+func kickClient(conn *net.UDPConn, target Client, by, reason string) {
+	if removeClientByAddr(target.Addr) == nil {
+		return
+	}
+	serverCrypto.RemoveClient(target.Addr)
+
+	sendJSON(conn, target.Addr, map[string]interface{}{
+		"type":   common.MsgKicked,
+		"by":     by,
+		"reason": reason,
+	})
+
+	notice := fmt.Sprintf("%s was kicked by %s", target.Nickname, by)
+	if reason != "" {
+		notice += ": " + reason
+	}
+	logger.Info("%s", notice)
+
+	broadcastChannelUserUpdate(conn)
+	broadcastSystemMessage(conn, target.Channel, nil, notice)
+}
+
+// Longest timed mute; longer requests are capped
+const maxMuteDuration = 24 * time.Hour
+
+// handleMuteUser server-mutes or unmutes a user. A positive duration_sec makes the mute expire on its own.
+func handleMuteUser(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig, mute bool) {
+	var req struct {
+		Key         string `json:"key"`
+		Nickname    string `json:"nickname"`
+		DurationSec int    `json:"duration_sec"`
+		Reason      string `json:"reason"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return
+	}
+
+	action := "unmute_user"
+	if mute {
+		action = "mute_user"
+	}
+
+	sender, ok := resolveActor(addr, req.Key, config)
+	if !ok {
+		sendModerationError(conn, addr, common.CodeNotAllowed, "Not allowed to %s", action)
+		return
+	}
+	target, ok := findClientByNickname(req.Nickname)
+	if !ok {
+		sendModerationError(conn, addr, common.CodeNotFound, "No user named %s", req.Nickname)
+		return
+	}
+	if !sender.canModerate(target) {
+		sendModerationError(conn, addr, common.CodeNotAllowed, "Not allowed to %s %s", action, req.Nickname)
+		return
+	}
+
+	var duration time.Duration
+	var until time.Time
+	if mute && req.DurationSec > 0 {
+		duration = time.Duration(min(req.DurationSec, int(maxMuteDuration/time.Second))) * time.Second
+		until = time.Now().Add(duration)
+	}
+	setClientMute(req.Nickname, mute, until)
+
+	notice := fmt.Sprintf("%s was unmuted by %s", req.Nickname, sender.Name)
+	if mute {
+		notice = fmt.Sprintf("%s was muted by %s", req.Nickname, sender.Name)
+		if duration > 0 {
+			notice += fmt.Sprintf(" for %v", duration)
+		}
+		if req.Reason != "" {
+			notice += ": " + req.Reason
+		}
+	}
+	logger.Info("%s", notice)
+
+	sendModerationAck(conn, addr, action, req.Nickname)
+	broadcastChannelUserUpdate(conn)
+	broadcastSystemMessage(conn, target.Channel, nil, notice)
+
+	// Timed mutes lift themselves; tell everyone when they do
+	if !until.IsZero() {
+		time.AfterFunc(duration, func() {
+			if !expireMute(req.Nickname, until) {
+				return
+			}
+			logger.Info("Mute on %s expired", req.Nickname)
+			broadcastChannelUserUpdate(conn)
+			if client, ok := findClientByNickname(req.Nickname); ok {
+				broadcastSystemMessage(conn, client.Channel, nil, fmt.Sprintf("%s is no longer muted", req.Nickname))
+			}
+		})
+	}
+}
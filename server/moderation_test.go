@@ -0,0 +1,95 @@
+package main
+
+import (
+	"ahcli/common"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCanModerate(t *testing.T) {
+	user := Client{Nickname: "u", Channel: "General"}
+	otherChannel := Client{Nickname: "o", Channel: "Gaming"}
+	mod := Client{Nickname: "m", Channel: "General", Role: common.RoleModerator}
+	admin := Client{Nickname: "a", Channel: "General", Role: common.RoleAdmin}
+
+	tests := []struct {
+		name   string
+		actor  actor
+		target Client
+		want   bool
+	}{
+		{"admin on user", actor{Role: common.RoleAdmin, Channel: "Gaming"}, user, true},
+		{"admin on admin", actor{Role: common.RoleAdmin}, admin, true},
+		{"moderator on user in channel", actor{Role: common.RoleModerator, Channel: "General"}, user, true},
+		{"moderator on other channel", actor{Role: common.RoleModerator, Channel: "General"}, otherChannel, false},
+		{"moderator on moderator", actor{Role: common.RoleModerator, Channel: "General"}, mod, false},
+		{"moderator on admin", actor{Role: common.RoleModerator, Channel: "General"}, admin, false},
+		{"user on user", actor{Role: "", Channel: "General"}, user, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.actor.canModerate(tt.target); got != tt.want {
+			t.Errorf("%s: canModerate = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveActor(t *testing.T) {
+	config := &ServerConfig{AdminKey: "secret"}
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40020}
+	stranger := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40021}
+
+	reserveNickname("erin", addr, nil)
+	defer removeClientByAddr(addr)
+
+	if a, ok := resolveActor(addr, "", config); !ok || a.Role != "" || a.Name != "erin" {
+		t.Errorf("connected user without key: got %+v, %t", a, ok)
+	}
+
+	setClientRole("erin", common.RoleModerator)
+	if a, _ := resolveActor(addr, "", config); a.Role != common.RoleModerator {
+		t.Errorf("role not picked up: got %+v", a)
+	}
+
+	if a, ok := resolveActor(stranger, "secret", config); !ok || a.Role != common.RoleAdmin {
+		t.Errorf("key holder should be admin: got %+v, %t", a, ok)
+	}
+	if _, ok := resolveActor(stranger, "wrong", config); ok {
+		t.Error("unconnected sender with a bad key should be refused")
+	}
+	if _, ok := resolveActor(stranger, "", &ServerConfig{}); ok {
+		t.Error("empty admin key must never match")
+	}
+}
+
+func TestTimedMuteExpires(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40022}
+	reserveNickname("frank", addr, nil)
+	defer removeClientByAddr(addr)
+
+	now := time.Now()
+	until := now.Add(time.Minute)
+	setClientMute("frank", true, until)
+
+	if !clientMuted(addr, now) {
+		t.Fatal("client should be muted before the deadline")
+	}
+	if clientMuted(addr, until.Add(time.Second)) {
+		t.Error("mute should lapse after the deadline even before expireMute runs")
+	}
+
+	// A newer mute replaces the timed one; the old timer must not lift it
+	setClientMute("frank", true, time.Time{})
+	if expireMute("frank", until) {
+		t.Error("stale expiry cleared a newer mute")
+	}
+	if !clientMuted(addr, until.Add(time.Hour)) {
+		t.Error("indefinite mute should not expire")
+	}
+
+	setClientMute("frank", false, time.Time{})
+	if clientMuted(addr, now) {
+		t.Error("client should be unmuted")
+	}
+}
@@ -0,0 +1,96 @@
+// FILE: server/motd.go
+
+package main
+
+import (
+	"ahcli/common/logger"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Max bytes of MOTD sent to clients - it rides in the connect reply
+const maxMOTDSize = 2048
+
+var motdCache struct {
+	sync.Mutex
+	text    string
+	modTime time.Time
+	loaded  bool
+}
+
+// currentMOTD returns the MOTD to send at connect time: the motd_file contents
+// if configured and readable, otherwise the inline motd. The file is re-read
+// whenever it changes on disk, so edits take effect without a restart.
+func currentMOTD(config *ServerConfig) string {
+	if config.MOTDFile == "" {
+		return config.MOTD
+	}
+
+	info, err := os.Stat(config.MOTDFile)
+	if err != nil {
+		logger.Debug("MOTD file %s unavailable (%v), using inline motd", config.MOTDFile, err)
+		return config.MOTD
+	}
+
+	motdCache.Lock()
+	stale := !motdCache.loaded || !info.ModTime().Equal(motdCache.modTime)
+	motdCache.Unlock()
+
+	if stale {
+		reloadMOTD(config)
+	}
+
+	motdCache.Lock()
+	defer motdCache.Unlock()
+	if !motdCache.loaded {
+		return config.MOTD
+	}
+	return motdCache.text
+}
+
+// reloadMOTD re-reads the MOTD file into the cache. On failure the inline motd is used.
+func reloadMOTD(config *ServerConfig) {
+	if config.MOTDFile == "" {
+		return
+	}
+
+	info, statErr := os.Stat(config.MOTDFile)
+	data, err := os.ReadFile(config.MOTDFile)
+
+	motdCache.Lock()
+	defer motdCache.Unlock()
+
+	if err != nil || statErr != nil {
+		logger.Warn("Failed to read MOTD file %s, falling back to inline motd: %v", config.MOTDFile, err)
+		motdCache.loaded = false
+		return
+	}
+
+	text := strings.TrimSpace(strings.ReplaceAll(string(data), "\r\n", "\n"))
+	if len(text) > maxMOTDSize {
+		logger.Warn("MOTD file %s is %d bytes, truncating to %d", config.MOTDFile, len(text), maxMOTDSize)
+		text = strings.ToValidUTF8(text[:maxMOTDSize], "")
+	}
+
+	motdCache.text = text
+	motdCache.modTime = info.ModTime()
+	motdCache.loaded = true
+	logger.Info("Loaded MOTD from %s (%d lines)", config.MOTDFile, strings.Count(text, "\n")+1)
+}
+
+// watchReloadSignal re-reads reloadable settings (currently the MOTD file) on SIGHUP
+func watchReloadSignal(config *ServerConfig) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			logger.Info("Reload signal received")
+			reloadMOTD(config)
+		}
+	}()
+}
@@ -6,8 +6,12 @@ import (
 	"ahcli/common"
 	"ahcli/common/logger"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
+	"strings"
 	"time"
 )
 
@@ -24,7 +28,19 @@ func startUDPServer(config *ServerConfig) {
 	defer conn.Close()
 	logger.Info("Listening on UDP %d...", config.ListenPort)
 
-	buffer := make([]byte, 4096)
+	// A fixed pool handles packets so an audio flood can't spawn unbounded goroutines
+	workers := startPacketWorkers(config.PacketWorkers, packetQueueSize, func(p udpPacket) {
+		handlePacket(conn, p.data, p.addr, config)
+	})
+	defer workers.stop()
+	logger.Info("Handling packets with %d workers", config.PacketWorkers)
+
+	watchShutdownSignal(conn)
+	go logStatsPeriodically()
+	go runClientReaper(conn, config.ClientTimeout)
+	logger.Info("Clients time out after %v without packets", config.ClientTimeout)
+
+	buffer := make([]byte, common.MaxPacketSize)
 	for {
 		n, clientAddr, err := conn.ReadFromUDP(buffer)
 		if err != nil {
@@ -35,60 +51,168 @@ func startUDPServer(config *ServerConfig) {
 		// Copy data so it's safe across goroutines
 		packet := make([]byte, n)
 		copy(packet, buffer[:n])
-		go handlePacket(conn, packet, clientAddr, config)
+		workers.submit(udpPacket{data: packet, addr: clientAddr})
 	}
 }
 
 func handlePacket(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
-	// Try JSON parsing first
+	// Banned addresses only get as far as the connect rejection
+	if bans.isBanned(addr.IP) && !isConnectPacket(data) {
+		if bans.shouldLogDrop(addr.IP.String(), time.Now()) {
+			logger.Info("Dropping packets from banned address %s", addr.IP)
+		}
+		return
+	}
+	now := time.Now()
+	known := touchClient(addr, now)
+
+	// Audio is most of the traffic and never JSON: skip the parse attempt.
+	// Audio from unknown addresses is dropped without a word: two bytes would
+	// otherwise buy a spoofed victim a whole error message.
+	if config.AudioMagic.IsAudio(data) {
+		if !known {
+			return
+		}
+		handleAudioData(conn, data, addr, config)
+		return
+	}
+
 	var raw map[string]interface{}
 	if err := json.Unmarshal(data, &raw); err == nil {
+		if !known && needsSession(raw) {
+			notifyNotConnected(conn, addr, now)
+			return
+		}
 		switch raw["type"] {
-		case "connect":
+		case common.MsgConnect:
 			handleConnect(conn, data, addr, config)
 
-		case "crypto_handshake":
+		case common.MsgCryptoHandshake:
 			handleCryptoHandshake(conn, data, addr)
 
-		case "change_channel":
+		case common.MsgChangeChannel:
 			handleChangeChannel(conn, data, addr)
 
-		case "chat":
-			handleChatMessage(conn, data, addr)
+		case common.MsgMonitorChannel:
+			handleMonitorChannel(conn, data, addr, config)
+
+		case common.MsgChat:
+			handleChatMessage(conn, data, addr, config)
+
+		case common.MsgEncryptedChat:
+			handleEncryptedChatMessage(conn, data, addr, config)
+
+		case common.MsgTyping:
+			handleTyping(conn, data, addr)
 
-		case "encrypted_chat":
-			handleEncryptedChatMessage(conn, data, addr)
+		case common.MsgTransmitEnd:
+			handleTransmitEnd(conn, addr)
 
-		case "ping":
+		case common.MsgSetStatus:
+			handleSetStatus(conn, data, addr)
+
+		case common.MsgPing:
 			handlePing(conn, addr)
+
+		case common.MsgEcho:
+			handleEcho(conn, data, addr)
+
+		case common.MsgDisconnect:
+			handleDisconnect(conn, addr)
+
+		case common.MsgAnnounce:
+			handleAnnounce(conn, data, addr, config)
+
+		case common.MsgSetRole:
+			handleSetRole(conn, data, addr, config)
+
+		case common.MsgKick:
+			handleKick(conn, data, addr, config)
+
+		case common.MsgBan:
+			handleBan(conn, data, addr, config)
+
+		case common.MsgUnban:
+			handleUnban(conn, data, addr, config)
+
+		case common.MsgMuteUser:
+			handleMuteUser(conn, data, addr, config, true)
+
+		case common.MsgUnmuteUser:
+			handleMuteUser(conn, data, addr, config, false)
+
+		case common.MsgSetTopic:
+			handleSetTopic(conn, data, addr, config)
+
+		case common.MsgStats:
+			handleStats(conn, data, addr, config)
 		}
 		return
 	}
 
 	// Not JSON: treat as raw audio
-	handleAudioData(conn, data, addr)
+	handleAudioData(conn, data, addr, config)
 }
 
 func handleConnect(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
+	// Every connect can reserve a nickname, so floods are dropped before any work
+	if !connectLimits.allow(addr.IP.String(), time.Now()) {
+		return
+	}
+
 	var req common.ConnectRequest
 	if err := json.Unmarshal(data, &req); err != nil {
 		return
 	}
 
-	var nickname string
+	if bans.isBanned(addr.IP) {
+		if bans.shouldLogDrop(addr.IP.String(), time.Now()) {
+			logger.Info("Rejected connection from banned address %s", addr)
+		}
+		sendJSON(conn, addr, common.Reject{Type: common.MsgReject, Code: common.CodeBanned, Message: "You are banned"})
+		return
+	}
+
+	var nickname, firstValid string
+	var invalidReason error
+	validCount := 0
 	for _, try := range req.Nicklist {
-		if reserveNickname(try, addr) {
+		if err := validateNickname(try); err != nil {
+			logger.Debug("Rejected nickname %q from %s: %v", try, addr, err)
+			invalidReason = err
+			continue
+		}
+		validCount++
+		if firstValid == "" {
+			firstValid = try
+		}
+		if reserveNickname(try, addr, req.Capabilities) {
 			nickname = try
 			break
 		}
 	}
+	if nickname == "" && firstValid != "" && config.NicknameSuffixes {
+		nickname = reserveSuffixedNickname(firstValid, addr, req.Capabilities)
+		if nickname != "" {
+			sessionLog(addr).Info("All nicknames from %s taken, assigned %s", addr, nickname)
+		}
+	}
 	if nickname == "" {
-		reject := common.Reject{Type: "reject", Message: "All nicknames are taken"}
+		code, message := common.CodeNicknameTaken, "All nicknames are taken"
+		if validCount == 0 && invalidReason != nil {
+			code, message = common.CodeInvalidNickname, "Invalid nickname: "+invalidReason.Error()
+		}
+		logger.Info("Rejected connection from %s: %s", addr, message)
+		reject := common.Reject{Type: common.MsgReject, Code: code, Message: message}
 		sendJSON(conn, addr, reject)
 		return
 	}
 
-	logger.Info("Client %s connected from %s", nickname, addr.String())
+	sessionLog(addr).Info("Client %s connected from %s (version: %s)", nickname, addr.String(), req.Version)
+	stats.recordConnect(clientCount())
+	if req.FrameSizeMs != 0 && req.FrameSizeMs != config.FrameSizeMs {
+		sessionLog(addr).Debug("Client %s prefers %dms frames, server uses %dms", nickname, req.FrameSizeMs, config.FrameSizeMs)
+	}
 
 	// Get channel names from config
 	channelNames := make([]string, len(config.Channels))
@@ -97,14 +221,44 @@ func handleConnect(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *Se
 	}
 
 	resp := common.ConnectAccepted{
-		Type:       "accept",
+		Type:       common.MsgAccept,
 		Nickname:   nickname,
 		ServerName: config.ServerName,
-		MOTD:       config.MOTD,
+		MOTD:       currentMOTD(config),
 		Channels:   channelNames,
-		Users:      listNicknames(),
+		Users:      listUsers(),
+
+		ServerVersion:    common.CurrentVersion,
+		MinClientVersion: config.MinClientVersion,
+
+		Capabilities: []string{common.CapabilityTyping, common.CapabilityAudioSource, common.CapabilityUserInfo, common.CapabilityEcho, common.CapabilityCoalesce, common.CapabilityTransmitEnd},
+		FrameSizeMs:  config.FrameSizeMs,
+		SourceIDs:    sourceIDs(),
+		Topics:       allChannelTopics(),
+
+		RequireEncryption: config.RequireEncryption,
+	}
+	if config.MaxMonitorChannels > 0 {
+		resp.Capabilities = append(resp.Capabilities, common.CapabilityMonitor)
+	}
+	if config.AudioMagic != common.DefaultAudioMagic {
+		magic := config.AudioMagic
+		resp.AudioMagic = &magic
+	}
+	if !config.Theme.IsZero() {
+		theme := config.Theme
+		resp.Theme = &theme
 	}
-	sendJSON(conn, addr, resp)
+	if common.HasCapability(req.Capabilities, common.CapabilityUserInfo) {
+		sendJSON(conn, addr, resp)
+	} else {
+		sendJSON(conn, addr, legacyAccept(resp))
+	}
+
+	// Let everyone else learn the newcomer (and its audio source ID)
+	broadcastChannelUserUpdate(conn)
+
+	broadcastSystemEvent(conn, "General", addr, fmt.Sprintf("%s joined #General", nickname), common.SystemEventJoin)
 
 	// Send recent chat history for the default channel (General)
 	if chatStorage != nil && chatStorage.enabled {
@@ -116,25 +270,21 @@ func handleConnect(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *Se
 }
 
 func handleCryptoHandshake(conn *net.UDPConn, data []byte, addr *net.UDPAddr) {
-	var handshake struct {
-		Type      string `json:"type"`
-		PublicKey string `json:"public_key"` // base64 encoded
-	}
-
+	var handshake common.CryptoHandshake
 	if err := json.Unmarshal(data, &handshake); err != nil {
-		logger.Error("Malformed crypto handshake from %s: %v", addr, err)
+		sessionLog(addr).Error("Malformed crypto handshake from %s: %v", addr, err)
 		return
 	}
 
 	// Decode client public key
 	clientPubKeyBytes, err := base64.StdEncoding.DecodeString(handshake.PublicKey)
 	if err != nil {
-		logger.Error("Invalid public key from %s: %v", addr, err)
+		sessionLog(addr).Error("Invalid public key from %s: %v", addr, err)
 		return
 	}
 
 	if len(clientPubKeyBytes) != 32 {
-		logger.Error("Invalid public key length from %s: %d bytes", addr, len(clientPubKeyBytes))
+		sessionLog(addr).Error("Invalid public key length from %s: %d bytes", addr, len(clientPubKeyBytes))
 		return
 	}
 
@@ -142,86 +292,155 @@ func handleCryptoHandshake(conn *net.UDPConn, data []byte, addr *net.UDPAddr) {
 	copy(clientPubKey[:], clientPubKeyBytes)
 
 	// Process handshake through crypto manager
-	serverPubKey, err := serverCrypto.HandleHandshake(addr, clientPubKey)
+	serverPubKey, err := serverCrypto.HandleHandshake(addr, clientPubKey, handshake.Ratchet)
 	if err != nil {
-		logger.Error("Crypto handshake failed for %s: %v", addr, err)
+		sessionLog(addr).Error("Crypto handshake failed for %s: %v", addr, err)
 
 		// Send error response
-		errorResp := map[string]string{
-			"type":   "crypto_handshake_response",
-			"status": "error",
-			"error":  "Handshake failed",
+		errorResp := common.CryptoHandshakeResponse{
+			Type:   common.MsgCryptoHandshakeResponse,
+			Status: "error",
+			Error:  "Handshake failed",
 		}
 		sendJSON(conn, addr, errorResp)
 		return
 	}
 
 	// Send success response with server public key
-	response := map[string]string{
-		"type":       "crypto_handshake_response",
-		"status":     "success",
-		"public_key": base64.StdEncoding.EncodeToString(serverPubKey[:]),
+	response := common.CryptoHandshakeResponse{
+		Type:      common.MsgCryptoHandshakeResponse,
+		Status:    "success",
+		PublicKey: base64.StdEncoding.EncodeToString(serverPubKey[:]),
+		Ratchet:   handshake.Ratchet,
 	}
 
 	err = sendJSON(conn, addr, response)
 	if err != nil {
-		logger.Error("Failed to send crypto handshake response to %s: %v", addr, err)
+		sessionLog(addr).Error("Failed to send crypto handshake response to %s: %v", addr, err)
 		return
 	}
 
-	logger.Info("Crypto handshake completed for client %s", addr.String())
+	sessionLog(addr).Info("Crypto handshake completed for client %s", addr.String())
 }
 
 func handleChangeChannel(conn *net.UDPConn, data []byte, addr *net.UDPAddr) {
-	var req struct {
-		Type    string `json:"type"`
-		Channel string `json:"channel"`
-	}
+	var req common.ChangeChannel
 	if err := json.Unmarshal(data, &req); err != nil {
-		logger.Error("Malformed change_channel packet from %s", addr)
+		sessionLog(addr).Error("Malformed change_channel packet from %s", addr)
 		return
 	}
 
 	if !channelExists(req.Channel) {
-		logger.Info("Client at %s tried to switch to invalid channel: %s", addr, req.Channel)
+		sessionLog(addr).Info("Client at %s tried to switch to invalid channel: %s", addr, req.Channel)
+		return
+	}
+
+	// Switches inside the cooldown are queued, not dropped: the client ends up
+	// in the last channel it asked for, one cooldown after its previous switch
+	wait, queued := reserveChannelSwitch(addr, req.Channel, time.Now())
+	if wait > 0 {
+		sessionLog(addr).Debug("Channel switch to %s from %s deferred %v", req.Channel, addr, wait)
+		if !queued {
+			time.AfterFunc(wait, func() {
+				if channel, ok := takePendingChannelSwitch(addr, time.Now()); ok {
+					switchChannel(conn, addr, channel)
+				}
+			})
+		}
 		return
 	}
+	switchChannel(conn, addr, req.Channel)
+}
+
+// switchChannel moves a client to a channel, announces the move and sends the
+// channel's recent history
+func switchChannel(conn *net.UDPConn, addr *net.UDPAddr, channel string) {
+	var nickname, oldChannel string
+	if client := getClientByAddr(addr); client != nil {
+		nickname, oldChannel = client.Nickname, client.Channel
+	}
 
-	if updated := updateClientChannel(addr, req.Channel); updated {
-		logger.Info("Client at %s switched to channel: %s", addr, req.Channel)
-		ack := map[string]string{
-			"type":    "channel_changed",
-			"channel": req.Channel,
+	if updated := updateClientChannel(addr, channel); updated {
+		sessionLog(addr).Info("Client at %s switched to channel: %s", addr, channel)
+		if oldChannel != channel {
+			broadcastSystemEvent(conn, oldChannel, addr, fmt.Sprintf("%s left #%s", nickname, oldChannel), common.SystemEventLeave)
+			broadcastSystemEvent(conn, channel, addr, fmt.Sprintf("%s joined #%s", nickname, channel), common.SystemEventJoin)
+		}
+
+		ack := common.ChannelChanged{
+			Type:    common.MsgChannelChanged,
+			Channel: channel,
+			Topic:   channelTopic(channel),
 		}
 		sendJSON(conn, addr, ack)
 		broadcastChannelUserUpdate(conn)
 
 		// Send recent chat history for the new channel
 		if chatStorage != nil && chatStorage.enabled {
-			channelGUID := GetChannelGUID(req.Channel)
+			channelGUID := GetChannelGUID(channel)
 			if channelGUID != "" {
 				sendRecentChatHistory(conn, addr, channelGUID)
 			}
 		}
 	} else {
-		nack := map[string]string{
-			"type":    "error",
-			"message": "Could not switch channel",
+		nack := common.ErrorMessage{
+			Type:    common.MsgError,
+			Code:    common.CodeNotConnected,
+			Message: "Could not switch channel",
 		}
 		sendJSON(conn, addr, nack)
 	}
 }
 
-func handleChatMessage(conn *net.UDPConn, data []byte, addr *net.UDPAddr) {
-	var chatMsg struct {
-		Type     string `json:"type"`
-		Channel  string `json:"channel"`  // Channel name for routing
-		Message  string `json:"message"`  // The actual message
-		Username string `json:"username"` // Who sent it
+// handleMonitorChannel starts or stops relaying another channel's audio to a
+// client. Monitoring is receive-only: the client still talks in, and chats in,
+// its own channel, and doesn't show up in the monitored channel's user list.
+func handleMonitorChannel(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
+	var req common.MonitorChannel
+	if err := json.Unmarshal(data, &req); err != nil {
+		sessionLog(addr).Error("Malformed monitor_channel packet from %s", addr)
+		return
+	}
+
+	refuse := func(code, message string) {
+		sendJSON(conn, addr, common.ErrorMessage{Type: common.MsgError, Code: code, Message: message})
+	}
+	if config.MaxMonitorChannels <= 0 {
+		refuse(common.CodeDisabled, "Monitoring other channels is disabled on this server")
+		return
+	}
+	if !channelExists(req.Channel) {
+		sessionLog(addr).Info("Client at %s tried to monitor invalid channel: %s", addr, req.Channel)
+		refuse(common.CodeNotFound, fmt.Sprintf("No such channel: %s", req.Channel))
+		return
 	}
 
+	channels, err := setClientMonitor(addr, req.Channel, req.Monitor, config.MaxMonitorChannels)
+	if err != nil {
+		sessionLog(addr).Debug("Refused to change monitoring of %s for %s: %v", req.Channel, addr, err)
+		code := common.CodeInvalidRequest
+		switch {
+		case errors.Is(err, errMonitorLimit):
+			code = common.CodeLimitReached
+		case errors.Is(err, errNotConnected):
+			code = common.CodeNotConnected
+		}
+		refuse(code, fmt.Sprintf("Cannot monitor #%s: %v", req.Channel, err))
+		return
+	}
+
+	sessionLog(addr).Info("Client at %s now monitors %v", addr, channels)
+	sendJSON(conn, addr, common.Monitoring{
+		Type:     common.MsgMonitoring,
+		Channels: channels,
+		Max:      config.MaxMonitorChannels,
+	})
+}
+
+func handleChatMessage(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
+	var chatMsg common.Chat
 	if err := json.Unmarshal(data, &chatMsg); err != nil {
-		logger.Error("Malformed chat message from %s: %v", addr, err)
+		sessionLog(addr).Error("Malformed chat message from %s: %v", addr, err)
 		return
 	}
 
@@ -232,16 +451,49 @@ func handleChatMessage(conn *net.UDPConn, data []byte, addr *net.UDPAddr) {
 		return
 	}
 
+	// Plaintext is refused outright, not even acked, so nothing leaks into the log or history
+	if config.RequireEncryption {
+		sendChatRefused(conn, addr, client.Nickname, common.CodeEncryptionRequired,
+			"This server requires encrypted chat - reconnect to retry encryption")
+		return
+	}
+
 	// Validate message content
 	if chatMsg.Message == "" {
-		logger.Debug("Empty chat message from %s, ignoring", client.Nickname)
+		client.log().Debug("Empty chat message from %s, ignoring", client.Nickname)
 		return
 	}
 
+	// Retransmit of a message we already delivered (or are delivering) - just ack again
+	if !claimChatMsgID(addr, chatMsg.MsgID) {
+		client.log().Debug("Duplicate chat msg_id %s from %s, re-acking", chatMsg.MsgID, client.Nickname)
+		sendChatAck(conn, addr, chatMsg.MsgID)
+		return
+	}
+	// Anything short of delivery frees the msg_id, so the retransmit isn't acked unseen
+	delivered := false
+	defer func() {
+		if !delivered {
+			releaseChatMsgID(addr, chatMsg.MsgID)
+		}
+	}()
+
+	if clientMuted(addr, time.Now()) {
+		sendChatRefused(conn, addr, client.Nickname, common.CodeMuted, "You are muted by a moderator")
+		return
+	}
+
+	if !allowChatMessage(addr, time.Now()) {
+		sendChatRefused(conn, addr, client.Nickname, common.CodeRateLimited, "You're sending messages too quickly")
+		return
+	}
+
+	chatMsg.Message = applyChatFilters(client.Nickname, chatMsg.Message)
+
 	// Get channel GUID for routing
 	channelGUID := GetChannelGUID(client.Channel)
 	if channelGUID == "" {
-		logger.Error("No GUID found for channel %s", client.Channel)
+		client.log().Error("No GUID found for channel %s", client.Channel)
 		return
 	}
 
@@ -249,27 +501,24 @@ func handleChatMessage(conn *net.UDPConn, data []byte, addr *net.UDPAddr) {
 	if chatStorage != nil && chatStorage.enabled {
 		err := chatStorage.StoreMessage(channelGUID, client.Channel, client.Nickname, chatMsg.Message)
 		if err != nil {
-			logger.Error("Failed to store chat message: %v", err)
+			client.log().Error("Failed to store chat message: %v", err)
 			// Continue anyway - still broadcast the message
 		}
 	}
 
-	logger.Info("Chat in %s (%s): <%s> %s", client.Channel, channelGUID, client.Nickname, chatMsg.Message)
+	client.log().Info("Chat in %s (%s): <%s> %s", client.Channel, channelGUID, client.Nickname, chatMsg.Message)
 
 	// Broadcast to all users in the same channel
 	broadcastChatMessage(conn, channelGUID, client.Channel, client.Nickname, chatMsg.Message)
-}
 
-func handleEncryptedChatMessage(conn *net.UDPConn, data []byte, addr *net.UDPAddr) {
-	var encryptedMsg struct {
-		Type      string `json:"type"`
-		Channel   string `json:"channel"`
-		Encrypted bool   `json:"encrypted"`
-		Payload   string `json:"payload"` // base64 encoded encrypted data
-	}
+	delivered = true
+	sendChatAck(conn, addr, chatMsg.MsgID)
+}
 
+func handleEncryptedChatMessage(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
+	var encryptedMsg common.EncryptedChat
 	if err := json.Unmarshal(data, &encryptedMsg); err != nil {
-		logger.Error("Malformed encrypted chat message from %s: %v", addr, err)
+		sessionLog(addr).Error("Malformed encrypted chat message from %s: %v", addr, err)
 		return
 	}
 
@@ -282,30 +531,56 @@ func handleEncryptedChatMessage(conn *net.UDPConn, data []byte, addr *net.UDPAdd
 
 	// Check if client has crypto established
 	if !serverCrypto.HasClientCrypto(addr) {
-		logger.Error("Encrypted chat from %s but no crypto context", addr)
+		client.log().Error("Encrypted chat from %s but no crypto context", addr)
+		return
+	}
+
+	// Retransmit of a message we already delivered (or are delivering) - just ack again
+	if !claimChatMsgID(addr, encryptedMsg.MsgID) {
+		client.log().Debug("Duplicate encrypted chat msg_id %s from %s, re-acking", encryptedMsg.MsgID, client.Nickname)
+		sendChatAck(conn, addr, encryptedMsg.MsgID)
+		return
+	}
+	// Anything short of delivery frees the msg_id, so the retransmit isn't acked unseen
+	delivered := false
+	defer func() {
+		if !delivered {
+			releaseChatMsgID(addr, encryptedMsg.MsgID)
+		}
+	}()
+
+	if clientMuted(addr, time.Now()) {
+		sendChatRefused(conn, addr, client.Nickname, common.CodeMuted, "You are muted by a moderator")
+		return
+	}
+
+	if !allowChatMessage(addr, time.Now()) {
+		sendChatRefused(conn, addr, client.Nickname, common.CodeRateLimited, "You're sending messages too quickly")
 		return
 	}
 
 	// Decode and decrypt the payload
 	encryptedData, err := base64.StdEncoding.DecodeString(encryptedMsg.Payload)
 	if err != nil {
-		logger.Error("Invalid base64 payload from %s: %v", addr, err)
+		client.log().Error("Invalid base64 payload from %s: %v", addr, err)
 		return
 	}
 
 	// Decrypt the message
 	decryptedMessage, err := serverCrypto.DecryptFromClient(addr, encryptedData)
 	if err != nil {
-		logger.Error("Failed to decrypt message from %s: %v", addr, err)
+		client.log().Error("Failed to decrypt message from %s: %v", addr, err)
 		return
 	}
 
-	logger.Info("Encrypted chat in %s: <%s> %s", client.Channel, client.Nickname, decryptedMessage)
+	decryptedMessage = applyChatFilters(client.Nickname, decryptedMessage)
+
+	client.log().Info("Encrypted chat in %s: <%s> %s", client.Channel, client.Nickname, decryptedMessage)
 
 	// Get channel GUID for routing
 	channelGUID := GetChannelGUID(client.Channel)
 	if channelGUID == "" {
-		logger.Error("No GUID found for channel %s", client.Channel)
+		client.log().Error("No GUID found for channel %s", client.Channel)
 		return
 	}
 
@@ -313,106 +588,402 @@ func handleEncryptedChatMessage(conn *net.UDPConn, data []byte, addr *net.UDPAdd
 	if chatStorage != nil && chatStorage.enabled {
 		err := chatStorage.StoreMessage(channelGUID, client.Channel, client.Nickname, decryptedMessage)
 		if err != nil {
-			logger.Error("Failed to store encrypted chat message: %v", err)
+			client.log().Error("Failed to store encrypted chat message: %v", err)
 		}
 	}
 
 	// Broadcast the message encrypted to all users in the same channel
-	broadcastEncryptedChatMessage(conn, channelGUID, client.Channel, client.Nickname, decryptedMessage)
+	broadcastEncryptedChatMessage(conn, channelGUID, client.Channel, client.Nickname, decryptedMessage, config)
+
+	delivered = true
+	sendChatAck(conn, addr, encryptedMsg.MsgID)
 }
 
-func handlePing(conn *net.UDPConn, addr *net.UDPAddr) {
-	pong := map[string]string{"type": "pong"}
-	sendJSON(conn, addr, pong)
+// sendChatRefused tells a client its chat message was not delivered, and why
+func sendChatRefused(conn *net.UDPConn, addr *net.UDPAddr, nickname, code, message string) {
+	sessionLog(addr).Debug("Chat from %s refused (%s): %s", nickname, code, message)
+
+	errMsg := common.ErrorMessage{
+		Type:    common.MsgError,
+		Code:    code,
+		Message: message,
+	}
+	if err := sendJSON(conn, addr, errMsg); err != nil {
+		sessionLog(addr).Error("Failed to send chat refusal to %s: %v", addr, err)
+	}
+}
+
+// sendChatAck confirms to the sender that a chat message was stored and broadcast
+func sendChatAck(conn *net.UDPConn, addr *net.UDPAddr, msgID string) {
+	if msgID == "" {
+		return // Older client without delivery tracking
+	}
+
+	ack := common.ChatAck{
+		Type:  common.MsgChatAck,
+		MsgID: msgID,
+	}
+	if err := sendJSON(conn, addr, ack); err != nil {
+		sessionLog(addr).Error("Failed to send chat ack to %s: %v", addr, err)
+	}
 }
 
-func handleAudioData(conn *net.UDPConn, data []byte, addr *net.UDPAddr) {
+// handleTyping relays a "user is composing" hint to the rest of the channel
+func handleTyping(conn *net.UDPConn, data []byte, addr *net.UDPAddr) {
+	var typingMsg struct {
+		Channel string `json:"channel"`
+	}
+	if err := json.Unmarshal(data, &typingMsg); err != nil {
+		return
+	}
+
 	client := getClientByAddr(addr)
 	if client == nil {
-		logger.Debug("Received audio from unknown client: %s", addr)
 		return
 	}
 
-	// Log and forward raw audio
-	logger.Debug("%s (%s) sent %d bytes to channel %s", client.Nickname, addr, len(data), client.Channel)
-	relayCount := 0
+	// Stale hint from before a channel switch - drop it
+	if typingMsg.Channel != client.Channel {
+		return
+	}
+
+	update := map[string]interface{}{
+		"type":     common.MsgTypingUpdate,
+		"channel":  client.Channel,
+		"username": client.Nickname,
+	}
+
+	// Only clients that understand typing_update get it
+	for _, clientAddr := range channelClientAddrs(client.Channel, common.CapabilityTyping) {
+		if clientAddr.String() == addr.String() {
+			continue
+		}
+		if err := sendJSON(conn, clientAddr, update); err != nil {
+			logger.Debug("Failed to send typing update to %s: %v", clientAddr, err)
+		}
+	}
+}
+
+// handleTransmitEnd tells everyone who hears a talker that they released
+// push-to-talk, so pauses stop being filled with comfort noise
+func handleTransmitEnd(conn *net.UDPConn, addr *net.UDPAddr) {
+	var listeners []*net.UDPAddr
+	var source uint16
 	state.Lock()
-	for _, other := range state.Clients {
-		if other.Channel == client.Channel && other.Addr.String() != addr.String() {
-			_, err := conn.WriteToUDP(data, other.Addr)
-			if err != nil {
-				logger.Error("Relay to %s failed: %v", other.Addr, err)
-			} else {
-				relayCount++
+	for _, client := range state.Clients {
+		if client.Addr.String() == addr.String() {
+			source = client.SourceID
+			for _, other := range state.Clients {
+				if other.hears(client.Channel) && other.Addr.String() != addr.String() &&
+					common.HasCapability(other.Capabilities, common.CapabilityTransmitEnd) {
+					listeners = append(listeners, other.Addr)
+				}
 			}
+			break
 		}
 	}
 	state.Unlock()
 
-	logger.Debug("Relayed to %d peer(s)", relayCount)
+	ended := map[string]interface{}{
+		"type":   common.MsgTransmitEnded,
+		"source": source,
+	}
+	for _, listener := range listeners {
+		if err := sendJSON(conn, listener, ended); err != nil {
+			logger.Debug("Failed to send transmit end to %s: %v", listener, err)
+		}
+	}
 }
 
-func broadcastChatMessage(conn *net.UDPConn, channelGUID, channelName, username, message string) {
-	// Create chat message for broadcast
-	chatBroadcast := map[string]interface{}{
-		"type":      "chat_message",
-		"guid":      channelGUID,
+func handleDisconnect(conn *net.UDPConn, addr *net.UDPAddr) {
+	client := removeClientByAddr(addr)
+	if client == nil {
+		logger.Debug("Disconnect from unknown client: %s", addr)
+		return
+	}
+
+	client.log().Info("Client %s disconnected from %s", client.Nickname, addr)
+
+	broadcastChannelUserUpdate(conn)
+	announceDeparture(conn, client, fmt.Sprintf("%s left", client.Nickname))
+}
+
+// broadcastSystemMessage sends a server notice (joins, leaves) to a channel.
+// These use their own "system_message" type so clients never mistake them for user chat.
+func broadcastSystemMessage(conn *net.UDPConn, channelName string, exclude *net.UDPAddr, message string) {
+	broadcastSystemEvent(conn, channelName, exclude, message, "")
+}
+
+// broadcastSystemEvent is broadcastSystemMessage tagged with a common.SystemEvent*
+func broadcastSystemEvent(conn *net.UDPConn, channelName string, exclude *net.UDPAddr, message, event string) {
+	systemMsg := map[string]interface{}{
+		"type":      common.MsgSystemMessage,
 		"channel":   channelName,
-		"username":  username,
 		"message":   message,
-		"timestamp": time.Now().Format("15:04:05"), // HH:MM:SS format
+		"timestamp": chatTimestamp(time.Now()),
+	}
+	if event != "" {
+		systemMsg["event"] = event
 	}
 
-	// Get all clients in the same channel
-	var clientAddrs []*net.UDPAddr
+	for _, clientAddr := range channelClientAddrs(channelName, "") {
+		if exclude != nil && clientAddr.String() == exclude.String() {
+			continue
+		}
+		if err := sendJSON(conn, clientAddr, systemMsg); err != nil {
+			logger.Debug("Failed to send system message to %s: %v", clientAddr, err)
+		}
+	}
+
+	logger.Debug("System message in %s: %s", channelName, message)
+}
+
+// handleAnnounce broadcasts an operator announcement to every connected client.
+// Needs the admin key or a connected admin; key holders don't have to be connected.
+func handleAnnounce(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
+	var req struct {
+		Key     string `json:"key"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return
+	}
+
+	if sender, ok := resolveActor(addr, req.Key, config); !ok || sender.Role != common.RoleAdmin {
+		sessionLog(addr).Warn("Rejected announcement from %s: not an admin", addr)
+		return
+	}
+	if req.Message == "" {
+		sessionLog(addr).Warn("Rejected empty announcement from %s", addr)
+		return
+	}
+
+	announcement := map[string]interface{}{
+		"type":         common.MsgSystemMessage,
+		"announcement": true,
+		"message":      req.Message,
+		"timestamp":    chatTimestamp(time.Now()),
+	}
+
+	recipients := allClientAddrs()
+	for _, clientAddr := range recipients {
+		if err := sendJSON(conn, clientAddr, announcement); err != nil {
+			logger.Debug("Failed to send announcement to %s: %v", clientAddr, err)
+		}
+	}
+
+	sessionLog(addr).Info("Announcement from %s to %d clients: %s", addr, len(recipients), req.Message)
+	sendJSON(conn, addr, map[string]interface{}{
+		"type":       common.MsgAnnounceAck,
+		"recipients": len(recipients),
+	})
+}
+
+// handleSetStatus updates a user's presence and pushes it out with the user lists
+func handleSetStatus(conn *net.UDPConn, data []byte, addr *net.UDPAddr) {
+	var req common.UserStatus
+	if err := json.Unmarshal(data, &req); err != nil {
+		return
+	}
+
+	if !common.ValidStatus(req.Status) {
+		sessionLog(addr).Debug("Invalid status %q from %s", req.Status, addr)
+		sendJSON(conn, addr, common.ErrorMessage{
+			Type:    common.MsgError,
+			Code:    common.CodeInvalidRequest,
+			Message: fmt.Sprintf("Unknown status %q (use online, away or busy)", req.Status),
+		})
+		return
+	}
+	if len(req.Message) > common.MaxStatusMessageLength {
+		req.Message = strings.ToValidUTF8(req.Message[:common.MaxStatusMessageLength], "")
+	}
+	if req.Status == common.StatusOnline {
+		req.Message = ""
+	}
+
+	if !setClientStatus(addr, req) {
+		logger.Debug("Status from unknown client: %s", addr)
+		return
+	}
+
+	sessionLog(addr).Info("Status for %s: %s %s", addr, req.Status, req.Message)
+	broadcastChannelUserUpdate(conn)
+}
+
+func handlePing(conn *net.UDPConn, addr *net.UDPAddr) {
+	pong := map[string]string{"type": common.MsgPong}
+	sendJSON(conn, addr, pong)
+}
+
+// Longest echo ID sent back; keeps replies no bigger than requests
+const maxEchoIDLength = 64
+
+// handleEcho answers a reachability check immediately with the caller's ID
+func handleEcho(conn *net.UDPConn, data []byte, addr *net.UDPAddr) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil || req.ID == "" || len(req.ID) > maxEchoIDLength {
+		return
+	}
+	sendJSON(conn, addr, map[string]string{"type": common.MsgEchoReply, "id": req.ID})
+}
+
+func handleAudioData(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
+	client := getClientByAddr(addr)
+	if client == nil {
+		logger.Debug("Received audio from unknown client: %s", addr)
+		return
+	}
+
+	// Oversized "audio" would be copied to every listener - an amplification vector
+	if len(data) < 6 || len(data) > config.MaxAudioPacketBytes {
+		client.log().Debug("Dropped %d-byte audio packet from %s (allowed 6-%d)", len(data), addr, config.MaxAudioPacketBytes)
+		return
+	}
+	if prefix := binary.LittleEndian.Uint16(data[0:2]); prefix != config.AudioMagic.Audio {
+		client.log().Debug("Dropped packet from %s with unexpected prefix 0x%04X", addr, prefix)
+		return
+	}
+
+	// Everyone uses the negotiated frame size. Audio cut to another size would
+	// be dropped or misplayed by every listener, so it stops here and the
+	// sender is told once.
+	frames := common.AudioFrameCount(len(data)-4, config.FrameSizeMs)
+	if frames == 0 {
+		client.log().Debug("Dropped %d-byte audio packet from %s: not whole %dms frames", len(data), addr, config.FrameSizeMs)
+		state.Lock()
+		warn := !client.frameSizeWarned
+		client.frameSizeWarned = true
+		state.Unlock()
+		if warn {
+			client.log().Warn("%s (%s) sends audio that doesn't match the %dms frame size; dropping it", client.Nickname, addr, config.FrameSizeMs)
+			sendJSON(conn, addr, common.ErrorMessage{
+				Type:    common.MsgError,
+				Code:    common.CodeFrameSizeMismatch,
+				Message: fmt.Sprintf("Audio dropped: this server uses %dms frames - reconnect or update your client", config.FrameSizeMs),
+			})
+		}
+		return
+	}
+
+	// Tagged copy for clients that can tell talkers apart: insert the source ID after seq
+	tagged := make([]byte, len(data)+2)
+	binary.LittleEndian.PutUint16(tagged[0:2], config.AudioMagic.Source)
+	copy(tagged[2:4], data[2:4])
+	binary.LittleEndian.PutUint16(tagged[4:6], client.SourceID)
+	copy(tagged[6:], data[4:])
+
+	// Coalesced frames go out as they came to clients that understand them,
+	// and one frame per packet to the rest
+	var split, splitTagged [][]byte
+	if frames > 1 {
+		split = common.SplitAudioPacket(data, 4, frames)
+		splitTagged = common.SplitAudioPacket(tagged, 6, frames)
+	}
+
+	// Log and forward audio
+	client.log().Debug("%s (%s) sent %d bytes to channel %s", client.Nickname, addr, len(data), client.Channel)
+	relayCount, relayBytes := 0, 0
 	state.Lock()
-	for _, client := range state.Clients {
-		if client.Channel == channelName {
-			clientAddrs = append(clientAddrs, client.Addr)
+	if client.mutedAt(time.Now()) {
+		state.Unlock()
+		client.log().Debug("Dropped audio from muted client %s", client.Nickname)
+		return
+	}
+	for _, other := range state.Clients {
+		if other.hears(client.Channel) && other.Addr.String() != addr.String() {
+			packets := [][]byte{data}
+			if common.HasCapability(other.Capabilities, common.CapabilityAudioSource) {
+				packets[0] = tagged
+			}
+			if split != nil && !common.HasCapability(other.Capabilities, common.CapabilityCoalesce) {
+				packets = split
+				if common.HasCapability(other.Capabilities, common.CapabilityAudioSource) {
+					packets = splitTagged
+				}
+			}
+			for _, packet := range packets {
+				_, err := conn.WriteToUDP(packet, other.Addr)
+				if err != nil {
+					other.log().Error("Relay to %s failed: %v", other.Addr, err)
+					break
+				}
+				relayCount++
+				relayBytes += len(packet)
+			}
 		}
 	}
 	state.Unlock()
 
+	if relayCount > 0 {
+		stats.recordAudio(relayBytes)
+	}
+
+	client.log().Debug("Relayed to %d peer(s)", relayCount)
+}
+
+func broadcastChatMessage(conn *net.UDPConn, channelGUID, channelName, username, message string) {
+	// Create chat message for broadcast
+	chatBroadcast := common.ChatMessage{
+		Type:      common.MsgChatMessage,
+		GUID:      channelGUID,
+		Channel:   channelName,
+		Username:  username,
+		Message:   message,
+		Timestamp: chatTimestamp(time.Now()),
+	}
+
 	// Broadcast to all clients in the channel
-	broadcastCount := 0
+	clientAddrs := channelClientAddrs(channelName, "")
+	broadcastCount, broadcastBytes := 0, 0
 	for _, clientAddr := range clientAddrs {
-		err := sendJSON(conn, clientAddr, chatBroadcast)
+		n, err := writeJSON(conn, clientAddr, chatBroadcast)
 		if err != nil {
 			logger.Error("Failed to broadcast chat to %s: %v", clientAddr, err)
 		} else {
 			broadcastCount++
+			broadcastBytes += n
 		}
 	}
+	stats.recordChat(broadcastBytes)
 
 	logger.Debug("Broadcasted chat message to %d clients in %s", broadcastCount, channelName)
 }
 
-func broadcastEncryptedChatMessage(conn *net.UDPConn, channelGUID, channelName, username, message string) {
+func broadcastEncryptedChatMessage(conn *net.UDPConn, channelGUID, channelName, username, message string, config *ServerConfig) {
 	// Get all clients in the same channel
-	var clientAddrs []*net.UDPAddr
-	state.Lock()
-	for _, client := range state.Clients {
-		if client.Channel == channelName {
-			clientAddrs = append(clientAddrs, client.Addr)
-		}
-	}
-	state.Unlock()
+	clientAddrs := channelClientAddrs(channelName, "")
 
 	// Encrypt and send to each client individually
-	broadcastCount := 0
+	broadcastCount, broadcastBytes := 0, 0
 	for _, clientAddr := range clientAddrs {
 		// Check if client has crypto established
 		if !serverCrypto.HasClientCrypto(clientAddr) {
+			// With encryption required, chat never goes out in plaintext:
+			// the recipient only learns that it missed something
+			if config.RequireEncryption {
+				sessionLog(clientAddr).Info("Withheld chat from %s to %s: no crypto context", username, clientAddr)
+				sendJSON(conn, clientAddr, common.ErrorMessage{
+					Type:    common.MsgError,
+					Code:    common.CodeEncryptionRequired,
+					Message: fmt.Sprintf("Chat from %s withheld: this server requires encryption - reconnect to retry encryption", username),
+				})
+				continue
+			}
+
 			// Fall back to unencrypted for clients without crypto
-			chatBroadcast := map[string]interface{}{
-				"type":      "chat_message",
-				"guid":      channelGUID,
-				"channel":   channelName,
-				"username":  username,
-				"message":   message,
-				"timestamp": time.Now().Format("15:04:05"),
+			chatBroadcast := common.ChatMessage{
+				Type:      common.MsgChatMessage,
+				GUID:      channelGUID,
+				Channel:   channelName,
+				Username:  username,
+				Message:   message,
+				Timestamp: chatTimestamp(time.Now()),
 			}
-			sendJSON(conn, clientAddr, chatBroadcast)
+			n, _ := writeJSON(conn, clientAddr, chatBroadcast)
+			broadcastBytes += n
 			continue
 		}
 
@@ -424,23 +995,25 @@ func broadcastEncryptedChatMessage(conn *net.UDPConn, channelGUID, channelName,
 		}
 
 		// Create encrypted broadcast message
-		encryptedBroadcast := map[string]interface{}{
-			"type":      "encrypted_chat",
-			"guid":      channelGUID,
-			"channel":   channelName,
-			"username":  username,
-			"encrypted": true,
-			"payload":   base64.StdEncoding.EncodeToString(encryptedData),
-			"timestamp": time.Now().Format("15:04:05"),
+		encryptedBroadcast := common.EncryptedChat{
+			Type:      common.MsgEncryptedChat,
+			GUID:      channelGUID,
+			Channel:   channelName,
+			Username:  username,
+			Encrypted: true,
+			Payload:   base64.StdEncoding.EncodeToString(encryptedData),
+			Timestamp: chatTimestamp(time.Now()),
 		}
 
-		err = sendJSON(conn, clientAddr, encryptedBroadcast)
+		n, err := writeJSON(conn, clientAddr, encryptedBroadcast)
 		if err != nil {
 			logger.Error("Failed to broadcast encrypted chat to %s: %v", clientAddr, err)
 		} else {
 			broadcastCount++
+			broadcastBytes += n
 		}
 	}
+	stats.recordChat(broadcastBytes)
 
 	logger.Debug("Broadcasted encrypted chat message to %d clients in %s", broadcastCount, channelName)
 }
@@ -451,68 +1024,105 @@ func sendRecentChatHistory(conn *net.UDPConn, addr *net.UDPAddr, channelGUID str
 	}
 
 	// Get recent messages for this channel
-	recentMessages := chatStorage.GetRecentMessages(channelGUID, chatStorage.recentOnJoin)
+	count := chatStorage.recentOnJoin
+	if count > maxRecentOnJoin {
+		count = maxRecentOnJoin
+	}
+	recentMessages := chatStorage.GetRecentMessages(channelGUID, count)
 	if len(recentMessages) == 0 {
 		logger.Debug("No recent chat history for channel GUID %s", channelGUID)
 		return
 	}
 
 	// Send chat history as a batch
-	historyMsg := map[string]interface{}{
-		"type":     "chat_history",
-		"guid":     channelGUID,
-		"channel":  GetChannelName(channelGUID),
-		"messages": recentMessages,
+	historyMsg := common.ChatHistory{
+		Type:     common.MsgChatHistory,
+		GUID:     channelGUID,
+		Channel:  GetChannelName(channelGUID),
+		Messages: recentMessages,
 	}
 
 	err := sendJSON(conn, addr, historyMsg)
 	if err != nil {
-		logger.Error("Failed to send chat history to %s: %v", addr, err)
+		sessionLog(addr).Error("Failed to send chat history to %s: %v", addr, err)
 	} else {
-		logger.Debug("Sent %d recent chat messages to %s", len(recentMessages), addr)
+		sessionLog(addr).Debug("Sent %d recent chat messages to %s", len(recentMessages), addr)
 	}
 }
 
 func sendJSON(conn *net.UDPConn, addr *net.UDPAddr, v any) error {
+	_, err := writeJSON(conn, addr, v)
+	return err
+}
+
+// writeJSON is sendJSON that also reports the bytes written
+func writeJSON(conn *net.UDPConn, addr *net.UDPAddr, v any) (int, error) {
 	payload, err := json.Marshal(v)
 	if err != nil {
 		logger.Error("Marshal error: %v", err)
-		return err
+		return 0, err
 	}
-	_, err = conn.WriteToUDP(payload, addr)
-	return err
+	return conn.WriteToUDP(payload, addr)
+}
+
+// legacyAcceptMessage is an accept message with Users as bare nicknames, for clients
+// without CapabilityUserInfo. The outer Users field shadows the embedded one.
+type legacyAcceptMessage struct {
+	common.ConnectAccepted
+	Users []string `json:"users"`
+}
+
+func legacyAccept(resp common.ConnectAccepted) legacyAcceptMessage {
+	return legacyAcceptMessage{ConnectAccepted: resp, Users: common.UserNicknames(resp.Users)}
 }
 
 func broadcastChannelUserUpdate(conn *net.UDPConn) {
-	// Build current channel user mapping
-	channelUsers := make(map[string][]string)
+	// Build current channel user mapping, in both the UserInfo and bare nickname forms
+	channelUsers := make(map[string][]common.UserInfo)
+	channelNicks := make(map[string][]string)
 
 	state.Lock()
 	// Initialize all channels with empty arrays
 	for _, client := range state.Clients {
 		if _, exists := channelUsers[client.Channel]; !exists {
-			channelUsers[client.Channel] = make([]string, 0)
+			channelUsers[client.Channel] = make([]common.UserInfo, 0)
+			channelNicks[client.Channel] = make([]string, 0)
 		}
 	}
 	// Populate with actual users
 	for _, client := range state.Clients {
-		channelUsers[client.Channel] = append(channelUsers[client.Channel], client.Nickname)
+		channelUsers[client.Channel] = append(channelUsers[client.Channel], client.info())
+		channelNicks[client.Channel] = append(channelNicks[client.Channel], client.Nickname)
 	}
 
-	// Get all client addresses
-	clientAddrs := make([]*net.UDPAddr, 0, len(state.Clients))
+	// Get all client addresses, split by which form they understand
+	var infoAddrs, legacyAddrs []*net.UDPAddr
 	for _, client := range state.Clients {
-		clientAddrs = append(clientAddrs, client.Addr)
+		if common.HasCapability(client.Capabilities, common.CapabilityUserInfo) {
+			infoAddrs = append(infoAddrs, client.Addr)
+		} else {
+			legacyAddrs = append(legacyAddrs, client.Addr)
+		}
 	}
 	state.Unlock()
 
 	// Broadcast to all clients
+	ids := sourceIDs()
 	update := map[string]interface{}{
-		"type":         "channel_users_update",
+		"type":         common.MsgChannelUsersUpdate,
 		"channelUsers": channelUsers,
+		"sourceIds":    ids,
+	}
+	legacyUpdate := map[string]interface{}{
+		"type":         common.MsgChannelUsersUpdate,
+		"channelUsers": channelNicks,
+		"sourceIds":    ids,
 	}
 
-	for _, addr := range clientAddrs {
+	for _, addr := range infoAddrs {
 		sendJSON(conn, addr, update)
 	}
+	for _, addr := range legacyAddrs {
+		sendJSON(conn, addr, legacyUpdate)
+	}
 }
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"ahcli/common"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAudioRelayReachesMonitors(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	monitor, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer monitor.Close()
+	monitorAddr := monitor.LocalAddr().(*net.UDPAddr)
+
+	talker := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40021}
+	reserveNickname("ops-talker", talker, nil)
+	defer removeClientByAddr(talker)
+	updateClientChannel(talker, "Ops")
+	reserveNickname("dispatcher", monitorAddr, []string{common.CapabilityAudioSource})
+	defer removeClientByAddr(monitorAddr)
+
+	config := &ServerConfig{
+		AudioMagic:          common.DefaultAudioMagic,
+		FrameSizeMs:         common.DefaultFrameSizeMs,
+		MaxAudioPacketBytes: common.AudioPacketSize(common.DefaultFrameSizeMs),
+	}
+	data := make([]byte, config.MaxAudioPacketBytes)
+	binary.LittleEndian.PutUint16(data, common.AudioPrefix)
+	buffer := make([]byte, common.MaxPacketSize)
+	heard := func() bool {
+		handleAudioData(conn, data, talker, config)
+		monitor.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _, err := monitor.ReadFromUDP(buffer)
+		return err == nil
+	}
+
+	if heard() {
+		t.Error("audio from Ops reached a client in General")
+	}
+	if _, err := setClientMonitor(monitorAddr, "Ops", true, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !heard() {
+		t.Fatal("audio from Ops didn't reach a client monitoring it")
+	}
+	if binary.LittleEndian.Uint16(buffer) != common.AudioSourcePrefix {
+		t.Error("monitored audio should carry the talker's source ID")
+	}
+}
+
+func TestAudioRelaySplitsCoalescedFramesForOlderClients(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	listen := func(nick string, capabilities ...string) *net.UDPConn {
+		l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reserveNickname(nick, l.LocalAddr().(*net.UDPAddr), capabilities)
+		t.Cleanup(func() {
+			removeClientByAddr(l.LocalAddr().(*net.UDPAddr))
+			l.Close()
+		})
+		return l
+	}
+	coalescing := listen("coalescing", common.CapabilityAudioSource, common.CapabilityCoalesce)
+	older := listen("older", common.CapabilityAudioSource)
+
+	talker := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40022}
+	reserveNickname("batcher", talker, []string{common.CapabilityCoalesce})
+	defer removeClientByAddr(talker)
+
+	config := &ServerConfig{
+		AudioMagic:          common.DefaultAudioMagic,
+		FrameSizeMs:         common.DefaultFrameSizeMs,
+		MaxAudioPacketBytes: common.MaxPacketSize,
+	}
+	frameBytes := common.AudioPacketSize(config.FrameSizeMs) - 4
+	buffer := make([]byte, common.MaxPacketSize)
+	receive := func(l *net.UDPConn) (seqs []uint16, sizes []int) {
+		for {
+			l.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, _, err := l.ReadFromUDP(buffer)
+			if err != nil {
+				return seqs, sizes
+			}
+			seqs = append(seqs, binary.LittleEndian.Uint16(buffer[2:4]))
+			sizes = append(sizes, n)
+		}
+	}
+
+	for frames := 1; frames <= 3; frames++ {
+		data := make([]byte, 4+frames*frameBytes)
+		binary.LittleEndian.PutUint16(data, common.AudioPrefix)
+		binary.LittleEndian.PutUint16(data[2:], 100)
+		handleAudioData(conn, data, talker, config)
+
+		if seqs, sizes := receive(coalescing); len(seqs) != 1 || seqs[0] != 100 || sizes[0] != len(data)+2 {
+			t.Errorf("%d frames to a coalescing client: seqs %v sizes %v", frames, seqs, sizes)
+		}
+		seqs, sizes := receive(older)
+		if len(seqs) != frames {
+			t.Fatalf("%d frames reached an older client as %d packets", frames, len(seqs))
+		}
+		for i := range seqs {
+			if seqs[i] != 100+uint16(i) || sizes[i] != 6+frameBytes {
+				t.Errorf("%d frames, packet %d to an older client: seq %d, %d bytes", frames, i, seqs[i], sizes[i])
+			}
+		}
+	}
+}
+
+func TestShutdownNoticeReachesClients(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	reserveNickname("leaving", client.LocalAddr().(*net.UDPAddr), nil)
+	defer removeClientByAddr(client.LocalAddr().(*net.UDPAddr))
+
+	if told := broadcastShutdown(conn); told != 1 {
+		t.Errorf("told %d clients, want 1", told)
+	}
+
+	buffer := make([]byte, common.MaxPacketSize)
+	client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	n, _, err := client.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatalf("no shutdown notice: %v", err)
+	}
+	var notice common.ServerShutdown
+	if json.Unmarshal(buffer[:n], &notice); notice.Type != common.MsgServerShutdown || notice.RetryAfterSec <= 0 {
+		t.Errorf("got %s", buffer[:n])
+	}
+}
+
+func TestAudioRelayDropsOversizedPackets(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	talker := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40020}
+	reserveNickname("talker", talker, nil)
+	defer removeClientByAddr(talker)
+	reserveNickname("listener", listener.LocalAddr().(*net.UDPAddr), nil)
+	defer removeClientByAddr(listener.LocalAddr().(*net.UDPAddr))
+
+	config := &ServerConfig{
+		AudioMagic:          common.DefaultAudioMagic,
+		FrameSizeMs:         common.DefaultFrameSizeMs,
+		MaxAudioPacketBytes: common.AudioPacketSize(common.DefaultFrameSizeMs),
+	}
+	packet := func(size int) []byte {
+		data := make([]byte, size)
+		binary.LittleEndian.PutUint16(data, common.AudioPrefix)
+		return data
+	}
+
+	buffer := make([]byte, common.MaxPacketSize)
+	for _, tc := range []struct {
+		size    int
+		relayed bool
+	}{
+		{config.MaxAudioPacketBytes, true},
+		{config.MaxAudioPacketBytes + 2, false},
+		{common.MaxPacketSize, false},
+	} {
+		handleAudioData(conn, packet(tc.size), talker, config)
+
+		listener.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := listener.ReadFromUDP(buffer)
+		if got := err == nil; got != tc.relayed {
+			t.Errorf("%d-byte packet: relayed=%t, want %t", tc.size, got, tc.relayed)
+		}
+		if err == nil && n != tc.size {
+			t.Errorf("%d-byte packet relayed as %d bytes", tc.size, n)
+		}
+	}
+}
+
+func TestAudioRelayDropsMismatchedFrameSizes(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	talker, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer talker.Close()
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	talkerAddr := talker.LocalAddr().(*net.UDPAddr)
+	reserveNickname("10ms-talker", talkerAddr, nil)
+	defer removeClientByAddr(talkerAddr)
+	reserveNickname("listener", listener.LocalAddr().(*net.UDPAddr), nil)
+	defer removeClientByAddr(listener.LocalAddr().(*net.UDPAddr))
+
+	config := &ServerConfig{
+		AudioMagic:          common.DefaultAudioMagic,
+		FrameSizeMs:         common.DefaultFrameSizeMs,
+		MaxAudioPacketBytes: common.AudioPacketSize(common.DefaultFrameSizeMs),
+	}
+	// A 10ms frame on a 20ms server
+	data := make([]byte, common.AudioPacketSize(10))
+	binary.LittleEndian.PutUint16(data, common.AudioPrefix)
+
+	buffer := make([]byte, common.MaxPacketSize)
+	for i := 0; i < 2; i++ {
+		handleAudioData(conn, data, talkerAddr, config)
+	}
+
+	listener.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := listener.ReadFromUDP(buffer); err == nil {
+		t.Error("audio at the wrong frame size was relayed")
+	}
+
+	talker.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := talker.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatalf("sender wasn't told: %v", err)
+	}
+	var notice common.ErrorMessage
+	if json.Unmarshal(buffer[:n], &notice); notice.Code != common.CodeFrameSizeMismatch {
+		t.Errorf("got %s", buffer[:n])
+	}
+	talker.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := talker.ReadFromUDP(buffer); err == nil {
+		t.Error("sender was told more than once")
+	}
+}
+
+func TestTransmitEndReachesListeners(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	listen := func(nick string, capabilities ...string) *net.UDPConn {
+		l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reserveNickname(nick, l.LocalAddr().(*net.UDPAddr), capabilities)
+		t.Cleanup(func() {
+			removeClientByAddr(l.LocalAddr().(*net.UDPAddr))
+			l.Close()
+		})
+		return l
+	}
+	listener := listen("listener", common.CapabilityAudioSource, common.CapabilityTransmitEnd)
+	older := listen("older-listener", common.CapabilityAudioSource)
+
+	talker := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40024}
+	reserveNickname("releaser", talker, nil)
+	defer removeClientByAddr(talker)
+
+	handleTransmitEnd(conn, talker)
+
+	buffer := make([]byte, common.MaxPacketSize)
+	listener.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	n, _, err := listener.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatalf("listener got no transmit_ended: %v", err)
+	}
+	var ended struct {
+		Type   string `json:"type"`
+		Source uint16 `json:"source"`
+	}
+	json.Unmarshal(buffer[:n], &ended)
+	if ended.Type != common.MsgTransmitEnded || ended.Source != getClientByAddr(talker).SourceID {
+		t.Errorf("got %+v, want transmit_ended from the talker's source", ended)
+	}
+
+	older.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, _, err := older.ReadFromUDP(buffer); err == nil {
+		t.Error("a client without the capability shouldn't get transmit_ended")
+	}
+}
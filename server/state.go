@@ -1,19 +1,83 @@
 package main
 
 import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 )
 
 type Client struct {
 	Addr     *net.UDPAddr
 	Nickname string
 	Channel  string
+
+	// Other channels whose audio is relayed to this client, receive-only
+	Monitoring []string
+
+	// Optional protocol features this client advertised on connect
+	Capabilities []string
+
+	// Per-connection handle stamped on relayed audio (never 0)
+	SourceID uint16
+
+	// Short random ID tagging this connection's log lines
+	Session string
+
+	// Presence set by the user (zero value = online)
+	Status common.UserStatus
+
+	// Moderation role assigned by an admin (empty = plain user)
+	Role string
+
+	// Server mute set by a moderator: audio isn't relayed and chat is refused.
+	// A zero MutedUntil means muted until unmuted.
+	Muted      bool
+	MutedUntil time.Time
+
+	// Recently delivered chat msg_ids, used to drop client retransmits
+	recentChatIDs map[string]time.Time
+
+	// Send times of recent chat messages, for flood protection
+	chatTimes []time.Time
+
+	// When the last packet arrived, for the idle timeout
+	lastSeen time.Time
+
+	// Told its audio doesn't match the server's frame size (once per connection)
+	frameSizeWarned bool
+
+	// Channel switch cooldown: when the last switch happened, and the channel
+	// a switch requested during the cooldown will move to once it ends
+	lastSwitch    time.Time
+	pendingSwitch string
 }
 
+// How long a chat msg_id is remembered for retransmit dedup
+const chatIDRetention = time.Minute
+
+// Chat flood protection: at most chatRateLimit messages per chatRateWindow
+const (
+	chatRateLimit  = 5
+	chatRateWindow = 5 * time.Second
+)
+
+// Minimum time between channel switches. Each switch sends chat history and
+// broadcasts the user lists, so rapid switching would flood every client.
+const channelSwitchCooldown = time.Second
+
 type ServerState struct {
 	sync.Mutex
 	Clients map[string]*Client // nickname -> Client
+
+	lastSourceID uint16
 }
 
 var state = &ServerState{
@@ -31,8 +95,28 @@ func getClientByAddr(addr *net.UDPAddr) *Client {
 	return nil
 }
 
+// validateNickname checks length and character set of a requested nickname.
+// Allowed: ASCII letters, digits, '_', '-' and '.'.
+func validateNickname(nick string) error {
+	if nick == "" {
+		return fmt.Errorf("nickname is empty")
+	}
+	if len(nick) > common.MaxNicknameLength {
+		return fmt.Errorf("nickname longer than %d characters", common.MaxNicknameLength)
+	}
+	for _, r := range nick {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_' || r == '-' || r == '.':
+		default:
+			return fmt.Errorf("nickname contains invalid character %q", r)
+		}
+	}
+	return nil
+}
+
 // Attempts to reserve a nickname. Returns true if successful.
-func reserveNickname(nick string, addr *net.UDPAddr) bool {
+func reserveNickname(nick string, addr *net.UDPAddr, capabilities []string) bool {
 	state.Lock()
 	defer state.Unlock()
 
@@ -40,14 +124,93 @@ func reserveNickname(nick string, addr *net.UDPAddr) bool {
 		return false
 	}
 
+	state.lastSourceID++
+	if state.lastSourceID == 0 {
+		state.lastSourceID = 1 // 0 means "untagged"
+	}
+
 	state.Clients[nick] = &Client{
 		Addr:     addr,
 		Nickname: nick,
 		Channel:  "General", // default channel
+
+		Capabilities: capabilities,
+		SourceID:     state.lastSourceID,
+		Session:      newSessionID(),
+
+		lastSeen: time.Now(),
 	}
 	return true
 }
 
+// newSessionID returns a short random ID; unique enough to follow one
+// connection through the log, not an identifier to trust
+func newSessionID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// log returns a logger that tags lines with the client's session ID
+func (c *Client) log() logger.Context {
+	return logger.With("sess=" + c.Session)
+}
+
+// sessionLog returns a logger tagged with the session of the client at addr,
+// or an untagged one if nobody is connected from there
+func sessionLog(addr *net.UDPAddr) logger.Context {
+	if client, ok := findClientByAddr(addr); ok {
+		return client.log()
+	}
+	return logger.Context{}
+}
+
+// Highest suffix tried when every requested nickname is taken
+const maxNicknameSuffix = 99
+
+// reserveSuffixedNickname reserves base with the lowest free numeric suffix
+// ("alice" -> "alice2"), shortening base so the result stays a valid nickname.
+// Returns "" if alice2 through alice99 are all taken.
+func reserveSuffixedNickname(base string, addr *net.UDPAddr, capabilities []string) string {
+	for n := 2; n <= maxNicknameSuffix; n++ {
+		suffix := strconv.Itoa(n)
+		nick := base
+		if len(nick)+len(suffix) > common.MaxNicknameLength {
+			nick = nick[:common.MaxNicknameLength-len(suffix)]
+		}
+		nick += suffix
+		if reserveNickname(nick, addr, capabilities) {
+			return nick
+		}
+	}
+	return ""
+}
+
+// sourceIDs returns the nickname -> audio source ID mapping for all clients
+func sourceIDs() map[string]uint16 {
+	state.Lock()
+	defer state.Unlock()
+
+	ids := make(map[string]uint16, len(state.Clients))
+	for nick, client := range state.Clients {
+		ids[nick] = client.SourceID
+	}
+	return ids
+}
+
+// removeClientByAddr drops a client from the server state. Returns the removed client or nil.
+func removeClientByAddr(addr *net.UDPAddr) *Client {
+	state.Lock()
+	defer state.Unlock()
+	for nick, client := range state.Clients {
+		if client.Addr.String() == addr.String() {
+			delete(state.Clients, nick)
+			return client
+		}
+	}
+	return nil
+}
+
 func channelExists(name string) bool {
 	for _, ch := range serverConfig.Channels {
 		if ch.Name == name {
@@ -57,26 +220,357 @@ func channelExists(name string) bool {
 	return false
 }
 
+// updateClientChannel moves a client to a channel. A monitored channel the
+// client moves into stops being monitored, as its audio now arrives anyway.
 func updateClientChannel(addr *net.UDPAddr, channel string) bool {
 	state.Lock()
 	defer state.Unlock()
 	for _, client := range state.Clients {
 		if client.Addr.String() == addr.String() {
 			client.Channel = channel
+			client.Monitoring = slices.DeleteFunc(client.Monitoring, func(c string) bool { return c == channel })
 			return true
 		}
 	}
 	return false
 }
 
-// Returns a list of all current nicknames
-func listNicknames() []string {
+// hears reports whether audio spoken in channel is relayed to the client.
+// Caller holds the state lock.
+func (c *Client) hears(channel string) bool {
+	return c.Channel == channel || slices.Contains(c.Monitoring, channel)
+}
+
+// Reasons setClientMonitor refuses a channel
+var (
+	errMonitorOwnChannel = errors.New("already in that channel")
+	errMonitorLimit      = errors.New("monitoring limit reached")
+	errNotConnected      = errors.New("not connected")
+)
+
+// setClientMonitor adds or removes a monitored channel for the client at addr,
+// allowing at most max at once. Returns a copy of the updated list.
+func setClientMonitor(addr *net.UDPAddr, channel string, monitor bool, max int) ([]string, error) {
+	state.Lock()
+	defer state.Unlock()
+
+	for _, client := range state.Clients {
+		if client.Addr.String() != addr.String() {
+			continue
+		}
+		switch {
+		case !monitor:
+			client.Monitoring = slices.DeleteFunc(client.Monitoring, func(c string) bool { return c == channel })
+		case channel == client.Channel:
+			return nil, errMonitorOwnChannel
+		case slices.Contains(client.Monitoring, channel):
+		case len(client.Monitoring) >= max:
+			return nil, fmt.Errorf("%w (%d at once)", errMonitorLimit, max)
+		default:
+			client.Monitoring = append(client.Monitoring, channel)
+		}
+		return slices.Clone(client.Monitoring), nil
+	}
+	return nil, errNotConnected
+}
+
+// channelClientAddrs returns addresses of clients in a channel. If capability is
+// non-empty, only clients that advertised it are included.
+func channelClientAddrs(channel, capability string) []*net.UDPAddr {
+	state.Lock()
+	defer state.Unlock()
+
+	var addrs []*net.UDPAddr
+	for _, client := range state.Clients {
+		if client.Channel != channel {
+			continue
+		}
+		if capability != "" && !common.HasCapability(client.Capabilities, capability) {
+			continue
+		}
+		addrs = append(addrs, client.Addr)
+	}
+	return addrs
+}
+
+// findClientByNickname returns a copy of a connected client, or false if nobody uses the nickname
+func findClientByNickname(nick string) (Client, bool) {
+	state.Lock()
+	defer state.Unlock()
+
+	client, ok := state.Clients[nick]
+	if !ok {
+		return Client{}, false
+	}
+	return *client, true
+}
+
+// findClientByAddr returns a copy of the client at addr, or false if not connected
+func findClientByAddr(addr *net.UDPAddr) (Client, bool) {
+	state.Lock()
+	defer state.Unlock()
+
+	for _, client := range state.Clients {
+		if client.Addr.String() == addr.String() {
+			return *client, true
+		}
+	}
+	return Client{}, false
+}
+
+// clientsAtIP returns copies of every client connected from ip, on any port
+func clientsAtIP(ip string) []Client {
+	state.Lock()
+	defer state.Unlock()
+
+	var clients []Client
+	for _, client := range state.Clients {
+		if client.Addr.IP.String() == ip {
+			clients = append(clients, *client)
+		}
+	}
+	return clients
+}
+
+// setClientRole assigns a role by nickname. Returns false for unknown nicknames.
+func setClientRole(nick, role string) bool {
+	state.Lock()
+	defer state.Unlock()
+
+	client, ok := state.Clients[nick]
+	if !ok {
+		return false
+	}
+	client.Role = role
+	return true
+}
+
+// setClientStatus updates a client's presence. Returns false for unknown clients.
+func setClientStatus(addr *net.UDPAddr, status common.UserStatus) bool {
 	state.Lock()
 	defer state.Unlock()
 
-	nicks := make([]string, 0, len(state.Clients))
-	for nick := range state.Clients {
-		nicks = append(nicks, nick)
+	for _, client := range state.Clients {
+		if client.Addr.String() == addr.String() {
+			client.Status = status
+			return true
+		}
+	}
+	return false
+}
+
+// info builds the user list entry for a client. Caller holds the state lock.
+func (c *Client) info() common.UserInfo {
+	info := common.UserInfo{Nickname: c.Nickname}
+	if c.Status.Status != common.StatusOnline {
+		info.Status = c.Status.Status
+		info.StatusMessage = c.Status.Message
+	}
+	if c.Role != common.RoleUser {
+		info.Role = c.Role
+	}
+	info.Muted = c.mutedAt(time.Now())
+	return info
+}
+
+// mutedAt reports whether a server mute is in effect at now. Caller holds the state lock.
+func (c *Client) mutedAt(now time.Time) bool {
+	return c.Muted && (c.MutedUntil.IsZero() || now.Before(c.MutedUntil))
+}
+
+// setClientMute mutes or unmutes a client by nickname. Returns false for unknown nicknames.
+func setClientMute(nick string, muted bool, until time.Time) bool {
+	state.Lock()
+	defer state.Unlock()
+
+	client, ok := state.Clients[nick]
+	if !ok {
+		return false
+	}
+	client.Muted = muted
+	client.MutedUntil = until
+	if !muted {
+		client.MutedUntil = time.Time{}
+	}
+	return true
+}
+
+// expireMute clears a timed mute if it is still the one that ends at until.
+// Returns false if the client left, was unmuted, or was muted again since.
+func expireMute(nick string, until time.Time) bool {
+	state.Lock()
+	defer state.Unlock()
+
+	client, ok := state.Clients[nick]
+	if !ok || !client.Muted || !client.MutedUntil.Equal(until) {
+		return false
+	}
+	client.Muted = false
+	client.MutedUntil = time.Time{}
+	return true
+}
+
+// clientMuted reports whether the client at addr is server-muted right now
+func clientMuted(addr *net.UDPAddr, now time.Time) bool {
+	state.Lock()
+	defer state.Unlock()
+
+	for _, client := range state.Clients {
+		if client.Addr.String() == addr.String() {
+			return client.mutedAt(now)
+		}
+	}
+	return false
+}
+
+// clientCount returns how many clients are connected
+func clientCount() int {
+	state.Lock()
+	defer state.Unlock()
+	return len(state.Clients)
+}
+
+// allClientAddrs returns the addresses of every connected client, in any channel
+func allClientAddrs() []*net.UDPAddr {
+	state.Lock()
+	defer state.Unlock()
+
+	addrs := make([]*net.UDPAddr, 0, len(state.Clients))
+	for _, client := range state.Clients {
+		addrs = append(addrs, client.Addr)
+	}
+	return addrs
+}
+
+// allowChatMessage applies the per-client chat rate limit. Accepted messages are
+// recorded; throttled ones are not, so a client can retry once the window moves.
+func allowChatMessage(addr *net.UDPAddr, now time.Time) bool {
+	state.Lock()
+	defer state.Unlock()
+
+	for _, client := range state.Clients {
+		if client.Addr.String() != addr.String() {
+			continue
+		}
+
+		// Drop timestamps that fell out of the window
+		recent := client.chatTimes[:0]
+		for _, t := range client.chatTimes {
+			if now.Sub(t) < chatRateWindow {
+				recent = append(recent, t)
+			}
+		}
+		client.chatTimes = recent
+
+		if len(client.chatTimes) >= chatRateLimit {
+			return false
+		}
+		client.chatTimes = append(client.chatTimes, now)
+		return true
+	}
+	return false
+}
+
+// reserveChannelSwitch applies the channel switch cooldown. Outside the
+// cooldown it records the switch and returns 0. Inside it, channel becomes the
+// client's pending switch, replacing any earlier one, and it returns how long
+// until the cooldown ends; queued reports whether a pending switch was already
+// waiting, in which case it is already scheduled.
+func reserveChannelSwitch(addr *net.UDPAddr, channel string, now time.Time) (wait time.Duration, queued bool) {
+	state.Lock()
+	defer state.Unlock()
+
+	for _, client := range state.Clients {
+		if client.Addr.String() != addr.String() {
+			continue
+		}
+		if wait = client.lastSwitch.Add(channelSwitchCooldown).Sub(now); wait > 0 {
+			queued = client.pendingSwitch != ""
+			client.pendingSwitch = channel
+			return wait, queued
+		}
+		client.lastSwitch = now
+		client.pendingSwitch = ""
+		return 0, false
+	}
+	return 0, false
+}
+
+// takePendingChannelSwitch claims the client's pending switch once the cooldown
+// is over, recording it as the latest switch. ok is false if nothing is pending
+// or the client has left.
+func takePendingChannelSwitch(addr *net.UDPAddr, now time.Time) (channel string, ok bool) {
+	state.Lock()
+	defer state.Unlock()
+
+	for _, client := range state.Clients {
+		if client.Addr.String() != addr.String() || client.pendingSwitch == "" {
+			continue
+		}
+		channel = client.pendingSwitch
+		client.pendingSwitch = ""
+		client.lastSwitch = now
+		return channel, true
+	}
+	return "", false
+}
+
+// claimChatMsgID records a chat msg_id for delivery, pruning expired ones. It
+// reports false if the client already sent it: a retransmit, possibly being
+// handled by another worker right now. Messages without an ID always pass.
+func claimChatMsgID(addr *net.UDPAddr, msgID string) bool {
+	if msgID == "" {
+		return true
+	}
+
+	state.Lock()
+	defer state.Unlock()
+	for _, client := range state.Clients {
+		if client.Addr.String() == addr.String() {
+			if _, seen := client.recentChatIDs[msgID]; seen {
+				return false
+			}
+			if client.recentChatIDs == nil {
+				client.recentChatIDs = make(map[string]time.Time)
+			}
+			now := time.Now()
+			for id, seenAt := range client.recentChatIDs {
+				if now.Sub(seenAt) > chatIDRetention {
+					delete(client.recentChatIDs, id)
+				}
+			}
+			client.recentChatIDs[msgID] = now
+			return true
+		}
+	}
+	return true
+}
+
+// releaseChatMsgID forgets a claimed msg_id whose message was refused, so the
+// client's retransmit gets another try rather than a duplicate ack
+func releaseChatMsgID(addr *net.UDPAddr, msgID string) {
+	if msgID == "" {
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+	for _, client := range state.Clients {
+		if client.Addr.String() == addr.String() {
+			delete(client.recentChatIDs, msgID)
+			return
+		}
+	}
+}
+
+// Returns the user list entries of all current clients
+func listUsers() []common.UserInfo {
+	state.Lock()
+	defer state.Unlock()
+
+	users := make([]common.UserInfo, 0, len(state.Clients))
+	for _, client := range state.Clients {
+		users = append(users, client.info())
 	}
-	return nicks
+	return users
 }
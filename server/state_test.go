@@ -0,0 +1,335 @@
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAllowChatMessageThrottlesBurst(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40001}
+	if !reserveNickname("flooder", addr, nil) {
+		t.Fatal("failed to reserve nickname")
+	}
+	defer removeClientByAddr(addr)
+
+	now := time.Now()
+
+	// A burst within the window: first chatRateLimit pass, the rest are throttled
+	for i := 0; i < chatRateLimit*2; i++ {
+		allowed := allowChatMessage(addr, now.Add(time.Duration(i)*time.Millisecond))
+		if want := i < chatRateLimit; allowed != want {
+			t.Fatalf("message %d: allowed=%t, want %t", i, allowed, want)
+		}
+	}
+
+	// Once the window has passed the client may chat again
+	if !allowChatMessage(addr, now.Add(chatRateWindow+time.Second)) {
+		t.Fatal("message after window should be allowed")
+	}
+}
+
+func TestAllowChatMessageIsPerClient(t *testing.T) {
+	addrA := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40002}
+	addrB := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40003}
+	reserveNickname("alice", addrA, nil)
+	reserveNickname("bob", addrB, nil)
+	defer removeClientByAddr(addrA)
+	defer removeClientByAddr(addrB)
+
+	now := time.Now()
+	for i := 0; i < chatRateLimit; i++ {
+		allowChatMessage(addrA, now)
+	}
+
+	if allowChatMessage(addrA, now) {
+		t.Error("alice should be throttled")
+	}
+	if !allowChatMessage(addrB, now) {
+		t.Error("bob should not be affected by alice's flood")
+	}
+}
+
+func TestAllowChatMessageUnknownClient(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40004}
+	if allowChatMessage(addr, time.Now()) {
+		t.Error("unknown client should not be allowed to chat")
+	}
+}
+
+func TestClaimChatMsgIDOnce(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40005}
+	reserveNickname("retry", addr, nil)
+	defer removeClientByAddr(addr)
+
+	// Two copies of a retransmit handled concurrently: only one may deliver
+	var wg sync.WaitGroup
+	var claimed atomic.Int32
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if claimChatMsgID(addr, "msg-1") {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed.Load() != 1 {
+		t.Fatalf("msg-1 claimed %d times, want 1", claimed.Load())
+	}
+
+	releaseChatMsgID(addr, "msg-1")
+	if !claimChatMsgID(addr, "msg-1") {
+		t.Error("released msg_id should be claimable again")
+	}
+	if !claimChatMsgID(addr, "") {
+		t.Error("empty msg_id should always pass")
+	}
+}
+
+func TestChannelSwitchCooldownQueuesLatest(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40005}
+	if !reserveNickname("hopper", addr, nil) {
+		t.Fatal("failed to reserve nickname")
+	}
+	defer removeClientByAddr(addr)
+
+	now := time.Now()
+	if wait, _ := reserveChannelSwitch(addr, "General", now); wait != 0 {
+		t.Fatalf("first switch should go through, got wait %v", wait)
+	}
+
+	// Quick switches inside the cooldown are queued; the last one wins
+	wait, queued := reserveChannelSwitch(addr, "Gaming", now.Add(200*time.Millisecond))
+	if wait != channelSwitchCooldown-200*time.Millisecond || queued {
+		t.Fatalf("second switch: wait %v queued %t", wait, queued)
+	}
+	if _, queued := reserveChannelSwitch(addr, "AFK", now.Add(400*time.Millisecond)); !queued {
+		t.Error("third switch should find the second already queued")
+	}
+
+	channel, ok := takePendingChannelSwitch(addr, now.Add(channelSwitchCooldown))
+	if !ok || channel != "AFK" {
+		t.Fatalf("pending switch = %q, %t; want AFK", channel, ok)
+	}
+	if _, ok := takePendingChannelSwitch(addr, now.Add(channelSwitchCooldown)); ok {
+		t.Error("pending switch should only be taken once")
+	}
+
+	// The queued switch restarts the cooldown
+	if wait, _ := reserveChannelSwitch(addr, "General", now.Add(channelSwitchCooldown+500*time.Millisecond)); wait <= 0 {
+		t.Error("switch right after the queued one should wait")
+	}
+	if wait, _ := reserveChannelSwitch(addr, "General", now.Add(3*channelSwitchCooldown)); wait != 0 {
+		t.Errorf("switch after the cooldown should go through, got wait %v", wait)
+	}
+}
+
+func TestMonitorChannelsLimitAndJoin(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40006}
+	if !reserveNickname("dispatch", addr, nil) {
+		t.Fatal("failed to reserve nickname")
+	}
+	defer removeClientByAddr(addr)
+
+	if _, err := setClientMonitor(addr, "General", true, 2); err == nil {
+		t.Error("monitoring our own channel should be refused")
+	}
+	setClientMonitor(addr, "Ops", true, 2)
+	setClientMonitor(addr, "Ops", true, 2) // Already monitored, not counted twice
+	if channels, err := setClientMonitor(addr, "Fire", true, 2); err != nil || len(channels) != 2 {
+		t.Fatalf("second channel: %v, %v", channels, err)
+	}
+	if _, err := setClientMonitor(addr, "EMS", true, 2); err == nil {
+		t.Error("third channel should exceed the limit")
+	}
+
+	// Joining a monitored channel makes it the home channel instead
+	updateClientChannel(addr, "Ops")
+	client, _ := findClientByAddr(addr)
+	if !client.hears("Ops") || !client.hears("Fire") || client.hears("General") {
+		t.Errorf("after joining Ops: channel %s, monitoring %v", client.Channel, client.Monitoring)
+	}
+	if channels, _ := setClientMonitor(addr, "Fire", false, 2); len(channels) != 0 {
+		t.Errorf("after stopping: monitoring %v", channels)
+	}
+}
+
+func TestLegacyAcceptSendsNicknames(t *testing.T) {
+	resp := common.ConnectAccepted{
+		Type:     "accept",
+		Nickname: "alice",
+		Users:    []common.UserInfo{{Nickname: "alice"}, {Nickname: "bob", Status: common.StatusBusy}},
+	}
+
+	data, err := json.Marshal(legacyAccept(resp))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var decoded struct {
+		Nickname string   `json:"nickname"`
+		Users    []string `json:"users"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("older clients could not decode accept: %v (%s)", err, data)
+	}
+	if decoded.Nickname != "alice" || len(decoded.Users) != 2 || decoded.Users[1] != "bob" {
+		t.Errorf("unexpected legacy accept %s", data)
+	}
+}
+
+func TestClientInfoCarriesStatus(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40010}
+	reserveNickname("dave", addr, nil)
+	defer removeClientByAddr(addr)
+
+	setClientStatus(addr, common.UserStatus{Status: common.StatusAway, Message: "brb"})
+
+	var info common.UserInfo
+	for _, u := range listUsers() {
+		if u.Nickname == "dave" {
+			info = u
+		}
+	}
+	if info.Status != common.StatusAway || info.StatusMessage != "brb" {
+		t.Errorf("got %+v, want away/brb", info)
+	}
+
+	setClientStatus(addr, common.UserStatus{Status: common.StatusOnline})
+	for _, u := range listUsers() {
+		if u.Nickname == "dave" && u.Status != "" {
+			t.Errorf("online user should have no status, got %q", u.Status)
+		}
+	}
+}
+
+func TestReserveSuffixedNickname(t *testing.T) {
+	taken := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40011}
+	reserveNickname("erin2", taken, nil)
+	defer removeClientByAddr(taken)
+
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40012}
+	if got := reserveSuffixedNickname("erin", addr, nil); got != "erin3" {
+		t.Errorf("got %q, want erin3 (erin2 is taken)", got)
+	}
+	removeClientByAddr(addr)
+
+	// A name at the length limit is shortened to make room for the suffix
+	long := strings.Repeat("x", common.MaxNicknameLength)
+	got := reserveSuffixedNickname(long, addr, nil)
+	defer removeClientByAddr(addr)
+	if validateNickname(got) != nil || !strings.HasSuffix(got, "2") {
+		t.Errorf("got %q, want a valid nickname ending in 2", got)
+	}
+}
+
+func TestConnectRejectCodes(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	holder := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40013}
+	reserveNickname("frank", holder, nil)
+	defer removeClientByAddr(holder)
+
+	buffer := make([]byte, common.MaxPacketSize)
+	for _, tc := range []struct {
+		nicklist []string
+		code     string
+	}{
+		{[]string{"frank"}, common.CodeNicknameTaken},
+		{[]string{"bad nick!"}, common.CodeInvalidNickname},
+	} {
+		data, _ := json.Marshal(common.ConnectRequest{Type: common.MsgConnect, Nicklist: tc.nicklist})
+		handleConnect(conn, data, client.LocalAddr().(*net.UDPAddr), &ServerConfig{})
+
+		client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := client.ReadFromUDP(buffer)
+		if err != nil {
+			t.Fatalf("%v: no reply: %v", tc.nicklist, err)
+		}
+		var reject common.Reject
+		if err := json.Unmarshal(buffer[:n], &reject); err != nil || reject.Type != common.MsgReject || reject.Code != tc.code {
+			t.Errorf("%v: got %s, want a reject with code %s", tc.nicklist, buffer[:n], tc.code)
+		}
+	}
+}
+
+func TestAcceptCarriesTheme(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	addr := client.LocalAddr().(*net.UDPAddr)
+	defer removeClientByAddr(addr)
+
+	config := &ServerConfig{
+		Channels: []Channel{{Name: "General", AllowSpeak: true}},
+		Theme:    common.Theme{Name: "Bunker", Colors: map[string]string{"accent": "#ff8800"}},
+	}
+	data, _ := json.Marshal(common.ConnectRequest{
+		Type:         common.MsgConnect,
+		Nicklist:     []string{"themed"},
+		Capabilities: []string{common.CapabilityUserInfo},
+	})
+	handleConnect(conn, data, addr, config)
+
+	buffer := make([]byte, common.MaxPacketSize)
+	for {
+		client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := client.ReadFromUDP(buffer)
+		if err != nil {
+			t.Fatalf("no accept: %v", err)
+		}
+		var accepted common.ConnectAccepted
+		if json.Unmarshal(buffer[:n], &accepted) != nil || accepted.Type != common.MsgAccept {
+			continue
+		}
+		if accepted.Theme == nil || accepted.Theme.Name != "Bunker" || accepted.Theme.Colors["accent"] != "#ff8800" {
+			t.Errorf("accept should carry the theme, got %s", buffer[:n])
+		}
+		return
+	}
+}
+
+func TestClientsGetDistinctSessions(t *testing.T) {
+	a := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40013}
+	b := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40014}
+	reserveNickname("frank", a, nil)
+	reserveNickname("grace", b, nil)
+	defer removeClientByAddr(a)
+	defer removeClientByAddr(b)
+
+	ca, _ := findClientByAddr(a)
+	cb, _ := findClientByAddr(b)
+	if len(ca.Session) != 6 || ca.Session == cb.Session {
+		t.Errorf("sessions %q and %q, want two distinct 6-character IDs", ca.Session, cb.Session)
+	}
+	if sessionLog(a) != ca.log() {
+		t.Error("sessionLog should tag lines with the client's session")
+	}
+	if unknown := (&net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40015}); sessionLog(unknown) != (logger.Context{}) {
+		t.Error("unknown address should log untagged")
+	}
+}
@@ -0,0 +1,97 @@
+// FILE: server/stats.go
+
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"encoding/json"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// How often the stats summary is logged
+const statsLogInterval = 10 * time.Minute
+
+// serverStats counts what the server has done since it started. Updated from
+// every packet worker, so all counters are atomic.
+type serverStats struct {
+	start time.Time
+
+	connections  atomic.Uint64 // Connects accepted
+	audioRelayed atomic.Uint64 // Audio packets forwarded (once per packet, however many listeners)
+	chatRelayed  atomic.Uint64 // Chat messages broadcast to a channel
+	bytesRelayed atomic.Uint64 // Audio and chat bytes written to recipients
+	peakUsers    atomic.Int64  // Most clients connected at once
+}
+
+var stats = &serverStats{start: time.Now()}
+
+// recordConnect counts an accepted connect; users is the count including it
+func (s *serverStats) recordConnect(users int) {
+	s.connections.Add(1)
+	for {
+		peak := s.peakUsers.Load()
+		if int64(users) <= peak || s.peakUsers.CompareAndSwap(peak, int64(users)) {
+			return
+		}
+	}
+}
+
+// recordAudio counts one relayed audio packet and the bytes sent for it
+func (s *serverStats) recordAudio(bytes int) {
+	s.audioRelayed.Add(1)
+	s.bytesRelayed.Add(uint64(bytes))
+}
+
+// recordChat counts one broadcast chat message and the bytes sent for it
+func (s *serverStats) recordChat(bytes int) {
+	s.chatRelayed.Add(1)
+	s.bytesRelayed.Add(uint64(bytes))
+}
+
+// snapshot reports the counters, with users connected right now
+func (s *serverStats) snapshot(now time.Time, users int) common.ServerStats {
+	return common.ServerStats{
+		Type:         common.MsgStatsReply,
+		StartedAt:    s.start.UTC().Format(time.RFC3339),
+		UptimeSec:    int64(now.Sub(s.start) / time.Second),
+		Connections:  s.connections.Load(),
+		Users:        users,
+		PeakUsers:    int(s.peakUsers.Load()),
+		AudioRelayed: s.audioRelayed.Load(),
+		ChatRelayed:  s.chatRelayed.Load(),
+		BytesRelayed: s.bytesRelayed.Load(),
+	}
+}
+
+// logStatsPeriodically writes a one-line summary every statsLogInterval
+func logStatsPeriodically() {
+	ticker := time.NewTicker(statsLogInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s := stats.snapshot(time.Now(), clientCount())
+		logger.Info("Stats: up %v, %d users (peak %d), %d connections, %d audio packets, %d chat messages, %.1f MB relayed",
+			time.Duration(s.UptimeSec)*time.Second, s.Users, s.PeakUsers, s.Connections,
+			s.AudioRelayed, s.ChatRelayed, float64(s.BytesRelayed)/(1024*1024))
+	}
+}
+
+// handleStats answers an admin's stats query. Needs the admin key or a connected admin.
+func handleStats(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return
+	}
+
+	if sender, ok := resolveActor(addr, req.Key, config); !ok || sender.Role != common.RoleAdmin {
+		sendModerationError(conn, addr, common.CodeNotAllowed, "Server stats are for admins only")
+		return
+	}
+
+	logger.Debug("Stats requested by %s", addr)
+	sendJSON(conn, addr, stats.snapshot(time.Now(), clientCount()))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"ahcli/common"
+	"testing"
+	"time"
+)
+
+func TestServerStats(t *testing.T) {
+	s := &serverStats{start: time.Now().Add(-90 * time.Second)}
+
+	s.recordConnect(1)
+	s.recordConnect(3)
+	s.recordConnect(2) // Someone left in between; the peak stays
+	s.recordAudio(100)
+	s.recordAudio(100)
+	s.recordChat(50)
+
+	got := s.snapshot(time.Now(), 2)
+	want := common.ServerStats{
+		Type:         common.MsgStatsReply,
+		StartedAt:    got.StartedAt,
+		UptimeSec:    90,
+		Connections:  3,
+		Users:        2,
+		PeakUsers:    3,
+		AudioRelayed: 2,
+		ChatRelayed:  1,
+		BytesRelayed: 250,
+	}
+	if got != want {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+// FILE: server/timeout.go
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Clients that vanish without a disconnect (crash, lost network, sleep) are
+// reaped once nothing has arrived from them for the client timeout. Clients
+// ping every few seconds even when silent, so only a gone client goes quiet.
+const (
+	defaultClientTimeout = 45 * time.Second
+	minClientTimeout     = 15 * time.Second // Three of the client's pings, at its longest 5s interval
+)
+
+// A client that was timed out (or outlived a server restart) keeps sending
+// into a session that no longer exists. It's told so, but the source of a UDP
+// packet can be forged: at most once per IP per interval, and no more than
+// notConnectedGlobalLimit notices per interval overall.
+const (
+	notConnectedInterval    = 5 * time.Second
+	notConnectedGlobalLimit = 50
+)
+
+// notConnectedLimiter tracks the not_connected notices sent this interval
+type notConnectedLimiter struct {
+	sync.Mutex
+	sent      map[string]time.Time // By source IP
+	recent    []time.Time          // All notices, for the global limit
+	lastSweep time.Time
+}
+
+var notConnectedNotices = &notConnectedLimiter{sent: make(map[string]time.Time)}
+
+// allow reports whether ip may be sent a notice now, and records it if so
+func (l *notConnectedLimiter) allow(ip string, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	// Once per interval, forget sources that were told long enough ago
+	if now.Sub(l.lastSweep) >= notConnectedInterval {
+		for source, last := range l.sent {
+			if now.Sub(last) >= notConnectedInterval {
+				delete(l.sent, source)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	recent := l.recent[:0]
+	for _, t := range l.recent {
+		if now.Sub(t) < notConnectedInterval {
+			recent = append(recent, t)
+		}
+	}
+	l.recent = recent
+
+	if last, ok := l.sent[ip]; ok && now.Sub(last) < notConnectedInterval {
+		return false
+	}
+	if len(l.recent) >= notConnectedGlobalLimit {
+		return false
+	}
+	l.sent[ip] = now
+	l.recent = append(l.recent, now)
+	return true
+}
+
+// touchClient records that a packet arrived from addr and reports whether
+// addr belongs to a connected client
+func touchClient(addr *net.UDPAddr, now time.Time) bool {
+	state.Lock()
+	defer state.Unlock()
+	for _, client := range state.Clients {
+		if client.Addr.String() == addr.String() {
+			client.lastSeen = now
+			return true
+		}
+	}
+	return false
+}
+
+// needsSession reports whether a control packet only makes sense from a connected
+// client. Connecting, reachability checks, leaving and admin-key commands
+// work without one.
+func needsSession(msg map[string]interface{}) bool {
+	switch msg["type"] {
+	case common.MsgConnect, common.MsgCryptoHandshake, common.MsgPing, common.MsgEcho, common.MsgDisconnect:
+		return false
+	}
+	_, keyed := msg["key"]
+	return !keyed
+}
+
+// notifyNotConnected tells an unknown address its session is gone, so the
+// client can reconnect instead of talking to nobody
+func notifyNotConnected(conn *net.UDPConn, addr *net.UDPAddr, now time.Time) {
+	if !notConnectedNotices.allow(addr.IP.String(), now) {
+		return
+	}
+
+	logger.Debug("Packet from unknown address %s, telling it to reconnect", addr)
+	sendJSON(conn, addr, common.ErrorMessage{
+		Type:    common.MsgError,
+		Code:    common.CodeNotConnected,
+		Message: "Not connected to this server",
+	})
+}
+
+// reapIdleClients removes and returns the clients not heard from within timeout
+func reapIdleClients(now time.Time, timeout time.Duration) []*Client {
+	state.Lock()
+	defer state.Unlock()
+
+	var reaped []*Client
+	for nick, client := range state.Clients {
+		if now.Sub(client.lastSeen) > timeout {
+			delete(state.Clients, nick)
+			reaped = append(reaped, client)
+		}
+	}
+	return reaped
+}
+
+// runClientReaper drops timed-out clients and tells the others they left
+func runClientReaper(conn *net.UDPConn, timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 3)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		reaped := reapIdleClients(now, timeout)
+		for _, client := range reaped {
+			client.log().Info("Client %s at %s timed out after %v without packets",
+				client.Nickname, client.Addr, now.Sub(client.lastSeen).Round(time.Second))
+			announceDeparture(conn, client, fmt.Sprintf("%s left (connection lost)", client.Nickname))
+		}
+		if len(reaped) > 0 {
+			broadcastChannelUserUpdate(conn)
+		}
+	}
+}
+
+// announceDeparture forgets a removed client's crypto state and tells its
+// channel it's gone, so nobody waits on someone who isn't there
+func announceDeparture(conn *net.UDPConn, client *Client, message string) {
+	serverCrypto.RemoveClient(client.Addr)
+	broadcastSystemEvent(conn, client.Channel, nil, message, common.SystemEventLeave)
+}
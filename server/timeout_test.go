@@ -0,0 +1,109 @@
+package main
+
+import (
+	"ahcli/common"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReapIdleClientsDropsOnlySilentOnes(t *testing.T) {
+	quiet := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40101}
+	chatty := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40102}
+	reserveNickname("quiet", quiet, nil)
+	reserveNickname("chatty", chatty, nil)
+	defer removeClientByAddr(quiet)
+	defer removeClientByAddr(chatty)
+
+	now := time.Now()
+	touchClient(chatty, now.Add(40*time.Second))
+
+	if reaped := reapIdleClients(now.Add(30*time.Second), defaultClientTimeout); len(reaped) != 0 {
+		t.Fatalf("nobody is past the timeout yet, reaped %d", len(reaped))
+	}
+
+	reaped := reapIdleClients(now.Add(60*time.Second), defaultClientTimeout)
+	if len(reaped) != 1 || reaped[0].Nickname != "quiet" {
+		t.Fatalf("expected only quiet to be reaped, got %v", reaped)
+	}
+	if getClientByAddr(quiet) != nil {
+		t.Error("reaped client should be removed from the state")
+	}
+	if getClientByAddr(chatty) == nil {
+		t.Error("client with recent packets should stay")
+	}
+}
+
+func TestUnknownSenderIsToldToReconnect(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stale, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stale.Close()
+	staleAddr := stale.LocalAddr().(*net.UDPAddr)
+
+	notConnectedNotices = &notConnectedLimiter{sent: make(map[string]time.Time)}
+	config := &ServerConfig{AudioMagic: common.DefaultAudioMagic}
+	buffer := make([]byte, common.MaxPacketSize)
+	reply := func(packet string) (common.ErrorMessage, bool) {
+		handlePacket(conn, []byte(packet), staleAddr, config)
+		stale.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := stale.ReadFromUDP(buffer)
+		if err != nil {
+			return common.ErrorMessage{}, false
+		}
+		var msg common.ErrorMessage
+		json.Unmarshal(buffer[:n], &msg)
+		return msg, true
+	}
+
+	if _, ok := reply("AU"); ok {
+		t.Error("audio from an unknown address should be dropped silently")
+	}
+	msg, ok := reply(`{"type":"chat","message":"anyone?"}`)
+	if !ok || msg.Type != common.MsgError || msg.Code != common.CodeNotConnected {
+		t.Fatalf("chat from an unknown address got %+v, want a not_connected error", msg)
+	}
+	if _, ok := reply(`{"type":"typing"}`); ok {
+		t.Error("a second notice within the interval should be suppressed")
+	}
+	if msg, ok := reply(`{"type":"ping"}`); !ok || msg.Type != common.MsgPong {
+		t.Errorf("ping from an unknown address got %+v, want a pong", msg)
+	}
+}
+
+func TestNotConnectedLimiter(t *testing.T) {
+	l := &notConnectedLimiter{sent: make(map[string]time.Time)}
+	now := time.Now()
+
+	if !l.allow("10.0.0.1", now) {
+		t.Fatal("first notice to an IP should be allowed")
+	}
+	if l.allow("10.0.0.1", now.Add(time.Second)) {
+		t.Error("a second notice to the same IP, from any port, should wait out the interval")
+	}
+	if !l.allow("10.0.0.1", now.Add(notConnectedInterval)) {
+		t.Error("the IP should be told again after the interval")
+	}
+
+	// Spoofing many sources still hits the global cap
+	later := now.Add(3 * notConnectedInterval)
+	allowed := 0
+	for i := 0; i < 2*notConnectedGlobalLimit; i++ {
+		if l.allow(net.IPv4(10, 1, byte(i>>8), byte(i)).String(), later) {
+			allowed++
+		}
+	}
+	if allowed != notConnectedGlobalLimit {
+		t.Errorf("allowed %d notices across many IPs, want %d", allowed, notConnectedGlobalLimit)
+	}
+	if len(l.sent) > notConnectedGlobalLimit+1 {
+		t.Errorf("limiter holds %d IPs, want old ones swept", len(l.sent))
+	}
+}
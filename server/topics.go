@@ -0,0 +1,132 @@
+// FILE: server/topics.go
+
+package main
+
+import (
+	"ahcli/common"
+	"ahcli/common/logger"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// channelTopics holds each channel's topic. Seeded from config.json; set_topic
+// changes only last until the server restarts.
+var channelTopics = struct {
+	sync.RWMutex
+	topics map[string]string // channel name -> topic
+}{topics: make(map[string]string)}
+
+// loadChannelTopics seeds the topics from the configured channels
+func loadChannelTopics(channels []Channel) {
+	channelTopics.Lock()
+	defer channelTopics.Unlock()
+
+	channelTopics.topics = make(map[string]string)
+	for _, ch := range channels {
+		if ch.Topic != "" {
+			channelTopics.topics[ch.Name] = ch.Topic
+		}
+	}
+}
+
+// channelTopic returns a channel's topic, empty if it has none
+func channelTopic(channel string) string {
+	channelTopics.RLock()
+	defer channelTopics.RUnlock()
+	return channelTopics.topics[channel]
+}
+
+// allChannelTopics returns a copy of every non-empty topic
+func allChannelTopics() map[string]string {
+	channelTopics.RLock()
+	defer channelTopics.RUnlock()
+
+	topics := make(map[string]string, len(channelTopics.topics))
+	for channel, topic := range channelTopics.topics {
+		topics[channel] = topic
+	}
+	return topics
+}
+
+// setChannelTopic replaces a channel's topic; an empty topic clears it
+func setChannelTopic(channel, topic string) {
+	channelTopics.Lock()
+	defer channelTopics.Unlock()
+
+	if topic == "" {
+		delete(channelTopics.topics, channel)
+	} else {
+		channelTopics.topics[channel] = topic
+	}
+}
+
+// canSetTopic reports whether the actor may change a channel's topic: admins
+// anywhere, moderators in their own channel
+func (a actor) canSetTopic(channel string) bool {
+	switch a.Role {
+	case common.RoleAdmin:
+		return true
+	case common.RoleModerator:
+		return channel == a.Channel
+	}
+	return false
+}
+
+// handleSetTopic changes a channel's topic. The channel defaults to the sender's own.
+func handleSetTopic(conn *net.UDPConn, data []byte, addr *net.UDPAddr, config *ServerConfig) {
+	var req struct {
+		Key     string `json:"key"`
+		Channel string `json:"channel"`
+		Topic   string `json:"topic"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return
+	}
+
+	sender, ok := resolveActor(addr, req.Key, config)
+	if !ok {
+		sendModerationError(conn, addr, common.CodeNotAllowed, "Not allowed to set the topic")
+		return
+	}
+	channel := req.Channel
+	if channel == "" {
+		channel = sender.Channel
+	}
+	if !channelExists(channel) {
+		sendModerationError(conn, addr, common.CodeNotFound, "No channel named %s", channel)
+		return
+	}
+	if !sender.canSetTopic(channel) {
+		sendModerationError(conn, addr, common.CodeNotAllowed, "Not allowed to set the topic of #%s", channel)
+		return
+	}
+
+	topic := strings.TrimSpace(req.Topic)
+	if len(topic) > common.MaxTopicLength {
+		topic = strings.ToValidUTF8(topic[:common.MaxTopicLength], "")
+	}
+	setChannelTopic(channel, topic)
+
+	notice := fmt.Sprintf("%s changed the topic to: %s", sender.Name, topic)
+	if topic == "" {
+		notice = fmt.Sprintf("%s cleared the topic", sender.Name)
+	}
+	logger.Info("#%s: %s", channel, notice)
+
+	// Everyone gets the new topic for their channel list; the channel itself also sees who changed it
+	update := map[string]interface{}{
+		"type":    common.MsgChannelTopic,
+		"channel": channel,
+		"topic":   topic,
+		"by":      sender.Name,
+	}
+	for _, clientAddr := range allClientAddrs() {
+		sendJSON(conn, clientAddr, update)
+	}
+	broadcastSystemMessage(conn, channel, nil, notice)
+
+	sendModerationAck(conn, addr, "set_topic", channel)
+}
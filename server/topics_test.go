@@ -0,0 +1,46 @@
+package main
+
+import (
+	"ahcli/common"
+	"testing"
+)
+
+func TestChannelTopics(t *testing.T) {
+	loadChannelTopics([]Channel{{Name: "General"}, {Name: "AFK", Topic: "Away"}})
+	defer loadChannelTopics(nil)
+
+	if got := channelTopic("AFK"); got != "Away" {
+		t.Errorf("configured topic: got %q", got)
+	}
+	if topics := allChannelTopics(); len(topics) != 1 {
+		t.Errorf("only channels with a topic should be listed, got %v", topics)
+	}
+
+	setChannelTopic("General", "Raid night")
+	if got := channelTopic("General"); got != "Raid night" {
+		t.Errorf("set topic: got %q", got)
+	}
+	setChannelTopic("General", "")
+	if _, ok := allChannelTopics()["General"]; ok {
+		t.Error("empty topic should clear it")
+	}
+}
+
+func TestCanSetTopic(t *testing.T) {
+	tests := []struct {
+		name    string
+		actor   actor
+		channel string
+		want    bool
+	}{
+		{"admin elsewhere", actor{Role: common.RoleAdmin, Channel: "AFK"}, "General", true},
+		{"moderator in own channel", actor{Role: common.RoleModerator, Channel: "General"}, "General", true},
+		{"moderator elsewhere", actor{Role: common.RoleModerator, Channel: "AFK"}, "General", false},
+		{"user", actor{Channel: "General"}, "General", false},
+	}
+	for _, tt := range tests {
+		if got := tt.actor.canSetTopic(tt.channel); got != tt.want {
+			t.Errorf("%s: canSetTopic = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// FILE: server/workers.go
+
+package main
+
+import (
+	"ahcli/common/logger"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Packets waiting for a worker. When full, new packets are dropped like the
+// network would - stale audio is worse than lost audio.
+const packetQueueSize = 1024
+
+// How often a summary of dropped packets is logged
+const packetDropLogInterval = 10 * time.Second
+
+// udpPacket is one received datagram waiting to be handled
+type udpPacket struct {
+	data []byte
+	addr *net.UDPAddr
+}
+
+// packetWorkers is a fixed pool of goroutines handling packets from a queue
+type packetWorkers struct {
+	queue   chan udpPacket
+	wg      sync.WaitGroup
+	dropped atomic.Uint64
+
+	lastLogged atomic.Int64 // unix nanos of the last drop summary
+}
+
+// defaultPacketWorkers is used when packet_workers isn't set in config.json
+func defaultPacketWorkers() int {
+	return max(4, runtime.NumCPU())
+}
+
+// startPacketWorkers starts n workers calling handle for each queued packet
+func startPacketWorkers(n, queueSize int, handle func(udpPacket)) *packetWorkers {
+	w := &packetWorkers{queue: make(chan udpPacket, queueSize)}
+	for i := 0; i < n; i++ {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for packet := range w.queue {
+				handle(packet)
+			}
+		}()
+	}
+	return w
+}
+
+// submit queues a packet without blocking the reader. Returns false if it was dropped.
+func (w *packetWorkers) submit(packet udpPacket) bool {
+	select {
+	case w.queue <- packet:
+		return true
+	default:
+	}
+
+	dropped := w.dropped.Add(1)
+	now := time.Now().UnixNano()
+	last := w.lastLogged.Load()
+	if now-last >= int64(packetDropLogInterval) && w.lastLogged.CompareAndSwap(last, now) {
+		logger.Warn("Packet queue full, %d packets dropped so far", dropped)
+	}
+	return false
+}
+
+// stop closes the queue and waits for queued packets to be handled
+func (w *packetWorkers) stop() {
+	close(w.queue)
+	w.wg.Wait()
+}
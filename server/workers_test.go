@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPacketWorkersHandleEverything(t *testing.T) {
+	var handled atomic.Int64
+	w := startPacketWorkers(4, 64, func(udpPacket) { handled.Add(1) })
+
+	// Feed the queue directly (blocking) so nothing is dropped
+	for i := 0; i < 1000; i++ {
+		w.queue <- udpPacket{data: []byte{byte(i)}}
+	}
+	w.stop()
+
+	if got := handled.Load(); got != 1000 {
+		t.Errorf("handled %d packets, want 1000", got)
+	}
+}
+
+func TestPacketWorkersDropWhenFull(t *testing.T) {
+	block := make(chan struct{})
+	w := startPacketWorkers(1, 2, func(udpPacket) { <-block })
+
+	// One packet in the worker, two queued, the rest dropped
+	accepted := 0
+	for i := 0; i < 10; i++ {
+		if w.submit(udpPacket{}) {
+			accepted++
+		}
+	}
+	close(block)
+	w.stop()
+
+	if accepted > 3 || w.dropped.Load() < 7 {
+		t.Errorf("accepted %d, dropped %d; expected the full queue to drop", accepted, w.dropped.Load())
+	}
+}
+
+// relayWork stands in for handlePacket: roughly what relaying an audio frame costs
+func relayWork(p udpPacket) {
+	out := make([]byte, len(p.data)+2)
+	copy(out[2:], p.data)
+}
+
+var benchAddr = &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4422}
+
+// The old model: one goroutine per packet
+func BenchmarkSpawnPerPacket(b *testing.B) {
+	data := make([]byte, 964)
+	var wg sync.WaitGroup
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		wg.Add(1)
+		go func(p udpPacket) {
+			defer wg.Done()
+			relayWork(p)
+		}(udpPacket{data: data, addr: benchAddr})
+	}
+	wg.Wait()
+}
+
+func BenchmarkWorkerPool(b *testing.B) {
+	data := make([]byte, 964)
+	w := startPacketWorkers(defaultPacketWorkers(), packetQueueSize, relayWork)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w.queue <- udpPacket{data: data, addr: benchAddr}
+	}
+	w.stop()
+}